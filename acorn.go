@@ -4,12 +4,20 @@ package acorn
 
 import "encoding/binary"
 
+// maj and ch are written to need as few operations as possible,
+// and in particular no NOT, since not every target has an and-not
+// instruction (RISC-V only does with the Zbb extension).
+// They are equivalent to
+//
+//	maj(x, y, z) = (x & y) ^ (x & z) ^ (y & z)
+//	ch(x, y, z) = (x & y) ^ (^x & z)
+
 func maj(x, y, z uint32) uint32 {
-	return (x & y) ^ (x & z) ^ (y & z)
+	return (x & y) ^ (z & (x ^ y))
 }
 
 func ch(x, y, z uint32) uint32 {
-	return (x & y) ^ (^x & z)
+	return z ^ (x & (y ^ z))
 }
 
 type state struct {
@@ -67,48 +75,6 @@ func (s *state) update8(m, ca, cb uint32) uint32 {
 	return uint32(ks)
 }
 
-func (s *state) update32(m, ca, cb uint32) uint32 {
-	// same as update8, but with 32-bit shifts and masks instead of 8 bits.
-	// this is about as far as you can go before the feedback starts to compound.
-
-	s244 := uint32(s.s230 >> 14)
-	s235 := uint32(s.s230 >> 5)
-	s196 := uint32(s.s193 >> 3)
-	s160 := uint32(s.s154 >> 6)
-	s111 := uint32(s.s107 >> 4)
-	s66 := uint32(s.s61 >> 5)
-	s23 := uint32(s.s0 >> 23)
-	s12 := uint32(s.s0 >> 12)
-	s0 := uint32(s.s0)
-
-	// feedback the 6 LFSRs
-
-	x289 := (s235 ^ uint32(s.s230))
-
-	s230 := (uint32(s.s230) ^ s196 ^ uint32(s.s193))
-	s193 := (uint32(s.s193) ^ s160 ^ uint32(s.s154))
-	s154 := (uint32(s.s154) ^ s111 ^ uint32(s.s107))
-	s107 := (uint32(s.s107) ^ s66 ^ uint32(s.s61))
-	s61 := (uint32(s.s61) ^ s23 ^ s0)
-
-	// calculate keystream and feedback bit
-
-	ks := (s12 ^ s154 ^ maj(s235, s61, s193) ^ ch(s230, s111, s66))
-	f := (s0 ^ ^s107 ^ maj(s244, s23, s160) ^ (ca & s196) ^ (cb & ks))
-
-	s293 := f ^ m
-
-	// update the state
-	s.s230 = s.s230>>32 ^ uint64(x289)<<(289-230-32) ^ uint64(s293)<<(293-230-32)
-	s.s193 = s.s193>>32 ^ uint64(s230)<<(230-193-32)
-	s.s154 = s.s154>>32 ^ uint64(s193)<<(193-154-32)
-	s.s107 = s.s107>>32 ^ uint64(s154)<<(154-107-32)
-	s.s61 = s.s61>>32 ^ uint64(s107)<<(107-61-32)
-	s.s0 = s.s0>>32 ^ uint64(s61)<<(61-32)
-
-	return ks
-}
-
 func (s *state) reset() {
 	*s = state{}
 }
@@ -120,15 +86,22 @@ func (s *state) init(k *[4]uint32, iv []uint8) {
 	if len(iv)*8 != 128 {
 		panic("acorn: invalid iv length")
 	}
-	for i := range k {
-		s.update32(uint32(k[i]), one, one)
+	// All 1792 initialization steps have ca = cb = 1,
+	// so lay out the message words and run them through ones32.
+	var m [1792 / 32]uint32
+	copy(m[:4], k[:])
+	for i := range m[4:8] {
+		m[4+i] = binary.LittleEndian.Uint32(iv[i*4:])
 	}
-	for i := range iv {
-		s.update8(uint32(iv[i]), one, one)
+	for i := 8; i < len(m); i++ {
+		m[i] = k[i%4]
 	}
-	s.update32(uint32(k[0])^0x01, one, one)
-	for i := 32; i < 1536; i += 32 {
-		s.update32(uint32(k[i%128/32]), one, one)
+	m[8] ^= 0x01
+	s.ones32(m[:])
+	// m now holds keystream rather than the key,
+	// but there is no reason to leave that around either
+	for i := range m {
+		m[i] = 0
 	}
 }
 
@@ -143,35 +116,27 @@ func (s *state) pad(cb uint32) {
 }
 
 func (s *state) process(ad []uint8) {
-	for _, x := range ad {
-		s.update8(uint32(x), one, one)
-	}
-	s.pad(one)
-}
-
-func (s *state) crypt(dst, src []uint8, mode uint32) {
 	i := 0
-	for ; i+4 <= len(src); i += 4 {
-		x := binary.LittleEndian.Uint32(src[i:])
-		ks := s.update32(uint32(x), one, mode)
-		x ^= ks
-		binary.LittleEndian.PutUint32(dst[i:], x)
+	for ; i+4 <= len(ad); i += 4 {
+		s.update32(load32(ad[i:]), one, one)
 	}
-	for ; i < len(src); i++ {
-		x := src[i]
-		ks := s.update8(uint32(x), one, mode)
-		dst[i] = x ^ uint8(ks)
+	for ; i < len(ad); i++ {
+		s.update8(uint32(ad[i]), one, one)
 	}
-	s.pad(0)
+	s.pad(one)
 }
 
+// finalize writes the tag and then wipes the state, and the keystream
+// it used on the way, so that none of it outlives the message.
 func (s *state) finalize(tag []uint8) []uint8 {
-	for i := 0; i < 640; i += 32 {
-		s.update32(0, one, one)
+	var m [(640 + 128) / 32]uint32
+	s.ones32(m[:])
+	for i, ks := range m[640/32:] {
+		binary.LittleEndian.PutUint32(tag[i*4:], ks)
 	}
-	for i := range tag[:16] {
-		ks := s.update8(0, one, one)
-		tag[i] = uint8(ks)
+	for i := range m {
+		m[i] = 0
 	}
+	s.reset()
 	return tag
 }
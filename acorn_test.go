@@ -4,8 +4,11 @@ package acorn
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"encoding/binary"
 	"encoding/hex"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -28,7 +31,7 @@ func TestAcorn(t *testing.T) {
 	s.init(k, iv)
 	s.process(nil)
 	ci := make([]byte, len(p))
-	s.crypt(ci, p, 0)
+	s.encrypt(ci, p)
 
 	tag := hex.EncodeToString(s.finalize(make([]byte, TagSize)))
 	expectedTag := "f6881c28983aff930ad198968a401846"
@@ -104,6 +107,44 @@ func BenchmarkOpen(b *testing.B) {
 	b.Run("4096", func(b *testing.B) { bench(b, 4096) })
 }
 
+// BenchmarkCompare measures Seal alongside AES-128-GCM from the
+// standard library, for reference. (ChaCha20-Poly1305 lives in
+// golang.org/x/crypto, which this module doesn't depend on.)
+func BenchmarkCompare(b *testing.B) {
+	newGCM := func(key []byte) cipher.AEAD {
+		c, err := aes.NewCipher(key)
+		if err != nil {
+			b.Fatal(err)
+		}
+		a, err := cipher.NewGCM(c)
+		if err != nil {
+			b.Fatal(err)
+		}
+		return a
+	}
+	ciphers := []struct {
+		name string
+		new  func(key []byte) cipher.AEAD
+	}{
+		{"acorn", NewAEAD},
+		{"aes-gcm", newGCM},
+	}
+	for _, size := range []int{64, 1024, 16384} {
+		for _, c := range ciphers {
+			a := c.new(make([]byte, KeySize))
+			nonce := make([]byte, a.NonceSize())
+			p := make([]byte, size)
+			dst := make([]byte, 0, size+a.Overhead())
+			b.Run(c.name+"/"+strconv.Itoa(size), func(b *testing.B) {
+				b.SetBytes(int64(size))
+				for i := 0; i < b.N; i++ {
+					a.Seal(dst[:0], nonce, p, nil)
+				}
+			})
+		}
+	}
+}
+
 var testVectors = []struct {
 	key        []uint8
 	plaintext  []uint8
@@ -194,6 +235,43 @@ var testVectors = []struct {
 	},
 }
 
+func TestAllocs(t *testing.T) {
+	a := NewAEAD(make([]byte, KeySize))
+	nonce := make([]byte, NonceSize)
+	ad := make([]byte, 13)
+	for _, size := range []int{0, 1, 64, 4096} {
+		p := make([]byte, size)
+		c := a.Seal(nil, nonce, p, ad)
+		dst := make([]byte, 0, len(c))
+		n := testing.AllocsPerRun(10, func() {
+			a.Seal(dst[:0], nonce, p, ad)
+		})
+		if n != 0 {
+			t.Errorf("Seal(%d bytes) allocates %v times, want 0", size, n)
+		}
+		n = testing.AllocsPerRun(10, func() {
+			if _, err := a.Open(dst[:0], nonce, c, ad); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if n != 0 {
+			t.Errorf("Open(%d bytes) allocates %v times, want 0", size, n)
+		}
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	k, err := GenerateKey(nil)
+	if err != nil || len(k) != KeySize {
+		t.Errorf("GenerateKey(nil) = %x, %v", k, err)
+	}
+	// a short read must be reported, not panic or return a short key
+	k, err = GenerateKey(strings.NewReader("short"))
+	if err == nil {
+		t.Errorf("GenerateKey(short reader) = %x, want error", k)
+	}
+}
+
 func TestSeal(t *testing.T) {
 	for i, tt := range testVectors {
 		a := NewAEAD(tt.key)
@@ -223,3 +301,30 @@ func TestOpen(t *testing.T) {
 		}
 	}
 }
+
+// TestFinalizeWipes checks that no state is left behind after a message.
+func TestFinalizeWipes(t *testing.T) {
+	key := []byte(strings.Repeat("password", 2))
+	k := loadKey(key)
+	iv := []byte(strings.Repeat("randomiv", 2))
+	p := []byte("message")
+	tag := make([]byte, TagSize)
+
+	var s state
+	s.init(&k, iv)
+	s.process([]byte("ad"))
+	s.encrypt(make([]byte, len(p)), p)
+	s.finalize(tag)
+	if s != (state{}) {
+		t.Errorf("state not wiped after finalize: %+v", s)
+	}
+
+	e := NewEngine().(*goEngine)
+	e.Init(key, iv)
+	e.Absorb(nil)
+	e.Crypt(make([]byte, len(p)), p, false)
+	e.Finalize(tag)
+	if e.s != (state{}) {
+		t.Errorf("engine state not wiped after Finalize: %+v", e.s)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornaudit records the nonces used under each key and reports
+// probable reuse, for soak tests and canary deployments. It is a debugging
+// aid: it watches for a bug that would be a disaster in production, but
+// it does nothing to prevent it.
+//
+// Each key gets a Bloom filter of a fixed size, so memory stays bounded no
+// matter how many messages are sealed, at the cost of false positives once
+// a filter fills up. With the default 8 Mbit filter, a key can seal about
+// 180,000 messages before the chance that a fresh nonce is reported as a
+// reuse reaches one in a million, and about 500,000 before it reaches one
+// in two thousand. FalsePositiveRate tells how full a filter is.
+package acornaudit
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// A Config configures a Tracker.
+// The zero value is the default.
+type Config struct {
+	// Bits is the size of each key's filter, in bits.
+	// The default is 1<<23, which takes 1 MiB.
+	Bits int
+
+	// Hashes is the number of bits each nonce sets. The default is 7.
+	Hashes int
+
+	// OnReuse, if not nil, is called for each probable reuse.
+	// It is called with the tracker locked, so it must not use it.
+	OnReuse func(Reuse)
+}
+
+// A Reuse is a nonce which was probably used before under the same key.
+type Reuse struct {
+	KeyID [8]byte
+	Nonce []byte
+}
+
+// A Tracker records nonces. It is safe for concurrent use.
+type Tracker struct {
+	config Config
+
+	mu      sync.Mutex
+	filters map[[8]byte]*filter
+	reuses  int
+}
+
+type filter struct {
+	bits []uint64
+	n    int // nonces recorded
+}
+
+// New returns a Tracker with the given configuration,
+// which may be nil for the defaults.
+func New(config *Config) *Tracker {
+	t := &Tracker{filters: make(map[[8]byte]*filter)}
+	if config != nil {
+		t.config = *config
+	}
+	if t.config.Bits <= 0 {
+		t.config.Bits = 1 << 23
+	}
+	if t.config.Hashes <= 0 {
+		t.config.Hashes = 7
+	}
+	return t
+}
+
+// Record records a nonce used under the key identified by keyID,
+// and reports whether it was probably used before.
+func (t *Tracker) Record(keyID [8]byte, nonce []byte) bool {
+	sum := sha256.Sum256(nonce)
+	h1 := binary.LittleEndian.Uint64(sum[0:])
+	h2 := binary.LittleEndian.Uint64(sum[8:]) | 1
+	m := uint64(t.config.Bits)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.filters[keyID]
+	if f == nil {
+		f = &filter{bits: make([]uint64, (m+63)/64)}
+		t.filters[keyID] = f
+	}
+	seen := true
+	for i := 0; i < t.config.Hashes; i++ {
+		b := (h1 + uint64(i)*h2) % m
+		if f.bits[b/64]&(1<<(b%64)) == 0 {
+			seen = false
+			f.bits[b/64] |= 1 << (b % 64)
+		}
+	}
+	f.n++
+	if seen {
+		t.reuses++
+		if t.config.OnReuse != nil {
+			t.config.OnReuse(Reuse{KeyID: keyID, Nonce: append([]byte(nil), nonce...)})
+		}
+	}
+	return seen
+}
+
+// Reuses returns how many probable reuses have been reported.
+func (t *Tracker) Reuses() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.reuses
+}
+
+// FalsePositiveRate returns the estimated chance that a fresh nonce under
+// the key identified by keyID would be reported as a reuse, given the
+// number of nonces recorded for it so far.
+func (t *Tracker) FalsePositiveRate(keyID [8]byte) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.filters[keyID]
+	if f == nil {
+		return 0
+	}
+	k := float64(t.config.Hashes)
+	return math.Pow(1-math.Exp(-k*float64(f.n)/float64(t.config.Bits)), k)
+}
+
+// Forget drops the filter for the key identified by keyID,
+// such as when the key is retired.
+func (t *Tracker) Forget(keyID [8]byte) {
+	t.mu.Lock()
+	delete(t.filters, keyID)
+	t.mu.Unlock()
+}
+
+// Wrap returns an AEAD which records the nonce of every message a seals
+// under the key identified by keyID. Opening is not recorded, since
+// opening a message more than once is harmless.
+func (t *Tracker) Wrap(a cipher.AEAD, keyID [8]byte) cipher.AEAD {
+	return &auditAEAD{AEAD: a, t: t, id: keyID}
+}
+
+type auditAEAD struct {
+	cipher.AEAD
+	t  *Tracker
+	id [8]byte
+}
+
+func (a *auditAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	a.t.Record(a.id, nonce)
+	return a.AEAD.Seal(dst, nonce, plaintext, additionalData)
+}
@@ -0,0 +1,58 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornaudit
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/magical/go-acorn"
+)
+
+func TestTracker(t *testing.T) {
+	var reported []Reuse
+	tr := New(&Config{OnReuse: func(r Reuse) { reported = append(reported, r) }})
+	k1, k2 := [8]byte{1}, [8]byte{2}
+	nonce := make([]byte, acorn.NonceSize)
+	for i := 0; i < 10000; i++ {
+		binary.LittleEndian.PutUint64(nonce, uint64(i))
+		if tr.Record(k1, nonce) {
+			t.Fatalf("nonce %d reported as reused", i)
+		}
+	}
+	// the same nonce under another key is fine
+	if tr.Record(k2, nonce) {
+		t.Errorf("a nonce used under another key was reported")
+	}
+	if !tr.Record(k1, nonce) {
+		t.Errorf("a reused nonce was not reported")
+	}
+	if tr.Reuses() != 1 || len(reported) != 1 || reported[0].KeyID != k1 || string(reported[0].Nonce) != string(nonce) {
+		t.Errorf("reported %d reuses: %v", tr.Reuses(), reported)
+	}
+	if p := tr.FalsePositiveRate(k1); p <= 0 || p > 1e-12 {
+		t.Errorf("false positive rate after 10000 nonces = %g", p)
+	}
+	tr.Forget(k1)
+	if tr.Record(k1, nonce) || tr.FalsePositiveRate([8]byte{3}) != 0 {
+		t.Errorf("Forget did not clear the filter")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tr := New(nil)
+	key := make([]byte, acorn.KeySize)
+	a := tr.Wrap(acorn.NewAEAD(key), [8]byte{1})
+	nonce := make([]byte, acorn.NonceSize)
+	ct := a.Seal(nil, nonce, []byte("one"), nil)
+	if _, err := a.Open(nil, nonce, ct, nil); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Reuses() != 0 {
+		t.Errorf("opening was counted as a reuse")
+	}
+	a.Seal(nil, nonce, []byte("two"), nil)
+	if tr.Reuses() != 1 {
+		t.Errorf("sealing twice under one nonce was not reported")
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornblob implements a content-addressed store of encrypted
+// blobs in a directory.
+//
+// A blob is addressed by its ID, which is an HMAC-SHA256 of its plaintext
+// under a key derived from the store's key, so IDs reveal nothing about
+// the contents to anyone without the key, and storing the same plaintext
+// twice stores it once. Each blob is sealed with ACORN-128 under its own
+// key, derived from the store's key and the ID, with the ID as additional
+// data. Since an object key only ever seals one plaintext, a fixed
+// nonce is safe. A blob is stored in the file
+//
+//	<dir>/<first 2 hex digits of the ID>/<remaining hex digits>
+//
+// as its ciphertext and tag, and written under a temporary name first,
+// so that readers never see a partly written blob.
+//
+// A blob is read into memory whole, so the store is meant for objects
+// that comfortably fit; use acornstream for large files.
+//
+// Garbage collection is the caller's: it lists the store, marks the IDs
+// it still refers to, and then calls Collect. Put refreshes the
+// modification time of a blob that is already stored, so that passing
+// Collect the time the mark phase started keeps blobs which were put
+// while it ran, even if their IDs were not marked.
+package acornblob
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/magical/go-acorn"
+	"github.com/magical/go-acorn/internal/hkdf"
+)
+
+// IDSize is the length of a blob ID.
+const IDSize = sha256.Size
+
+// An ID is the address of a blob.
+type ID [IDSize]byte
+
+// String returns id in hexadecimal.
+func (id ID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// ParseID parses an ID in the form returned by String.
+func ParseID(s string) (ID, error) {
+	var id ID
+	if len(s) != 2*IDSize {
+		return id, ErrInvalidID
+	}
+	if _, err := hex.Decode(id[:], []byte(s)); err != nil {
+		return id, ErrInvalidID
+	}
+	return id, nil
+}
+
+var (
+	ErrNotFound  = errors.New("acornblob: blob not found")
+	ErrCorrupt   = errors.New("acornblob: blob failed authentication")
+	ErrInvalidID = errors.New("acornblob: invalid blob ID")
+)
+
+// tmpPrefix starts the names of blobs which are still being written.
+const tmpPrefix = ".tmp-"
+
+// A Store is a directory of encrypted blobs.
+// It is safe for concurrent use, including by other processes
+// opening the same directory with the same key.
+type Store struct {
+	dir    string
+	macKey []byte
+	prk    []byte // for object keys
+}
+
+// Open returns the store in directory dir, which it creates if it
+// doesn't exist. The key must be 16 bytes; Open panics otherwise.
+// A store's blobs can only be found and read with the key it was
+// written with.
+func Open(dir string, key []byte) (*Store, error) {
+	if len(key) != acorn.KeySize {
+		panic("acornblob: invalid key length")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{
+		dir:    dir,
+		macKey: hkdf.Key(key, nil, []byte("acorn blob id"), 32),
+		prk:    hkdf.Extract(key, []byte("acorn blob object")),
+	}, nil
+}
+
+// ID returns the ID that the plaintext p would be stored under.
+func (s *Store) ID(p []byte) ID {
+	m := hmac.New(sha256.New, s.macKey)
+	m.Write(p)
+	var id ID
+	m.Sum(id[:0])
+	return id
+}
+
+// aead returns an AEAD with the object key for id.
+func (s *Store) aead(id ID) cipher.AEAD {
+	k := hkdf.Expand(s.prk, id[:], acorn.KeySize)
+	a := acorn.NewAEAD(k)
+	for i := range k {
+		k[i] = 0
+	}
+	return a
+}
+
+// nonce is the fixed nonce that objects are sealed with.
+var nonce = make([]byte, acorn.NonceSize)
+
+func (s *Store) path(id ID) string {
+	h := id.String()
+	return filepath.Join(s.dir, h[:2], h[2:])
+}
+
+// Put stores p and returns its ID. If the blob is already stored,
+// Put leaves it alone except for updating its modification time.
+func (s *Store) Put(p []byte) (ID, error) {
+	id := s.ID(p)
+	name := s.path(id)
+	now := time.Now()
+	if err := os.Chtimes(name, now, now); err == nil {
+		return id, nil
+	} else if !os.IsNotExist(err) {
+		return id, err
+	}
+	ct := s.aead(id).Seal(nil, nonce, p, id[:])
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return id, err
+	}
+	return id, writeAtomic(name, ct)
+}
+
+// writeAtomic writes b to a temporary file next to name
+// and renames it into place once it is safely on disk.
+func writeAtomic(name string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), tmpPrefix)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Get returns the plaintext of the blob with the given ID.
+// It returns ErrNotFound if there is no such blob, and ErrCorrupt
+// if the blob has been altered or was written with another key.
+func (s *Store) Get(id ID) ([]byte, error) {
+	ct, err := ioutil.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.aead(id).Open(ct[:0], nonce, ct, id[:])
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	// The object key is bound to the ID, so this only fails if the
+	// HMAC and ACORN disagree, but it is cheap next to the read.
+	if got := s.ID(p); !hmac.Equal(got[:], id[:]) {
+		return nil, ErrCorrupt
+	}
+	return p, nil
+}
+
+// Has reports whether the blob with the given ID is stored.
+// It does not check the blob's contents; see Verify.
+func (s *Store) Has(id ID) (bool, error) {
+	_, err := os.Stat(s.path(id))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Verify checks that the blob with the given ID is intact.
+// It returns the same errors as Get.
+func (s *Store) Verify(id ID) error {
+	p, err := s.Get(id)
+	for i := range p {
+		p[i] = 0
+	}
+	return err
+}
+
+// Delete removes the blob with the given ID.
+// It returns ErrNotFound if there is no such blob.
+func (s *Store) Delete(id ID) error {
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Info describes a stored blob.
+type Info struct {
+	ID      ID
+	Size    int64 // of the plaintext
+	ModTime time.Time
+}
+
+// List returns the blobs in the store, sorted by ID.
+// It never includes blobs which are still being written,
+// and skips files that aren't named like a blob.
+func (s *Store) List() ([]Info, error) {
+	var infos []Info
+	err := s.walk(func(name string, fi os.FileInfo, id ID, ok bool) error {
+		if ok {
+			infos = append(infos, Info{
+				ID:      id,
+				Size:    fi.Size() - acorn.TagSize,
+				ModTime: fi.ModTime(),
+			})
+		}
+		return nil
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		return bytes.Compare(infos[i].ID[:], infos[j].ID[:]) < 0
+	})
+	return infos, err
+}
+
+// walk calls fn for each file in the store's fan-out directories,
+// with ok set if the file is named like a blob.
+func (s *Store) walk(fn func(name string, fi os.FileInfo, id ID, ok bool) error) error {
+	dirs, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		if !d.IsDir() || len(d.Name()) != 2 {
+			continue
+		}
+		dir := filepath.Join(s.dir, d.Name())
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, fi := range files {
+			id, err := ParseID(d.Name() + fi.Name())
+			ok := err == nil && fi.Mode().IsRegular() && fi.Size() >= acorn.TagSize
+			if err := fn(filepath.Join(dir, fi.Name()), fi, id, ok); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Collect deletes the blobs last modified before the given time whose
+// IDs keep does not report as live, along with any temporary files
+// left before then by writes that were interrupted. It returns the IDs
+// of the blobs it deleted.
+//
+// To collect garbage safely while other goroutines or processes put
+// blobs, note the time before marking which blobs are live, and pass
+// it as before: any blob put since then has a later modification time,
+// so is kept whether or not it was marked. This holds even when the Put
+// lands while Collect is deciding: Collect moves a blob aside before
+// looking at its modification time again, and puts it back if it has
+// been refreshed.
+func (s *Store) Collect(before time.Time, keep func(ID) bool) ([]ID, error) {
+	var removed []ID
+	err := s.walk(func(name string, fi os.FileInfo, id ID, ok bool) error {
+		if !fi.ModTime().Before(before) {
+			return nil
+		}
+		switch {
+		case ok && !keep(id):
+			gone, err := removeUnlessTouched(name, before)
+			if err != nil {
+				return err
+			}
+			if gone {
+				removed = append(removed, id)
+			}
+		case strings.HasPrefix(fi.Name(), tmpPrefix):
+			if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// removeUnlessTouched removes the blob at name unless it has been
+// modified since before, and reports whether it did. The blob is
+// renamed to a temporary name first, so that a Put which refreshes it
+// either does so before the rename, and the new time is seen here, or
+// finds it missing and writes it again.
+func removeUnlessTouched(name string, before time.Time) (bool, error) {
+	tomb := filepath.Join(filepath.Dir(name), tmpPrefix+filepath.Base(name))
+	if err := os.Rename(name, tomb); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	fi, err := os.Lstat(tomb)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !fi.ModTime().Before(before) {
+		return false, os.Rename(tomb, name)
+	}
+	if err := os.Remove(tomb); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,222 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornblob
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("0123456789abcdef")
+
+// tempStore returns a store in a new temporary directory,
+// and a function to remove it.
+func tempStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "acornblob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(filepath.Join(dir, "blobs"), testKey)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, func() { os.RemoveAll(dir) }
+}
+
+func TestPutGet(t *testing.T) {
+	s, cleanup := tempStore(t)
+	defer cleanup()
+	msg := []byte("attack at dawn")
+	id, err := s.Put(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != s.ID(msg) {
+		t.Errorf("Put returned %v, want %v", id, s.ID(msg))
+	}
+	if id2, err := s.Put(msg); err != nil || id2 != id {
+		t.Errorf("second Put = %v, %v", id2, err)
+	}
+	got, err := s.Get(id)
+	if err != nil || !bytes.Equal(got, msg) {
+		t.Errorf("Get = %q, %v; want %q", got, err, msg)
+	}
+	if ok, err := s.Has(id); !ok || err != nil {
+		t.Errorf("Has = %v, %v", ok, err)
+	}
+
+	// the plaintext must not appear on disk
+	raw, err := ioutil.ReadFile(s.path(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, msg) {
+		t.Error("blob file contains its plaintext")
+	}
+
+	if p, err := ParseID(id.String()); err != nil || p != id {
+		t.Errorf("ParseID(%v) = %v, %v", id, p, err)
+	}
+	if _, err := ParseID("abc"); err != ErrInvalidID {
+		t.Errorf("ParseID(abc) returned %v", err)
+	}
+
+	if err := s.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(id); err != ErrNotFound {
+		t.Errorf("Get after Delete returned %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(id); err != ErrNotFound {
+		t.Errorf("second Delete returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	s, cleanup := tempStore(t)
+	defer cleanup()
+	id, err := s.Put([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Verify(id); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := ioutil.ReadFile(s.path(id))
+	raw[0] ^= 1
+	if err := ioutil.WriteFile(s.path(id), raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Verify(id); err != ErrCorrupt {
+		t.Errorf("Verify of a tampered blob returned %v, want ErrCorrupt", err)
+	}
+
+	// the same directory under another key
+	other, err := Open(s.dir, []byte("fedcba9876543210"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ = s.Put([]byte("world"))
+	if _, err := other.Get(id); err != ErrCorrupt {
+		t.Errorf("Get under another key returned %v, want ErrCorrupt", err)
+	}
+}
+
+func TestListCollect(t *testing.T) {
+	s, cleanup := tempStore(t)
+	defer cleanup()
+	var ids []ID
+	for _, p := range []string{"a", "bb", "ccc"} {
+		id, err := s.Put([]byte(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	// a write that was interrupted, and a stray file
+	tmp := filepath.Join(s.dir, ids[0].String()[:2], tmpPrefix+"123")
+	ioutil.WriteFile(tmp, []byte("partial"), 0600)
+	ioutil.WriteFile(filepath.Join(s.dir, "README"), nil, 0600)
+
+	infos, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 3 {
+		t.Fatalf("List returned %d blobs, want 3", len(infos))
+	}
+	for i, info := range infos {
+		if i > 0 && bytes.Compare(infos[i-1].ID[:], info.ID[:]) >= 0 {
+			t.Error("List is not sorted")
+		}
+		p, _ := s.Get(info.ID)
+		if info.Size != int64(len(p)) {
+			t.Errorf("List size of %q = %d", p, info.Size)
+		}
+	}
+
+	// Mark ids[0] as live. ids[1] is put again during the mark phase,
+	// so must survive even though it isn't marked.
+	old := time.Now().Add(-time.Hour)
+	for _, id := range ids {
+		os.Chtimes(s.path(id), old, old)
+	}
+	os.Chtimes(tmp, old, old)
+	start := time.Now().Add(-time.Minute)
+	if _, err := s.Put([]byte("bb")); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := s.Collect(start, func(id ID) bool { return id == ids[0] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != ids[2] {
+		t.Errorf("Collect removed %v, want [%v]", removed, ids[2])
+	}
+	for i, want := range []bool{true, true, false} {
+		if ok, _ := s.Has(ids[i]); ok != want {
+			t.Errorf("Has(ids[%d]) = %v after Collect, want %v", i, ok, want)
+		}
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("Collect left the temporary file: %v", err)
+	}
+}
+
+// TestCollectConcurrentPut checks that a blob put again while Collect
+// runs is never lost, whichever of the two gets to it first.
+func TestCollectConcurrentPut(t *testing.T) {
+	s, cleanup := tempStore(t)
+	defer cleanup()
+	msg := []byte("attack at dawn")
+	id := s.ID(msg)
+	old := time.Now().Add(-time.Hour)
+
+	// Collect saw the blob's old time, then a Put refreshed it.
+	if _, err := s.Put(msg); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(s.path(id), old, old)
+	start := time.Now()
+	if _, err := s.Put(msg); err != nil {
+		t.Fatal(err)
+	}
+	if gone, err := removeUnlessTouched(s.path(id), start); gone || err != nil {
+		t.Errorf("removeUnlessTouched removed a refreshed blob: %v, %v", gone, err)
+	}
+	if ok, _ := s.Has(id); !ok {
+		t.Error("refreshed blob was not put back")
+	}
+
+	for i := 0; i < 200; i++ {
+		if _, err := s.Put(msg); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(s.path(id), old, old)
+		start = time.Now()
+		var wg sync.WaitGroup
+		var putErr, collectErr error
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, putErr = s.Put(msg)
+		}()
+		go func() {
+			defer wg.Done()
+			_, collectErr = s.Collect(start, func(ID) bool { return false })
+		}()
+		wg.Wait()
+		if putErr != nil || collectErr != nil {
+			t.Fatalf("Put: %v; Collect: %v", putErr, collectErr)
+		}
+		if got, err := s.Get(id); err != nil || !bytes.Equal(got, msg) {
+			t.Fatalf("iteration %d: Get after concurrent Put and Collect = %q, %v", i, got, err)
+		}
+	}
+}
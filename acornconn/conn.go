@@ -0,0 +1,350 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornconn implements a secure channel over a net.Conn
+// using ACORN-128.
+//
+// Data is sent in records of at most MaxRecordSize bytes of plaintext.
+// Each record is
+//
+//	header     uint32   big-endian; a flag in bit 31 and the
+//	                    length of the sealed payload in the rest
+//	payload    []byte   sealed plaintext and 16-byte tag
+//
+// The header is passed as additional data. Each direction has its own key,
+// derived from the shared key, and the nonce of each record is its
+// sequence number under that key, so records cannot be reordered,
+// replayed, dropped, or reflected back at the sender without detection.
+//
+// Closing a Conn sends a record with an empty payload, so that the peer
+// can tell a clean close from a truncated connection.
+//
+// After sending a configurable number of records or bytes, a Conn
+// replaces its sending key with one derived from it, and restarts the
+// sequence numbers from zero. It tells the peer to do the same with an
+// empty record that has the key update flag set, sealed under the old key.
+// Long-lived connections thus never use one key too much, and a key
+// that leaks does not expose the data sent before it.
+//
+// The shared key must be established by some other means, and must not
+// be used for more than one connection.
+package acornconn
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/magical/go-acorn"
+)
+
+// MaxRecordSize is the most plaintext that a single record carries.
+const MaxRecordSize = 16 * 1024
+
+const (
+	headerSize    = 4
+	maxSealedSize = MaxRecordSize + acorn.TagSize
+
+	flagKeyUpdate = 1 << 31
+	lengthMask    = flagKeyUpdate - 1
+)
+
+// The default limits after which a Conn updates its sending key.
+const (
+	DefaultRekeyRecords = 1 << 24
+	DefaultRekeyBytes   = 1 << 36
+)
+
+var (
+	// ErrAuthentication is returned by Read when a record fails to decrypt.
+	ErrAuthentication = errors.New("acornconn: message authentication failed")
+
+	errRecordHeader = errors.New("acornconn: invalid record header")
+	errSequence     = errors.New("acornconn: sequence number exhausted")
+	errClosed       = errors.New("acornconn: write to closed Conn")
+)
+
+// A Conn is a secure channel over an underlying net.Conn.
+// Reads and writes may happen concurrently with each other,
+// but not with themselves.
+type Conn struct {
+	conn net.Conn
+
+	rmu  sync.Mutex
+	in   halfConn
+	rhdr [headerSize]byte
+	rin  []byte // sealed record
+	rbuf []byte // decrypted data not yet returned by Read
+	rerr error
+
+	wmu          sync.Mutex
+	out          halfConn
+	rekeyRecords uint64
+	rekeyBytes   uint64
+	wbuf         []byte // record being written
+	werr         error
+}
+
+// A halfConn holds the state of one direction of a Conn.
+type halfConn struct {
+	key   []byte
+	aead  cipher.AEAD
+	seq   uint64
+	bytes uint64 // plaintext sent under key
+	nonce [acorn.NonceSize]byte
+}
+
+func newHalfConn(key []byte) halfConn {
+	return halfConn{key: key, aead: acorn.NewAEAD(key)}
+}
+
+// rekey replaces the key with the next one in the chain.
+func (h *halfConn) rekey() {
+	next := hmacKey(h.key, "acornconn key update")
+	for i := range h.key {
+		h.key[i] = 0
+	}
+	*h = newHalfConn(next)
+}
+
+// nextNonce returns the nonce for the next record
+// and advances the sequence number.
+func (h *halfConn) nextNonce() ([]byte, error) {
+	if h.seq == ^uint64(0) {
+		return nil, errSequence
+	}
+	binary.BigEndian.PutUint64(h.nonce[8:], h.seq)
+	h.seq++
+	return h.nonce[:], nil
+}
+
+// Client returns a Conn that secures c, on the side that
+// initiated the connection, using the given 16-byte shared key.
+func Client(c net.Conn, key []byte) *Conn {
+	return ClientConfig(c, key, &Config{})
+}
+
+// Server returns a Conn that secures c, on the side that
+// accepted the connection, using the given 16-byte shared key.
+func Server(c net.Conn, key []byte) *Conn {
+	return ServerConfig(c, key, &Config{})
+}
+
+// A Config holds optional settings for a Conn.
+// The zero value is the default configuration.
+type Config struct {
+	// RekeyRecords is how many data records are sent under one key,
+	// or zero for DefaultRekeyRecords.
+	RekeyRecords uint64
+
+	// RekeyBytes is how much plaintext is sent under one key,
+	// or zero for DefaultRekeyBytes.
+	RekeyBytes uint64
+}
+
+// ClientConfig is like Client but uses the settings in config.
+func ClientConfig(c net.Conn, key []byte, config *Config) *Conn {
+	return newConn(c, key, config, "client", "server")
+}
+
+// ServerConfig is like Server but uses the settings in config.
+func ServerConfig(c net.Conn, key []byte, config *Config) *Conn {
+	return newConn(c, key, config, "server", "client")
+}
+
+func newConn(c net.Conn, key []byte, config *Config, us, them string) *Conn {
+	if len(key) != acorn.KeySize {
+		panic("acornconn: invalid key length")
+	}
+	conn := &Conn{
+		conn:         c,
+		in:           newHalfConn(deriveKey(key, them)),
+		out:          newHalfConn(deriveKey(key, us)),
+		rekeyRecords: config.RekeyRecords,
+		rekeyBytes:   config.RekeyBytes,
+	}
+	if conn.rekeyRecords == 0 {
+		conn.rekeyRecords = DefaultRekeyRecords
+	}
+	if conn.rekeyBytes == 0 {
+		conn.rekeyBytes = DefaultRekeyBytes
+	}
+	return conn
+}
+
+// deriveKey derives the first key used for records sent by the named side.
+func deriveKey(key []byte, sender string) []byte {
+	return hmacKey(key, "acornconn "+sender+" key")
+}
+
+func hmacKey(key []byte, label string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(label))
+	return m.Sum(nil)[:acorn.KeySize]
+}
+
+// Read reads decrypted data into p.
+// It returns io.EOF once the peer has closed the connection cleanly,
+// and io.ErrUnexpectedEOF if the connection ends any other way.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	for len(c.rbuf) == 0 {
+		if c.rerr != nil {
+			return 0, c.rerr
+		}
+		if clean, err := c.readRecord(); err != nil {
+			if clean && isTimeout(err) {
+				return 0, err
+			}
+			c.rerr = err
+		}
+	}
+	n := copy(p, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+// readRecord reads and decrypts the next record into rbuf.
+// Key updates leave rbuf empty. On error, it also reports whether
+// nothing of the record was read, so the stream is still in step.
+func (c *Conn) readRecord() (clean bool, err error) {
+	if n, err := io.ReadFull(c.conn, c.rhdr[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n == 0, err
+	}
+	hdr := binary.BigEndian.Uint32(c.rhdr[:])
+	size := hdr & lengthMask
+	if hdr&^(flagKeyUpdate|lengthMask) != 0 || size < acorn.TagSize || size > maxSealedSize {
+		return false, errRecordHeader
+	}
+	if c.rin == nil {
+		c.rin = make([]byte, maxSealedSize)
+	}
+	in := c.rin[:size]
+	if _, err := io.ReadFull(c.conn, in); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return false, err
+	}
+	nonce, err := c.in.nextNonce()
+	if err != nil {
+		return false, err
+	}
+	// Decrypt in place; rbuf is empty, so nothing is overwritten
+	// that Read still has to return.
+	c.rbuf, err = c.in.aead.Open(in[:0], nonce, in, c.rhdr[:])
+	if err != nil {
+		return false, ErrAuthentication
+	}
+	if hdr&flagKeyUpdate != 0 {
+		if len(c.rbuf) != 0 {
+			return false, errRecordHeader
+		}
+		c.in.rekey()
+		return false, nil
+	}
+	if len(c.rbuf) == 0 {
+		return false, io.EOF
+	}
+	return false, nil
+}
+
+// isTimeout reports whether err is a network timeout, such as one
+// caused by a read deadline.
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// Write encrypts p and writes it to the connection,
+// split into as many records as needed.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	n := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > MaxRecordSize {
+			chunk = chunk[:MaxRecordSize]
+		}
+		if c.out.seq >= c.rekeyRecords || c.out.bytes >= c.rekeyBytes {
+			if err := c.writeRecord(nil, flagKeyUpdate); err != nil {
+				return n, err
+			}
+			c.out.rekey()
+		}
+		if err := c.writeRecord(chunk, 0); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// writeRecord seals p into a single record with the given flags and sends it.
+// Once a write fails, the stream is out of sync with the peer,
+// so every later write fails too.
+func (c *Conn) writeRecord(p []byte, flags uint32) error {
+	if c.werr != nil {
+		return c.werr
+	}
+	nonce, err := c.out.nextNonce()
+	if err != nil {
+		c.werr = err
+		return err
+	}
+	if c.wbuf == nil {
+		c.wbuf = make([]byte, 0, headerSize+maxSealedSize)
+	}
+	b := c.wbuf[:headerSize]
+	binary.BigEndian.PutUint32(b, flags|uint32(len(p)+acorn.TagSize))
+	c.out.bytes += uint64(len(p))
+	b = c.out.aead.Seal(b, nonce, p, b[:headerSize])
+	if _, err := c.conn.Write(b); err != nil {
+		c.werr = err
+		return err
+	}
+	return nil
+}
+
+// Close sends a closing record to the peer, if it can,
+// and closes the underlying connection.
+func (c *Conn) Close() error {
+	c.wmu.Lock()
+	if c.werr == nil {
+		c.writeRecord(nil, 0)
+		c.werr = errClosed
+	}
+	c.wmu.Unlock()
+	return c.conn.Close()
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr { return c.conn.LocalAddr() }
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+// SetDeadline sets the read and write deadlines of the underlying connection.
+// A write that times out leaves the Conn unusable for further writes;
+// reads time out as described for SetReadDeadline.
+func (c *Conn) SetDeadline(t time.Time) error { return c.conn.SetDeadline(t) }
+
+// SetReadDeadline sets the read deadline of the underlying connection.
+// A read that times out before any of the next record has arrived can
+// be retried; one that times out partway through a record leaves the
+// Conn unusable for further reads.
+func (c *Conn) SetReadDeadline(t time.Time) error { return c.conn.SetReadDeadline(t) }
+
+// SetWriteDeadline sets the write deadline of the underlying connection.
+func (c *Conn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
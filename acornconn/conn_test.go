@@ -0,0 +1,249 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornconn
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKey = []byte(strings.Repeat("password", 2))
+
+// pipe returns a connected client and server.
+func pipe() (*Conn, *Conn) {
+	a, b := net.Pipe()
+	return Client(a, testKey), Server(b, testKey)
+}
+
+// record captures the records that a Client writes for p, followed by Close.
+func record(t *testing.T, p []byte) []byte {
+	a, b := net.Pipe()
+	c := Client(a, testKey)
+	go func() {
+		c.Write(p)
+		c.Close()
+	}()
+	raw, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// replay feeds raw records to a Server and returns what it reads.
+func replay(raw []byte) ([]byte, error) {
+	a, b := net.Pipe()
+	go func() {
+		a.Write(raw)
+		a.Close()
+	}()
+	return ioutil.ReadAll(Server(b, testKey))
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 100, MaxRecordSize, MaxRecordSize + 1, 3*MaxRecordSize + 5} {
+		p := bytes.Repeat([]byte{'x'}, n)
+		client, server := pipe()
+		go func() {
+			client.Write(p)
+			client.Close()
+		}()
+		got, err := ioutil.ReadAll(server)
+		if err != nil {
+			t.Errorf("len=%d: unexpected error: %v", n, err)
+		} else if !bytes.Equal(got, p) {
+			t.Errorf("len=%d: got %d bytes, want %d", n, len(got), len(p))
+		}
+	}
+}
+
+func TestBothDirections(t *testing.T) {
+	client, server := pipe()
+	go func() {
+		io.Copy(server, server) // echo
+		server.Close()
+	}()
+	done := make(chan []byte)
+	go func() {
+		got, _ := ioutil.ReadAll(client)
+		done <- got
+	}()
+	msg := []byte("hello, world")
+	for i := 0; i < 3; i++ {
+		if _, err := client.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client.Close()
+	if got, want := <-done, bytes.Repeat(msg, 3); !bytes.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSmallReads(t *testing.T) {
+	p := []byte("abcdefghijklmnopqrstuvwxyz")
+	raw := record(t, p)
+	a, b := net.Pipe()
+	go func() {
+		a.Write(raw)
+		a.Close()
+	}()
+	server := Server(b, testKey)
+	var got []byte
+	buf := make([]byte, 3)
+	for {
+		n, err := server.Read(buf)
+		got = append(got, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(got, p) {
+		t.Errorf("got %q, want %q", got, p)
+	}
+}
+
+func TestTamper(t *testing.T) {
+	raw := record(t, []byte("attack at dawn"))
+	for i := range raw {
+		bad := append([]byte(nil), raw...)
+		bad[i] ^= 0x80
+		if _, err := replay(bad); err == nil {
+			t.Errorf("byte %d: tampering not detected", i)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	raw := record(t, []byte("attack at dawn"))
+	for n := 0; n < len(raw); n++ {
+		_, err := replay(raw[:n])
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("len=%d: got error %v, want %v", n, err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+func TestReorder(t *testing.T) {
+	a := record(t, []byte("first"))
+	b := record(t, []byte("second"))
+	// Both captures start at sequence number 0, so the first
+	// record of b is out of place after the first record of a.
+	first := a[:headerSize+5+16]
+	second := b[:headerSize+6+16]
+	raw := append(append([]byte(nil), first...), second...)
+	if _, err := replay(raw); err != ErrAuthentication {
+		t.Errorf("got error %v, want %v", err, ErrAuthentication)
+	}
+}
+
+func TestReflect(t *testing.T) {
+	// A server must not accept its own records.
+	a, b := net.Pipe()
+	server := Server(a, testKey)
+	go func() {
+		server.Write([]byte("hello"))
+		server.Close()
+	}()
+	raw, _ := ioutil.ReadAll(b)
+	c, d := net.Pipe()
+	go func() {
+		c.Write(raw)
+		c.Close()
+	}()
+	if _, err := ioutil.ReadAll(Server(d, testKey)); err != ErrAuthentication {
+		t.Errorf("got error %v, want %v", err, ErrAuthentication)
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	raw := record(t, []byte("hello"))
+	a, b := net.Pipe()
+	go func() {
+		a.Write(raw)
+		a.Close()
+	}()
+	key := bytes.Repeat([]byte{1}, len(testKey))
+	if _, err := ioutil.ReadAll(Server(b, key)); err != ErrAuthentication {
+		t.Errorf("got error %v, want %v", err, ErrAuthentication)
+	}
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	client, server := pipe()
+	go ioutil.ReadAll(server)
+	client.Close()
+	if _, err := client.Write([]byte("x")); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+}
+
+func TestRekey(t *testing.T) {
+	for _, config := range []Config{
+		{RekeyRecords: 1},
+		{RekeyRecords: 3},
+		{RekeyBytes: 100},
+		{RekeyBytes: MaxRecordSize},
+	} {
+		a, b := net.Pipe()
+		client := ClientConfig(a, testKey, &config)
+		server := Server(b, testKey)
+		msg := bytes.Repeat([]byte("0123456789"), 7)
+		go func() {
+			for i := 0; i < 20; i++ {
+				client.Write(msg)
+			}
+			client.Write(make([]byte, 2*MaxRecordSize))
+			client.Close()
+		}()
+		got, err := ioutil.ReadAll(server)
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %v", config, err)
+			continue
+		}
+		want := append(bytes.Repeat(msg, 20), make([]byte, 2*MaxRecordSize)...)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%+v: got %d bytes, want %d", config, len(got), len(want))
+		}
+		// plus one for the key update or closing record
+		if client.out.seq > config.RekeyRecords+1 && config.RekeyRecords != 0 {
+			t.Errorf("%+v: sent %d records under one key", config, client.out.seq)
+		}
+	}
+}
+
+func TestRekeyTamper(t *testing.T) {
+	// Flipping the key update flag on an ordinary record
+	// must not go unnoticed.
+	raw := record(t, []byte("hello"))
+	raw[0] ^= 0x80
+	if _, err := replay(raw); err != ErrAuthentication {
+		t.Errorf("got error %v, want %v", err, ErrAuthentication)
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	client, server := Client(a, testKey), Server(b, testKey)
+	server.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	buf := make([]byte, 16)
+	_, err := server.Read(buf)
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("Read past the deadline returned %v, want a timeout", err)
+	}
+	server.SetReadDeadline(time.Time{})
+	go client.Write([]byte("hello"))
+	n, err := server.Read(buf)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("Read after a timeout = %q, %v", buf[:n], err)
+	}
+}
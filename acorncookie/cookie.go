@@ -0,0 +1,162 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acorncookie seals values for storage in HTTP cookies,
+// in the manner of github.com/gorilla/securecookie, using ACORN-128.
+//
+// An encoded cookie value is the unpadded URL-safe base64 encoding of
+//
+//	keyID      [8]byte  ID of the key that sealed the value
+//	nonce      [16]byte random
+//	sealed     []byte   sealed body and 16-byte tag
+//
+// where the body is the time the value was encoded, as a big-endian
+// int64 of Unix seconds, followed by the JSON encoding of the value.
+// The key ID and the cookie name are passed as additional data, so a
+// value cannot be moved from one cookie to another.
+//
+// Keys are held by an agent.Agent, such as the one returned by
+// agent.NewKeyring. A Codec seals with one key but opens values sealed
+// with any key the agent holds, so keys can be rotated without logging
+// everyone out.
+package acorncookie
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/magical/go-acorn"
+	"github.com/magical/go-acorn/agent"
+)
+
+// DefaultMaxAge is the maximum age used by a new Codec,
+// the same as securecookie's.
+const DefaultMaxAge = 30 * 24 * time.Hour
+
+// MaxLength is the longest encoded value that a Codec
+// will produce or accept, the same as securecookie's.
+const MaxLength = 4096
+
+const (
+	idSize  = 8
+	minSize = idSize + acorn.NonceSize + 8 + acorn.TagSize
+)
+
+var (
+	ErrInvalid = errors.New("acorncookie: invalid value")
+	ErrExpired = errors.New("acorncookie: value has expired")
+	ErrTooLong = errors.New("acorncookie: encoded value is too long")
+	errName    = errors.New("acorncookie: empty cookie name")
+)
+
+var encoding = base64.RawURLEncoding.Strict()
+
+// A Codec encodes and decodes cookie values.
+type Codec struct {
+	keys   agent.Agent
+	keyID  [8]byte
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+// New returns a Codec that seals values with the agent's key keyID.
+func New(keys agent.Agent, keyID [8]byte) *Codec {
+	return &Codec{keys: keys, keyID: keyID, maxAge: DefaultMaxAge, now: time.Now}
+}
+
+// MaxAge sets how long after encoding a value is accepted by Decode.
+// Zero means forever. It returns c, for chaining.
+func (c *Codec) MaxAge(d time.Duration) *Codec {
+	c.maxAge = d
+	return c
+}
+
+// Encode seals value, bound to the cookie name,
+// and returns it encoded for use as a cookie value.
+func (c *Codec) Encode(name string, value interface{}) (string, error) {
+	if name == "" {
+		return "", errName
+	}
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := acorn.GenerateNonce(nil)
+	if err != nil {
+		return "", err
+	}
+	body := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint64(body, uint64(c.now().Unix()))
+	copy(body[8:], payload)
+	sealed, err := c.keys.Seal(c.keyID, nonce, body, additionalData(c.keyID, name))
+	if err != nil {
+		return "", err
+	}
+	raw := make([]byte, 0, idSize+len(nonce)+len(sealed))
+	raw = append(raw, c.keyID[:]...)
+	raw = append(raw, nonce...)
+	raw = append(raw, sealed...)
+	if encoding.EncodedLen(len(raw)) > MaxLength {
+		return "", ErrTooLong
+	}
+	return encoding.EncodeToString(raw), nil
+}
+
+// Decode opens a value produced by Encode for the same cookie name
+// and stores it in the value pointed to by dst.
+func (c *Codec) Decode(name, value string, dst interface{}) error {
+	if name == "" {
+		return errName
+	}
+	if len(value) > MaxLength {
+		return ErrTooLong
+	}
+	raw, err := encoding.DecodeString(value)
+	if err != nil || len(raw) < minSize {
+		return ErrInvalid
+	}
+	var id [8]byte
+	copy(id[:], raw)
+	nonce := raw[idSize : idSize+acorn.NonceSize]
+	body, err := c.keys.Open(id, nonce, raw[idSize+acorn.NonceSize:], additionalData(id, name))
+	if err != nil {
+		return ErrInvalid
+	}
+	t := time.Unix(int64(binary.BigEndian.Uint64(body)), 0)
+	if c.maxAge > 0 && !c.now().Before(t.Add(c.maxAge)) {
+		return ErrExpired
+	}
+	return json.Unmarshal(body[8:], dst)
+}
+
+// SetCookie encodes value as the value of cookie, which must have its
+// Name set, and adds the cookie to w. The cookie's other fields, such as
+// Path, MaxAge, and Secure, are left as the caller set them.
+func (c *Codec) SetCookie(w http.ResponseWriter, cookie *http.Cookie, value interface{}) error {
+	v, err := c.Encode(cookie.Name, value)
+	if err != nil {
+		return err
+	}
+	cookie.Value = v
+	http.SetCookie(w, cookie)
+	return nil
+}
+
+// Cookie decodes the value of the named cookie in r into dst.
+// It returns http.ErrNoCookie if there is no such cookie.
+func (c *Codec) Cookie(r *http.Request, name string, dst interface{}) error {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return err
+	}
+	return c.Decode(name, cookie.Value, dst)
+}
+
+func additionalData(keyID [8]byte, name string) []byte {
+	ad := make([]byte, 0, idSize+len(name))
+	ad = append(ad, keyID[:]...)
+	return append(ad, name...)
+}
@@ -0,0 +1,116 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorncookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magical/go-acorn/agent"
+)
+
+var (
+	oldID  = [8]byte{1}
+	newID  = [8]byte{2}
+	oldKey = []byte(strings.Repeat("password", 2))
+	newKey = []byte(strings.Repeat("PASSWORD", 2))
+)
+
+type session struct {
+	User string
+	Cart []int
+}
+
+func TestRoundTrip(t *testing.T) {
+	keys := agent.NewKeyring()
+	keys.Add(oldID, oldKey)
+	c := New(keys, oldID)
+	v, err := c.Encode("session", session{"alice", []int{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s session
+	if err := c.Decode("session", v, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.User != "alice" || len(s.Cart) != 2 {
+		t.Errorf("got %+v", s)
+	}
+	if err := c.Decode("prefs", v, &s); err != ErrInvalid {
+		t.Errorf("wrong name: got error %v, want %v", err, ErrInvalid)
+	}
+	if err := c.Decode("session", v[:len(v)-2], &s); err != ErrInvalid {
+		t.Errorf("truncated: got error %v, want %v", err, ErrInvalid)
+	}
+	if _, err := c.Encode("session", strings.Repeat("x", MaxLength)); err != ErrTooLong {
+		t.Errorf("long value: got error %v, want %v", err, ErrTooLong)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	keys := agent.NewKeyring()
+	keys.Add(oldID, oldKey)
+	v, err := New(keys, oldID).Encode("session", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.Add(newID, newKey)
+	c := New(keys, newID)
+	var s string
+	if err := c.Decode("session", v, &s); err != nil || s != "hello" {
+		t.Errorf("old value after adding new key: got %q, %v", s, err)
+	}
+	keys.Remove(oldID)
+	if err := c.Decode("session", v, &s); err != ErrInvalid {
+		t.Errorf("old value after removing old key: got error %v, want %v", err, ErrInvalid)
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	keys := agent.NewKeyring()
+	keys.Add(oldID, oldKey)
+	now := time.Unix(1500000000, 0)
+	c := New(keys, oldID).MaxAge(time.Hour)
+	c.now = func() time.Time { return now }
+	v, err := c.Encode("session", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	now = now.Add(59 * time.Minute)
+	if err := c.Decode("session", v, &n); err != nil || n != 42 {
+		t.Errorf("before expiry: got %d, %v", n, err)
+	}
+	now = now.Add(time.Minute)
+	if err := c.Decode("session", v, &n); err != ErrExpired {
+		t.Errorf("after expiry: got error %v, want %v", err, ErrExpired)
+	}
+	c.MaxAge(0)
+	if err := c.Decode("session", v, &n); err != nil {
+		t.Errorf("no max age: got error %v", err)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	keys := agent.NewKeyring()
+	keys.Add(oldID, oldKey)
+	c := New(keys, oldID)
+	rec := httptest.NewRecorder()
+	if err := c.SetCookie(rec, &http.Cookie{Name: "session", Path: "/"}, session{User: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	var s session
+	if err := c.Cookie(req, "session", &s); err != nil || s.User != "bob" {
+		t.Errorf("got %+v, %v", s, err)
+	}
+	if err := c.Cookie(req, "other", &s); err != http.ErrNoCookie {
+		t.Errorf("missing cookie: got error %v, want %v", err, http.ErrNoCookie)
+	}
+}
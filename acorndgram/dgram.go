@@ -0,0 +1,145 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acorndgram protects individual datagrams, such as UDP packets,
+// with ACORN-128.
+//
+// Each packet is
+//
+//	seq        uint64   big-endian sequence number
+//	payload    []byte   sealed payload and 16-byte tag
+//
+// The nonce is derived from the sequence number, which is passed as
+// additional data. Datagrams may be lost or arrive out of order, so an
+// Opener accepts any sequence number it has not seen before that is
+// within a window of the highest one seen so far, and rejects the rest
+// as replays.
+//
+// The sequence number is sent in the clear. A HeaderProtector can hide
+// it from observers.
+//
+// A key must only ever be used by one Sealer, so two peers that talk to
+// each other need a key for each direction.
+package acorndgram
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/magical/go-acorn"
+)
+
+const (
+	// HeaderSize is the length of the sequence number at the start of a packet.
+	HeaderSize = 8
+
+	// Overhead is how much longer a packet is than its payload.
+	Overhead = HeaderSize + acorn.TagSize
+)
+
+var (
+	ErrAuthentication = errors.New("acorndgram: message authentication failed")
+	ErrReplay         = errors.New("acorndgram: replayed or too old packet")
+	ErrExhausted      = errors.New("acorndgram: sequence numbers exhausted")
+	errShort          = errors.New("acorndgram: packet too short")
+)
+
+// maxSeq is reserved so that the highest sequence number
+// a ReplayWindow has seen plus one never overflows.
+const maxSeq = ^uint64(0)
+
+func nonceFor(seq uint64) [acorn.NonceSize]byte {
+	var nonce [acorn.NonceSize]byte
+	binary.BigEndian.PutUint64(nonce[8:], seq)
+	return nonce
+}
+
+// A Sealer seals outgoing packets.
+// It is safe for concurrent use.
+type Sealer struct {
+	aead cipher.AEAD
+	mu   sync.Mutex
+	seq  uint64
+}
+
+// NewSealer returns a Sealer that uses the given 16-byte key.
+// Its first packet has sequence number 0.
+func NewSealer(key []byte) *Sealer {
+	return &Sealer{aead: acorn.NewAEAD(key)}
+}
+
+// Seal seals payload into a packet with the next sequence number,
+// appends it to dst, and returns the updated slice.
+func (s *Sealer) Seal(dst, payload []byte) ([]byte, error) {
+	s.mu.Lock()
+	seq := s.seq
+	if seq == maxSeq {
+		s.mu.Unlock()
+		return dst, ErrExhausted
+	}
+	s.seq++
+	s.mu.Unlock()
+
+	var hdr [HeaderSize]byte
+	binary.BigEndian.PutUint64(hdr[:], seq)
+	nonce := nonceFor(seq)
+	dst = append(dst, hdr[:]...)
+	return s.aead.Seal(dst, nonce[:], payload, hdr[:]), nil
+}
+
+// An Opener opens incoming packets and rejects replays.
+// It is safe for concurrent use.
+type Opener struct {
+	aead cipher.AEAD
+	mu   sync.Mutex
+	w    ReplayWindow
+}
+
+// NewOpener returns an Opener that uses the given 16-byte key
+// and a window of DefaultWindowSize.
+func NewOpener(key []byte) *Opener {
+	return NewOpenerSize(key, DefaultWindowSize)
+}
+
+// NewOpenerSize is like NewOpener but uses the given window size,
+// which must be 64 or 128.
+func NewOpenerSize(key []byte, windowSize int) *Opener {
+	o := &Opener{aead: acorn.NewAEAD(key)}
+	o.w.init(windowSize)
+	return o
+}
+
+// Open authenticates and decrypts packet, appends the payload to dst,
+// and returns the updated slice and the packet's sequence number.
+// Packets are only recorded as seen once they have been authenticated,
+// so forged packets cannot make the Opener reject genuine ones.
+func (o *Opener) Open(dst, packet []byte) ([]byte, uint64, error) {
+	if len(packet) < Overhead {
+		return dst, 0, errShort
+	}
+	hdr := packet[:HeaderSize]
+	seq := binary.BigEndian.Uint64(hdr)
+	o.mu.Lock()
+	fresh := o.w.Check(seq)
+	o.mu.Unlock()
+	if !fresh {
+		return dst, seq, ErrReplay
+	}
+	nonce := nonceFor(seq)
+	out, err := o.aead.Open(dst, nonce[:], packet[HeaderSize:], hdr)
+	if err != nil {
+		return dst, seq, ErrAuthentication
+	}
+	// Another goroutine may have accepted the same packet meanwhile.
+	o.mu.Lock()
+	fresh = o.w.Update(seq)
+	o.mu.Unlock()
+	if !fresh {
+		for i := range out[len(dst):] {
+			out[len(dst)+i] = 0
+		}
+		return dst, seq, ErrReplay
+	}
+	return out, seq, nil
+}
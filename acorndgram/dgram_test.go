@@ -0,0 +1,151 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorndgram
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var testKey = []byte(strings.Repeat("password", 2))
+
+func sealN(t *testing.T, s *Sealer, n int) [][]byte {
+	var packets [][]byte
+	for i := 0; i < n; i++ {
+		p, err := s.Seal(nil, []byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+func TestRoundTrip(t *testing.T) {
+	s, o := NewSealer(testKey), NewOpener(testKey)
+	for i, n := range []int{0, 1, 15, 16, 17, 1200} {
+		payload := bytes.Repeat([]byte{'x'}, n)
+		p, err := s.Seal(nil, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p) != n+Overhead {
+			t.Errorf("len=%d: packet length = %d, want %d", n, len(p), n+Overhead)
+		}
+		got, seq, err := o.Open(nil, p)
+		if err != nil {
+			t.Errorf("len=%d: unexpected error: %v", n, err)
+		} else if !bytes.Equal(got, payload) {
+			t.Errorf("len=%d: got %q, want %q", n, got, payload)
+		}
+		if seq != uint64(i) {
+			t.Errorf("len=%d: seq = %d, want %d", n, seq, i)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	packets := sealN(t, NewSealer(testKey), 100)
+	o := NewOpener(testKey)
+	// out of order, within the window
+	for _, i := range []int{5, 3, 4, 0, 70, 69, 10} {
+		if _, _, err := o.Open(nil, packets[i]); err != nil {
+			t.Errorf("packet %d: unexpected error: %v", i, err)
+		}
+	}
+	// duplicates, and packets that fell out of the window
+	for _, i := range []int{5, 70, 69, 1, 6} {
+		if _, _, err := o.Open(nil, packets[i]); err != ErrReplay {
+			t.Errorf("packet %d: got error %v, want %v", i, err, ErrReplay)
+		}
+	}
+	if _, _, err := o.Open(nil, packets[7]); err != nil {
+		t.Errorf("packet 7: unexpected error: %v", err)
+	}
+}
+
+func TestTamper(t *testing.T) {
+	p := sealN(t, NewSealer(testKey), 1)[0]
+	for i := range p {
+		o := NewOpener(testKey)
+		bad := append([]byte(nil), p...)
+		bad[i] ^= 0x80
+		if _, _, err := o.Open(nil, bad); err == nil {
+			t.Errorf("byte %d: tampering not detected", i)
+		}
+		// a forgery must not use up the sequence number
+		if _, _, err := o.Open(nil, p); err != nil {
+			t.Errorf("byte %d: genuine packet rejected after forgery: %v", i, err)
+		}
+	}
+	if _, _, err := NewOpener(testKey).Open(nil, p[:Overhead-1]); err == nil {
+		t.Error("short packet accepted")
+	}
+}
+
+func TestExhausted(t *testing.T) {
+	s := NewSealer(testKey)
+	s.seq = maxSeq - 1
+	p, err := s.Seal(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Seal(nil, nil); err != ErrExhausted {
+		t.Errorf("got error %v, want %v", err, ErrExhausted)
+	}
+	if _, seq, err := NewOpener(testKey).Open(nil, p); err != nil || seq != maxSeq-1 {
+		t.Errorf("got seq %d, error %v", seq, err)
+	}
+}
+
+func TestReplayWindow(t *testing.T) {
+	steps := []struct {
+		seq   uint64
+		ok64  bool
+		ok128 bool
+	}{
+		{0, true, true}, {0, false, false}, {2, true, true}, {1, true, true}, {1, false, false},
+		{65, true, true}, {1, false, false}, {3, true, true}, {3, false, false}, {64, true, true},
+		{100, true, true}, {30, false, true}, {30, false, false}, {37, true, true},
+		{300, true, true}, {172, false, false}, {173, false, true}, {237, true, true},
+		{299, true, true}, {300, false, false}, {maxSeq, false, false},
+	}
+	w64, w128 := NewReplayWindow(64), NewReplayWindow(128)
+	for _, s := range steps {
+		if ok := w64.Update(s.seq); ok != s.ok64 {
+			t.Errorf("64: Update(%d) = %v, want %v", s.seq, ok, s.ok64)
+		}
+		if ok := w128.Update(s.seq); ok != s.ok128 {
+			t.Errorf("128: Update(%d) = %v, want %v", s.seq, ok, s.ok128)
+		}
+	}
+}
+
+func TestHeaderProtection(t *testing.T) {
+	s, o := NewSealer(testKey), NewOpener(testKey)
+	hp := NewHeaderProtector([]byte(strings.Repeat("hp", 8)))
+	for i := 0; i < 3; i++ {
+		p, err := s.Seal(nil, []byte("temperature=21.5"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain := append([]byte(nil), p...)
+		hp.Protect(p)
+		if bytes.Equal(p[:HeaderSize], plain[:HeaderSize]) {
+			t.Errorf("packet %d: header unchanged", i)
+		}
+		if !bytes.Equal(p[HeaderSize:], plain[HeaderSize:]) {
+			t.Errorf("packet %d: body changed", i)
+		}
+		if err := hp.Unprotect(p); err != nil {
+			t.Fatal(err)
+		}
+		if _, seq, err := o.Open(nil, p); err != nil || seq != uint64(i) {
+			t.Errorf("packet %d: got seq %d, error %v", i, seq, err)
+		}
+	}
+	if err := hp.Unprotect(make([]byte, Overhead-1)); err == nil {
+		t.Error("short packet accepted")
+	}
+}
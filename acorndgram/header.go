@@ -0,0 +1,76 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorndgram
+
+import (
+	"crypto/cipher"
+
+	"github.com/magical/go-acorn"
+)
+
+const (
+	// SampleSize is the length of the ciphertext sample used for header protection.
+	SampleSize = acorn.NonceSize
+
+	// MaskSize is the length of a header protection mask.
+	MaskSize = 16
+)
+
+// A HeaderProtector hides packet headers, such as sequence numbers and
+// flags, from observers, in the manner of QUIC header protection
+// (RFC 9001, section 5.4).
+//
+// The mask for a packet is derived from a sample of its ciphertext,
+// which the receiver can read before removing the protection. The mask
+// is the ACORN-128 keystream for a message encrypted under the header
+// protection key, using the sample as the nonce. Since ciphertexts look
+// random, so do the samples, and distinct samples give unrelated masks.
+//
+// Header protection does not authenticate anything; the protected
+// fields must still be authenticated by the packet's AEAD, and the key
+// must be independent of the packet key.
+type HeaderProtector struct {
+	aead cipher.AEAD
+}
+
+// NewHeaderProtector returns a HeaderProtector that uses the given 16-byte key.
+func NewHeaderProtector(key []byte) *HeaderProtector {
+	return &HeaderProtector{aead: acorn.NewAEAD(key)}
+}
+
+// Mask returns the mask for a SampleSize-byte sample of ciphertext.
+// The caller XORs as many bytes of it as it needs into the header.
+func (h *HeaderProtector) Mask(sample []byte) [MaskSize]byte {
+	if len(sample) != SampleSize {
+		panic("acorndgram: invalid sample length")
+	}
+	var zero [MaskSize]byte
+	var buf [MaskSize + acorn.TagSize]byte
+	var mask [MaskSize]byte
+	copy(mask[:], h.aead.Seal(buf[:0], sample, zero[:], nil))
+	return mask
+}
+
+// Protect hides the sequence number of a packet produced by a Sealer,
+// in place. The sample is the first SampleSize bytes after the header,
+// which every packet has, since the tag alone is that long.
+func (h *HeaderProtector) Protect(packet []byte) {
+	h.xorHeader(packet)
+}
+
+// Unprotect reveals the sequence number of a packet protected by
+// Protect, in place, so that it can be passed to an Opener.
+func (h *HeaderProtector) Unprotect(packet []byte) error {
+	if len(packet) < Overhead {
+		return errShort
+	}
+	h.xorHeader(packet)
+	return nil
+}
+
+func (h *HeaderProtector) xorHeader(packet []byte) {
+	mask := h.Mask(packet[HeaderSize : HeaderSize+SampleSize])
+	for i := range packet[:HeaderSize] {
+		packet[i] ^= mask[i]
+	}
+}
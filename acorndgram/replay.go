@@ -0,0 +1,83 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorndgram
+
+// DefaultWindowSize is the window size used by an Opener.
+const DefaultWindowSize = 64
+
+// A ReplayWindow detects replayed packets by their sequence numbers,
+// in the manner of IPsec (RFC 4303, section 3.4.3, and RFC 6479).
+//
+// It remembers the highest sequence number it has seen, and which of
+// the ones before it, up to the window size, it has seen. Sequence
+// numbers that are higher, or within the window and not yet seen, are
+// fresh; all others are rejected. Packets may therefore be reordered by
+// up to the window size without being dropped.
+//
+// A protocol should Check a sequence number before authenticating the
+// packet, which is cheap rejection of obvious replays, and Update only
+// after, so that forged packets cannot advance the window.
+//
+// A ReplayWindow is not safe for concurrent use.
+type ReplayWindow struct {
+	size uint64
+	next uint64    // highest sequence number seen plus one, or 0
+	seen [2]uint64 // bit i is set if next-1-i has been seen
+}
+
+// NewReplayWindow returns a ReplayWindow of the given size,
+// which must be 64 or 128, that has seen nothing.
+func NewReplayWindow(size int) *ReplayWindow {
+	w := new(ReplayWindow)
+	w.init(size)
+	return w
+}
+
+func (w *ReplayWindow) init(size int) {
+	if size != 64 && size != 128 {
+		panic("acorndgram: invalid replay window size")
+	}
+	*w = ReplayWindow{size: uint64(size)}
+}
+
+// Check reports whether seq is fresh, without recording it.
+// The highest sequence number, 2^64-1, is never fresh.
+func (w *ReplayWindow) Check(seq uint64) bool {
+	if seq == maxSeq {
+		return false
+	}
+	if seq >= w.next {
+		return true
+	}
+	d := w.next - 1 - seq
+	return d < w.size && w.seen[d/64]&(1<<(d%64)) == 0
+}
+
+// Update records seq as seen, if it is fresh,
+// and reports whether it was.
+func (w *ReplayWindow) Update(seq uint64) bool {
+	if !w.Check(seq) {
+		return false
+	}
+	if seq >= w.next {
+		w.shift(seq + 1 - w.next)
+		w.seen[0] |= 1
+		w.next = seq + 1
+	} else {
+		d := w.next - 1 - seq
+		w.seen[d/64] |= 1 << (d % 64)
+	}
+	return true
+}
+
+// shift moves the window forward by n > 0.
+func (w *ReplayWindow) shift(n uint64) {
+	switch {
+	case n >= 128:
+		w.seen = [2]uint64{}
+	case n >= 64:
+		w.seen = [2]uint64{0, w.seen[0] << (n - 64)}
+	default:
+		w.seen = [2]uint64{w.seen[0] << n, w.seen[1]<<n | w.seen[0]>>(64-n)}
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornframe
+
+import "errors"
+
+var errCOBS = errors.New("acornframe: invalid COBS encoding")
+
+// EncodedLen returns the most bytes that Encode produces for n bytes of input.
+func EncodedLen(n int) int {
+	return n + 1 + n/254
+}
+
+// Encode appends the COBS encoding of src to dst and returns the
+// updated slice. The encoding contains no zero bytes, so a zero byte
+// can mark the end of a frame.
+func Encode(dst, src []byte) []byte {
+	code := len(dst)
+	dst = append(dst, 0)
+	n := byte(1)
+	for i, b := range src {
+		if b != 0 {
+			dst = append(dst, b)
+			n++
+		}
+		if b == 0 || n == 0xff {
+			dst[code] = n
+			n = 1
+			if b != 0 && i == len(src)-1 {
+				return dst
+			}
+			code = len(dst)
+			dst = append(dst, 0)
+		}
+	}
+	dst[code] = n
+	return dst
+}
+
+// Decode appends the decoding of a COBS-encoded src to dst
+// and returns the updated slice.
+func Decode(dst, src []byte) ([]byte, error) {
+	for len(src) > 0 {
+		n := int(src[0])
+		if n == 0 || n > len(src) {
+			return dst, errCOBS
+		}
+		for _, b := range src[1:n] {
+			if b == 0 {
+				return dst, errCOBS
+			}
+		}
+		dst = append(dst, src[1:n]...)
+		src = src[n:]
+		if n < 0xff && len(src) > 0 {
+			dst = append(dst, 0)
+		}
+	}
+	return dst, nil
+}
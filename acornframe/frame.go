@@ -0,0 +1,132 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornframe authenticates and encrypts small frames on
+// byte-oriented links, such as UARTs and CAN-FD, for gateways that talk
+// to firmware.
+//
+// Each frame is an acornradio frame, typically with a 1- or 2-byte
+// counter and a truncated tag, encoded with Consistent Overhead Byte
+// Stuffing (COBS) and followed by a zero byte. The zero byte marks the
+// end of every frame, so a reader that joins the link partway through,
+// or loses bytes to noise, picks up again at the next frame.
+//
+// Both ends enforce a maximum frame size, counted in bytes on the wire
+// including the zero byte, to match the link's buffers.
+package acornframe
+
+import (
+	"bufio"
+	"errors"
+	"io"
+
+	"github.com/magical/go-acorn/acornradio"
+)
+
+var (
+	ErrTooLong = errors.New("acornframe: frame too long")
+	errEmpty   = errors.New("acornframe: empty frame")
+)
+
+// A Writer writes sealed frames to a link.
+type Writer struct {
+	w   io.Writer
+	s   *acornradio.Sender
+	max int
+	buf []byte
+}
+
+// NewWriter returns a Writer that seals frames with s and writes them
+// to w, each no more than maxFrame bytes long.
+func NewWriter(w io.Writer, s *acornradio.Sender, maxFrame int) *Writer {
+	return &Writer{w: w, s: s, max: maxFrame}
+}
+
+// MaxPayload returns the longest payload that fits in a frame.
+func (w *Writer) MaxPayload() int {
+	p := w.s.Profile()
+	n := w.max - 1 - p.Overhead()
+	for n > 0 && EncodedLen(n+p.Overhead())+1 > w.max {
+		n--
+	}
+	return n
+}
+
+// WriteFrame seals payload and writes it as a single frame, with a single
+// call to the underlying Write. It returns ErrTooLong if the payload is
+// longer than MaxPayload.
+func (w *Writer) WriteFrame(payload []byte) error {
+	p := w.s.Profile()
+	if EncodedLen(len(payload)+p.Overhead())+1 > w.max {
+		return ErrTooLong
+	}
+	sealed, err := w.s.Seal(w.buf[:0], payload)
+	if err != nil {
+		return err
+	}
+	n := len(sealed)
+	out := Encode(sealed, sealed)
+	out = append(out, 0)
+	w.buf = out[:0]
+	_, err = w.w.Write(out[n:])
+	return err
+}
+
+// A Reader reads sealed frames from a link.
+type Reader struct {
+	r   *bufio.Reader
+	rcv *acornradio.Receiver
+	max int
+	buf []byte
+}
+
+// NewReader returns a Reader that reads frames from r, each no more
+// than maxFrame bytes long, and opens them with rcv.
+func NewReader(r io.Reader, rcv *acornradio.Receiver, maxFrame int) *Reader {
+	return &Reader{r: bufio.NewReader(r), rcv: rcv, max: maxFrame}
+}
+
+// ReadFrame reads the next frame and returns its payload.
+// If the frame is too long, malformed, or not authentic, ReadFrame
+// returns an error, and the next call goes on to the following frame.
+func (r *Reader) ReadFrame() ([]byte, error) {
+	enc, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	if len(enc) == 0 {
+		return nil, errEmpty
+	}
+	sealed, err := Decode(nil, enc)
+	if err != nil {
+		return nil, err
+	}
+	payload, _, err := r.rcv.Open(nil, sealed)
+	return payload, err
+}
+
+// next returns the bytes up to the next zero byte.
+func (r *Reader) next() ([]byte, error) {
+	r.buf = r.buf[:0]
+	tooLong := false
+	for {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(r.buf) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if b == 0 {
+			break
+		}
+		if len(r.buf)+1 >= r.max {
+			tooLong = true
+			continue
+		}
+		r.buf = append(r.buf, b)
+	}
+	if tooLong {
+		return nil, ErrTooLong
+	}
+	return r.buf, nil
+}
@@ -0,0 +1,137 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornframe
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/magical/go-acorn/acornradio"
+)
+
+func seq(from, to int) []byte {
+	var b []byte
+	for i := from; i <= to; i++ {
+		b = append(b, byte(i))
+	}
+	return b
+}
+
+func cat(bs ...[]byte) []byte {
+	return bytes.Join(bs, nil)
+}
+
+// Examples from the Wikipedia article on COBS.
+var cobsTests = []struct {
+	in, out []byte
+}{
+	{nil, []byte{0x01}},
+	{[]byte{0x00}, []byte{0x01, 0x01}},
+	{[]byte{0x00, 0x00}, []byte{0x01, 0x01, 0x01}},
+	{[]byte{0x00, 0x11, 0x00}, []byte{0x01, 0x02, 0x11, 0x01}},
+	{[]byte{0x11, 0x22, 0x00, 0x33}, []byte{0x03, 0x11, 0x22, 0x02, 0x33}},
+	{[]byte{0x11, 0x22, 0x33, 0x44}, []byte{0x05, 0x11, 0x22, 0x33, 0x44}},
+	{[]byte{0x11, 0x00, 0x00, 0x00}, []byte{0x02, 0x11, 0x01, 0x01, 0x01}},
+	{seq(0x01, 0xfe), cat([]byte{0xff}, seq(0x01, 0xfe))},
+	{seq(0x00, 0xfe), cat([]byte{0x01, 0xff}, seq(0x01, 0xfe))},
+	{seq(0x01, 0xff), cat([]byte{0xff}, seq(0x01, 0xfe), []byte{0x02, 0xff})},
+	{cat(seq(0x02, 0xff), []byte{0x00}), cat([]byte{0xff}, seq(0x02, 0xff), []byte{0x01, 0x01})},
+	{cat(seq(0x03, 0xff), []byte{0x00, 0x01}), cat([]byte{0xfe}, seq(0x03, 0xff), []byte{0x02, 0x01})},
+}
+
+func TestCOBS(t *testing.T) {
+	for _, tt := range cobsTests {
+		enc := Encode(nil, tt.in)
+		if !bytes.Equal(enc, tt.out) {
+			t.Errorf("Encode(%x) = %x, want %x", tt.in, enc, tt.out)
+		}
+		if len(enc) > EncodedLen(len(tt.in)) {
+			t.Errorf("Encode(%x): length %d exceeds EncodedLen %d", tt.in, len(enc), EncodedLen(len(tt.in)))
+		}
+		dec, err := Decode(nil, enc)
+		if err != nil || !bytes.Equal(dec, tt.in) {
+			t.Errorf("Decode(%x) = %x, %v; want %x", enc, dec, err, tt.in)
+		}
+	}
+	for _, bad := range []string{"00", "03", "031100", "020001"} {
+		b, _ := hex.DecodeString(bad)
+		if _, err := Decode(nil, b); err == nil {
+			t.Errorf("Decode(%s) succeeded", bad)
+		}
+	}
+}
+
+var (
+	testKey     = []byte(strings.Repeat("password", 2))
+	testProfile = acornradio.Profile{CounterSize: 1, TagSize: 4, ShortTags: true}
+)
+
+func pair(t *testing.T, link io.ReadWriter, max int) (*Writer, *Reader) {
+	s, err := acornradio.NewSender(testKey, 42, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := acornradio.NewReceiver(testKey, 42, testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewWriter(link, s, max), NewReader(link, r, max)
+}
+
+func TestFrames(t *testing.T) {
+	var link bytes.Buffer
+	w, r := pair(t, &link, 64) // CAN-FD
+	if n := w.MaxPayload(); n != 64-1-1-6 {
+		t.Errorf("MaxPayload = %d", n)
+	}
+	msgs := [][]byte{{}, {0}, []byte("rpm=3000"), make([]byte, w.MaxPayload())}
+	for _, m := range msgs {
+		if err := w.WriteFrame(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.WriteFrame(make([]byte, w.MaxPayload()+1)); err != ErrTooLong {
+		t.Errorf("long payload: got error %v, want %v", err, ErrTooLong)
+	}
+	if bytes.Count(link.Bytes(), []byte{0}) != len(msgs) {
+		t.Errorf("link has %d zero bytes, want %d", bytes.Count(link.Bytes(), []byte{0}), len(msgs))
+	}
+	for i, m := range msgs {
+		got, err := r.ReadFrame()
+		if err != nil || !bytes.Equal(got, m) {
+			t.Errorf("frame %d: got %x, %v; want %x", i, got, err, m)
+		}
+	}
+	if _, err := r.ReadFrame(); err != io.EOF {
+		t.Errorf("got error %v, want EOF", err)
+	}
+}
+
+func TestResync(t *testing.T) {
+	var link bytes.Buffer
+	w, r := pair(t, &link, 16)
+	link.WriteString("noise")                  // joined partway through a frame
+	link.Write([]byte{0})                      // ...which ends here
+	link.Write(bytes.Repeat([]byte{0x55}, 40)) // an overlong frame
+	link.Write([]byte{0})
+	w.WriteFrame([]byte("a"))
+	link.Write([]byte{0}) // an empty frame
+	w.WriteFrame([]byte("b"))
+
+	var got []string
+	for {
+		p, err := r.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			got = append(got, string(p))
+		}
+	}
+	if strings.Join(got, ",") != "a,b" {
+		t.Errorf("got frames %q, want [a b]", got)
+	}
+}
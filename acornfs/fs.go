@@ -0,0 +1,136 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build go1.16
+// +build go1.16
+
+// Package acornfs provides a read-only fs.FS whose files are decrypted
+// on the fly from the acornstream format, so that embedded assets and
+// configuration trees can ship encrypted.
+//
+// Every regular file in the underlying file system must be an encrypted
+// stream with attached tags, under the same key and with the same name
+// as the plaintext file. Directories are passed through unchanged. Files
+// support Seek and ReadAt, decrypting only the chunks that are read; see
+// acornstream.SeekReader.
+//
+// For example, with the files encrypted by acornstream.EncryptDir or
+// the acorn command, and then embedded:
+//
+//	//go:embed assets
+//	var assets embed.FS
+//
+//	fsys := acornfs.New(assets, key)
+//	http.Handle("/", http.FileServer(http.FS(fsys)))
+package acornfs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"io/ioutil"
+
+	"github.com/magical/go-acorn/acornstream"
+)
+
+type encFS struct {
+	fsys fs.FS
+	key  []byte
+}
+
+// New returns a file system which decrypts the files of fsys with key.
+func New(fsys fs.FS, key []byte) fs.FS {
+	return &encFS{fsys: fsys, key: append([]byte(nil), key...)}
+}
+
+func (e *encFS) Open(name string) (fs.File, error) {
+	f, err := e.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		return &dir{File: f, fsys: e, name: name}, nil
+	}
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		// read it all, as there is no other way to seek
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			f.Close()
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		ra = bytes.NewReader(b)
+	}
+	s, err := acornstream.NewReaderAt(ra, info.Size(), e.key)
+	if err != nil {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &file{SeekReader: s, f: f, info: plainInfo{info, s.Size()}}, nil
+}
+
+// A file is an open encrypted file.
+type file struct {
+	*acornstream.SeekReader
+	f    fs.File
+	info fs.FileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return f.f.Close() }
+
+// plainInfo reports the plaintext size of an encrypted file.
+type plainInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (i plainInfo) Size() int64 { return i.size }
+
+// A dir is an open directory, whose entries report plaintext sizes.
+type dir struct {
+	fs.File
+	fsys *encFS
+	name string
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rd, ok := d.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: fs.ErrInvalid}
+	}
+	entries, err := rd.ReadDir(n)
+	for i, ent := range entries {
+		if !ent.IsDir() {
+			entries[i] = &dirEntry{DirEntry: ent, fsys: d.fsys, name: joinPath(d.name, ent.Name())}
+		}
+	}
+	return entries, err
+}
+
+type dirEntry struct {
+	fs.DirEntry
+	fsys *encFS
+	name string
+}
+
+// Info opens the file to find its plaintext size.
+func (d *dirEntry) Info() (fs.FileInfo, error) {
+	f, err := d.fsys.Open(d.name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+func joinPath(dir, name string) string {
+	if dir == "." {
+		return name
+	}
+	return dir + "/" + name
+}
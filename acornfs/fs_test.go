@@ -0,0 +1,108 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build go1.16
+// +build go1.16
+
+package acornfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/magical/go-acorn/acornstream"
+)
+
+var testKey = []byte(strings.Repeat("password", 2))
+
+func encrypt(t *testing.T, p string) []byte {
+	var buf bytes.Buffer
+	w, err := acornstream.NewWriterSize(&buf, testKey, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, p)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+var plain = map[string]string{
+	"config.json":      `{"debug": false}`,
+	"assets/empty.txt": "",
+	"assets/long.txt":  strings.Repeat("the quick brown fox ", 20),
+	"assets/img/a.svg": "<svg/>",
+}
+
+func testFS(t *testing.T) fstest.MapFS {
+	m := fstest.MapFS{}
+	for name, p := range plain {
+		m[name] = &fstest.MapFile{Data: encrypt(t, p), Mode: 0644}
+	}
+	return m
+}
+
+func TestFS(t *testing.T) {
+	fsys := New(testFS(t), testKey)
+	for name, p := range plain {
+		got, err := fs.ReadFile(fsys, name)
+		if err != nil || string(got) != p {
+			t.Errorf("ReadFile(%q) = %q, %v; want %q", name, got, err, p)
+		}
+	}
+	expected := make([]string, 0, len(plain))
+	for name := range plain {
+		expected = append(expected, name)
+	}
+	if err := fstest.TestFS(fsys, expected...); err != nil {
+		t.Error(err)
+	}
+
+	f, err := fsys.Open("assets/long.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.(io.Seeker).Seek(-4, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if rest, err := io.ReadAll(f); err != nil || string(rest) != "fox " {
+		t.Errorf("read after Seek = %q, %v", rest, err)
+	}
+}
+
+// noReaderAt hides the ReadAt method of the files of an fs.FS.
+type noReaderAt struct{ fs.FS }
+
+func (n noReaderAt) Open(name string) (fs.File, error) {
+	f, err := n.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ fs.File }{f}, nil
+}
+
+func TestNoReaderAt(t *testing.T) {
+	fsys := New(noReaderAt{testFS(t)}, testKey)
+	if got, err := fs.ReadFile(fsys, "config.json"); err != nil || string(got) != plain["config.json"] {
+		t.Errorf("ReadFile = %q, %v", got, err)
+	}
+}
+
+func TestTampered(t *testing.T) {
+	m := testFS(t)
+	m["config.json"].Data[acornstream.HeaderSize] ^= 1
+	_, err := New(m, testKey).Open("config.json")
+	if !errors.Is(err, acornstream.ErrAuthentication) {
+		t.Errorf("Open of a tampered file returned %v, want ErrAuthentication", err)
+	}
+	wrongKey := bytes.Repeat([]byte{1}, 16)
+	if _, err := New(testFS(t), wrongKey).Open("config.json"); !errors.Is(err, acornstream.ErrAuthentication) {
+		t.Errorf("Open under the wrong key returned %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornhttp encrypts HTTP request and response bodies with a
+// shared key, for service-to-service traffic on a network that is
+// mostly, but not entirely, trusted.
+//
+// Bodies are encrypted as acornstream streams, and marked with the
+// Content-Encoding Encoding. A Transport encrypts the bodies of the
+// requests it sends and decrypts the responses; Handler does the
+// reverse on the server.
+//
+// Only bodies are protected. Methods, URLs, headers, and status codes
+// are sent as they are, and a response is not bound to the request it
+// answers; use TLS if any of that matters.
+package acornhttp
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/magical/go-acorn/acornstream"
+)
+
+// Encoding is the Content-Encoding of an encrypted body.
+const Encoding = "x-acorn-stream"
+
+// chunkSize is small so that streamed bodies are not held back for long.
+const chunkSize = 16 * 1024
+
+var errPlaintext = errors.New("acornhttp: response body is not encrypted")
+
+// A Transport is an http.RoundTripper that encrypts request bodies
+// and decrypts response bodies.
+type Transport struct {
+	// Key is the 16-byte shared key.
+	Key []byte
+
+	// Base is the RoundTripper used to make requests.
+	// If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+// Requests without a body are sent as they are. Responses that may have
+// a body must be encrypted; RoundTrip returns an error for any that are not.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		req = t.encryptRequest(req)
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Header.Get("Content-Encoding") != Encoding {
+		if bodyAllowed(req.Method, resp.StatusCode) {
+			resp.Body.Close()
+			return nil, errPlaintext
+		}
+		return resp, nil
+	}
+	r, err := acornstream.NewReader(resp.Body, t.Key)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	resp.Body = readCloser{r, resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// encryptRequest returns a copy of req whose body is encrypted
+// as it is read by the transport.
+func (t *Transport) encryptRequest(req *http.Request) *http.Request {
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("Content-Encoding", Encoding)
+	r.ContentLength = -1
+	r.GetBody = nil
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer req.Body.Close()
+		w, err := acornstream.NewWriterSize(pw, t.Key, chunkSize)
+		if err == nil {
+			_, err = io.Copy(w, req.Body)
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	r.Body = pr
+	return r
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyAllowed reports whether a response to a request with the
+// given method may have a body with the given status.
+func bodyAllowed(method string, status int) bool {
+	switch {
+	case method == "HEAD":
+		return false
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// Handler returns a handler that decrypts request bodies, encrypts
+// response bodies, and otherwise calls h. Requests that have a body
+// must encrypt it; Handler rejects any that do not.
+func Handler(h http.Handler, key []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") == Encoding {
+			sr, err := acornstream.NewReader(r.Body, key)
+			if err != nil {
+				http.Error(w, "invalid encrypted body", http.StatusBadRequest)
+				return
+			}
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.Header = make(http.Header, len(r.Header))
+			for k, v := range r.Header {
+				r2.Header[k] = v
+			}
+			r2.Header.Del("Content-Encoding")
+			r2.Body = readCloser{sr, r.Body}
+			r2.ContentLength = -1
+			r = r2
+		} else if r.ContentLength != 0 {
+			http.Error(w, "request body must be encrypted", http.StatusUnsupportedMediaType)
+			return
+		}
+		ew := &responseWriter{w: w, key: key, method: r.Method}
+		h.ServeHTTP(ew, r)
+		ew.close()
+	})
+}
+
+// A responseWriter encrypts the body written to it.
+type responseWriter struct {
+	w           http.ResponseWriter
+	key         []byte
+	method      string
+	sw          *acornstream.Writer
+	wroteHeader bool
+	err         error
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.w.Header()
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if !bodyAllowed(w.method, status) {
+		w.w.WriteHeader(status)
+		return
+	}
+	h := w.w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", Encoding)
+	w.w.WriteHeader(status)
+	w.sw, w.err = acornstream.NewWriterSize(w.w, w.key, chunkSize)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.sw == nil {
+		// Let the underlying ResponseWriter report the error.
+		return w.w.Write(p)
+	}
+	return w.sw.Write(p)
+}
+
+func (w *responseWriter) close() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.sw != nil && w.err == nil {
+		w.sw.Close()
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornhttp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var testKey = []byte(strings.Repeat("password", 2))
+
+// echo replies with the request body, reversed in case.
+var echo = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/empty":
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case "/hello":
+		w.Header().Set("Content-Length", "5")
+		io.WriteString(w, "hello")
+		return
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Write(bytes.ToUpper(b))
+})
+
+func TestRoundTrip(t *testing.T) {
+	srv := httptest.NewServer(Handler(echo, testKey))
+	defer srv.Close()
+	client := &http.Client{Transport: &Transport{Key: testKey}}
+	for _, n := range []int{1, 100, chunkSize, 1 << 20} {
+		body := bytes.Repeat([]byte{'x'}, n)
+		resp, err := client.Post(srv.URL, "text/plain", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Errorf("len=%d: %v", n, err)
+		} else if want := bytes.ToUpper(body); !bytes.Equal(got, want) {
+			t.Errorf("len=%d: got %d bytes, want %d", n, len(got), len(want))
+		}
+	}
+
+	for _, path := range []string{"/hello", "/empty"} {
+		for _, method := range []string{"GET", "HEAD"} {
+			req, _ := http.NewRequest(method, srv.URL+path, nil)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Errorf("%s %s: %v", method, path, err)
+				continue
+			}
+			got, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			want := "hello"
+			if method == "HEAD" || path == "/empty" {
+				want = ""
+			}
+			if err != nil || string(got) != want {
+				t.Errorf("%s %s: got %q, %v; want %q", method, path, got, err, want)
+			}
+		}
+	}
+}
+
+func TestWireFormat(t *testing.T) {
+	var sawBody []byte
+	inner := httptest.NewServer(Handler(echo, testKey))
+	defer inner.Close()
+	// A proxy that records what crosses the network.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sawBody, _ = ioutil.ReadAll(r.Body)
+		req, _ := http.NewRequest(r.Method, inner.URL, bytes.NewReader(sawBody))
+		req.Header = r.Header
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer proxy.Close()
+	client := &http.Client{Transport: &Transport{Key: testKey}}
+	resp, err := client.Post(proxy.URL, "text/plain", strings.NewReader("attack at dawn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(got) != "ATTACK AT DAWN" {
+		t.Errorf("got %q", got)
+	}
+	if bytes.Contains(sawBody, []byte("attack")) {
+		t.Errorf("plaintext visible on the wire: %q", sawBody)
+	}
+}
+
+func TestReject(t *testing.T) {
+	srv := httptest.NewServer(Handler(echo, testKey))
+	defer srv.Close()
+
+	// plaintext request body
+	resp, err := http.Post(srv.URL, "text/plain", strings.NewReader("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("plaintext request: got status %d", resp.StatusCode)
+	}
+
+	// plaintext response body
+	plain := httptest.NewServer(echo)
+	defer plain.Close()
+	client := &http.Client{Transport: &Transport{Key: testKey}}
+	if _, err := client.Get(plain.URL + "/hello"); err == nil {
+		t.Error("plaintext response accepted")
+	}
+
+	// wrong key
+	wrong := &http.Client{Transport: &Transport{Key: []byte(strings.Repeat("PASSWORD", 2))}}
+	resp, err = wrong.Get(srv.URL + "/hello")
+	if err == nil {
+		_, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if err == nil {
+		t.Error("response with wrong key accepted")
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornjson defines a JSON envelope for ACORN-128 ciphertexts,
+// for systems that need to embed them in JSON documents.
+//
+// An envelope is a JSON object such as
+//
+//	{
+//	  "alg": "ACORN-128",
+//	  "kid": "AQIDBAUGBwg",
+//	  "nonce": "b0Mc2zKhDRFk6ArKEZ2R0A",
+//	  "ct": "q3w6MCKb",
+//	  "tag": "hYIw-nGJ9Qp9yQhU9W5hvA"
+//	}
+//
+// where every field but alg is unpadded URL-safe base64. The algorithm
+// and key ID are passed as additional data, along with any additional
+// data supplied by the caller, so they cannot be changed without
+// detection. The additional data does not depend on how the JSON is
+// written, so envelopes survive being re-encoded with fields reordered
+// or whitespace changed.
+//
+// Keys are held by an agent.Agent and looked up by key ID.
+//
+// A Codec uses envelopes to encrypt individual fields of a struct,
+// chosen with struct tags, as it is marshaled to JSON.
+package acornjson
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/magical/go-acorn"
+	"github.com/magical/go-acorn/agent"
+)
+
+// Alg is the value of the alg field.
+const Alg = "ACORN-128"
+
+var (
+	ErrInvalid        = errors.New("acornjson: invalid envelope")
+	ErrAuthentication = errors.New("acornjson: message authentication failed")
+)
+
+var encoding = base64.RawURLEncoding.Strict()
+
+// An Envelope holds a sealed message.
+type Envelope struct {
+	KeyID      [8]byte
+	Nonce      []byte
+	Ciphertext []byte
+	Tag        []byte
+}
+
+type envelopeJSON struct {
+	Alg   string `json:"alg"`
+	KeyID string `json:"kid"`
+	Nonce string `json:"nonce"`
+	CT    string `json:"ct"`
+	Tag   string `json:"tag"`
+}
+
+// Seal seals plaintext with the agent's key keyID and a random nonce.
+// The same additional data must be passed to Open.
+func Seal(a agent.Agent, keyID [8]byte, plaintext, additionalData []byte) (*Envelope, error) {
+	nonce, err := acorn.GenerateNonce(nil)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := a.Seal(keyID, nonce, plaintext, envelopeAD(keyID, additionalData))
+	if err != nil {
+		return nil, err
+	}
+	n := len(sealed) - acorn.TagSize
+	return &Envelope{
+		KeyID:      keyID,
+		Nonce:      nonce,
+		Ciphertext: sealed[:n:n],
+		Tag:        sealed[n:],
+	}, nil
+}
+
+// Open opens the envelope with the agent's key e.KeyID.
+func (e *Envelope) Open(a agent.Agent, additionalData []byte) ([]byte, error) {
+	if len(e.Nonce) != acorn.NonceSize || len(e.Tag) != acorn.TagSize {
+		return nil, ErrInvalid
+	}
+	sealed := make([]byte, 0, len(e.Ciphertext)+acorn.TagSize)
+	sealed = append(sealed, e.Ciphertext...)
+	sealed = append(sealed, e.Tag...)
+	p, err := a.Open(e.KeyID, e.Nonce, sealed, envelopeAD(e.KeyID, additionalData))
+	if err == agent.ErrNotFound {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+	return p, nil
+}
+
+// envelopeAD returns the additional data for an envelope:
+// the algorithm name, a zero byte, the key ID, and the caller's data.
+func envelopeAD(keyID [8]byte, additionalData []byte) []byte {
+	ad := make([]byte, 0, len(Alg)+1+len(keyID)+len(additionalData))
+	ad = append(ad, Alg...)
+	ad = append(ad, 0)
+	ad = append(ad, keyID[:]...)
+	return append(ad, additionalData...)
+}
+
+// MarshalJSON encodes the envelope as a JSON object.
+func (e *Envelope) MarshalJSON() ([]byte, error) {
+	return json.Marshal(envelopeJSON{
+		Alg:   Alg,
+		KeyID: encoding.EncodeToString(e.KeyID[:]),
+		Nonce: encoding.EncodeToString(e.Nonce),
+		CT:    encoding.EncodeToString(e.Ciphertext),
+		Tag:   encoding.EncodeToString(e.Tag),
+	})
+}
+
+// UnmarshalJSON decodes an envelope from a JSON object.
+// It requires every field, with alg set to Alg, and rejects unknown ones.
+func (e *Envelope) UnmarshalJSON(data []byte) error {
+	var v envelopeJSON
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&v); err != nil {
+		return ErrInvalid
+	}
+	if v.Alg != Alg {
+		return ErrInvalid
+	}
+	var env Envelope
+	kid, err1 := encoding.DecodeString(v.KeyID)
+	nonce, err2 := encoding.DecodeString(v.Nonce)
+	ct, err3 := encoding.DecodeString(v.CT)
+	tag, err4 := encoding.DecodeString(v.Tag)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return ErrInvalid
+	}
+	if len(kid) != len(env.KeyID) || len(nonce) != acorn.NonceSize || len(tag) != acorn.TagSize {
+		return ErrInvalid
+	}
+	copy(env.KeyID[:], kid)
+	env.Nonce, env.Ciphertext, env.Tag = nonce, ct, tag
+	*e = env
+	return nil
+}
+
+// Marshal seals plaintext like Seal and returns the envelope as JSON.
+func Marshal(a agent.Agent, keyID [8]byte, plaintext, additionalData []byte) ([]byte, error) {
+	e, err := Seal(a, keyID, plaintext, additionalData)
+	if err != nil {
+		return nil, err
+	}
+	return e.MarshalJSON()
+}
+
+// Unmarshal decodes a JSON envelope and opens it.
+func Unmarshal(a agent.Agent, data, additionalData []byte) ([]byte, error) {
+	var e Envelope
+	if err := e.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return e.Open(a, additionalData)
+}
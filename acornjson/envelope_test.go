@@ -0,0 +1,177 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornjson
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/magical/go-acorn/agent"
+)
+
+var (
+	testID  = [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	testKey = []byte(strings.Repeat("password", 2))
+)
+
+func testKeyring() agent.Agent {
+	r := agent.NewKeyring()
+	r.Add(testID, testKey)
+	return r
+}
+
+func TestRoundTrip(t *testing.T) {
+	r := testKeyring()
+	data, err := Marshal(r, testID, []byte("secret"), []byte("record 7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Unmarshal(r, data, []byte("record 7"))
+	if err != nil || string(p) != "secret" {
+		t.Errorf("got %q, %v", p, err)
+	}
+	if _, err := Unmarshal(r, data, []byte("record 8")); err != ErrAuthentication {
+		t.Errorf("wrong additional data: got error %v, want %v", err, ErrAuthentication)
+	}
+	if _, err := Unmarshal(agent.NewKeyring(), data, []byte("record 7")); err != agent.ErrNotFound {
+		t.Errorf("unknown key: got error %v, want %v", err, agent.ErrNotFound)
+	}
+}
+
+func TestReorder(t *testing.T) {
+	r := testKeyring()
+	data, err := Marshal(r, testID, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Round trip through a map, which sorts the keys,
+	// and embed the envelope in a larger document.
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := json.MarshalIndent(map[string]interface{}{"id": 7, "secret": m}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		ID     int
+		Secret *Envelope
+	}
+	if err := json.Unmarshal(doc, &v); err != nil {
+		t.Fatal(err)
+	}
+	p, err := v.Secret.Open(r, nil)
+	if err != nil || string(p) != "secret" {
+		t.Errorf("got %q, %v", p, err)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	r := testKeyring()
+	data, err := Marshal(r, testID, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]string
+	json.Unmarshal(data, &m)
+	edit := func(f func(map[string]string)) []byte {
+		c := make(map[string]string)
+		for k, v := range m {
+			c[k] = v
+		}
+		f(c)
+		b, _ := json.Marshal(c)
+		return b
+	}
+	for _, bad := range [][]byte{
+		[]byte(`{}`),
+		[]byte(`[]`),
+		edit(func(c map[string]string) { c["alg"] = "AES-GCM" }),
+		edit(func(c map[string]string) { delete(c, "tag") }),
+		edit(func(c map[string]string) { c["extra"] = "" }),
+		edit(func(c map[string]string) { c["nonce"] = c["nonce"][1:] }),
+		edit(func(c map[string]string) { c["kid"] = c["kid"] + "A" }),
+		edit(func(c map[string]string) { c["ct"] = c["ct"] + "==" }),
+	} {
+		if _, err := Unmarshal(r, bad, nil); err != ErrInvalid {
+			t.Errorf("%s: got error %v, want %v", bad, err, ErrInvalid)
+		}
+	}
+	// A different kid names a different key, and so fails to authenticate.
+	r.Add([8]byte{9}, testKey)
+	other := edit(func(c map[string]string) { c["kid"] = "CQAAAAAAAAA" })
+	if _, err := Unmarshal(r, other, nil); err != ErrAuthentication {
+		t.Errorf("changed kid: got error %v, want %v", err, ErrAuthentication)
+	}
+}
+
+type Contact struct {
+	Email string `json:"email" acorn:"encrypt"`
+	Phone string `json:"phone,omitempty" acorn:"encrypt"`
+}
+
+type Audit struct {
+	Note string `acorn:"encrypt"`
+}
+
+type user struct {
+	Audit
+	Name    string   `json:"name"`
+	SSN     string   `json:"ssn" acorn:"encrypt"`
+	Tags    []string `json:"tags" acorn:"encrypt"`
+	Home    Contact  `json:"home"`
+	Work    *Contact `json:"work"`
+	Skipped string   `json:"-" acorn:"encrypt"`
+}
+
+func TestCodec(t *testing.T) {
+	c := &Codec{Agent: testKeyring(), KeyID: testID}
+	in := user{
+		Audit: Audit{Note: "vip"},
+		Name:  "Ann",
+		SSN:   "123-45-6789",
+		Tags:  []string{"a", "b"},
+		Home:  Contact{Email: "ann@example.com", Phone: "555-0100"},
+	}
+	data, err := c.Marshal(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"vip", "123-45-6789", `"a"`, "ann@example.com", "555-0100"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("%q appears in the output: %s", secret, data)
+		}
+	}
+	if !strings.Contains(string(data), `"name":"Ann"`) || !strings.Contains(string(data), `"work":null`) {
+		t.Errorf("unencrypted fields are missing: %s", data)
+	}
+	var out user
+	if err := c.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip gave %+v, want %+v", out, in)
+	}
+
+	// moving an encrypted value to another field is detected
+	var m map[string]json.RawMessage
+	json.Unmarshal(data, &m)
+	var home map[string]json.RawMessage
+	json.Unmarshal(m["home"], &home)
+	m["ssn"] = home["email"]
+	moved, _ := json.Marshal(m)
+	if err := c.Unmarshal(moved, &out); err != ErrAuthentication {
+		t.Errorf("Unmarshal with a moved field returned %v, want ErrAuthentication", err)
+	}
+	m["ssn"] = json.RawMessage(`"123-45-6789"`)
+	plain, _ := json.Marshal(m)
+	if err := c.Unmarshal(plain, &out); err != ErrInvalid {
+		t.Errorf("Unmarshal with a plaintext field returned %v, want ErrInvalid", err)
+	}
+	if _, err := c.Marshal("not a struct"); err == nil {
+		t.Errorf("Marshal of a string succeeded")
+	}
+}
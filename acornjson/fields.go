@@ -0,0 +1,165 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornjson
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/magical/go-acorn/agent"
+)
+
+// A Codec marshals structs to JSON with some fields encrypted.
+// A field tagged
+//
+//	SSN string `json:"ssn" acorn:"encrypt"`
+//
+// is marshaled as usual, and then sealed into an envelope which takes
+// its place in the document. Each field gets its own nonce, and its
+// envelope records the key ID, so a document can be decrypted after the
+// Codec has moved on to a newer key. The field's path in the document,
+// such as "user.ssn", is the additional data, so encrypted values cannot
+// be moved from one field to another without detection.
+//
+// Tags are honored in the top-level struct, in nested structs and
+// pointers to structs, and in embedded structs. Fields inside slices
+// and maps are not examined, though a tagged slice or map is encrypted
+// as a whole.
+type Codec struct {
+	Agent agent.Agent
+	KeyID [8]byte // the key to seal with
+}
+
+// errNotStruct is returned for values which are not structs.
+var errNotStruct = errors.New("acornjson: Codec needs a struct or pointer to struct")
+
+// Marshal returns the JSON encoding of v, which must be a struct or a
+// pointer to one, with its tagged fields encrypted. The fields of the
+// result are in sorted order.
+func (c *Codec) Marshal(v interface{}) ([]byte, error) {
+	t := structType(reflect.TypeOf(v))
+	if t == nil {
+		return nil, errNotStruct
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	out, err := c.walk(t, data, "", c.sealField)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Unmarshal decrypts the tagged fields of data, which must have been
+// encoded by Marshal for the same type, and unmarshals it into v.
+// It returns ErrInvalid if a tagged field is not an envelope.
+func (c *Codec) Unmarshal(data []byte, v interface{}) error {
+	t := structType(reflect.TypeOf(v))
+	if t == nil {
+		return errNotStruct
+	}
+	plain, err := c.walk(t, data, "", c.openField)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plain, v)
+}
+
+func (c *Codec) sealField(path string, value json.RawMessage) (json.RawMessage, error) {
+	e, err := Seal(c.Agent, c.KeyID, value, []byte(path))
+	if err != nil {
+		return nil, err
+	}
+	return e.MarshalJSON()
+}
+
+func (c *Codec) openField(path string, value json.RawMessage) (json.RawMessage, error) {
+	var e Envelope
+	if err := e.UnmarshalJSON(value); err != nil {
+		return nil, err
+	}
+	return e.Open(c.Agent, []byte(path))
+}
+
+// walk applies f to the tagged fields of the JSON object data, which
+// encodes a value of type t, and returns the object with their results
+// in their place.
+func (c *Codec) walk(t reflect.Type, data []byte, prefix string, f func(string, json.RawMessage) (json.RawMessage, error)) ([]byte, error) {
+	if string(data) == "null" {
+		return data, nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, ErrInvalid
+	}
+	if err := c.walkFields(t, m, prefix, f); err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+func (c *Codec) walkFields(t reflect.Type, m map[string]json.RawMessage, prefix string, f func(string, json.RawMessage) (json.RawMessage, error)) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := jsonName(field)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			// an embedded struct, whose fields are promoted
+			if err := c.walkFields(structType(field.Type), m, prefix, f); err != nil {
+				return err
+			}
+			continue
+		}
+		value, present := m[name]
+		if !present {
+			continue // omitempty
+		}
+		var err error
+		if field.Tag.Get("acorn") == "encrypt" {
+			m[name], err = f(prefix+name, value)
+		} else if st := structType(field.Type); st != nil {
+			m[name], err = c.walk(st, value, prefix+name+".", f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonName returns the name encoding/json uses for a field, or "" for
+// an embedded struct without a name, and false for a field it skips.
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name := strings.Split(tag, ",")[0]
+	if field.Anonymous && name == "" && structType(field.Type) != nil {
+		return "", true
+	}
+	if field.PkgPath != "" {
+		return "", false // unexported
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, true
+}
+
+// structType returns t, or the type t points to, if it is a struct.
+func structType(t reflect.Type) reflect.Type {
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,233 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornkms implements envelope encryption with ACORN-128.
+//
+// Each message is sealed locally under a new random data key, and the
+// data key is wrapped with a key-encryption key (KEK), which is typically
+// held by a cloud key management service and never leaves it. Only the
+// short data key makes the round trip to the KMS, however long the
+// message is. Implementations of KEK adapt a KMS client; NewLocalKEK
+// provides one backed by an ACORN-128 master key held in memory.
+//
+// A sealed envelope is a single self-describing blob:
+//
+//	magic "ACKE" || version byte (1)
+//	|| KEK name length uint16 || KEK name
+//	|| wrapped key length uint16 || wrapped key
+//	|| nonce [16]byte || ciphertext || tag [16]byte
+//
+// with lengths big-endian. Everything before the ciphertext is passed
+// as additional data, followed by any additional data supplied by the
+// caller, so neither the KEK name nor the wrapped key can be swapped.
+package acornkms
+
+import (
+	"context"
+	"crypto/cipher"
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/magical/go-acorn"
+)
+
+// A KEK is a key-encryption key, which wraps and unwraps data keys.
+// Its methods may be called concurrently.
+type KEK interface {
+	// Name identifies the KEK, such as by a KMS key resource name.
+	// It is recorded in envelopes, and must be at most 65535 bytes.
+	Name() string
+
+	// Wrap encrypts a data key.
+	Wrap(ctx context.Context, dataKey []byte) ([]byte, error)
+
+	// Unwrap decrypts a data key returned by Wrap.
+	Unwrap(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+var (
+	ErrInvalid        = errors.New("acornkms: invalid envelope")
+	ErrAuthentication = errors.New("acornkms: message authentication failed")
+	ErrWrongKEK       = errors.New("acornkms: envelope was sealed with a different KEK")
+)
+
+var magic = [4]byte{'A', 'C', 'K', 'E'}
+
+const version = 1
+
+// An Envelope seals and opens messages with envelope encryption.
+type Envelope struct {
+	KEK KEK
+}
+
+// Seal seals plaintext under a new data key, wraps the data key with
+// the KEK, and returns the envelope. The same additional data must be
+// passed to Open.
+func (e *Envelope) Seal(ctx context.Context, plaintext, additionalData []byte) ([]byte, error) {
+	name := e.KEK.Name()
+	if len(name) > 0xffff {
+		return nil, errors.New("acornkms: KEK name too long")
+	}
+	dataKey := make([]byte, acorn.KeySize)
+	defer wipe(dataKey)
+	if _, err := io.ReadFull(cryptorand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	wrapped, err := e.KEK.Wrap(ctx, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) > 0xffff {
+		return nil, errors.New("acornkms: wrapped key too long")
+	}
+	hlen := len(magic) + 1 + 2 + len(name) + 2 + len(wrapped) + acorn.NonceSize
+	out := make([]byte, 0, hlen+len(plaintext)+acorn.TagSize)
+	out = append(out, magic[:]...)
+	out = append(out, version)
+	out = appendString(out, []byte(name))
+	out = appendString(out, wrapped)
+	out = out[:hlen]
+	nonce := out[hlen-acorn.NonceSize:]
+	if _, err := io.ReadFull(cryptorand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	a := acorn.NewAEAD(dataKey)
+	return a.Seal(out, nonce, plaintext, envelopeAD(out, additionalData)), nil
+}
+
+// Open unwraps the data key of an envelope returned by Seal,
+// and returns the plaintext. It returns ErrWrongKEK if the envelope
+// was sealed with a KEK of another name, and ErrAuthentication if it
+// has been altered.
+func (e *Envelope) Open(ctx context.Context, envelope, additionalData []byte) ([]byte, error) {
+	h, err := parse(envelope)
+	if err != nil {
+		return nil, err
+	}
+	if h.name != e.KEK.Name() {
+		return nil, ErrWrongKEK
+	}
+	dataKey, err := e.KEK.Unwrap(ctx, h.wrapped)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(dataKey)
+	if len(dataKey) != acorn.KeySize {
+		return nil, ErrAuthentication
+	}
+	a := acorn.NewAEAD(dataKey)
+	pt, err := a.Open(nil, h.nonce, envelope[len(h.raw):], envelopeAD(h.raw, additionalData))
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+	return pt, nil
+}
+
+// KEKName returns the name of the KEK that an envelope was sealed with,
+// so that callers with several KEKs can pick the one to open it with.
+func KEKName(envelope []byte) (string, error) {
+	h, err := parse(envelope)
+	if err != nil {
+		return "", err
+	}
+	return h.name, nil
+}
+
+type header struct {
+	raw     []byte // everything up to the ciphertext
+	name    string
+	wrapped []byte
+	nonce   []byte
+}
+
+func parse(b []byte) (*header, error) {
+	if len(b) < len(magic)+1 || string(b[:len(magic)]) != string(magic[:]) || b[len(magic)] != version {
+		return nil, ErrInvalid
+	}
+	rest := b[len(magic)+1:]
+	name, rest, ok := readString(rest)
+	if !ok {
+		return nil, ErrInvalid
+	}
+	wrapped, rest, ok := readString(rest)
+	if !ok || len(rest) < acorn.NonceSize+acorn.TagSize {
+		return nil, ErrInvalid
+	}
+	n := len(b) - len(rest) + acorn.NonceSize
+	return &header{
+		raw:     b[:n:n],
+		name:    string(name),
+		wrapped: wrapped,
+		nonce:   rest[:acorn.NonceSize],
+	}, nil
+}
+
+func appendString(b, s []byte) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+func readString(b []byte) (s, rest []byte, ok bool) {
+	if len(b) < 2 {
+		return nil, nil, false
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return nil, nil, false
+	}
+	return b[2 : 2+n], b[2+n:], true
+}
+
+// envelopeAD returns the additional data for the payload.
+func envelopeAD(header, additionalData []byte) []byte {
+	ad := make([]byte, 0, len(header)+len(additionalData))
+	ad = append(ad, header...)
+	return append(ad, additionalData...)
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// localKEK is a KEK held in memory.
+type localKEK struct {
+	name string
+	aead cipher.AEAD
+}
+
+// NewLocalKEK returns a KEK which wraps data keys with ACORN-128 under
+// the given 128-bit master key. It is for development, tests, and
+// systems without a KMS. If the key is not the correct length,
+// NewLocalKEK will panic.
+func NewLocalKEK(name string, key []byte) KEK {
+	return &localKEK{name: name, aead: acorn.NewAEAD(key)}
+}
+
+func (k *localKEK) Name() string { return k.name }
+
+// ad binds wrapped keys to the KEK's name.
+func (k *localKEK) ad() []byte {
+	return append([]byte("acornkms local kek\x00"), k.name...)
+}
+
+func (k *localKEK) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	nonce, err := acorn.GenerateNonce(nil)
+	if err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(nonce, nonce, dataKey, k.ad()), nil
+}
+
+func (k *localKEK) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < acorn.NonceSize+acorn.TagSize {
+		return nil, ErrAuthentication
+	}
+	dataKey, err := k.aead.Open(nil, wrapped[:acorn.NonceSize], wrapped[acorn.NonceSize:], k.ad())
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+	return dataKey, nil
+}
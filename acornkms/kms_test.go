@@ -0,0 +1,76 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornkms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+var ctx = context.Background()
+
+func TestEnvelope(t *testing.T) {
+	kek := NewLocalKEK("local/test", []byte("0123456789abcdef"))
+	e := &Envelope{KEK: kek}
+	msg, ad := []byte("the payload"), []byte("record 7")
+	blob, err := e.Seal(ctx, msg, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, err := KEKName(blob); err != nil || name != "local/test" {
+		t.Errorf("KEKName = %q, %v", name, err)
+	}
+	got, err := e.Open(ctx, blob, ad)
+	if err != nil || !bytes.Equal(got, msg) {
+		t.Fatalf("Open = %q, %v", got, err)
+	}
+	if _, err := e.Open(ctx, blob, nil); err != ErrAuthentication {
+		t.Errorf("Open with the wrong additional data returned %v", err)
+	}
+
+	// every byte is authenticated, including the header
+	for i := range blob {
+		bad := append([]byte(nil), blob...)
+		bad[i] ^= 1
+		if _, err := e.Open(ctx, bad, ad); err == nil {
+			t.Errorf("Open succeeded with byte %d altered", i)
+		}
+	}
+	for n := 0; n < len(blob); n++ {
+		if _, err := e.Open(ctx, blob[:n], ad); err == nil {
+			t.Errorf("Open succeeded with %d bytes", n)
+		}
+	}
+
+	// a KEK with another name is refused before it is asked to unwrap
+	other := &Envelope{KEK: NewLocalKEK("local/other", []byte("0123456789abcdef"))}
+	if _, err := other.Open(ctx, blob, ad); err != ErrWrongKEK {
+		t.Errorf("Open with another KEK returned %v", err)
+	}
+	// and one with the same name but another key can't unwrap
+	wrong := &Envelope{KEK: NewLocalKEK("local/test", []byte("fedcba9876543210"))}
+	if _, err := wrong.Open(ctx, blob, ad); err != ErrAuthentication {
+		t.Errorf("Open with the wrong key returned %v", err)
+	}
+}
+
+// failKEK is a KEK whose service is down.
+type failKEK struct{}
+
+var errDown = errors.New("kms is down")
+
+func (failKEK) Name() string { return "remote" }
+func (failKEK) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	return nil, errDown
+}
+func (failKEK) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	return nil, errDown
+}
+
+func TestKEKError(t *testing.T) {
+	if _, err := (&Envelope{KEK: failKEK{}}).Seal(ctx, []byte("x"), nil); err != errDown {
+		t.Errorf("Seal returned %v, want the KEK's error", err)
+	}
+}
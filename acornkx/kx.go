@@ -0,0 +1,171 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build go1.20
+// +build go1.20
+
+// Package acornkx sets up an encrypted session between two parties
+// with an ephemeral X25519 key exchange.
+//
+// Each side sends a fresh 32-byte X25519 public key. Both compute the
+// shared secret and derive session keys and starting nonces with
+// HKDF-SHA256, using the shared secret as the input keying material,
+// pubC || pubS as the salt, and "acornkx v1" as the info. The output is
+// split into keys and starting nonces as in package acornpsk, followed
+// by a 16-byte session ID.
+//
+// The exchange is anonymous: it keeps out passive eavesdroppers, but
+// an active attacker can sit in the middle and talk to each side
+// separately. Authenticate the session by other means, such as by
+// checking Session.ID over a trusted channel, or by running acornpsk
+// inside it.
+//
+// The package requires Go 1.20 or later, for crypto/ecdh.
+package acornkx
+
+import (
+	"crypto/cipher"
+	"crypto/ecdh"
+	cryptorand "crypto/rand"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/magical/go-acorn"
+	"github.com/magical/go-acorn/acornpsk"
+	"github.com/magical/go-acorn/internal/hkdf"
+)
+
+const info = "acornkx v1"
+
+// PublicKeySize is the length of the public keys exchanged.
+const PublicKeySize = 32
+
+var (
+	ErrAuthentication = errors.New("acornkx: message authentication failed")
+	errPublicKey      = errors.New("acornkx: invalid public key")
+	errSequence       = errors.New("acornkx: sequence number exhausted")
+)
+
+// A Session seals messages to and opens messages from the peer.
+// Messages must be opened in the order they were sealed, so a Session
+// suits transports, like TCP, that deliver messages reliably and in order.
+//
+// Seal and Open may be called concurrently with each other,
+// but not with themselves.
+type Session struct {
+	// ID identifies the session. Both sides have the same ID, and an
+	// attacker in the middle cannot make them match, so comparing it
+	// over a trusted channel authenticates the session.
+	ID [16]byte
+
+	// Keys holds the session keys and starting nonces.
+	Keys acornpsk.Session
+
+	send, recv direction
+}
+
+type direction struct {
+	mu    sync.Mutex
+	aead  cipher.AEAD
+	start [acorn.NonceSize]byte
+	seq   uint64
+}
+
+// Client runs the client side of the exchange over rw.
+func Client(rw io.ReadWriter) (*Session, error) {
+	return exchange(rw, true)
+}
+
+// Server runs the server side of the exchange over rw.
+func Server(rw io.ReadWriter) (*Session, error) {
+	return exchange(rw, false)
+}
+
+func exchange(rw io.ReadWriter, client bool) (*Session, error) {
+	priv, err := ecdh.X25519().GenerateKey(cryptorand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ours := priv.PublicKey().Bytes()
+	theirs := make([]byte, PublicKeySize)
+	if client {
+		if _, err := rw.Write(ours); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(rw, theirs); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := io.ReadFull(rw, theirs); err != nil {
+			return nil, err
+		}
+		if _, err := rw.Write(ours); err != nil {
+			return nil, err
+		}
+	}
+	peer, err := ecdh.X25519().NewPublicKey(theirs)
+	if err != nil {
+		return nil, errPublicKey
+	}
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		// the peer sent a low-order point
+		return nil, errPublicKey
+	}
+	pubC, pubS := ours, theirs
+	if !client {
+		pubC, pubS = theirs, ours
+	}
+	salt := append(append([]byte(nil), pubC...), pubS...)
+	b := hkdf.Key(shared, salt, []byte(info), 5*16)
+	c2s, s2c := b[0:16], b[16:32]
+	s := new(Session)
+	copy(s.ID[:], b[64:80])
+	if client {
+		s.Keys.SendKey, s.Keys.RecvKey = c2s, s2c
+		copy(s.Keys.SendNonce[:], b[32:48])
+		copy(s.Keys.RecvNonce[:], b[48:64])
+	} else {
+		s.Keys.SendKey, s.Keys.RecvKey = s2c, c2s
+		copy(s.Keys.SendNonce[:], b[48:64])
+		copy(s.Keys.RecvNonce[:], b[32:48])
+	}
+	s.send.aead = acorn.NewAEAD(s.Keys.SendKey)
+	s.send.start = s.Keys.SendNonce
+	s.recv.aead = acorn.NewAEAD(s.Keys.RecvKey)
+	s.recv.start = s.Keys.RecvNonce
+	return s, nil
+}
+
+// Seal seals the next message to the peer, appends it to dst,
+// and returns the updated slice.
+func (s *Session) Seal(dst, plaintext, additionalData []byte) ([]byte, error) {
+	d := &s.send
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.seq == ^uint64(0) {
+		return dst, errSequence
+	}
+	nonce := acornpsk.Nonce(d.start, d.seq)
+	d.seq++
+	return d.aead.Seal(dst, nonce[:], plaintext, additionalData), nil
+}
+
+// Open opens the next message from the peer, appends it to dst,
+// and returns the updated slice. A message that fails to open does
+// not use up a sequence number.
+func (s *Session) Open(dst, ciphertext, additionalData []byte) ([]byte, error) {
+	d := &s.recv
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.seq == ^uint64(0) {
+		return dst, errSequence
+	}
+	nonce := acornpsk.Nonce(d.start, d.seq)
+	out, err := d.aead.Open(dst, nonce[:], ciphertext, additionalData)
+	if err != nil {
+		return dst, ErrAuthentication
+	}
+	d.seq++
+	return out, nil
+}
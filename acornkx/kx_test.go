@@ -0,0 +1,91 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build go1.20
+// +build go1.20
+
+package acornkx
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func exchangePair(t *testing.T) (c, s *Session) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	done := make(chan error)
+	go func() {
+		var err error
+		s, err = Server(b)
+		done <- err
+	}()
+	c, err := Client(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	return c, s
+}
+
+func TestExchange(t *testing.T) {
+	c, s := exchangePair(t)
+	if c.ID != s.ID {
+		t.Errorf("IDs differ: %x != %x", c.ID, s.ID)
+	}
+	if !bytes.Equal(c.Keys.SendKey, s.Keys.RecvKey) || c.Keys.SendNonce != s.Keys.RecvNonce {
+		t.Error("client send keys do not match server receive keys")
+	}
+	for i, msg := range []string{"hello", "", "world"} {
+		ct, err := c.Seal(nil, []byte(msg), []byte("ad"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.Open(nil, ct, []byte("ad"))
+		if err != nil || string(got) != msg {
+			t.Errorf("message %d: got %q, %v", i, got, err)
+		}
+		reply, _ := s.Seal(nil, []byte(msg), nil)
+		if got, err := c.Open(nil, reply, nil); err != nil || string(got) != msg {
+			t.Errorf("reply %d: got %q, %v", i, got, err)
+		}
+	}
+	c2, _ := exchangePair(t)
+	if c2.ID == c.ID {
+		t.Error("two exchanges gave the same session")
+	}
+}
+
+func TestReject(t *testing.T) {
+	c, s := exchangePair(t)
+	m0, _ := c.Seal(nil, []byte("first"), nil)
+	m1, _ := c.Seal(nil, []byte("second"), nil)
+	if _, err := s.Open(nil, m1, nil); err != ErrAuthentication {
+		t.Errorf("out of order: got error %v, want %v", err, ErrAuthentication)
+	}
+	if _, err := c.Open(nil, m0, nil); err != ErrAuthentication {
+		t.Errorf("reflected: got error %v, want %v", err, ErrAuthentication)
+	}
+	if _, err := s.Open(nil, m0, nil); err != nil {
+		t.Errorf("first message: %v", err)
+	}
+	if _, err := s.Open(nil, m0, nil); err != ErrAuthentication {
+		t.Errorf("replayed: got error %v, want %v", err, ErrAuthentication)
+	}
+}
+
+func TestLowOrderPoint(t *testing.T) {
+	a, b := net.Pipe()
+	go func() {
+		buf := make([]byte, PublicKeySize)
+		a.Read(buf)
+		a.Write(make([]byte, PublicKeySize)) // the identity point
+		a.Close()
+	}()
+	if _, err := Client(b); err != errPublicKey {
+		t.Errorf("got error %v, want %v", err, errPublicKey)
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornlock
+
+import (
+	"os"
+	"syscall"
+)
+
+// madvDontdump is MADV_DONTDUMP, which the syscall
+// package does not define on every architecture.
+const madvDontdump = 0x10
+
+// dontDump leaves b out of core dumps.
+func dontDump(b []byte) error {
+	if err := syscall.Madvise(b, madvDontdump); err != nil {
+		return os.NewSyscallError("madvise", err)
+	}
+	return nil
+}
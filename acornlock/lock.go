@@ -0,0 +1,70 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornlock provides an acorn.KeyStore which keeps keys in
+// locked, guarded memory, for use with acorn.NewAEADStore.
+//
+// Each key gets its own mapping of three pages. The middle page holds
+// the key, pressed against the end of it, and is locked into RAM so it
+// is never written to swap. The pages on either side are made
+// inaccessible, so that a stray read or write past the key faults
+// instead of reaching it. On Linux, the key page is also left out of
+// core dumps.
+//
+// This is supported on Linux and macOS. Elsewhere, Alloc returns
+// ErrUnsupported, and callers who would rather fall back to ordinary
+// memory than fail can use acorn.NewAEAD instead.
+//
+// Locking memory is limited by RLIMIT_MEMLOCK, which on many systems
+// allows only a few dozen pages to an unprivileged process, and each key
+// uses a whole page of it. The store is meant for a handful of long-lived
+// keys, not one per message.
+package acornlock
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/magical/go-acorn"
+)
+
+// ErrUnsupported is returned by Alloc on platforms
+// where locked memory is not supported.
+var ErrUnsupported = errors.New("acornlock: locked memory is not supported on this platform")
+
+// A Store is an acorn.KeyStore backed by locked, guarded pages.
+// The zero value is ready to use, and a Store is safe for concurrent use.
+type Store struct {
+	mu      sync.Mutex
+	regions map[*[acorn.KeySize]byte][]byte
+}
+
+var _ acorn.KeyStore = (*Store)(nil)
+
+// Alloc returns zeroed, locked memory for one key.
+func (s *Store) Alloc() (*[acorn.KeySize]byte, error) {
+	key, region, err := alloc()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if s.regions == nil {
+		s.regions = make(map[*[acorn.KeySize]byte][]byte)
+	}
+	s.regions[key] = region
+	s.mu.Unlock()
+	return key, nil
+}
+
+// Free wipes the key, unlocks its memory, and unmaps it.
+// It panics if key was not returned by s.Alloc, or was already freed.
+func (s *Store) Free(key *[acorn.KeySize]byte) {
+	s.mu.Lock()
+	region, ok := s.regions[key]
+	delete(s.regions, key)
+	s.mu.Unlock()
+	if !ok {
+		panic("acornlock: Free of memory not allocated by this Store")
+	}
+	*key = [acorn.KeySize]byte{}
+	free(region)
+}
@@ -0,0 +1,14 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package acornlock
+
+import "github.com/magical/go-acorn"
+
+func alloc() (*[acorn.KeySize]byte, []byte, error) {
+	return nil, nil, ErrUnsupported
+}
+
+func free(region []byte) {}
@@ -0,0 +1,45 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornlock
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/magical/go-acorn"
+)
+
+func TestStore(t *testing.T) {
+	var s Store
+	key := []byte("0123456789abcdef")
+	a, err := acorn.NewAEADStore(key, &s)
+	if err == ErrUnsupported {
+		t.Skip(err)
+	}
+	if err != nil {
+		// typically RLIMIT_MEMLOCK in a constrained environment
+		t.Skipf("cannot lock memory: %v", err)
+	}
+	nonce := make([]byte, acorn.NonceSize)
+	want := acorn.NewAEAD(key).Seal(nil, nonce, []byte("hello"), nil)
+	if got := a.Seal(nil, nonce, []byte("hello"), nil); !bytes.Equal(got, want) {
+		t.Errorf("Seal = %x, want %x", got, want)
+	}
+	if len(s.regions) != 1 {
+		t.Errorf("%d regions mapped, want 1", len(s.regions))
+	}
+	a.Close()
+	if len(s.regions) != 0 {
+		t.Errorf("%d regions still mapped after Close", len(s.regions))
+	}
+}
+
+func TestFreeForeign(t *testing.T) {
+	var s Store
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Free of foreign memory did not panic")
+		}
+	}()
+	s.Free(new([acorn.KeySize]byte))
+}
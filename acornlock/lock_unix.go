@@ -0,0 +1,59 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package acornlock
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/magical/go-acorn"
+)
+
+// alloc maps a guard page, a key page, and another guard page,
+// and returns the key's place at the end of the key page along
+// with the whole mapping.
+func alloc() (*[acorn.KeySize]byte, []byte, error) {
+	page := os.Getpagesize()
+	region, err := syscall.Mmap(-1, 0, 3*page, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return nil, nil, os.NewSyscallError("mmap", err)
+	}
+	data := region[page : 2*page]
+	if err := guard(region, page); err != nil {
+		syscall.Munmap(region)
+		return nil, nil, err
+	}
+	if err := syscall.Mlock(data); err != nil {
+		syscall.Munmap(region)
+		return nil, nil, os.NewSyscallError("mlock", err)
+	}
+	if err := dontDump(data); err != nil {
+		syscall.Munlock(data)
+		syscall.Munmap(region)
+		return nil, nil, err
+	}
+	key := (*[acorn.KeySize]byte)(unsafe.Pointer(&data[page-acorn.KeySize]))
+	return key, region, nil
+}
+
+func guard(region []byte, page int) error {
+	if err := syscall.Mprotect(region[:page], syscall.PROT_NONE); err != nil {
+		return os.NewSyscallError("mprotect", err)
+	}
+	if err := syscall.Mprotect(region[2*page:], syscall.PROT_NONE); err != nil {
+		return os.NewSyscallError("mprotect", err)
+	}
+	return nil
+}
+
+func free(region []byte) {
+	page := os.Getpagesize()
+	syscall.Munlock(region[page : 2*page])
+	if err := syscall.Munmap(region); err != nil {
+		panic("acornlock: munmap: " + err.Error())
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornmetrics counts ACORN-128 operations and exports the
+// counts in the Prometheus text format, so that operators can watch for
+// spikes in authentication failures, which suggest tampering or a
+// misconfigured peer, and for how often keys are replaced.
+//
+// Nothing is counted unless asked for. Wrap instruments an AEAD, and
+// WatchAuthFailures counts failures from every AEAD in package acorn.
+// A Metrics is an http.Handler, so it can be served for Prometheus to
+// scrape directly:
+//
+//	m := acornmetrics.New()
+//	m.WatchAuthFailures()
+//	a := m.Wrap(acorn.NewAEAD(key))
+//	http.Handle("/metrics/acorn", m)
+//
+// Programs that already export metrics with a Prometheus client library
+// can copy the values from Snapshot into their own collectors instead.
+//
+// The metrics are
+//
+//	acorn_operations_total{op}          messages sealed or opened
+//	acorn_bytes_total{op}               bytes of plaintext sealed or opened
+//	acorn_message_bytes{op}             histogram of plaintext lengths
+//	acorn_duration_seconds{op}          histogram of the time per call
+//	acorn_auth_failures_total           messages which failed to open
+//	acorn_keys_total                    AEADs wrapped, which is to say keys put in use
+//	acorn_backend_info{backend}         the batch backend in use, always 1
+//
+// where op is "seal" or "open". A batch counts as one call
+// but as many operations as it has messages.
+package acornmetrics
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/magical/go-acorn"
+)
+
+// SizeBuckets are the upper bounds of the acorn_message_bytes buckets.
+var SizeBuckets = []float64{64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+
+// DurationBuckets are the upper bounds of the acorn_duration_seconds buckets.
+var DurationBuckets = []float64{1e-6, 4e-6, 16e-6, 64e-6, 256e-6, 1e-3, 4e-3, 16e-3, 64e-3}
+
+const (
+	opSeal = iota
+	opOpen
+	numOps
+)
+
+// A histogram is a Prometheus histogram with fixed buckets,
+// whose counts are not cumulative until they are exported.
+//
+// The uint64s that are updated atomically come first in each struct,
+// and histograms are allocated separately, so that they are 64-bit
+// aligned on 32-bit platforms, as sync/atomic requires.
+type histogram struct {
+	sum    uint64   // updated atomically; must be 64-bit aligned
+	counts []uint64 // one more than the buckets, for +Inf; updated atomically
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{counts: make([]uint64, len(buckets)+1)}
+}
+
+func (h *histogram) observe(buckets []float64, v float64, sum uint64) {
+	i := 0
+	for i < len(buckets) && v > buckets[i] {
+		i++
+	}
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.sum, sum)
+}
+
+type opStats struct {
+	count, bytes uint64 // updated atomically; must be 64-bit aligned
+	size, time   *histogram
+}
+
+// Metrics counts operations. It is safe for concurrent use.
+type Metrics struct {
+	failures uint64 // updated atomically; must be 64-bit aligned
+	keys     uint64 // updated atomically; must be 64-bit aligned
+	ops      [numOps]opStats
+}
+
+// New returns a Metrics with all counts at zero.
+func New() *Metrics {
+	m := new(Metrics)
+	for i := range m.ops {
+		m.ops[i].size = newHistogram(SizeBuckets)
+		m.ops[i].time = newHistogram(DurationBuckets)
+	}
+	return m
+}
+
+// message counts a message with n bytes of plaintext.
+func (m *Metrics) message(op, n int) {
+	s := &m.ops[op]
+	atomic.AddUint64(&s.count, 1)
+	atomic.AddUint64(&s.bytes, uint64(n))
+	s.size.observe(SizeBuckets, float64(n), uint64(n))
+}
+
+// call counts a call to seal or open which took d.
+func (m *Metrics) call(op int, d time.Duration) {
+	m.ops[op].time.observe(DurationBuckets, d.Seconds(), uint64(d))
+}
+
+// WatchAuthFailures counts the messages that fail to open on any AEAD
+// from package acorn, wrapped or not, by setting the hook with
+// acorn.SetAuthFailureHook. It replaces any hook already set.
+func (m *Metrics) WatchAuthFailures() {
+	acorn.SetAuthFailureHook(func(acorn.AuthFailure) {
+		atomic.AddUint64(&m.failures, 1)
+	})
+}
+
+// Wrap returns an AEAD which counts its calls to Seal and Open, and
+// otherwise behaves like a. If a implements acorn.Batch, so does the
+// result. Each call to Wrap counts as a new key in acorn_keys_total.
+func (m *Metrics) Wrap(a cipher.AEAD) cipher.AEAD {
+	atomic.AddUint64(&m.keys, 1)
+	w := &aead{AEAD: a, m: m}
+	if b, ok := a.(acorn.Batch); ok {
+		return &batch{aead: w, b: b}
+	}
+	return w
+}
+
+type aead struct {
+	cipher.AEAD
+	m *Metrics
+}
+
+func (a *aead) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	start := time.Now()
+	out := a.AEAD.Seal(dst, nonce, plaintext, additionalData)
+	a.m.call(opSeal, time.Since(start))
+	a.m.message(opSeal, len(plaintext))
+	return out
+}
+
+func (a *aead) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	start := time.Now()
+	out, err := a.AEAD.Open(dst, nonce, ciphertext, additionalData)
+	a.m.call(opOpen, time.Since(start))
+	if err == nil {
+		a.m.message(opOpen, len(out)-len(dst))
+	}
+	return out, err
+}
+
+type batch struct {
+	*aead
+	b acorn.Batch
+}
+
+func (a *batch) SealBatch(dst [][]byte, nonces, plaintexts, ads [][]byte) {
+	start := time.Now()
+	a.b.SealBatch(dst, nonces, plaintexts, ads)
+	a.m.call(opSeal, time.Since(start))
+	for _, p := range plaintexts {
+		a.m.message(opSeal, len(p))
+	}
+}
+
+func (a *batch) OpenBatch(dst [][]byte, nonces, ciphertexts, ads [][]byte, parallel bool) []error {
+	start := time.Now()
+	errs := a.b.OpenBatch(dst, nonces, ciphertexts, ads, parallel)
+	a.m.call(opOpen, time.Since(start))
+	for i, err := range errs {
+		if err == nil {
+			a.m.message(opOpen, len(ciphertexts[i])-acorn.TagSize)
+		}
+	}
+	return errs
+}
+
+// A Snapshot holds the values of the metrics at one time.
+// The histogram buckets are cumulative, as Prometheus expects,
+// and the last one is for +Inf.
+type Snapshot struct {
+	Seals, Opens         uint64
+	SealBytes, OpenBytes uint64
+	SealSizes, OpenSizes []uint64 // by SizeBuckets
+	SealTimes, OpenTimes []uint64 // by DurationBuckets
+	SealTime, OpenTime   time.Duration
+	AuthFailures         uint64
+	Keys                 uint64
+	Backend              string
+}
+
+// Snapshot returns the current values of the metrics. Since they are
+// read one at a time while others may be updating them, they may not
+// agree with each other exactly.
+func (m *Metrics) Snapshot() Snapshot {
+	load := func(h *histogram) []uint64 {
+		c := make([]uint64, len(h.counts))
+		var sum uint64
+		for i := range h.counts {
+			sum += atomic.LoadUint64(&h.counts[i])
+			c[i] = sum
+		}
+		return c
+	}
+	seal, open := &m.ops[opSeal], &m.ops[opOpen]
+	return Snapshot{
+		Seals:        atomic.LoadUint64(&seal.count),
+		Opens:        atomic.LoadUint64(&open.count),
+		SealBytes:    atomic.LoadUint64(&seal.bytes),
+		OpenBytes:    atomic.LoadUint64(&open.bytes),
+		SealSizes:    load(seal.size),
+		OpenSizes:    load(open.size),
+		SealTimes:    load(seal.time),
+		OpenTimes:    load(open.time),
+		SealTime:     time.Duration(atomic.LoadUint64(&seal.time.sum)),
+		OpenTime:     time.Duration(atomic.LoadUint64(&open.time.sum)),
+		AuthFailures: atomic.LoadUint64(&m.failures),
+		Keys:         atomic.LoadUint64(&m.keys),
+		Backend:      acorn.Backend(),
+	}
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	s := m.Snapshot()
+	var b bytes.Buffer
+	p := func(format string, args ...interface{}) {
+		fmt.Fprintf(&b, format, args...)
+	}
+	header := func(metric, typ, help string) {
+		p("# HELP %s %s\n", metric, help)
+		p("# TYPE %s %s\n", metric, typ)
+	}
+	hist := func(metric string, buckets []float64, op string, counts []uint64, sum float64) {
+		for i, le := range buckets {
+			p("%s_bucket{op=%q,le=\"%g\"} %d\n", metric, op, le, counts[i])
+		}
+		n := counts[len(counts)-1]
+		p("%s_bucket{op=%q,le=\"+Inf\"} %d\n", metric, op, n)
+		p("%s_sum{op=%q} %g\n", metric, op, sum)
+		p("%s_count{op=%q} %d\n", metric, op, n)
+	}
+
+	header("acorn_operations_total", "counter", "Messages sealed or opened.")
+	p("acorn_operations_total{op=\"seal\"} %d\n", s.Seals)
+	p("acorn_operations_total{op=\"open\"} %d\n", s.Opens)
+	header("acorn_bytes_total", "counter", "Bytes of plaintext sealed or opened.")
+	p("acorn_bytes_total{op=\"seal\"} %d\n", s.SealBytes)
+	p("acorn_bytes_total{op=\"open\"} %d\n", s.OpenBytes)
+	header("acorn_message_bytes", "histogram", "Plaintext length of messages sealed or opened.")
+	hist("acorn_message_bytes", SizeBuckets, "seal", s.SealSizes, float64(s.SealBytes))
+	hist("acorn_message_bytes", SizeBuckets, "open", s.OpenSizes, float64(s.OpenBytes))
+	header("acorn_duration_seconds", "histogram", "Time taken by calls to seal or open.")
+	hist("acorn_duration_seconds", DurationBuckets, "seal", s.SealTimes, s.SealTime.Seconds())
+	hist("acorn_duration_seconds", DurationBuckets, "open", s.OpenTimes, s.OpenTime.Seconds())
+	header("acorn_auth_failures_total", "counter", "Messages which failed to open.")
+	p("acorn_auth_failures_total %d\n", s.AuthFailures)
+	header("acorn_keys_total", "counter", "AEADs wrapped for metrics, one per key put in use.")
+	p("acorn_keys_total %d\n", s.Keys)
+	header("acorn_backend_info", "gauge", "The backend that batches prefer on this machine.")
+	p("acorn_backend_info{backend=%q} 1\n", s.Backend)
+	return b.WriteTo(w)
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
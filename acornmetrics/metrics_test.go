@@ -0,0 +1,81 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornmetrics
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/magical/go-acorn"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	m.WatchAuthFailures()
+	defer acorn.SetAuthFailureHook(nil)
+
+	a := m.Wrap(acorn.NewAEAD(make([]byte, acorn.KeySize)))
+	nonce := make([]byte, acorn.NonceSize)
+	ct := a.Seal(nil, nonce, make([]byte, 100), nil)
+	if _, err := a.Open(nil, nonce, ct, nil); err != nil {
+		t.Fatal(err)
+	}
+	ct[0] ^= 1
+	if _, err := a.Open(nil, nonce, ct, nil); err == nil {
+		t.Fatal("Open succeeded with a tampered message")
+	}
+
+	b, ok := a.(acorn.Batch)
+	if !ok {
+		t.Fatal("wrapped AEAD does not implement Batch")
+	}
+	pts := [][]byte{make([]byte, 10), make([]byte, 5000)}
+	nonces := [][]byte{nonce, nonce}
+	dst := make([][]byte, 2)
+	b.SealBatch(dst, nonces, pts, make([][]byte, 2))
+
+	s := m.Snapshot()
+	if s.Seals != 3 || s.Opens != 1 || s.SealBytes != 5110 || s.OpenBytes != 100 {
+		t.Errorf("counts = %d seals of %d bytes, %d opens of %d bytes", s.Seals, s.SealBytes, s.Opens, s.OpenBytes)
+	}
+	if s.AuthFailures != 1 || s.Keys != 1 {
+		t.Errorf("%d failures, %d keys; want 1 and 1", s.AuthFailures, s.Keys)
+	}
+	// 10 ≤ 64, 100 ≤ 256, and 5000 ≤ 16K
+	if got := s.SealSizes; got[0] != 1 || got[1] != 2 || got[3] != 2 || got[4] != 3 || got[len(got)-1] != 3 {
+		t.Errorf("seal size buckets = %v", got)
+	}
+	if got := s.OpenTimes; got[len(got)-1] != 2 {
+		t.Errorf("%d open calls timed, want 2", got[len(got)-1])
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE acorn_operations_total counter\n",
+		`acorn_operations_total{op="seal"} 3` + "\n",
+		`acorn_bytes_total{op="open"} 100` + "\n",
+		`acorn_message_bytes_bucket{op="seal",le="256"} 2` + "\n",
+		`acorn_message_bytes_bucket{op="seal",le="+Inf"} 3` + "\n",
+		`acorn_message_bytes_sum{op="seal"} 5110` + "\n",
+		"acorn_auth_failures_total 1\n",
+		`acorn_backend_info{backend="` + acorn.Backend() + `"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+
+	// plain cipher.AEADs don't gain Batch
+	var buf bytes.Buffer
+	if _, ok := m.Wrap(struct{ cipher.AEAD }{a}).(acorn.Batch); ok {
+		t.Error("wrapped non-batch AEAD implements Batch")
+	}
+	if n, err := m.WriteTo(&buf); err != nil || n != int64(buf.Len()) {
+		t.Errorf("WriteTo = %d, %v; wrote %d", n, err, buf.Len())
+	}
+}
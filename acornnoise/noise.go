@@ -0,0 +1,83 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornnoise provides ACORN-128 as a cipher function for the
+// Noise protocol framework.
+//
+// Noise cipher keys are 32 bytes; ACORN-128 uses the first 16 of them.
+// The 64-bit Noise nonce n is encoded as 8 zero bytes followed by n in
+// big-endian order. Rekeying follows the default in section 4.2 of the
+// Noise specification. The cipher name is "ACORN", so a protocol name
+// looks like Noise_XX_25519_ACORN_BLAKE2s.
+//
+// Noise libraries define their own interfaces for cipher functions, so
+// a small adapter is needed to use this package with one. For
+// github.com/flynn/noise, that is
+//
+//	type cipherFunc struct{}
+//
+//	func (cipherFunc) Cipher(k [32]byte) noise.Cipher { return acornnoise.New(k) }
+//	func (cipherFunc) CipherName() string              { return acornnoise.Name }
+//
+// and cipherFunc{} can then be passed to noise.NewCipherSuite.
+package acornnoise
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+
+	"github.com/magical/go-acorn"
+)
+
+// Name is the name of the cipher in Noise protocol names.
+const Name = "ACORN"
+
+// KeySize is the length of a Noise cipher key.
+const KeySize = 32
+
+var errDecryption = errors.New("acornnoise: message authentication failed")
+
+// A Cipher encrypts and decrypts Noise transport and handshake messages
+// under a single key.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// New returns a Cipher for the key k.
+func New(k [KeySize]byte) *Cipher {
+	return &Cipher{aead: acorn.NewAEAD(k[:acorn.KeySize])}
+}
+
+func nonce(n uint64) [acorn.NonceSize]byte {
+	var b [acorn.NonceSize]byte
+	binary.BigEndian.PutUint64(b[8:], n)
+	return b
+}
+
+// Encrypt seals plaintext with nonce n and additional data ad,
+// appends the result to out, and returns the updated slice.
+func (c *Cipher) Encrypt(out []byte, n uint64, ad, plaintext []byte) []byte {
+	b := nonce(n)
+	return c.aead.Seal(out, b[:], plaintext, ad)
+}
+
+// Decrypt opens ciphertext with nonce n and additional data ad,
+// appends the plaintext to out, and returns the updated slice.
+func (c *Cipher) Decrypt(out []byte, n uint64, ad, ciphertext []byte) ([]byte, error) {
+	b := nonce(n)
+	out, err := c.aead.Open(out, b[:], ciphertext, ad)
+	if err != nil {
+		return out, errDecryption
+	}
+	return out, nil
+}
+
+// Rekey returns the key that results from applying the Noise REKEY
+// function to the Cipher's key: the first 32 bytes of the encryption of
+// 32 zero bytes with nonce 2^64-1 and no additional data.
+func (c *Cipher) Rekey() [KeySize]byte {
+	var zeros, k [KeySize]byte
+	out := c.Encrypt(make([]byte, 0, KeySize+acorn.TagSize), ^uint64(0), nil, zeros[:])
+	copy(k[:], out)
+	return k
+}
@@ -0,0 +1,45 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornnoise
+
+import (
+	"bytes"
+	"testing"
+)
+
+var testKey = [KeySize]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+func TestRoundTrip(t *testing.T) {
+	c := New(testKey)
+	msg := []byte("hello, noise")
+	ad := []byte("handshake hash")
+	ct := c.Encrypt(nil, 7, ad, msg)
+	got, err := c.Decrypt(nil, 7, ad, ct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Errorf("got %q, want %q", got, msg)
+	}
+	if _, err := c.Decrypt(nil, 8, ad, ct); err == nil {
+		t.Error("decrypted with the wrong nonce")
+	}
+	if _, err := c.Decrypt(nil, 7, nil, ct); err == nil {
+		t.Error("decrypted with the wrong additional data")
+	}
+}
+
+func TestRekey(t *testing.T) {
+	c := New(testKey)
+	k := c.Rekey()
+	if k == testKey || k == ([KeySize]byte{}) {
+		t.Fatalf("Rekey returned %x", k)
+	}
+	if k2 := c.Rekey(); k2 != k {
+		t.Errorf("Rekey is not deterministic: %x != %x", k2, k)
+	}
+	ct := New(k).Encrypt(nil, 0, nil, []byte("x"))
+	if _, err := c.Decrypt(nil, 0, nil, ct); err == nil {
+		t.Error("old key decrypted a message under the new key")
+	}
+}
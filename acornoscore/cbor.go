@@ -0,0 +1,52 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornoscore
+
+// This file has just enough of a CBOR (RFC 8949) encoder to build the
+// structures that OSCORE authenticates and feeds to HKDF.
+
+const (
+	cborUint  = 0 << 5
+	cborNeg   = 1 << 5
+	cborBytes = 2 << 5
+	cborText  = 3 << 5
+	cborArray = 4 << 5
+	cborNull  = 0xf6
+)
+
+func cborHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n < 1<<8:
+		return append(b, major|24, byte(n))
+	case n < 1<<16:
+		return append(b, major|25, byte(n>>8), byte(n))
+	case n < 1<<32:
+		return append(b, major|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	b = append(b, major|27)
+	for i := 56; i >= 0; i -= 8 {
+		b = append(b, byte(n>>uint(i)))
+	}
+	return b
+}
+
+func cborInt(b []byte, n int64) []byte {
+	if n < 0 {
+		return cborHead(b, cborNeg, uint64(-1-n))
+	}
+	return cborHead(b, cborUint, uint64(n))
+}
+
+func cborBstr(b, s []byte) []byte {
+	return append(cborHead(b, cborBytes, uint64(len(s))), s...)
+}
+
+func cborTstr(b []byte, s string) []byte {
+	return append(cborHead(b, cborText, uint64(len(s))), s...)
+}
+
+func cborArrayHead(b []byte, n int) []byte {
+	return cborHead(b, cborArray, uint64(n))
+}
@@ -0,0 +1,118 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornoscore
+
+import (
+	"errors"
+	"sort"
+)
+
+// A Message is the part of a CoAP message that OSCORE protects:
+// the code, the options to be encrypted (class E), and the payload.
+type Message struct {
+	Code    byte
+	Options []Option
+	Payload []byte
+}
+
+// An Option is a CoAP option.
+type Option struct {
+	Number uint16
+	Value  []byte
+}
+
+var errMessage = errors.New("acornoscore: malformed inner message")
+
+// marshal encodes m in the CoAP format used for the OSCORE plaintext:
+// the code, the options sorted by number, and the payload marker and
+// payload if there is one.
+func (m *Message) marshal() []byte {
+	opts := append([]Option(nil), m.Options...)
+	sort.SliceStable(opts, func(i, j int) bool { return opts[i].Number < opts[j].Number })
+	b := []byte{m.Code}
+	prev := uint16(0)
+	for _, o := range opts {
+		b = appendOption(b, o.Number-prev, len(o.Value))
+		b = append(b, o.Value...)
+		prev = o.Number
+	}
+	if len(m.Payload) > 0 {
+		b = append(b, 0xff)
+		b = append(b, m.Payload...)
+	}
+	return b
+}
+
+// appendOption appends the header of an option with the given
+// delta and value length.
+func appendOption(b []byte, delta uint16, length int) []byte {
+	d, dx := optionNibble(int(delta))
+	l, lx := optionNibble(length)
+	b = append(b, d<<4|l)
+	b = append(b, dx...)
+	return append(b, lx...)
+}
+
+func optionNibble(n int) (byte, []byte) {
+	switch {
+	case n < 13:
+		return byte(n), nil
+	case n < 269:
+		return 13, []byte{byte(n - 13)}
+	}
+	n -= 269
+	return 14, []byte{byte(n >> 8), byte(n)}
+}
+
+// unmarshal decodes a message encoded by marshal.
+func (m *Message) unmarshal(b []byte) error {
+	if len(b) == 0 {
+		return errMessage
+	}
+	*m = Message{Code: b[0]}
+	b = b[1:]
+	num := 0
+	for len(b) > 0 {
+		if b[0] == 0xff {
+			if len(b) == 1 {
+				return errMessage
+			}
+			m.Payload = b[1:]
+			break
+		}
+		d, l := int(b[0]>>4), int(b[0]&0xf)
+		b = b[1:]
+		var ok bool
+		if d, b, ok = readNibble(d, b); !ok {
+			return errMessage
+		}
+		if l, b, ok = readNibble(l, b); !ok {
+			return errMessage
+		}
+		num += d
+		if num > 0xffff || len(b) < l {
+			return errMessage
+		}
+		m.Options = append(m.Options, Option{uint16(num), b[:l]})
+		b = b[l:]
+	}
+	return nil
+}
+
+func readNibble(n int, b []byte) (int, []byte, bool) {
+	switch n {
+	case 13:
+		if len(b) < 1 {
+			return 0, nil, false
+		}
+		return int(b[0]) + 13, b[1:], true
+	case 14:
+		if len(b) < 2 {
+			return 0, nil, false
+		}
+		return int(b[0])<<8 | int(b[1]) + 269, b[2:], true
+	case 15:
+		return 0, nil, false
+	}
+	return n, b, true
+}
@@ -0,0 +1,289 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornoscore protects CoAP messages in the manner of OSCORE
+// (RFC 8613), with ACORN-128 as the AEAD algorithm.
+//
+// It follows RFC 8613 in deriving the sender key, recipient key, and
+// common IV from a master secret with HKDF-SHA256, in building nonces
+// from the sender ID and partial IV, in the OSCORE option, and in the
+// additional data, which is the COSE Enc_structure over the external
+// AAD. ACORN-128 has no registered COSE algorithm identifier, so this
+// package uses AlgACORN, from the private-use range; both ends must
+// agree on it.
+//
+// Only the inner message is handled here: the caller moves the class E
+// options it wants protected into a Message, sends the OSCORE option and
+// ciphertext returned by the Protect methods in the outer CoAP message,
+// and passes them to the Unprotect methods on the other side. Class I
+// options are not supported.
+package acornoscore
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/magical/go-acorn"
+	"github.com/magical/go-acorn/acorndgram"
+	"github.com/magical/go-acorn/internal/hkdf"
+)
+
+// AlgACORN is the COSE algorithm identifier used for ACORN-128.
+// It is in the private-use range.
+const AlgACORN = -65537
+
+const (
+	nonceLen = acorn.NonceSize
+	maxIDLen = nonceLen - 6
+	maxPIV   = 1<<40 - 1
+)
+
+var (
+	ErrAuthentication = errors.New("acornoscore: message authentication failed")
+	ErrReplay         = errors.New("acornoscore: replayed request")
+	ErrExhausted      = errors.New("acornoscore: sender sequence number exhausted")
+	errOption         = errors.New("acornoscore: malformed OSCORE option")
+	errKeyID          = errors.New("acornoscore: unknown key ID")
+)
+
+// A Context is an OSCORE security context between two endpoints.
+// It is safe for concurrent use.
+type Context struct {
+	senderID    []byte
+	recipientID []byte
+	idContext   []byte
+	sender      cipher.AEAD
+	recipient   cipher.AEAD
+	commonIV    []byte
+
+	mu     sync.Mutex
+	ssn    uint64
+	replay *acorndgram.ReplayWindow
+}
+
+// NewContext derives a security context as in RFC 8613, section 3.2.
+// The master secret must be at least 16 bytes, and the sender and
+// recipient IDs, which must differ, at most 10 bytes. The master salt
+// and ID context may be nil.
+func NewContext(masterSecret, masterSalt, senderID, recipientID, idContext []byte) (*Context, error) {
+	if len(masterSecret) < acorn.KeySize {
+		return nil, errors.New("acornoscore: master secret too short")
+	}
+	if len(senderID) > maxIDLen || len(recipientID) > maxIDLen || bytes.Equal(senderID, recipientID) {
+		return nil, errors.New("acornoscore: invalid sender or recipient ID")
+	}
+	c := &Context{
+		senderID:    append([]byte{}, senderID...),
+		recipientID: append([]byte{}, recipientID...),
+		idContext:   idContext,
+		replay:      acorndgram.NewReplayWindow(64),
+	}
+	derive := func(id []byte, typ string, n int) []byte {
+		return deriveKey(masterSecret, masterSalt, id, idContext, AlgACORN, typ, n)
+	}
+	c.sender = acorn.NewAEAD(derive(senderID, "Key", acorn.KeySize))
+	c.recipient = acorn.NewAEAD(derive(recipientID, "Key", acorn.KeySize))
+	c.commonIV = derive(nil, "IV", nonceLen)
+	return c, nil
+}
+
+// deriveKey computes HKDF with the info structure of RFC 8613, section 3.2.1.
+func deriveKey(secret, salt, id, idContext []byte, alg int64, typ string, n int) []byte {
+	info := cborArrayHead(nil, 5)
+	info = cborBstr(info, id)
+	if idContext == nil {
+		info = append(info, cborNull)
+	} else {
+		info = cborBstr(info, idContext)
+	}
+	info = cborInt(info, alg)
+	info = cborTstr(info, typ)
+	info = cborInt(info, int64(n))
+	return hkdf.Key(secret, salt, info, n)
+}
+
+// nonce builds the AEAD nonce from an ID and partial IV,
+// as in RFC 8613, section 5.2.
+func (c *Context) nonce(id, piv []byte) []byte {
+	n := make([]byte, nonceLen)
+	n[0] = byte(len(id))
+	copy(n[1+maxIDLen-len(id):], id)
+	copy(n[nonceLen-len(piv):], piv)
+	for i := range n {
+		n[i] ^= c.commonIV[i]
+	}
+	return n
+}
+
+// aad builds the COSE Enc_structure for a request with the given
+// key ID and partial IV, as in RFC 8613, section 5.4.
+func aad(kid, piv []byte) []byte {
+	ext := cborArrayHead(nil, 5)
+	ext = cborInt(ext, 1) // oscore_version
+	ext = cborArrayHead(ext, 1)
+	ext = cborInt(ext, AlgACORN)
+	ext = cborBstr(ext, kid)
+	ext = cborBstr(ext, piv)
+	ext = cborBstr(ext, nil) // class I options
+	b := cborArrayHead(nil, 3)
+	b = cborTstr(b, "Encrypt0")
+	b = cborBstr(b, nil)
+	return cborBstr(b, ext)
+}
+
+// encodePIV returns the shortest big-endian encoding of a sequence number.
+func encodePIV(ssn uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], ssn)
+	i := 3
+	for i < 7 && b[i] == 0 {
+		i++
+	}
+	return append([]byte(nil), b[i:]...)
+}
+
+// A Request records what a response to a request is bound to.
+type Request struct {
+	kid []byte
+	piv []byte
+}
+
+// option encodes an OSCORE option value, as in RFC 8613, section 6.1.
+func option(piv, kidContext, kid []byte, hasKid bool) []byte {
+	flags := byte(len(piv))
+	if hasKid {
+		flags |= 0x08
+	}
+	if kidContext != nil {
+		flags |= 0x10
+	}
+	if flags == 0 {
+		return nil
+	}
+	b := append([]byte{flags}, piv...)
+	if kidContext != nil {
+		b = append(b, byte(len(kidContext)))
+		b = append(b, kidContext...)
+	}
+	return append(b, kid...)
+}
+
+// parseOption decodes an OSCORE option value.
+func parseOption(b []byte) (piv, kidContext, kid []byte, hasKid bool, err error) {
+	if len(b) == 0 {
+		return nil, nil, nil, false, nil
+	}
+	flags := b[0]
+	b = b[1:]
+	n := int(flags & 0x07)
+	if flags&0xe0 != 0 || n > 5 || len(b) < n {
+		return nil, nil, nil, false, errOption
+	}
+	piv, b = b[:n], b[n:]
+	if flags&0x10 != 0 {
+		if len(b) < 1 || len(b) < 1+int(b[0]) {
+			return nil, nil, nil, false, errOption
+		}
+		kidContext, b = b[1:1+int(b[0])], b[1+int(b[0]):]
+	}
+	hasKid = flags&0x08 != 0
+	if hasKid {
+		kid = b
+	} else if len(b) != 0 {
+		return nil, nil, nil, false, errOption
+	}
+	return piv, kidContext, kid, hasKid, nil
+}
+
+// ProtectRequest encrypts a request. It returns the value of the OSCORE
+// option and the ciphertext, which becomes the payload of the outer
+// message, and a Request to open the response with.
+func (c *Context) ProtectRequest(m *Message) (opt, ciphertext []byte, req *Request, err error) {
+	c.mu.Lock()
+	ssn := c.ssn
+	if ssn > maxPIV {
+		c.mu.Unlock()
+		return nil, nil, nil, ErrExhausted
+	}
+	c.ssn++
+	c.mu.Unlock()
+
+	piv := encodePIV(ssn)
+	req = &Request{kid: c.senderID, piv: piv}
+	nonce := c.nonce(c.senderID, piv)
+	ciphertext = c.sender.Seal(nil, nonce, m.marshal(), aad(req.kid, req.piv))
+	return option(piv, c.idContext, c.senderID, true), ciphertext, req, nil
+}
+
+// UnprotectRequest decrypts a request protected by the peer's
+// ProtectRequest, rejecting replays. The Request it returns is
+// for protecting the response.
+func (c *Context) UnprotectRequest(opt, ciphertext []byte) (*Message, *Request, error) {
+	piv, _, kid, hasKid, err := parseOption(opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !hasKid || len(piv) == 0 {
+		return nil, nil, errOption
+	}
+	if !bytes.Equal(kid, c.recipientID) {
+		return nil, nil, errKeyID
+	}
+	var b [8]byte
+	copy(b[8-len(piv):], piv)
+	seq := binary.BigEndian.Uint64(b[:])
+	c.mu.Lock()
+	fresh := c.replay.Check(seq)
+	c.mu.Unlock()
+	if !fresh {
+		return nil, nil, ErrReplay
+	}
+	req := &Request{kid: c.recipientID, piv: append([]byte(nil), piv...)}
+	p, err := c.recipient.Open(nil, c.nonce(c.recipientID, piv), ciphertext, aad(req.kid, req.piv))
+	if err != nil {
+		return nil, nil, ErrAuthentication
+	}
+	c.mu.Lock()
+	fresh = c.replay.Update(seq)
+	c.mu.Unlock()
+	if !fresh {
+		return nil, nil, ErrReplay
+	}
+	m := new(Message)
+	if err := m.unmarshal(p); err != nil {
+		return nil, nil, err
+	}
+	return m, req, nil
+}
+
+// ProtectResponse encrypts the response to req. Like most OSCORE
+// responses, it reuses the request's nonce under the responder's key,
+// so the OSCORE option value is empty.
+func (c *Context) ProtectResponse(req *Request, m *Message) (opt, ciphertext []byte) {
+	nonce := c.nonce(req.kid, req.piv)
+	return nil, c.sender.Seal(nil, nonce, m.marshal(), aad(req.kid, req.piv))
+}
+
+// UnprotectResponse decrypts the response to a request
+// returned by ProtectRequest.
+func (c *Context) UnprotectResponse(req *Request, opt, ciphertext []byte) (*Message, error) {
+	piv, _, _, hasKid, err := parseOption(opt)
+	if err != nil {
+		return nil, err
+	}
+	if hasKid || len(piv) != 0 {
+		// Responses with their own partial IV are not supported.
+		return nil, errOption
+	}
+	p, err := c.recipient.Open(nil, c.nonce(req.kid, req.piv), ciphertext, aad(req.kid, req.piv))
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+	m := new(Message)
+	if err := m.unmarshal(p); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,156 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornoscore
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+var (
+	testSecret = unhex("0102030405060708090a0b0c0d0e0f10")
+	testSalt   = unhex("9e7ca92223786340")
+)
+
+// The key derivation is the same as for any other algorithm,
+// so it can be checked against RFC 8613, appendix C.1.1.
+func TestDeriveKey(t *testing.T) {
+	const aesCCM16_64_128 = 10
+	for _, tt := range []struct {
+		id   []byte
+		typ  string
+		n    int
+		want string
+	}{
+		{[]byte{}, "Key", 16, "f0910ed7295e6ad4b54fc793154302ff"},
+		{[]byte{0x01}, "Key", 16, "ffb14e093c94c9cac9471648b4f98710"},
+		{[]byte{}, "IV", 13, "4622d4dd6d944168eefb54987c"},
+	} {
+		got := deriveKey(testSecret, testSalt, tt.id, nil, aesCCM16_64_128, tt.typ, tt.n)
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("%x %s: got %x, want %s", tt.id, tt.typ, got, tt.want)
+		}
+	}
+}
+
+func testContexts(t *testing.T) (client, server *Context) {
+	client, err := NewContext(testSecret, testSalt, []byte{}, []byte{0x01}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err = NewContext(testSecret, testSalt, []byte{0x01}, []byte{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+func TestRoundTrip(t *testing.T) {
+	client, server := testContexts(t)
+	get := &Message{
+		Code: 0x01, // GET
+		Options: []Option{
+			{15, []byte("id=7")},        // Uri-Query
+			{11, []byte("temperature")}, // Uri-Path
+			{300, bytes.Repeat([]byte{'x'}, 300)},
+		},
+	}
+	for i := 0; i < 3; i++ {
+		opt, ct, req, err := client.ProtectRequest(get)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []byte{0x09, byte(i)}; !bytes.Equal(opt, want) {
+			t.Errorf("request %d: option = %x, want %x", i, opt, want)
+		}
+		m, sreq, err := server.UnprotectRequest(opt, ct)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Code != get.Code || len(m.Options) != 3 || m.Options[0].Number != 11 || m.Options[2].Number != 300 {
+			t.Errorf("request %d: got %+v", i, m)
+		}
+		resp := &Message{Code: 0x45, Payload: []byte("22.5 C")} // 2.05 Content
+		ropt, rct := server.ProtectResponse(sreq, resp)
+		got, err := client.UnprotectResponse(req, ropt, rct)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, resp) {
+			t.Errorf("response %d: got %+v, want %+v", i, got, resp)
+		}
+	}
+}
+
+func TestReject(t *testing.T) {
+	client, server := testContexts(t)
+	m := &Message{Code: 0x02, Payload: []byte("on")}
+	opt, ct, req, _ := client.ProtectRequest(m)
+	_, sreq, err := server.UnprotectRequest(opt, ct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := server.UnprotectRequest(opt, ct); err != ErrReplay {
+		t.Errorf("replay: got error %v, want %v", err, ErrReplay)
+	}
+
+	opt2, ct2, _, _ := client.ProtectRequest(m)
+	bad := append([]byte(nil), ct2...)
+	bad[0] ^= 1
+	if _, _, err := server.UnprotectRequest(opt2, bad); err != ErrAuthentication {
+		t.Errorf("tampered: got error %v, want %v", err, ErrAuthentication)
+	}
+	if _, _, err := server.UnprotectRequest(opt2, ct2); err != nil {
+		t.Errorf("genuine request after forgery: %v", err)
+	}
+	if _, _, err := server.UnprotectRequest([]byte{0x09, 0x05, 0x02}, ct2); err != errKeyID {
+		t.Errorf("wrong kid: got error %v, want %v", err, errKeyID)
+	}
+
+	// A response is bound to its request.
+	_, rct := server.ProtectResponse(sreq, &Message{Code: 0x44})
+	_, _, req2, _ := client.ProtectRequest(m)
+	if _, err := client.UnprotectResponse(req2, nil, rct); err != ErrAuthentication {
+		t.Errorf("response to other request: got error %v, want %v", err, ErrAuthentication)
+	}
+	if _, err := client.UnprotectResponse(req, nil, rct); err != nil {
+		t.Errorf("response: %v", err)
+	}
+}
+
+func TestOption(t *testing.T) {
+	for _, tt := range []struct {
+		piv, kidContext, kid []byte
+		hasKid               bool
+		enc                  string
+	}{
+		{nil, nil, nil, false, ""},
+		{[]byte{0x14}, nil, []byte{}, true, "0914"},
+		{[]byte{0x14}, []byte{0x37, 0xcb}, []byte{0x01}, true, "19140237cb01"},
+	} {
+		enc := option(tt.piv, tt.kidContext, tt.kid, tt.hasKid)
+		if hex.EncodeToString(enc) != tt.enc {
+			t.Errorf("option = %x, want %s", enc, tt.enc)
+		}
+		piv, kidContext, kid, hasKid, err := parseOption(enc)
+		if err != nil || !bytes.Equal(piv, tt.piv) || !bytes.Equal(kidContext, tt.kidContext) ||
+			!bytes.Equal(kid, tt.kid) || hasKid != tt.hasKid {
+			t.Errorf("parseOption(%x) = %x, %x, %x, %v, %v", enc, piv, kidContext, kid, hasKid, err)
+		}
+	}
+	for _, bad := range []string{"06", "0e", "21", "010102", "1001", "0a01"} {
+		if _, _, _, _, err := parseOption(unhex(bad)); err != errOption {
+			t.Errorf("parseOption(%s): got error %v, want %v", bad, err, errOption)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornpsk implements a small handshake that derives fresh
+// session keys from a long-term pre-shared key, so that traffic is
+// never encrypted directly under the long-term key.
+//
+// The handshake is
+//
+//	client -> server   randC    [32]byte
+//	server -> client   randS    [32]byte, confirmS [16]byte
+//	client -> server   confirmC [16]byte
+//
+// Both sides compute HKDF-SHA256 (RFC 5869) with the pre-shared key as
+// the input keying material, randC || randS as the salt, and
+// "acornpsk v1" as the info, and split the output into
+//
+//	keyC2S, keyS2C       [16]byte  session key for each direction
+//	nonceC2S, nonceS2C   [16]byte  starting nonce for each direction
+//	confirmKey           [16]byte
+//
+// confirmS and confirmC are the ACORN-128 tags of empty messages sealed
+// under confirmKey, with the nonce set to 16 bytes of 0x01 or 0x02 and
+// the additional data "server" or "client" followed by randC || randS.
+// Each side checks the other's confirmation, so a handshake only
+// succeeds if both sides have the same pre-shared key.
+//
+// The handshake does not provide forward secrecy: anyone who records it
+// and later learns the pre-shared key can recover the session keys.
+package acornpsk
+
+import (
+	cryptorand "crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/magical/go-acorn"
+	"github.com/magical/go-acorn/internal/hkdf"
+)
+
+// RandomSize is the length of each side's random contribution.
+const RandomSize = 32
+
+const info = "acornpsk v1"
+
+// ErrAuthentication is returned when the peer's confirmation is wrong,
+// which means that it has a different pre-shared key or that the
+// handshake was tampered with.
+var ErrAuthentication = errors.New("acornpsk: handshake authentication failed")
+
+// A Session holds the keys for one direction each way,
+// as seen from one side of the handshake.
+type Session struct {
+	SendKey   []byte
+	RecvKey   []byte
+	SendNonce [acorn.NonceSize]byte // starting nonce for messages sent
+	RecvNonce [acorn.NonceSize]byte // starting nonce for messages received
+}
+
+// Nonce returns the nonce for the message with the given sequence number:
+// the starting nonce with seq XORed into its last 8 bytes, big-endian.
+func Nonce(start [acorn.NonceSize]byte, seq uint64) [acorn.NonceSize]byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], seq)
+	for i := range b {
+		start[8+i] ^= b[i]
+	}
+	return start
+}
+
+type keys struct {
+	c2s, s2c, nonceC2S, nonceS2C, confirm []byte
+}
+
+func deriveKeys(psk, randC, randS []byte) keys {
+	salt := append(append([]byte(nil), randC...), randS...)
+	b := hkdf.Key(psk, salt, []byte(info), 5*16)
+	return keys{b[0:16], b[16:32], b[32:48], b[48:64], b[64:80]}
+}
+
+func confirm(k *keys, side string, randC, randS []byte) []byte {
+	nonce := make([]byte, acorn.NonceSize)
+	for i := range nonce {
+		nonce[i] = 0x01
+		if side == "client" {
+			nonce[i] = 0x02
+		}
+	}
+	ad := append(append([]byte(side), randC...), randS...)
+	return acorn.NewAEAD(k.confirm).Seal(nil, nonce, nil, ad)
+}
+
+// Client runs the client side of the handshake over rw.
+func Client(rw io.ReadWriter, psk []byte) (*Session, error) {
+	randC := make([]byte, RandomSize)
+	if _, err := io.ReadFull(cryptorand.Reader, randC); err != nil {
+		return nil, err
+	}
+	if _, err := rw.Write(randC); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, RandomSize+acorn.TagSize)
+	if _, err := io.ReadFull(rw, msg); err != nil {
+		return nil, err
+	}
+	randS := msg[:RandomSize]
+	k := deriveKeys(psk, randC, randS)
+	if subtle.ConstantTimeCompare(msg[RandomSize:], confirm(&k, "server", randC, randS)) != 1 {
+		return nil, ErrAuthentication
+	}
+	if _, err := rw.Write(confirm(&k, "client", randC, randS)); err != nil {
+		return nil, err
+	}
+	s := &Session{SendKey: k.c2s, RecvKey: k.s2c}
+	copy(s.SendNonce[:], k.nonceC2S)
+	copy(s.RecvNonce[:], k.nonceS2C)
+	return s, nil
+}
+
+// Server runs the server side of the handshake over rw.
+func Server(rw io.ReadWriter, psk []byte) (*Session, error) {
+	randC := make([]byte, RandomSize)
+	if _, err := io.ReadFull(rw, randC); err != nil {
+		return nil, err
+	}
+	randS := make([]byte, RandomSize)
+	if _, err := io.ReadFull(cryptorand.Reader, randS); err != nil {
+		return nil, err
+	}
+	k := deriveKeys(psk, randC, randS)
+	msg := append(randS, confirm(&k, "server", randC, randS)...)
+	if _, err := rw.Write(msg); err != nil {
+		return nil, err
+	}
+	got := make([]byte, acorn.TagSize)
+	if _, err := io.ReadFull(rw, got); err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(got, confirm(&k, "client", randC, randS)) != 1 {
+		return nil, ErrAuthentication
+	}
+	s := &Session{SendKey: k.s2c, RecvKey: k.c2s}
+	copy(s.SendNonce[:], k.nonceS2C)
+	copy(s.RecvNonce[:], k.nonceC2S)
+	return s, nil
+}
@@ -0,0 +1,64 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornpsk
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+)
+
+var testPSK = []byte(strings.Repeat("password", 2))
+
+func handshake(clientPSK, serverPSK []byte) (c, s *Session, cerr, serr error) {
+	a, b := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s, serr = Server(b, serverPSK)
+		b.Close()
+		close(done)
+	}()
+	c, cerr = Client(a, clientPSK)
+	a.Close()
+	<-done
+	return
+}
+
+func TestHandshake(t *testing.T) {
+	c, s, cerr, serr := handshake(testPSK, testPSK)
+	if cerr != nil || serr != nil {
+		t.Fatal(cerr, serr)
+	}
+	if !bytes.Equal(c.SendKey, s.RecvKey) || !bytes.Equal(c.RecvKey, s.SendKey) ||
+		c.SendNonce != s.RecvNonce || c.RecvNonce != s.SendNonce {
+		t.Fatalf("sessions do not match:\n%+v\n%+v", c, s)
+	}
+	if bytes.Equal(c.SendKey, c.RecvKey) || bytes.Equal(c.SendKey, testPSK) {
+		t.Error("session keys are not distinct")
+	}
+	c2, _, _, _ := handshake(testPSK, testPSK)
+	if bytes.Equal(c.SendKey, c2.SendKey) {
+		t.Error("two handshakes gave the same keys")
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	_, _, cerr, serr := handshake(testPSK, []byte(strings.Repeat("PASSWORD", 2)))
+	if cerr != ErrAuthentication {
+		t.Errorf("client: got error %v, want %v", cerr, ErrAuthentication)
+	}
+	if serr == nil {
+		t.Error("server: handshake succeeded")
+	}
+}
+
+func TestNonce(t *testing.T) {
+	var start [16]byte
+	start[15] = 0x0f
+	n := Nonce(start, 0x0102)
+	want := [16]byte{14: 0x01, 15: 0x0d}
+	if n != want {
+		t.Errorf("Nonce = %x, want %x", n, want)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornradio protects payloads on constrained radio links, such
+// as LoRaWAN or MQTT-SN, where every byte on air counts.
+//
+// Each device has a 32-bit frame counter, which starts at 0 and goes up
+// by one for every frame, and a 64-bit device ID, which both ends know.
+// A frame is
+//
+//	header     uint8    see below
+//	counter    []byte   low CounterSize (1-4) bytes of the frame counter, big-endian
+//	ciphertext []byte
+//	tag        []byte   first TagSize bytes of the ACORN-128 tag
+//
+// The header holds the format version, 0, in bits 7-6, CounterSize-1 in
+// bits 5-4, and TagSize/4-1 in bits 3-2; bits 1-0 are zero. The receiver
+// rebuilds the full frame counter from the bytes it was sent and the last
+// counter it accepted, as LoRaWAN does. The 16-byte nonce is the device ID,
+// big-endian, followed by four zero bytes and the full frame counter,
+// big-endian. The header and counter bytes are the additional data.
+//
+// Sending fewer counter bytes and keeping less of the tag saves space
+// at the cost of security, which a Profile makes explicit.
+package acornradio
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+
+	"github.com/magical/go-acorn"
+)
+
+const version = 0
+
+var (
+	ErrAuthentication = errors.New("acornradio: message authentication failed")
+	ErrReplay         = errors.New("acornradio: replayed or out of range frame counter")
+	ErrExhausted      = errors.New("acornradio: frame counter exhausted")
+	errProfile        = errors.New("acornradio: frame does not match profile")
+	errShort          = errors.New("acornradio: frame too short")
+)
+
+// A Profile chooses the sizes of the counter and tag in a frame.
+// Both ends of a link must use the same Profile.
+type Profile struct {
+	// CounterSize is how many low bytes of the frame counter are sent:
+	// 1, 2, 3, or 4. The receiver can follow the counter across at most
+	// MaxGap lost frames in a row.
+	CounterSize int
+
+	// TagSize is how many bytes of the tag are sent: 4, 8, 12, or 16.
+	// Each forged frame is accepted with probability 2^-(8*TagSize).
+	TagSize int
+
+	// ShortTags must be set to use a TagSize of 4, acknowledging that
+	// an attacker who can send about 2^32 frames can expect to get
+	// one accepted.
+	ShortTags bool
+}
+
+// Default is a profile suitable for most links:
+// 2 counter bytes and 8 tag bytes, for 11 bytes of overhead.
+var Default = Profile{CounterSize: 2, TagSize: 8}
+
+func (p *Profile) check() error {
+	switch {
+	case p.CounterSize < 1 || p.CounterSize > 4:
+		return errors.New("acornradio: invalid counter size")
+	case p.TagSize < 4 || p.TagSize > acorn.TagSize || p.TagSize%4 != 0:
+		return errors.New("acornradio: invalid tag size")
+	case p.TagSize < 8 && !p.ShortTags:
+		return errors.New("acornradio: tag size below 8 requires ShortTags")
+	}
+	return nil
+}
+
+// Overhead returns how much longer a frame is than its payload.
+func (p *Profile) Overhead() int {
+	return 1 + p.CounterSize + p.TagSize
+}
+
+// MaxGap returns the most frames in a row that may be lost
+// without the receiver losing track of the frame counter.
+func (p *Profile) MaxGap() uint32 {
+	return 1<<uint(8*p.CounterSize-1) - 1
+}
+
+func (p *Profile) header() byte {
+	return version<<6 | byte(p.CounterSize-1)<<4 | byte(p.TagSize/4-1)<<2
+}
+
+type codec struct {
+	p        Profile
+	key      []byte
+	deviceID uint64
+	e        acorn.Engine
+}
+
+func newCodec(key []byte, deviceID uint64, p Profile) (codec, error) {
+	if err := p.check(); err != nil {
+		return codec{}, err
+	}
+	if len(key) != acorn.KeySize {
+		return codec{}, errors.New("acornradio: invalid key length")
+	}
+	return codec{p, append([]byte(nil), key...), deviceID, acorn.NewEngine()}, nil
+}
+
+// start initializes the engine for the frame with the given counter
+// and absorbs the frame's header.
+func (c *codec) start(ctr uint32, hdr []byte) {
+	var nonce [acorn.NonceSize]byte
+	binary.BigEndian.PutUint64(nonce[0:], c.deviceID)
+	binary.BigEndian.PutUint32(nonce[12:], ctr)
+	c.e.Init(c.key, nonce[:])
+	c.e.Absorb(hdr)
+}
+
+// A Sender seals frames from one device.
+// It is not safe for concurrent use.
+type Sender struct {
+	c   codec
+	ctr uint64
+}
+
+// NewSender returns a Sender for the device with the given ID,
+// whose frame counter starts at 0.
+func NewSender(key []byte, deviceID uint64, p Profile) (*Sender, error) {
+	c, err := newCodec(key, deviceID, p)
+	if err != nil {
+		return nil, err
+	}
+	return &Sender{c: c}, nil
+}
+
+// Profile returns the Sender's profile.
+func (s *Sender) Profile() Profile {
+	return s.c.p
+}
+
+// SetCounter sets the frame counter of the next frame, such as after a
+// device restarts from a counter kept in non-volatile memory. Counters
+// must never be reused with the same key.
+func (s *Sender) SetCounter(ctr uint32) {
+	s.ctr = uint64(ctr)
+}
+
+// Seal seals payload into the next frame, appends it to dst,
+// and returns the updated slice.
+func (s *Sender) Seal(dst, payload []byte) ([]byte, error) {
+	if s.ctr > 0xFFFFFFFF {
+		return dst, ErrExhausted
+	}
+	p := &s.c.p
+	ctr := uint32(s.ctr)
+	s.ctr++
+
+	n := len(dst)
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], ctr)
+	dst = append(dst, p.header())
+	dst = append(dst, b[4-p.CounterSize:]...)
+	hdr := dst[n:]
+	s.c.start(ctr, hdr)
+	dst = append(dst, payload...)
+	out := dst[len(dst)-len(payload):]
+	s.c.e.Crypt(out, payload, false)
+	var tag [acorn.TagSize]byte
+	s.c.e.Finalize(tag[:])
+	return append(dst, tag[:p.TagSize]...), nil
+}
+
+// A Receiver opens frames from one device.
+// It is not safe for concurrent use.
+type Receiver struct {
+	c    codec
+	next uint64 // lowest frame counter that will be accepted
+}
+
+// NewReceiver returns a Receiver for the device with the given ID.
+func NewReceiver(key []byte, deviceID uint64, p Profile) (*Receiver, error) {
+	c, err := newCodec(key, deviceID, p)
+	if err != nil {
+		return nil, err
+	}
+	return &Receiver{c: c}, nil
+}
+
+// SetCounter sets the lowest frame counter that will be accepted.
+func (r *Receiver) SetCounter(ctr uint32) {
+	r.next = uint64(ctr)
+}
+
+// expand returns the lowest full counter that is at least r.next
+// and ends in the given low bytes.
+func (r *Receiver) expand(low uint32) (uint32, bool) {
+	bits := uint(8 * r.c.p.CounterSize)
+	mask := uint64(1)<<bits - 1
+	full := r.next&^mask | uint64(low)
+	if full < r.next {
+		full += mask + 1
+	}
+	if full > 0xFFFFFFFF || full-r.next > uint64(r.c.p.MaxGap()) {
+		return 0, false
+	}
+	return uint32(full), true
+}
+
+// Open authenticates and decrypts a frame, appends the payload to dst,
+// and returns the updated slice and the frame's full counter.
+// Frames must arrive in order; a frame with a counter at or below
+// that of the last frame accepted is rejected.
+func (r *Receiver) Open(dst, frame []byte) ([]byte, uint32, error) {
+	p := &r.c.p
+	if len(frame) < p.Overhead() {
+		return dst, 0, errShort
+	}
+	if frame[0] != p.header() {
+		return dst, 0, errProfile
+	}
+	hdr := frame[:1+p.CounterSize]
+	var b [4]byte
+	copy(b[4-p.CounterSize:], hdr[1:])
+	ctr, ok := r.expand(binary.BigEndian.Uint32(b[:]))
+	if !ok {
+		return dst, 0, ErrReplay
+	}
+	ct := frame[len(hdr) : len(frame)-p.TagSize]
+	r.c.start(ctr, hdr)
+	ret, out := sliceForAppend(dst, len(ct))
+	r.c.e.Crypt(out, ct, true)
+	var tag [acorn.TagSize]byte
+	r.c.e.Finalize(tag[:])
+	if subtle.ConstantTimeCompare(tag[:p.TagSize], frame[len(frame)-p.TagSize:]) == 0 {
+		for i := range out {
+			out[i] = 0
+		}
+		return dst, ctr, ErrAuthentication
+	}
+	r.next = uint64(ctr) + 1
+	return ret, ctr, nil
+}
+
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
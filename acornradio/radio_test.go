@@ -0,0 +1,145 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornradio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/magical/go-acorn"
+)
+
+var testKey = []byte(strings.Repeat("password", 2))
+
+const testDevice = 0x0102030405060708
+
+func pair(t *testing.T, p Profile) (*Sender, *Receiver) {
+	s, err := NewSender(testKey, testDevice, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReceiver(testKey, testDevice, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, r
+}
+
+func TestProfiles(t *testing.T) {
+	for cs := 1; cs <= 4; cs++ {
+		for ts := 4; ts <= 16; ts += 4 {
+			p := Profile{CounterSize: cs, TagSize: ts, ShortTags: ts < 8}
+			s, r := pair(t, p)
+			for i := 0; i < 3; i++ {
+				payload := []byte("t=21.5")
+				f, err := s.Seal(nil, payload)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(f) != len(payload)+p.Overhead() {
+					t.Errorf("%+v: frame length %d, want %d", p, len(f), len(payload)+p.Overhead())
+				}
+				got, ctr, err := r.Open(nil, f)
+				if err != nil || !bytes.Equal(got, payload) || ctr != uint32(i) {
+					t.Errorf("%+v: got %q, %d, %v", p, got, ctr, err)
+				}
+			}
+		}
+	}
+	for _, p := range []Profile{
+		{CounterSize: 0, TagSize: 8},
+		{CounterSize: 5, TagSize: 8},
+		{CounterSize: 2, TagSize: 6},
+		{CounterSize: 2, TagSize: 20},
+		{CounterSize: 2, TagSize: 4},
+	} {
+		if _, err := NewSender(testKey, testDevice, p); err == nil {
+			t.Errorf("%+v: accepted invalid profile", p)
+		}
+	}
+}
+
+// A frame with a full tag is an ordinary ACORN-128 message,
+// which firmware can check against any implementation.
+func TestWireFormat(t *testing.T) {
+	p := Profile{CounterSize: 3, TagSize: 16}
+	s, _ := pair(t, p)
+	s.SetCounter(0x00abcdef)
+	payload := []byte("hello")
+	f, err := s.Seal(nil, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHdr := []byte{0x2c, 0xab, 0xcd, 0xef}
+	if !bytes.Equal(f[:4], wantHdr) {
+		t.Errorf("header = %x, want %x", f[:4], wantHdr)
+	}
+	nonce := make([]byte, acorn.NonceSize)
+	binary.BigEndian.PutUint64(nonce, testDevice)
+	binary.BigEndian.PutUint32(nonce[12:], 0x00abcdef)
+	want := acorn.NewAEAD(testKey).Seal(nil, nonce, payload, wantHdr)
+	if !bytes.Equal(f[4:], want) {
+		t.Errorf("sealed = %x, want %x", f[4:], want)
+	}
+}
+
+func TestCounter(t *testing.T) {
+	p := Profile{CounterSize: 2, TagSize: 8}
+	s, r := pair(t, p)
+	s.SetCounter(0xfffe)
+	r.SetCounter(0xfff0)
+	var frames [][]byte
+	for i := 0; i < 4; i++ {
+		f, _ := s.Seal(nil, []byte{byte(i)})
+		frames = append(frames, f)
+	}
+	// lose frame 1, then cross the 16-bit boundary
+	for _, i := range []int{0, 2, 3} {
+		if _, ctr, err := r.Open(nil, frames[i]); err != nil || ctr != 0xfffe+uint32(i) {
+			t.Errorf("frame %d: got counter %#x, error %v", i, ctr, err)
+		}
+	}
+	for _, i := range []int{1, 3} {
+		if _, _, err := r.Open(nil, frames[i]); err != ErrReplay {
+			t.Errorf("frame %d again: got error %v, want %v", i, err, ErrReplay)
+		}
+	}
+
+	// too many lost frames
+	s.SetCounter(0x10002 + p.MaxGap() + 1)
+	f, _ := s.Seal(nil, nil)
+	if _, _, err := r.Open(nil, f); err == nil {
+		t.Error("counter beyond MaxGap accepted")
+	}
+
+	s.SetCounter(0xffffffff)
+	if _, err := s.Seal(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Seal(nil, nil); err != ErrExhausted {
+		t.Errorf("got error %v, want %v", err, ErrExhausted)
+	}
+}
+
+func TestTamper(t *testing.T) {
+	s, r := pair(t, Default)
+	f, _ := s.Seal(nil, []byte("open valve 3"))
+	for i := range f {
+		bad := append([]byte(nil), f...)
+		bad[i] ^= 0x01
+		if _, _, err := r.Open(nil, bad); err == nil {
+			t.Errorf("byte %d: tampering not detected", i)
+		}
+	}
+	if _, _, err := r.Open(nil, f); err != nil {
+		t.Errorf("genuine frame rejected after forgeries: %v", err)
+	}
+	other, _ := NewReceiver(testKey, testDevice+1, Default)
+	s2, _ := NewSender(testKey, testDevice, Default)
+	f2, _ := s2.Seal(nil, []byte("x"))
+	if _, _, err := other.Open(nil, f2); err != ErrAuthentication {
+		t.Errorf("other device: got error %v, want %v", err, ErrAuthentication)
+	}
+}
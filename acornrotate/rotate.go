@@ -0,0 +1,247 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornrotate manages a set of ACORN-128 keys for scheduled
+// rotation across a fleet.
+//
+// Each key has an 8-byte ID, such as the one in a key file, and a period
+// in which it is active. Seal always uses the newest active key, and
+// Open accepts any key which is active, give or take an overlap window.
+// The overlap lets a fleet switch keys without losing messages: a key
+// opens messages from the overlap before it activates, for hosts whose
+// clocks run ahead or which switched early, until the overlap after it
+// retires, for messages still in flight.
+//
+// A sealed message is
+//
+//	id [8]byte || nonce [16]byte || ciphertext || tag [16]byte
+//
+// where the nonce is random. The ID is not authenticated on its own, but
+// a message whose ID is changed names a different key and fails to open.
+package acornrotate
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/magical/go-acorn"
+)
+
+// IDSize is the length of a key ID.
+const IDSize = 8
+
+// Overhead is how much longer a sealed message is than its plaintext.
+const Overhead = IDSize + acorn.NonceSize + acorn.TagSize
+
+var (
+	ErrNoActiveKey    = errors.New("acornrotate: no active key")
+	ErrUnknownKey     = errors.New("acornrotate: message sealed with an unknown key")
+	ErrInactiveKey    = errors.New("acornrotate: message sealed with a key that is not active")
+	ErrAuthentication = errors.New("acornrotate: message authentication failed")
+	errDuplicateID    = errors.New("acornrotate: duplicate key ID")
+	errDuplicateKey   = errors.New("acornrotate: key is already in the registry under another ID")
+	errKeySize        = errors.New("acornrotate: invalid key length")
+	errErased         = errors.New("acornrotate: keys have been erased")
+)
+
+// A Key is a key and the period in which it is active.
+type Key struct {
+	ID  [IDSize]byte
+	Key []byte
+
+	// Activate is when the key starts sealing messages.
+	Activate time.Time
+
+	// Retire is when the key stops sealing messages.
+	// The zero value means never.
+	Retire time.Time
+}
+
+// Equal reports whether k and other hold the same key material,
+// comparing it in constant time. The IDs and times are not compared.
+func (k *Key) Equal(other *Key) bool {
+	return acorn.KeysEqual(k.Key, other.Key)
+}
+
+type entry struct {
+	Key
+	aead *acorn.StoredAEAD
+}
+
+// A KeyRegistry holds keys and seals and opens messages with them.
+// It is safe for concurrent use.
+//
+// acorn.Shutdown or Close erases the keys, after which the registry is
+// empty and refuses to add more.
+type KeyRegistry struct {
+	overlap time.Duration
+	now     func() time.Time
+
+	mu     sync.RWMutex
+	keys   []entry // sorted by activation time, newest first
+	erased bool
+	cancel func()
+}
+
+// NewKeyRegistry returns an empty KeyRegistry. Keys open messages from
+// overlap before their activation until overlap after their retirement.
+func NewKeyRegistry(overlap time.Duration) *KeyRegistry {
+	r := &KeyRegistry{overlap: overlap, now: time.Now}
+	r.cancel = acorn.OnShutdown(r.erase)
+	return r
+}
+
+// Close erases the keys and unregisters the registry from
+// acorn.Shutdown. It is safe to call more than once.
+func (r *KeyRegistry) Close() error {
+	r.erase()
+	r.cancel()
+	return nil
+}
+
+func (r *KeyRegistry) erase() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.keys {
+		e.aead.Close()
+	}
+	r.keys = nil
+	r.erased = true
+}
+
+// Add adds a key to the registry. It is an error to add a key with
+// the ID of one already there, or one that is already there under
+// another ID, since rotating to the same key would protect nothing.
+func (r *KeyRegistry) Add(k Key) error {
+	if len(k.Key) != acorn.KeySize {
+		return errKeySize
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.erased {
+		return errErased
+	}
+	i := len(r.keys)
+	for j, old := range r.keys {
+		if old.ID == k.ID {
+			return errDuplicateID
+		}
+		if i == len(r.keys) && k.Activate.After(old.Activate) {
+			i = j
+		}
+	}
+	a, err := acorn.NewAEADStore(k.Key, nil)
+	if err != nil {
+		return err
+	}
+	for _, old := range r.keys {
+		if old.aead.Equal(a) {
+			a.Close()
+			return errDuplicateKey
+		}
+	}
+	e := entry{Key: k, aead: a}
+	e.Key.Key = nil // only the AEAD keeps the key
+	r.keys = append(r.keys, entry{})
+	copy(r.keys[i+1:], r.keys[i:])
+	r.keys[i] = e
+	return nil
+}
+
+// Remove removes the key with the given ID, if there is one.
+func (r *KeyRegistry) Remove(id [IDSize]byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, e := range r.keys {
+		if e.ID == id {
+			e.aead.Close()
+			r.keys = append(r.keys[:i], r.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+// Prune removes the keys which have retired for longer than the overlap,
+// and returns their IDs.
+func (r *KeyRegistry) Prune() [][IDSize]byte {
+	now := r.now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids [][IDSize]byte
+	keys := r.keys[:0]
+	for _, e := range r.keys {
+		if !e.Retire.IsZero() && !now.Before(e.Retire.Add(r.overlap)) {
+			ids = append(ids, e.ID)
+			e.aead.Close()
+			continue
+		}
+		keys = append(keys, e)
+	}
+	r.keys = keys
+	return ids
+}
+
+// Current returns the ID of the key that Seal would use now.
+func (r *KeyRegistry) Current() ([IDSize]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, err := r.current()
+	return e.ID, err
+}
+
+// current returns the newest active key. r must be read-locked.
+func (r *KeyRegistry) current() (entry, error) {
+	now := r.now()
+	for _, e := range r.keys {
+		if !now.Before(e.Activate) && (e.Retire.IsZero() || now.Before(e.Retire)) {
+			return e, nil
+		}
+	}
+	return entry{}, ErrNoActiveKey
+}
+
+// Seal seals plaintext with the newest active key under a random nonce,
+// and appends the sealed message to dst.
+// dst and plaintext must not overlap.
+func (r *KeyRegistry) Seal(dst, plaintext, additionalData []byte) ([]byte, error) {
+	// hold the lock throughout, so that the key is not erased in use
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, err := r.current()
+	if err != nil {
+		return dst, err
+	}
+	out := append(dst, e.ID[:]...)
+	return acorn.SealWithRandomNonce(e.aead, out, plaintext, additionalData)
+}
+
+// Open opens a sealed message and appends the plaintext to dst.
+func (r *KeyRegistry) Open(dst, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < Overhead {
+		return dst, ErrAuthentication
+	}
+	var id [IDSize]byte
+	copy(id[:], sealed)
+	now := r.now()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var e entry
+	found := false
+	for _, k := range r.keys {
+		if k.ID == id {
+			e, found = k, true
+			break
+		}
+	}
+	if !found {
+		return dst, ErrUnknownKey
+	}
+	if now.Before(e.Activate.Add(-r.overlap)) || (!e.Retire.IsZero() && !now.Before(e.Retire.Add(r.overlap))) {
+		return dst, ErrInactiveKey
+	}
+	out, err := acorn.OpenWithNonce(e.aead, dst, sealed[IDSize:], additionalData)
+	if err != nil {
+		return dst, ErrAuthentication
+	}
+	return out, nil
+}
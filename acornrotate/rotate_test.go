@@ -0,0 +1,160 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornrotate
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func testKey(id byte, activate, retire time.Time) Key {
+	return Key{
+		ID:       [IDSize]byte{id},
+		Key:      bytes.Repeat([]byte{id}, 16),
+		Activate: activate,
+		Retire:   retire,
+	}
+}
+
+func TestRotation(t *testing.T) {
+	r := NewKeyRegistry(time.Hour)
+	now := t0
+	r.now = func() time.Time { return now }
+
+	if _, err := r.Seal(nil, []byte("x"), nil); err != ErrNoActiveKey {
+		t.Fatalf("Seal with no keys returned %v, want ErrNoActiveKey", err)
+	}
+	day := 24 * time.Hour
+	// added out of order, to check the sorting
+	for _, k := range []Key{
+		testKey(2, t0.Add(day), t0.Add(2*day)),
+		testKey(1, t0, t0.Add(day)),
+		testKey(3, t0.Add(2*day), time.Time{}),
+	} {
+		if err := r.Add(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Add(testKey(1, t0, time.Time{})); err == nil {
+		t.Errorf("Add of a duplicate ID succeeded")
+	}
+	reused := testKey(1, t0.Add(3*day), time.Time{})
+	reused.ID = [IDSize]byte{4}
+	if err := r.Add(reused); err != errDuplicateKey {
+		t.Errorf("Add of a key under a second ID returned %v, want errDuplicateKey", err)
+	}
+	if k1, k2 := testKey(1, t0, t0), testKey(2, t0, t0); !k1.Equal(&reused) || k1.Equal(&k2) {
+		t.Errorf("Key.Equal is wrong")
+	}
+	if err := r.Add(Key{ID: [IDSize]byte{9}, Key: []byte("short")}); err == nil {
+		t.Errorf("Add of a short key succeeded")
+	}
+
+	seal := func() []byte {
+		t.Helper()
+		out, err := r.Seal([]byte("hdr"), []byte("message"), []byte("ad"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(out, []byte("hdr")) || len(out) != 3+len("message")+Overhead {
+			t.Fatalf("Seal = %x", out)
+		}
+		return out[3:]
+	}
+	open := func(sealed []byte) error {
+		t.Helper()
+		pt, err := r.Open(nil, sealed, []byte("ad"))
+		if err == nil && string(pt) != "message" {
+			t.Fatalf("Open = %q", pt)
+		}
+		return err
+	}
+
+	m1 := seal()
+	if m1[0] != 1 {
+		t.Errorf("sealed with key %d at t0, want 1", m1[0])
+	}
+	// just before key 2 activates, a host which switched early
+	now = t0.Add(day - time.Minute)
+	m2 := func() []byte {
+		defer func(old time.Time) { now = old }(now)
+		now = t0.Add(day)
+		return seal()
+	}()
+	if m2[0] != 2 {
+		t.Errorf("sealed with key %d on day 1, want 2", m2[0])
+	}
+	if err := open(m2); err != nil {
+		t.Errorf("opening a message from a host ahead: %v", err)
+	}
+	if id, _ := r.Current(); id[0] != 1 {
+		t.Errorf("current key is %d before day 1, want 1", id[0])
+	}
+
+	// key 1 retired, but within the overlap
+	now = t0.Add(day + 30*time.Minute)
+	if err := open(m1); err != nil {
+		t.Errorf("opening within the overlap: %v", err)
+	}
+	now = t0.Add(day + time.Hour)
+	if err := open(m1); err != ErrInactiveKey {
+		t.Errorf("opening after the overlap returned %v, want ErrInactiveKey", err)
+	}
+	// key 3 never retires
+	now = t0.Add(100 * day)
+	if m3 := seal(); m3[0] != 3 || open(m3) != nil {
+		t.Errorf("key 3 does not work on day 100")
+	}
+
+	if ids := r.Prune(); len(ids) != 2 {
+		t.Errorf("Prune removed %v, want keys 1 and 2", ids)
+	}
+	if err := open(m1); err != ErrUnknownKey {
+		t.Errorf("opening with a pruned key returned %v, want ErrUnknownKey", err)
+	}
+
+	m3 := seal()
+	m3[len(m3)-1] ^= 1
+	if err := open(m3); err != ErrAuthentication {
+		t.Errorf("opening a forgery returned %v, want ErrAuthentication", err)
+	}
+	if err := open(m3[:Overhead-1]); err != ErrAuthentication {
+		t.Errorf("opening a short message returned %v, want ErrAuthentication", err)
+	}
+	r.Remove([IDSize]byte{3})
+	if _, err := r.Seal(nil, nil, nil); err != ErrNoActiveKey {
+		t.Errorf("Seal after removing every key returned %v", err)
+	}
+}
+
+func TestErase(t *testing.T) {
+	r := NewKeyRegistry(0)
+	if err := r.Add(testKey(1, time.Time{}, time.Time{})); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := r.Seal(nil, []byte("message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.erase() // as acorn.Shutdown does
+	if _, err := r.Seal(nil, []byte("message"), nil); err != ErrNoActiveKey {
+		t.Errorf("Seal after erasing returned %v, want ErrNoActiveKey", err)
+	}
+	if _, err := r.Open(nil, sealed, nil); err != ErrUnknownKey {
+		t.Errorf("Open after erasing returned %v, want ErrUnknownKey", err)
+	}
+	if err := r.Add(testKey(2, time.Time{}, time.Time{})); err == nil {
+		t.Errorf("Add after erasing succeeded")
+	}
+
+	r = NewKeyRegistry(0)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Add(testKey(1, time.Time{}, time.Time{})); err == nil {
+		t.Errorf("Add after Close succeeded")
+	}
+}
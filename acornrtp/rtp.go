@@ -0,0 +1,233 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornrtp protects RTP media packets with ACORN-128,
+// in the manner of SRTP (RFC 3711), for low-latency media experiments.
+//
+// Each synchronization source (SSRC) has its own key, derived from the
+// master key and the SSRC. A protected packet is the RTP header, in the
+// clear, followed by the sealed payload and a 16-byte tag. The nonce is
+//
+//	ssrc       uint32   big-endian
+//	zero       [4]byte
+//	roc        uint32   big-endian rollover counter
+//	zero       [2]byte
+//	seq        uint16   big-endian RTP sequence number
+//
+// where the rollover counter counts how many times the sequence number
+// has wrapped around. It is not sent; the receiver estimates it as in
+// RFC 3711, section 3.3.1. The header is passed as additional data,
+// unless Config.UnauthenticatedHeader is set, in which case middleboxes
+// may rewrite it. The sequence number and SSRC are bound to the packet
+// through the nonce and key either way.
+//
+// A Context keeps the state for one direction: use separate Contexts,
+// with separate master keys, for sending and receiving.
+package acornrtp
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/magical/go-acorn"
+	"github.com/magical/go-acorn/acorndgram"
+)
+
+const headerSize = 12
+
+var (
+	ErrAuthentication = errors.New("acornrtp: message authentication failed")
+	ErrReplay         = errors.New("acornrtp: replayed or too old packet")
+	errHeader         = errors.New("acornrtp: invalid RTP header")
+)
+
+// A Config holds optional settings for a Context.
+// The zero value is the default configuration.
+type Config struct {
+	// If UnauthenticatedHeader is set, the RTP header is not
+	// passed as additional data.
+	UnauthenticatedHeader bool
+
+	// WindowSize is the size of the replay window, 64 or 128,
+	// or zero for 128.
+	WindowSize int
+}
+
+// A Context protects or unprotects the packets of one direction of
+// an RTP session. It is safe for concurrent use.
+type Context struct {
+	master []byte
+	config Config
+
+	mu      sync.Mutex
+	streams map[uint32]*stream
+}
+
+type stream struct {
+	aead    cipher.AEAD
+	started bool
+	roc     uint32
+	seq     uint16 // highest sequence number seen
+	window  *acorndgram.ReplayWindow
+}
+
+// NewContext returns a Context that uses the given 16-byte master key.
+func NewContext(masterKey []byte, config *Config) *Context {
+	if len(masterKey) != acorn.KeySize {
+		panic("acornrtp: invalid key length")
+	}
+	c := &Context{
+		master:  append([]byte(nil), masterKey...),
+		streams: make(map[uint32]*stream),
+	}
+	if config != nil {
+		c.config = *config
+	}
+	if c.config.WindowSize == 0 {
+		c.config.WindowSize = 128
+	}
+	return c
+}
+
+func (c *Context) stream(ssrc uint32) *stream {
+	s := c.streams[ssrc]
+	if s == nil {
+		m := hmac.New(sha256.New, c.master)
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], ssrc)
+		m.Write([]byte("acornrtp ssrc key\x00"))
+		m.Write(b[:])
+		s = &stream{
+			aead:   acorn.NewAEAD(m.Sum(nil)[:acorn.KeySize]),
+			window: acorndgram.NewReplayWindow(c.config.WindowSize),
+		}
+		c.streams[ssrc] = s
+	}
+	return s
+}
+
+// estimate returns the rollover counter for seq, as in RFC 3711,
+// appendix A.
+func (s *stream) estimate(seq uint16) uint32 {
+	if !s.started {
+		return 0
+	}
+	if s.seq < 1<<15 {
+		if seq > s.seq && seq-s.seq > 1<<15 && s.roc > 0 {
+			return s.roc - 1
+		}
+		return s.roc
+	}
+	if s.seq-1<<15 > seq {
+		return s.roc + 1
+	}
+	return s.roc
+}
+
+// update records that the packet with index (roc, seq) was sent or received.
+func (s *stream) update(roc uint32, seq uint16) {
+	if !s.started || roc > s.roc || (roc == s.roc && seq > s.seq) {
+		s.roc, s.seq = roc, seq
+	}
+	s.started = true
+}
+
+// headerLen returns the length of the RTP header at the start of packet.
+func headerLen(packet []byte) (int, error) {
+	if len(packet) < headerSize || packet[0]>>6 != 2 {
+		return 0, errHeader
+	}
+	n := headerSize + 4*int(packet[0]&0x0f)
+	if packet[0]&0x10 != 0 {
+		if len(packet) < n+4 {
+			return 0, errHeader
+		}
+		n += 4 + 4*int(binary.BigEndian.Uint16(packet[n+2:]))
+	}
+	if len(packet) < n {
+		return 0, errHeader
+	}
+	return n, nil
+}
+
+func nonce(ssrc, roc uint32, seq uint16) []byte {
+	n := make([]byte, acorn.NonceSize)
+	binary.BigEndian.PutUint32(n[0:], ssrc)
+	binary.BigEndian.PutUint32(n[8:], roc)
+	binary.BigEndian.PutUint16(n[14:], seq)
+	return n
+}
+
+func (c *Context) ad(header []byte) []byte {
+	if c.config.UnauthenticatedHeader {
+		return nil
+	}
+	return header
+}
+
+// Protect seals an RTP packet, appends it to dst, and returns the
+// updated slice. Packets from each SSRC must be protected in order.
+func (c *Context) Protect(dst, packet []byte) ([]byte, error) {
+	n, err := headerLen(packet)
+	if err != nil {
+		return dst, err
+	}
+	hdr := packet[:n]
+	seq := binary.BigEndian.Uint16(hdr[2:])
+	ssrc := binary.BigEndian.Uint32(hdr[8:])
+
+	c.mu.Lock()
+	s := c.stream(ssrc)
+	roc := s.estimate(seq)
+	s.update(roc, seq)
+	c.mu.Unlock()
+
+	dst = append(dst, hdr...)
+	return s.aead.Seal(dst, nonce(ssrc, roc, seq), packet[n:], c.ad(hdr)), nil
+}
+
+// Unprotect authenticates and decrypts a packet sealed by Protect,
+// appends the RTP packet to dst, and returns the updated slice.
+// Packets may arrive out of order, but replayed packets are rejected.
+func (c *Context) Unprotect(dst, packet []byte) ([]byte, error) {
+	n, err := headerLen(packet)
+	if err != nil {
+		return dst, err
+	}
+	if len(packet)-n < acorn.TagSize {
+		return dst, ErrAuthentication
+	}
+	hdr := packet[:n]
+	seq := binary.BigEndian.Uint16(hdr[2:])
+	ssrc := binary.BigEndian.Uint32(hdr[8:])
+
+	c.mu.Lock()
+	s := c.stream(ssrc)
+	roc := s.estimate(seq)
+	index := uint64(roc)<<16 | uint64(seq)
+	fresh := s.window.Check(index)
+	c.mu.Unlock()
+	if !fresh {
+		return dst, ErrReplay
+	}
+
+	out := append(dst, hdr...)
+	out, err = s.aead.Open(out, nonce(ssrc, roc, seq), packet[n:], c.ad(hdr))
+	if err != nil {
+		return dst, ErrAuthentication
+	}
+
+	c.mu.Lock()
+	fresh = s.window.Update(index)
+	if fresh {
+		s.update(roc, seq)
+	}
+	c.mu.Unlock()
+	if !fresh {
+		return dst, ErrReplay
+	}
+	return out, nil
+}
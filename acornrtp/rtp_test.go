@@ -0,0 +1,108 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornrtp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+var testKey = []byte(strings.Repeat("password", 2))
+
+// rtpPacket builds an RTP packet with the given sequence number and SSRC,
+// csrcs contributing sources, and a header extension if ext is set.
+func rtpPacket(seq uint16, ssrc uint32, csrcs int, ext bool, payload string) []byte {
+	p := make([]byte, headerSize)
+	p[0] = 2<<6 | byte(csrcs)
+	p[1] = 96
+	binary.BigEndian.PutUint16(p[2:], seq)
+	binary.BigEndian.PutUint32(p[4:], uint32(seq)*160)
+	binary.BigEndian.PutUint32(p[8:], ssrc)
+	p = append(p, make([]byte, 4*csrcs)...)
+	if ext {
+		p[0] |= 0x10
+		p = append(p, 0xbe, 0xde, 0, 1, 1, 2, 3, 4)
+	}
+	return append(p, payload...)
+}
+
+func TestRoundTrip(t *testing.T) {
+	tx, rx := NewContext(testKey, nil), NewContext(testKey, nil)
+	for _, ssrc := range []uint32{1, 0xdeadbeef} {
+		for i := 0; i < 10; i++ {
+			seq := uint16(65530 + i) // wraps around
+			p := rtpPacket(seq, ssrc, i%3, i%2 == 0, "frame")
+			sealed, err := tx.Protect(nil, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(sealed[:len(p)-5], p[:len(p)-5]) {
+				t.Errorf("ssrc %x seq %d: header changed", ssrc, seq)
+			}
+			got, err := rx.Unprotect(nil, sealed)
+			if err != nil || !bytes.Equal(got, p) {
+				t.Errorf("ssrc %x seq %d: got %x, %v", ssrc, seq, got, err)
+			}
+		}
+		if s := rx.streams[ssrc]; s.roc != 1 {
+			t.Errorf("ssrc %x: roc = %d, want 1", ssrc, s.roc)
+		}
+	}
+}
+
+func TestReorder(t *testing.T) {
+	tx, rx := NewContext(testKey, nil), NewContext(testKey, nil)
+	var sealed [][]byte
+	for i := 0; i < 6; i++ {
+		p, _ := tx.Protect(nil, rtpPacket(uint16(65533+i), 7, 0, false, "x"))
+		sealed = append(sealed, p)
+	}
+	// 65533, 65535, 0, 65534, 2, 1
+	for _, i := range []int{0, 2, 3, 1, 5, 4} {
+		if _, err := rx.Unprotect(nil, sealed[i]); err != nil {
+			t.Errorf("packet %d: %v", i, err)
+		}
+	}
+	for _, i := range []int{1, 3} {
+		if _, err := rx.Unprotect(nil, sealed[i]); err != ErrReplay {
+			t.Errorf("packet %d again: got error %v, want %v", i, err, ErrReplay)
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	for _, unauth := range []bool{false, true} {
+		config := &Config{UnauthenticatedHeader: unauth}
+		tx := NewContext(testKey, config)
+		sealed, _ := tx.Protect(nil, rtpPacket(10, 7, 0, false, "voice"))
+
+		marked := append([]byte(nil), sealed...)
+		marked[1] |= 0x80 // marker bit
+		_, err := NewContext(testKey, config).Unprotect(nil, marked)
+		if unauth && err != nil {
+			t.Errorf("unauthenticated header: marker change rejected: %v", err)
+		}
+		if !unauth && err != ErrAuthentication {
+			t.Errorf("authenticated header: marker change got error %v", err)
+		}
+
+		moved := append([]byte(nil), sealed...)
+		moved[3]++ // sequence number
+		if _, err := NewContext(testKey, config).Unprotect(nil, moved); err != ErrAuthentication {
+			t.Errorf("unauth=%v: sequence change got error %v", unauth, err)
+		}
+	}
+
+	for _, p := range [][]byte{
+		nil,
+		make([]byte, headerSize),           // version 0
+		rtpPacket(1, 1, 2, false, "")[:15], // short CSRC list
+		rtpPacket(1, 1, 0, true, "")[:15],  // short extension
+	} {
+		if _, err := NewContext(testKey, nil).Protect(nil, p); err != errHeader {
+			t.Errorf("%x: got error %v, want %v", p, err, errHeader)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornsql provides an encrypted column type for database/sql.
+//
+// A Value seals its plaintext when it is written to the database and
+// opens it when it is read back, so that the column is encrypted at rest
+// and any change to it is detected. It is stored as bytes:
+//
+//	key id [8]byte || nonce [16]byte || ciphertext || tag [16]byte
+//
+// The additional data is the table and column name followed by the key
+// ID, so a value copied to another column fails to open. Values copied
+// between rows of the same column are not detected; bind them to their
+// rows at a higher level if that matters.
+//
+// For example,
+//
+//	var ssnColumn = &acornsql.Column{Keys: keys, Table: "users", Name: "ssn"}
+//
+//	db.Exec("INSERT INTO users (name, ssn) VALUES (?, ?)",
+//		name, ssnColumn.Value([]byte(ssn)))
+//
+//	ssn := ssnColumn.Value(nil)
+//	err := db.QueryRow("SELECT ssn FROM users WHERE name = ?", name).Scan(ssn)
+package acornsql
+
+import (
+	"crypto/cipher"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"github.com/magical/go-acorn"
+)
+
+// IDSize is the length of a key ID.
+const IDSize = 8
+
+var (
+	ErrInvalid        = errors.New("acornsql: invalid encrypted value")
+	ErrAuthentication = errors.New("acornsql: message authentication failed")
+)
+
+// A KeyProvider supplies the keys for a column.
+type KeyProvider interface {
+	// Current returns the ID of the key to seal new values with.
+	Current() ([IDSize]byte, error)
+
+	// AEAD returns an AEAD for the key with the given ID.
+	AEAD(id [IDSize]byte) (cipher.AEAD, error)
+}
+
+// ErrUnknownKey is returned by the KeyProvider from StaticKeys,
+// and so by Value.Scan, for a key it does not have.
+var ErrUnknownKey = errors.New("acornsql: unknown key")
+
+// StaticKeys returns a KeyProvider with a fixed set of keys,
+// which seals with the key current. Its keys must be the
+// right length for acorn.NewAEAD, which panics otherwise.
+func StaticKeys(current [IDSize]byte, keys map[[IDSize]byte][]byte) KeyProvider {
+	s := staticKeys{current: current, aeads: make(map[[IDSize]byte]cipher.AEAD)}
+	for id, key := range keys {
+		s.aeads[id] = acorn.NewAEAD(key)
+	}
+	return s
+}
+
+type staticKeys struct {
+	current [IDSize]byte
+	aeads   map[[IDSize]byte]cipher.AEAD
+}
+
+func (s staticKeys) Current() ([IDSize]byte, error) { return s.current, nil }
+
+func (s staticKeys) AEAD(id [IDSize]byte) (cipher.AEAD, error) {
+	a, ok := s.aeads[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return a, nil
+}
+
+// A Column identifies an encrypted column and where its keys come from.
+type Column struct {
+	Keys  KeyProvider
+	Table string
+	Name  string
+}
+
+// Value returns a Value in the column with the given plaintext,
+// which is NULL if plaintext is nil.
+func (c *Column) Value(plaintext []byte) *Value {
+	return &Value{Column: c, Plaintext: plaintext, Valid: plaintext != nil}
+}
+
+func (c *Column) additionalData(id [IDSize]byte) []byte {
+	ad := make([]byte, 0, len(c.Table)+len(c.Name)+2+IDSize)
+	ad = append(ad, c.Table...)
+	ad = append(ad, 0)
+	ad = append(ad, c.Name...)
+	ad = append(ad, 0)
+	return append(ad, id[:]...)
+}
+
+// A Value is the plaintext of a value in an encrypted column.
+// It implements driver.Valuer and sql.Scanner.
+type Value struct {
+	Column    *Column
+	Plaintext []byte
+	Valid     bool // false if the value is NULL
+}
+
+var (
+	_ driver.Valuer = (*Value)(nil)
+	_ sql.Scanner   = (*Value)(nil)
+)
+
+// Value seals the plaintext with the column's current key.
+func (v *Value) Value() (driver.Value, error) {
+	if !v.Valid {
+		return nil, nil
+	}
+	c := v.Column
+	id, err := c.Keys.Current()
+	if err != nil {
+		return nil, err
+	}
+	a, err := c.Keys.AEAD(id)
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), id[:]...)
+	return acorn.SealWithRandomNonce(a, out, v.Plaintext, c.additionalData(id))
+}
+
+// Scan opens a value read from the database, which may be bytes,
+// a string, or NULL.
+func (v *Value) Scan(src interface{}) error {
+	var b []byte
+	switch src := src.(type) {
+	case nil:
+		v.Plaintext, v.Valid = nil, false
+		return nil
+	case []byte:
+		b = src
+	case string:
+		b = []byte(src)
+	default:
+		return fmt.Errorf("acornsql: cannot scan %T into an encrypted value", src)
+	}
+	if len(b) < IDSize+acorn.NonceSize+acorn.TagSize {
+		return ErrInvalid
+	}
+	var id [IDSize]byte
+	copy(id[:], b)
+	c := v.Column
+	a, err := c.Keys.AEAD(id)
+	if err != nil {
+		return err
+	}
+	// the driver may reuse src, so the plaintext gets its own memory
+	p, err := acorn.OpenWithNonce(a, nil, b[IDSize:], c.additionalData(id))
+	if err != nil {
+		return ErrAuthentication
+	}
+	v.Plaintext, v.Valid = p, true
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornsql
+
+import (
+	"bytes"
+	"testing"
+)
+
+var (
+	oldID = [IDSize]byte{1}
+	newID = [IDSize]byte{2}
+)
+
+func testKeys(current [IDSize]byte) KeyProvider {
+	return StaticKeys(current, map[[IDSize]byte][]byte{
+		oldID: bytes.Repeat([]byte{1}, 16),
+		newID: bytes.Repeat([]byte{2}, 16),
+	})
+}
+
+func TestRoundTrip(t *testing.T) {
+	col := &Column{Keys: testKeys(oldID), Table: "users", Name: "ssn"}
+	stored, err := col.Value([]byte("123-45-6789")).Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := stored.([]byte)
+	if bytes.Contains(b, []byte("6789")) || !bytes.HasPrefix(b, oldID[:]) {
+		t.Errorf("stored value %x", b)
+	}
+
+	// after rotation, old values still open
+	col.Keys = testKeys(newID)
+	for _, src := range []interface{}{b, string(b)} {
+		v := col.Value(nil)
+		if err := v.Scan(src); err != nil || !v.Valid || string(v.Plaintext) != "123-45-6789" {
+			t.Errorf("Scan(%T) = %q, %v, %v", src, v.Plaintext, v.Valid, err)
+		}
+	}
+	stored2, _ := col.Value([]byte("x")).Value()
+	if !bytes.HasPrefix(stored2.([]byte), newID[:]) {
+		t.Errorf("a new value was not sealed with the current key")
+	}
+
+	other := &Column{Keys: col.Keys, Table: "users", Name: "phone"}
+	if err := other.Value(nil).Scan(b); err != ErrAuthentication {
+		t.Errorf("Scan in another column returned %v, want ErrAuthentication", err)
+	}
+	tampered := append([]byte(nil), b...)
+	tampered[len(tampered)-1] ^= 1
+	if err := col.Value(nil).Scan(tampered); err != ErrAuthentication {
+		t.Errorf("Scan of a tampered value returned %v, want ErrAuthentication", err)
+	}
+	if err := col.Value(nil).Scan(b[:20]); err != ErrInvalid {
+		t.Errorf("Scan of a short value returned %v, want ErrInvalid", err)
+	}
+	unknown := append([]byte(nil), b...)
+	unknown[0] = 9
+	if err := col.Value(nil).Scan(unknown); err != ErrUnknownKey {
+		t.Errorf("Scan with an unknown key returned %v, want ErrUnknownKey", err)
+	}
+	if err := col.Value(nil).Scan(42); err == nil {
+		t.Errorf("Scan of an int succeeded")
+	}
+}
+
+func TestNull(t *testing.T) {
+	col := &Column{Keys: testKeys(oldID), Table: "t", Name: "c"}
+	if v, err := col.Value(nil).Value(); v != nil || err != nil {
+		t.Errorf("NULL Value() = %v, %v", v, err)
+	}
+	v := col.Value([]byte("x"))
+	if err := v.Scan(nil); err != nil || v.Valid || v.Plaintext != nil {
+		t.Errorf("Scan(nil) gave %+v, %v", v, err)
+	}
+	// an empty value is not NULL
+	stored, err := col.Value([]byte{}).Value()
+	if err != nil || stored == nil {
+		t.Fatalf("empty Value() = %v, %v", stored, err)
+	}
+	if err := v.Scan(stored); err != nil || !v.Valid || len(v.Plaintext) != 0 {
+		t.Errorf("Scan of an empty value gave %+v, %v", v, err)
+	}
+}
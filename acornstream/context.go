@@ -0,0 +1,63 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornstream
+
+import (
+	"context"
+	"io"
+)
+
+// EncryptContext encrypts src to dst as a stream, using the settings in
+// c, which may be nil. It checks ctx between chunks, and returns ctx.Err()
+// if ctx is done before the end of src, so that a dropped client or a
+// shutdown stops work on a large stream promptly. The final chunk is only
+// written once src has been read to the end; after an error, dst holds an
+// incomplete stream that will fail to decrypt.
+func EncryptContext(ctx context.Context, dst io.Writer, src io.Reader, key []byte, c *Config) error {
+	if c == nil {
+		c = &Config{}
+	}
+	w, err := NewWriterConfig(dst, key, c)
+	if err != nil {
+		return err
+	}
+	if err := copyContext(ctx, w, src, w.header.ChunkSize); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// DecryptContext decrypts the stream in src and writes the plaintext
+// to dst, checking ctx between chunks like EncryptContext. As with a
+// Reader, the plaintext is written as it is authenticated, one chunk at
+// a time, and must be discarded if DecryptContext returns an error.
+func DecryptContext(ctx context.Context, dst io.Writer, src io.Reader, key []byte) error {
+	r, err := NewReader(src, key)
+	if err != nil {
+		return err
+	}
+	return copyContext(ctx, dst, r, r.header.ChunkSize)
+}
+
+// copyContext copies src to dst in pieces of up to size bytes,
+// checking ctx before each one.
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader, size int) error {
+	buf := make([]byte, size)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
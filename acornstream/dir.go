@@ -0,0 +1,225 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornstream
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// EncryptDir writes the directory tree rooted at dir to w
+// as an encrypted tar archive.
+// Regular files, directories, and symbolic links are stored along with
+// their permissions and modification times; other file types are an error.
+func EncryptDir(w io.Writer, key []byte, dir string) error {
+	sw, err := NewWriter(w, key)
+	if err != nil {
+		return err
+	}
+	if err := WriteDir(sw, dir); err != nil {
+		return err
+	}
+	return sw.Close()
+}
+
+// WriteDir writes the directory tree rooted at dir to w as a tar archive
+// in the same way as EncryptDir. It is for callers that need to configure
+// the Writer themselves; w is typically a Writer, which the caller must close.
+func WriteDir(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		var link string
+		switch mode := fi.Mode(); {
+		case mode.IsRegular():
+		case mode.IsDir():
+			rel += "/"
+		case mode&os.ModeSymlink != 0:
+			if link, err = os.Readlink(name); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("acornstream: %s: unsupported file type", name)
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		hdr.Format = tar.FormatPAX
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// DecryptDir decrypts a tar archive written by EncryptDir
+// and extracts it into a new directory named dir.
+//
+// The archive is extracted into a temporary directory alongside dir,
+// which is renamed to dir only after the whole stream has been
+// authenticated, so a tampered or truncated stream never leaves a
+// partial tree behind. It is an error if dir already exists.
+func DecryptDir(r io.Reader, key []byte, dir string) error {
+	if _, err := os.Lstat(dir); err == nil {
+		return &os.PathError{Op: "mkdir", Path: dir, Err: os.ErrExist}
+	}
+	sr, err := NewReader(r, key)
+	if err != nil {
+		return err
+	}
+	return ExtractDir(sr, dir)
+}
+
+// ExtractDir extracts a tar archive written by WriteDir from r
+// in the same way as DecryptDir. It is for callers that need to set up
+// the Reader themselves; r is typically a Reader.
+func ExtractDir(r io.Reader, dir string) error {
+	if _, err := os.Lstat(dir); err == nil {
+		return &os.PathError{Op: "mkdir", Path: dir, Err: os.ErrExist}
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), ".acorn-")
+	if err != nil {
+		return err
+	}
+	if err := extractTar(r, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return nil
+}
+
+var errUnsafePath = errors.New("acornstream: archive entry has unsafe path")
+
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	var dirs []*tar.Header
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name, err := safePath(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if name != dir {
+				if err := os.Mkdir(name, 0700); err != nil {
+					return err
+				}
+			}
+			dirs = append(dirs, hdr)
+		case tar.TypeReg, tar.TypeRegA:
+			if err := writeFile(name, tr, mode); err != nil {
+				return err
+			}
+			if err := os.Chtimes(name, hdr.ModTime, hdr.ModTime); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, name); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("acornstream: %s: unsupported file type", hdr.Name)
+		}
+	}
+	// Drain the stream so that the final chunk is authenticated.
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return err
+	}
+	// Fix up directories last, deepest first, so that restrictive
+	// permissions and modification times aren't disturbed
+	// by the entries extracted into them.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		hdr := dirs[i]
+		name, _ := safePath(dir, hdr.Name)
+		if err := os.Chmod(name, os.FileMode(hdr.Mode).Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(name, hdr.ModTime, hdr.ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(name string, r io.Reader, mode os.FileMode) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// safePath returns the path that the archive entry name should be
+// extracted to. It rejects names that would escape dir, either
+// directly or by way of a symbolic link extracted earlier.
+func safePath(dir, name string) (string, error) {
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", errUnsafePath
+	}
+	if clean == "." {
+		return dir, nil
+	}
+	p := dir
+	elems := strings.Split(clean, "/")
+	for _, elem := range elems[:len(elems)-1] {
+		p = filepath.Join(p, elem)
+		fi, err := os.Lstat(p)
+		if err != nil {
+			return "", err
+		}
+		if !fi.IsDir() {
+			return "", errUnsafePath
+		}
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
@@ -0,0 +1,46 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornstream
+
+import (
+	"context"
+	"io"
+)
+
+// ReEncrypt decrypts the stream in src with oldKey and writes it to dst
+// encrypted with newKey, one chunk at a time, so that rotating the key
+// of a large stream doesn't require staging its plaintext anywhere.
+// The new stream has the same chunk size as the old one and no key ID.
+//
+// Each chunk is authenticated before it is re-encrypted, and the final
+// chunk of the new stream is written only after the whole of src has
+// been authenticated. If ReEncrypt returns an error, whatever was written
+// to dst is an incomplete stream that will fail to decrypt.
+// See ReEncryptContext for a version that can be canceled.
+func ReEncrypt(dst io.Writer, src io.Reader, oldKey, newKey []byte) error {
+	return ReEncryptConfig(dst, src, oldKey, newKey, nil)
+}
+
+// ReEncryptConfig is like ReEncrypt but writes the new stream
+// using the settings in c. If c is nil or its chunk size is zero,
+// the old stream's chunk size is kept.
+func ReEncryptConfig(dst io.Writer, src io.Reader, oldKey, newKey []byte, c *Config) error {
+	return ReEncryptContext(context.Background(), dst, src, oldKey, newKey, c)
+}
+
+// ReEncryptContext is like ReEncryptConfig, but checks ctx between
+// chunks like EncryptContext.
+func ReEncryptContext(ctx context.Context, dst io.Writer, src io.Reader, oldKey, newKey []byte, c *Config) error {
+	r, err := NewReader(src, oldKey)
+	if err != nil {
+		return err
+	}
+	config := Config{}
+	if c != nil {
+		config = *c
+	}
+	if config.ChunkSize == 0 {
+		config.ChunkSize = r.Header().ChunkSize
+	}
+	return EncryptContext(ctx, dst, r, newKey, &config)
+}
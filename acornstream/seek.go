@@ -0,0 +1,165 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornstream
+
+import (
+	"crypto/cipher"
+	"errors"
+	"io"
+
+	"github.com/magical/go-acorn"
+)
+
+var errWhence = errors.New("acornstream: invalid whence")
+var errOffset = errors.New("acornstream: negative position")
+
+// A SeekReader decrypts an encrypted stream stored in an io.ReaderAt,
+// with random access. Each read decrypts and authenticates only the
+// chunks it touches, keeping the last one in memory.
+//
+// Since the length of the stream is known up front, NewReaderAt checks
+// the final chunk before returning, so a stream which has been cut short
+// is detected even if it is never read to the end.
+//
+// A SeekReader is not safe for concurrent use.
+type SeekReader struct {
+	r      io.ReaderAt
+	aead   cipher.AEAD
+	header Header
+	ad     []byte
+	size   int64  // plaintext size
+	chunks int64  // number of chunks
+	in     []byte // sealed chunk
+	buf    []byte // decrypted chunk
+	cur    int64  // index of the chunk in buf, or -1
+	pos    int64  // offset for Read and Seek
+	nonce  [acorn.NonceSize]byte
+}
+
+// NewReaderAt returns a SeekReader for the encrypted stream of the given
+// total length stored in r, which it decrypts with key. Streams with
+// detached tags are not supported.
+func NewReaderAt(r io.ReaderAt, size int64, key []byte) (*SeekReader, error) {
+	h, err := ReadHeader(io.NewSectionReader(r, 0, HeaderSize))
+	if err != nil {
+		return nil, err
+	}
+	if h.Detached {
+		return nil, ErrDetached
+	}
+	plain, err := h.PlaintextSize(size)
+	if err != nil {
+		return nil, err
+	}
+	chunks := plain/int64(h.ChunkSize) + 1
+	if plain%int64(h.ChunkSize) == 0 && plain > 0 {
+		chunks--
+	}
+	if chunks-1 > maxChunk {
+		return nil, ErrTooLong
+	}
+	s := &SeekReader{
+		r:      r,
+		aead:   acorn.NewAEAD(key),
+		header: *h,
+		ad:     h.marshal(),
+		size:   plain,
+		chunks: chunks,
+		in:     make([]byte, h.ChunkSize+acorn.TagSize),
+		cur:    -1,
+	}
+	if err := s.load(chunks - 1); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Header returns the header of the stream.
+func (s *SeekReader) Header() Header {
+	return s.header
+}
+
+// Size returns the length of the plaintext.
+func (s *SeekReader) Size() int64 {
+	return s.size
+}
+
+// load decrypts the i'th chunk into s.buf.
+func (s *SeekReader) load(i int64) error {
+	if i == s.cur {
+		return nil
+	}
+	s.cur = -1
+	sealed := int64(s.header.ChunkSize) + acorn.TagSize
+	n := int(sealed)
+	last := i == s.chunks-1
+	if last {
+		n = int(s.size-i*int64(s.header.ChunkSize)) + acorn.TagSize
+	}
+	if m, err := s.r.ReadAt(s.in[:n], HeaderSize+i*sealed); m < n {
+		if err == nil || err == io.EOF {
+			return ErrTruncated
+		}
+		return err
+	}
+	s.header.nonce(s.nonce[:], uint32(i), last)
+	var err error
+	s.buf, err = s.aead.Open(s.buf[:0], s.nonce[:], s.in[:n], s.ad)
+	if err != nil {
+		return ErrAuthentication
+	}
+	s.cur = i
+	return nil
+}
+
+// ReadAt reads len(p) bytes of plaintext starting at offset off.
+func (s *SeekReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errOffset
+	}
+	n := 0
+	for n < len(p) {
+		if off >= s.size {
+			return n, io.EOF
+		}
+		chunk := int64(s.header.ChunkSize)
+		if err := s.load(off / chunk); err != nil {
+			return n, err
+		}
+		m := copy(p[n:], s.buf[off%chunk:])
+		n += m
+		off += int64(m)
+	}
+	return n, nil
+}
+
+// Read reads plaintext from the current position.
+func (s *SeekReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := s.ReadAt(p, s.pos)
+	s.pos += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the position for the next Read, as io.Seeker describes.
+func (s *SeekReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, errWhence
+	}
+	if offset < 0 {
+		return 0, errOffset
+	}
+	s.pos = offset
+	return offset, nil
+}
@@ -0,0 +1,471 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornstream implements a chunked encryption format for
+// streams of arbitrary length on top of ACORN-128.
+//
+// The plaintext is split into fixed-size chunks, each of which is sealed
+// separately, so that a stream can be encrypted and decrypted with a
+// bounded amount of memory. Each chunk is sealed under a nonce made of a
+// random per-stream prefix, the chunk number, and a flag marking the
+// final chunk, following the STREAM construction of Hoang, Reyhanitabar,
+// Rogaway, and Vizár. This prevents chunks from being reordered,
+// dropped, or duplicated, and the stream from being truncated.
+//
+// An encrypted stream consists of a 32-byte header
+//
+//	magic      [4]byte  "ACRN"
+//	version    uint8    1
+//	flags      uint8    0
+//	reserved   [2]byte  0
+//	chunkSize  uint32   little-endian
+//	keyID      [8]byte  zero if unused
+//	prefix     [12]byte random nonce prefix
+//
+// followed by a sequence of sealed chunks. Every chunk but the last holds
+// exactly chunkSize bytes of plaintext; the last holds at most chunkSize
+// bytes and may be empty. The header is passed as additional data to
+// every chunk, so it cannot be modified without detection.
+//
+// If bit 0 of the flags is set, the tags are detached: the 16-byte tag of
+// each chunk is written to a separate tag stream instead of following the
+// chunk's ciphertext, for systems where integrity metadata travels out of
+// band. The ciphertext and tag streams must be recombined to decrypt.
+package acornstream
+
+import (
+	"bufio"
+	"crypto/cipher"
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/magical/go-acorn"
+)
+
+const (
+	// HeaderSize is the length of an encoded stream header.
+	HeaderSize = 32
+
+	// DefaultChunkSize is the chunk size used by NewWriter.
+	DefaultChunkSize = 64 * 1024
+
+	// MaxChunkSize is the largest chunk size allowed by the format.
+	MaxChunkSize = 16 * 1024 * 1024
+
+	version      = 1
+	flagDetached = 1 << 0
+	lastFlag     = 1 << 31
+	maxChunk     = lastFlag - 1
+)
+
+var magic = [4]byte{'A', 'C', 'R', 'N'}
+
+var (
+	ErrInvalidHeader  = errors.New("acornstream: invalid header")
+	ErrTruncated      = errors.New("acornstream: truncated stream")
+	ErrAuthentication = errors.New("acornstream: message authentication failed")
+	ErrTooLong        = errors.New("acornstream: stream too long")
+	ErrDetached       = errors.New("acornstream: stream has detached tags")
+	errNotDetached    = errors.New("acornstream: stream does not have detached tags")
+	errTrailingTags   = errors.New("acornstream: unexpected data after final tag")
+	errClosed         = errors.New("acornstream: write to closed Writer")
+)
+
+// Header describes an encrypted stream.
+type Header struct {
+	Version   int
+	ChunkSize int
+	Detached  bool // tags are stored separately
+	KeyID     [8]byte
+	Prefix    [12]byte
+}
+
+func (h *Header) marshal() []byte {
+	b := make([]byte, HeaderSize)
+	copy(b[0:4], magic[:])
+	b[4] = uint8(h.Version)
+	if h.Detached {
+		b[5] |= flagDetached
+	}
+	binary.LittleEndian.PutUint32(b[8:12], uint32(h.ChunkSize))
+	copy(b[12:20], h.KeyID[:])
+	copy(b[20:32], h.Prefix[:])
+	return b
+}
+
+func (h *Header) unmarshal(b []byte) error {
+	if len(b) != HeaderSize || string(b[0:4]) != string(magic[:]) {
+		return ErrInvalidHeader
+	}
+	if b[4] != version || b[5]&^flagDetached != 0 || b[6] != 0 || b[7] != 0 {
+		return ErrInvalidHeader
+	}
+	size := binary.LittleEndian.Uint32(b[8:12])
+	if size == 0 || size > MaxChunkSize {
+		return ErrInvalidHeader
+	}
+	h.Version = int(b[4])
+	h.ChunkSize = int(size)
+	h.Detached = b[5]&flagDetached != 0
+	copy(h.KeyID[:], b[12:20])
+	copy(h.Prefix[:], b[20:32])
+	return nil
+}
+
+// ReadHeader reads and parses a stream header from r
+// without decrypting anything.
+func ReadHeader(r io.Reader) (*Header, error) {
+	b := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrInvalidHeader
+		}
+		return nil, err
+	}
+	return ParseHeader(b)
+}
+
+// ParseHeader parses an encoded stream header.
+func ParseHeader(b []byte) (*Header, error) {
+	h := new(Header)
+	if err := h.unmarshal(b); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// PlaintextSize returns the length of the plaintext in an encrypted stream
+// of the given total length, including the header. For a stream with
+// detached tags, the length does not include the tags.
+// It returns an error if no valid stream has that length.
+func (h *Header) PlaintextSize(streamSize int64) (int64, error) {
+	n := streamSize - HeaderSize
+	if n < 0 {
+		return 0, ErrTruncated
+	}
+	if h.Detached {
+		return n, nil
+	}
+	sealed := int64(h.ChunkSize) + acorn.TagSize
+	chunks := n / sealed
+	if n%sealed != 0 || chunks == 0 {
+		chunks++
+		if n%sealed < acorn.TagSize {
+			return 0, ErrTruncated
+		}
+	}
+	return n - chunks*acorn.TagSize, nil
+}
+
+// nonce returns the nonce for the i'th chunk.
+func (h *Header) nonce(nonce []byte, i uint32, last bool) {
+	copy(nonce, h.Prefix[:])
+	if last {
+		i |= lastFlag
+	}
+	binary.BigEndian.PutUint32(nonce[12:], i)
+}
+
+// A Writer encrypts data written to it and writes
+// the encrypted stream to an underlying writer.
+//
+// The caller must call Close to write the final chunk.
+// Data is not authenticated until the final chunk is written.
+type Writer struct {
+	w      io.Writer
+	tags   io.Writer // nil unless tags are detached
+	aead   cipher.AEAD
+	header Header
+	ad     []byte // encoded header
+	buf    []byte // pending plaintext
+	out    []byte // sealed chunk
+	nonce  [acorn.NonceSize]byte
+	n      uint32 // chunk counter
+	err    error
+}
+
+// NewWriter returns a Writer that encrypts data with the given key
+// using the default chunk size.
+// The header is written to w immediately.
+func NewWriter(w io.Writer, key []byte) (*Writer, error) {
+	return NewWriterSize(w, key, DefaultChunkSize)
+}
+
+// NewWriterSize is like NewWriter but uses the given chunk size,
+// which must be between 1 and MaxChunkSize.
+func NewWriterSize(w io.Writer, key []byte, chunkSize int) (*Writer, error) {
+	return NewWriterConfig(w, key, &Config{ChunkSize: chunkSize})
+}
+
+// NewDetachedWriter is like NewWriter but writes each chunk's tag
+// to tags instead of w.
+func NewDetachedWriter(w, tags io.Writer, key []byte) (*Writer, error) {
+	return NewWriterConfig(w, key, &Config{Tags: tags})
+}
+
+// A Config holds optional settings for a Writer.
+// The zero value is the default configuration.
+type Config struct {
+	// ChunkSize is the chunk size, or zero for DefaultChunkSize.
+	ChunkSize int
+
+	// KeyID is recorded in the header, to help readers find the key.
+	// It is not secret, and is not checked when decrypting. Use
+	// acorn.KeyID(key), or the ID of a key file, to name the key the
+	// same way as the rest of this module.
+	KeyID [8]byte
+
+	// If Tags is not nil, tags are detached and written to Tags.
+	Tags io.Writer
+
+	// Rand is the source of the random nonce prefix.
+	// If nil, crypto/rand is used.
+	Rand io.Reader
+}
+
+// NewWriterConfig is like NewWriter but uses the settings in c.
+func NewWriterConfig(w io.Writer, key []byte, c *Config) (*Writer, error) {
+	h := Header{
+		Version:   version,
+		ChunkSize: c.ChunkSize,
+		Detached:  c.Tags != nil,
+		KeyID:     c.KeyID,
+	}
+	if h.ChunkSize == 0 {
+		h.ChunkSize = DefaultChunkSize
+	}
+	rand := c.Rand
+	if rand == nil {
+		rand = cryptorand.Reader
+	}
+	if _, err := io.ReadFull(rand, h.Prefix[:]); err != nil {
+		return nil, err
+	}
+	return newWriter(w, c.Tags, key, &h)
+}
+
+func newWriter(w, tags io.Writer, key []byte, h *Header) (*Writer, error) {
+	if h.ChunkSize <= 0 || h.ChunkSize > MaxChunkSize {
+		return nil, errors.New("acornstream: invalid chunk size")
+	}
+	sw := &Writer{
+		w:      w,
+		tags:   tags,
+		aead:   acorn.NewAEAD(key),
+		header: *h,
+		ad:     h.marshal(),
+		buf:    make([]byte, 0, h.ChunkSize),
+		out:    make([]byte, 0, h.ChunkSize+acorn.TagSize),
+	}
+	if _, err := w.Write(sw.ad); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+// Header returns the header of the stream being written.
+func (w *Writer) Header() Header {
+	return w.header
+}
+
+// Write encrypts p and writes it to the underlying writer.
+// A chunk is written once the chunk after it has been started,
+// so up to a full chunk of data may be held in memory until Close.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n := 0
+	for len(p) > 0 {
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (w *Writer) flush(last bool) error {
+	if w.n > maxChunk {
+		w.err = ErrTooLong
+		return w.err
+	}
+	w.header.nonce(w.nonce[:], w.n, last)
+	w.out = w.aead.Seal(w.out[:0], w.nonce[:], w.buf, w.ad)
+	ciphertext, tag := w.out, []byte(nil)
+	if w.tags != nil {
+		ciphertext, tag = w.out[:len(w.buf)], w.out[len(w.buf):]
+	}
+	if _, err := w.w.Write(ciphertext); err != nil {
+		w.err = err
+		return err
+	}
+	if tag != nil {
+		if _, err := w.tags.Write(tag); err != nil {
+			w.err = err
+			return err
+		}
+	}
+	w.n++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close writes the final chunk. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		if w.err == errClosed {
+			return nil
+		}
+		return w.err
+	}
+	if err := w.flush(true); err != nil {
+		return err
+	}
+	w.err = errClosed
+	return nil
+}
+
+// A Reader decrypts and authenticates an encrypted stream.
+//
+// Each chunk is authenticated before any of its plaintext is returned,
+// but a stream which is truncated or tampered with partway through
+// may return some valid plaintext before the error is detected.
+// Callers must not act on the data until Read returns io.EOF.
+type Reader struct {
+	r      *bufio.Reader
+	tags   io.Reader // nil unless tags are detached
+	aead   cipher.AEAD
+	header Header
+	ad     []byte
+	in     []byte // sealed chunk
+	buf    []byte // decrypted plaintext
+	off    int    // read offset into buf
+	nonce  [acorn.NonceSize]byte
+	n      uint32
+	err    error
+}
+
+// NewReader reads the stream header from r and returns a Reader
+// that decrypts the rest of the stream with the given key.
+func NewReader(r io.Reader, key []byte) (*Reader, error) {
+	h, err := ReadHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if h.Detached {
+		return nil, ErrDetached
+	}
+	return newReader(r, nil, key, h), nil
+}
+
+// NewDetachedReader is like NewReader but reads each chunk's tag
+// from tags. The stream must have been written by a detached Writer.
+func NewDetachedReader(r, tags io.Reader, key []byte) (*Reader, error) {
+	h, err := ReadHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if !h.Detached {
+		return nil, errNotDetached
+	}
+	return newReader(r, tags, key, h), nil
+}
+
+func newReader(r, tags io.Reader, key []byte, h *Header) *Reader {
+	return &Reader{
+		r:      bufio.NewReader(r),
+		tags:   tags,
+		aead:   acorn.NewAEAD(key),
+		header: *h,
+		ad:     h.marshal(),
+		in:     make([]byte, h.ChunkSize+acorn.TagSize),
+	}
+}
+
+// Header returns the header of the stream being read.
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Read reads decrypted data into p.
+// It returns io.EOF only after the final chunk has been authenticated.
+func (r *Reader) Read(p []byte) (int, error) {
+	for r.off == len(r.buf) {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.buf[r.off:])
+	r.off += n
+	return n, nil
+}
+
+// next reads and decrypts the next chunk.
+func (r *Reader) next() error {
+	size := len(r.in)
+	if r.tags != nil {
+		size -= acorn.TagSize
+	}
+	n, err := io.ReadFull(r.r, r.in[:size])
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	} else if err != nil {
+		return err
+	}
+	last := n < size
+	if !last {
+		if _, err := r.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if r.tags != nil {
+		if _, err := io.ReadFull(r.tags, r.in[n:n+acorn.TagSize]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return ErrTruncated
+			}
+			return err
+		}
+		n += acorn.TagSize
+	}
+	if n < acorn.TagSize {
+		return ErrTruncated
+	}
+	if r.n > maxChunk {
+		return ErrTooLong
+	}
+	r.header.nonce(r.nonce[:], r.n, last)
+	r.buf, err = r.aead.Open(r.buf[:0], r.nonce[:], r.in[:n], r.ad)
+	r.off = 0
+	if err != nil {
+		if last {
+			// The final chunk may have failed because the stream
+			// was cut off at a chunk boundary.
+			r.header.nonce(r.nonce[:], r.n, false)
+			if _, err := r.aead.Open(nil, r.nonce[:], r.in[:n], r.ad); err == nil {
+				return ErrTruncated
+			}
+		}
+		return ErrAuthentication
+	}
+	r.n++
+	if last {
+		if r.tags != nil {
+			var b [1]byte
+			if n, _ := io.ReadFull(r.tags, b[:]); n != 0 {
+				return errTrailingTags
+			}
+		}
+		return io.EOF
+	}
+	return nil
+}
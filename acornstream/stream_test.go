@@ -0,0 +1,411 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornstream
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKey = []byte(strings.Repeat("password", 2))
+
+func seal(t *testing.T, p []byte, chunkSize int) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriterSize(&buf, testKey, chunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func open(ciphertext []byte) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(ciphertext), testKey)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, chunkSize := range []int{1, 7, 16, 64} {
+		for _, n := range []int{0, 1, 15, 16, 17, 63, 64, 65, 200} {
+			p := bytes.Repeat([]byte{'x'}, n)
+			c := seal(t, p, chunkSize)
+			chunks := (n + chunkSize - 1) / chunkSize
+			if chunks == 0 {
+				chunks = 1
+			}
+			if want := HeaderSize + n + chunks*16; len(c) != want {
+				t.Errorf("chunk=%d len=%d: ciphertext length = %d, want %d", chunkSize, n, len(c), want)
+			}
+			got, err := open(c)
+			if err != nil {
+				t.Errorf("chunk=%d len=%d: unexpected error: %v", chunkSize, n, err)
+			} else if !bytes.Equal(got, p) {
+				t.Errorf("chunk=%d len=%d: got %q, want %q", chunkSize, n, got, p)
+			}
+		}
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	p := bytes.Repeat([]byte{'x'}, 64)
+	c := seal(t, p, 16)
+	// drop the final chunk
+	if _, err := open(c[:len(c)-32]); err != ErrTruncated {
+		t.Errorf("dropped final chunk: got %v, want %v", err, ErrTruncated)
+	}
+	if _, err := open(c[:len(c)-1]); err != ErrAuthentication {
+		t.Errorf("truncated tag: got %v, want %v", err, ErrAuthentication)
+	}
+	if _, err := open(c[:HeaderSize]); err != ErrTruncated {
+		t.Errorf("header only: got %v, want %v", err, ErrTruncated)
+	}
+	if _, err := open(c[:HeaderSize-1]); err != ErrInvalidHeader {
+		t.Errorf("short header: got %v, want %v", err, ErrInvalidHeader)
+	}
+}
+
+func TestTampered(t *testing.T) {
+	p := bytes.Repeat([]byte{'x'}, 64)
+	c := seal(t, p, 16)
+	for i := range c {
+		if 4 <= i && i < 12 {
+			// version, flags, and chunk size are checked before decryption
+			continue
+		}
+		d := append([]byte(nil), c...)
+		d[i] ^= 1
+		if _, err := open(d); err == nil {
+			t.Errorf("flipped byte %d: expected error", i)
+		}
+	}
+
+	// swap two chunks
+	d := append([]byte(nil), c...)
+	a := d[HeaderSize : HeaderSize+32]
+	b := d[HeaderSize+32 : HeaderSize+64]
+	tmp := append([]byte(nil), a...)
+	copy(a, b)
+	copy(b, tmp)
+	if _, err := open(d); err != ErrAuthentication {
+		t.Errorf("swapped chunks: got %v, want %v", err, ErrAuthentication)
+	}
+}
+
+func TestDir(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "acornstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	mtime := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	mustWrite := func(name, data string, mode os.FileMode) {
+		name = filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(name, mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustWrite("a.txt", "hello", 0644)
+	mustWrite("sub/b.sh", "#!/bin/sh\n", 0755)
+	mustWrite("sub/deeper/c", strings.Repeat("c", 100000), 0600)
+	if err := os.Symlink("a.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(src, "sub"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(src, "sub"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := EncryptDir(&buf, testKey, src); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(tmp, "dst")
+	if err := DecryptDir(bytes.NewReader(buf.Bytes()), testKey, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a.txt", "sub", "sub/b.sh", "sub/deeper/c"} {
+		want, err := os.Stat(filepath.Join(src, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.Stat(filepath.Join(dst, name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got.Mode() != want.Mode() {
+			t.Errorf("%s: mode = %v, want %v", name, got.Mode(), want.Mode())
+		}
+		if !got.ModTime().Equal(want.ModTime()) {
+			t.Errorf("%s: mtime = %v, want %v", name, got.ModTime(), want.ModTime())
+		}
+		if got.Mode().IsRegular() {
+			a, _ := ioutil.ReadFile(filepath.Join(src, name))
+			b, _ := ioutil.ReadFile(filepath.Join(dst, name))
+			if !bytes.Equal(a, b) {
+				t.Errorf("%s: contents differ", name)
+			}
+		}
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "link")); err != nil || link != "a.txt" {
+		t.Errorf("link = %q, %v; want %q", link, err, "a.txt")
+	}
+
+	// a tampered stream must not leave anything behind
+	c := buf.Bytes()
+	c[len(c)-1] ^= 1
+	bad := filepath.Join(tmp, "bad")
+	if err := DecryptDir(bytes.NewReader(c), testKey, bad); err == nil {
+		t.Errorf("tampered stream: expected error")
+	}
+	entries, _ := ioutil.ReadDir(tmp)
+	if len(entries) != 2 {
+		t.Errorf("tampered stream left files behind: %d entries in temp dir", len(entries))
+	}
+}
+
+func TestSafePath(t *testing.T) {
+	for _, name := range []string{"../x", "/etc/passwd", "a/../../x", ".."} {
+		if _, err := safePath("/tmp/dir", name); err != errUnsafePath {
+			t.Errorf("safePath(%q) = %v, want %v", name, err, errUnsafePath)
+		}
+	}
+}
+
+func TestDetached(t *testing.T) {
+	p := bytes.Repeat([]byte{'x'}, 3*DefaultChunkSize+5)
+	var ciphertext, tags bytes.Buffer
+	w, err := NewDetachedWriter(&ciphertext, &tags, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(p)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if ciphertext.Len() != HeaderSize+len(p) {
+		t.Errorf("ciphertext length = %d, want %d", ciphertext.Len(), HeaderSize+len(p))
+	}
+	if tags.Len() != 4*16 {
+		t.Errorf("tags length = %d, want %d", tags.Len(), 4*16)
+	}
+
+	open := func(c, tags []byte) ([]byte, error) {
+		r, err := NewDetachedReader(bytes.NewReader(c), bytes.NewReader(tags), testKey)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(r)
+	}
+	c, tg := ciphertext.Bytes(), tags.Bytes()
+	if got, err := open(c, tg); err != nil || !bytes.Equal(got, p) {
+		t.Errorf("open: err = %v, plaintext equal = %v", err, bytes.Equal(got, p))
+	}
+	if _, err := NewReader(bytes.NewReader(c), testKey); err != ErrDetached {
+		t.Errorf("NewReader: got %v, want %v", err, ErrDetached)
+	}
+	if _, err := open(c, tg[:len(tg)-16]); err != ErrTruncated {
+		t.Errorf("missing tag: got %v, want %v", err, ErrTruncated)
+	}
+	if _, err := open(c, append(tg[:len(tg):len(tg)], 0)); err != errTrailingTags {
+		t.Errorf("extra tag data: got %v, want %v", err, errTrailingTags)
+	}
+	bad := append([]byte(nil), tg...)
+	bad[20] ^= 1
+	if _, err := open(c, bad); err != ErrAuthentication {
+		t.Errorf("flipped tag bit: got %v, want %v", err, ErrAuthentication)
+	}
+}
+
+func TestPlaintextSize(t *testing.T) {
+	for _, n := range []int{0, 1, 15, 16, 17, 47, 48, 49} {
+		c := seal(t, make([]byte, n), 16)
+		h, err := ParseHeader(c[:HeaderSize])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := h.PlaintextSize(int64(len(c))); err != nil || got != int64(n) {
+			t.Errorf("PlaintextSize(%d) = %d, %v; want %d", len(c), got, err, n)
+		}
+	}
+	h := &Header{ChunkSize: 16}
+	for _, size := range []int64{0, HeaderSize - 1, HeaderSize, HeaderSize + 15, HeaderSize + 32 + 15} {
+		if _, err := h.PlaintextSize(size); err == nil {
+			t.Errorf("PlaintextSize(%d) succeeded, want error", size)
+		}
+	}
+}
+
+func TestReEncrypt(t *testing.T) {
+	newKey := []byte(strings.Repeat("drowssap", 2))
+	p := bytes.Repeat([]byte("0123456789"), 1000)
+	c := seal(t, p, 100)
+
+	var out bytes.Buffer
+	if err := ReEncrypt(&out, bytes.NewReader(c), testKey, newKey); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(&out, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Header().ChunkSize != 100 {
+		t.Errorf("chunk size = %d, want %d", r.Header().ChunkSize, 100)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(got, p) {
+		t.Errorf("ReadAll: err = %v, plaintext equal = %v", err, bytes.Equal(got, p))
+	}
+
+	// a damaged source must not produce a valid output
+	c[len(c)/2] ^= 1
+	out.Reset()
+	if err := ReEncrypt(&out, bytes.NewReader(c), testKey, newKey); err != ErrAuthentication {
+		t.Errorf("damaged source: got %v, want %v", err, ErrAuthentication)
+	}
+	r, err = NewReader(&out, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); err != ErrTruncated {
+		t.Errorf("partial output: got %v, want %v", err, ErrTruncated)
+	}
+}
+
+// cancelWriter cancels a context once more than n bytes are written to it.
+type cancelWriter struct {
+	bytes.Buffer
+	n      int
+	cancel func()
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	if w.Len()+len(p) > w.n {
+		w.cancel()
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestContext(t *testing.T) {
+	p := bytes.Repeat([]byte("0123456789"), 1000)
+	ctx := context.Background()
+	var enc, dec bytes.Buffer
+	if err := EncryptContext(ctx, &enc, bytes.NewReader(p), testKey, &Config{ChunkSize: 100}); err != nil {
+		t.Fatal(err)
+	}
+	c := enc.Bytes()
+	if err := DecryptContext(ctx, &dec, bytes.NewReader(c), testKey); err != nil || !bytes.Equal(dec.Bytes(), p) {
+		t.Fatalf("DecryptContext: err = %v, plaintext equal = %v", err, bytes.Equal(dec.Bytes(), p))
+	}
+
+	// each one stops within a chunk of being canceled
+	for name, f := range map[string]func(context.Context, io.Writer) error{
+		"EncryptContext": func(ctx context.Context, w io.Writer) error {
+			return EncryptContext(ctx, w, bytes.NewReader(p), testKey, &Config{ChunkSize: 100})
+		},
+		"DecryptContext": func(ctx context.Context, w io.Writer) error {
+			return DecryptContext(ctx, w, bytes.NewReader(c), testKey)
+		},
+		"ReEncryptContext": func(ctx context.Context, w io.Writer) error {
+			return ReEncryptContext(ctx, w, bytes.NewReader(c), testKey, testKey, nil)
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		w := &cancelWriter{n: 1000, cancel: cancel}
+		if err := f(ctx, w); err != context.Canceled {
+			t.Errorf("%s returned %v, want context.Canceled", name, err)
+		}
+		if w.Len() > 1000+2*(100+16) {
+			t.Errorf("%s wrote %d bytes after being canceled at 1000", name, w.Len())
+		}
+		cancel()
+	}
+}
+
+func TestSeekReader(t *testing.T) {
+	for _, n := range []int{0, 1, 15, 16, 17, 64, 200} {
+		p := make([]byte, n)
+		for i := range p {
+			p[i] = byte(i)
+		}
+		c := seal(t, p, 16)
+		s, err := NewReaderAt(bytes.NewReader(c), int64(len(c)), testKey)
+		if err != nil {
+			t.Fatalf("len=%d: %v", n, err)
+		}
+		if s.Size() != int64(n) {
+			t.Errorf("len=%d: Size() = %d", n, s.Size())
+		}
+		if got, err := ioutil.ReadAll(s); err != nil || !bytes.Equal(got, p) {
+			t.Errorf("len=%d: ReadAll = %x, %v", n, got, err)
+		}
+		for _, off := range []int{0, 5, 15, 16, 31, n - 1} {
+			if off < 0 || off >= n {
+				continue
+			}
+			for _, size := range []int{1, 16, 40} {
+				buf := make([]byte, size)
+				m, err := s.ReadAt(buf, int64(off))
+				want := p[off:]
+				if len(want) > size {
+					want = want[:size]
+				}
+				if m != len(want) || !bytes.Equal(buf[:m], want) || (m < size) != (err == io.EOF) {
+					t.Errorf("len=%d: ReadAt(%d bytes, %d) = %d, %v", n, size, off, m, err)
+				}
+			}
+		}
+		if pos, err := s.Seek(-3, io.SeekEnd); n >= 3 && (err != nil || pos != int64(n-3)) {
+			t.Errorf("len=%d: Seek = %d, %v", n, pos, err)
+		}
+	}
+
+	c := seal(t, bytes.Repeat([]byte{'x'}, 64), 16)
+	// dropping the last chunk is caught up front
+	if _, err := NewReaderAt(bytes.NewReader(c[:len(c)-32]), int64(len(c)-32), testKey); err != ErrAuthentication {
+		t.Errorf("dropped final chunk: got %v, want %v", err, ErrAuthentication)
+	}
+	// a lie about the size
+	if _, err := NewReaderAt(bytes.NewReader(c[:len(c)-8]), int64(len(c)), testKey); err != ErrTruncated {
+		t.Errorf("short ReaderAt: got %v, want %v", err, ErrTruncated)
+	}
+	c[HeaderSize] ^= 1
+	s, err := NewReaderAt(bytes.NewReader(c), int64(len(c)), testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReadAt(make([]byte, 1), 20); err != nil {
+		t.Errorf("reading an intact chunk: %v", err)
+	}
+	if _, err := s.ReadAt(make([]byte, 1), 0); err != ErrAuthentication {
+		t.Errorf("reading a tampered chunk: got %v, want %v", err, ErrAuthentication)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acorntest checks that a cipher.AEAD behaves like ACORN-128.
+//
+// It is for packages that wrap or re-expose an ACORN AEAD, such as one
+// backed by a registered Engine or hardware, and want to know that
+// their wrapper still meets the cipher.AEAD contract and produces the
+// same output as this module. Call TestAEAD from a test:
+//
+//	func TestConformance(t *testing.T) {
+//		acorntest.TestAEAD(t, mypkg.NewAEAD)
+//	}
+package acorntest
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/hex"
+	"math/rand"
+	"testing"
+
+	"github.com/magical/go-acorn"
+)
+
+// vectors are taken from the CAESAR known-answer tests,
+// with key and nonce 000102...0f.
+var vectors = []struct {
+	pt, ad, ct string
+}{
+	{"", "", "b38dee89989da78527566bd4a51cf30d"},
+	{"", "00", "ebf7a723ea6611076e2481f5beea2d41"},
+}
+
+// TestAEAD runs the conformance checks against AEADs returned by
+// newAEAD, which is called with 16-byte keys. Each check is a subtest.
+//
+// Beyond matching ACORN-128 on known answers and random inputs,
+// the AEAD must report NonceSize and Overhead of 16, append to dst
+// without disturbing its contents, allow dst to alias the input exactly,
+// and reject inauthentic input with an error rather than a panic,
+// without changing the existing contents of dst.
+func TestAEAD(t *testing.T, newAEAD func(key []byte) cipher.AEAD) {
+	t.Helper()
+	t.Run("Sizes", func(t *testing.T) { testSizes(t, newAEAD) })
+	t.Run("KnownAnswers", func(t *testing.T) { testKnownAnswers(t, newAEAD) })
+	t.Run("Reference", func(t *testing.T) { testReference(t, newAEAD) })
+	t.Run("Append", func(t *testing.T) { testAppend(t, newAEAD) })
+	t.Run("Aliasing", func(t *testing.T) { testAliasing(t, newAEAD) })
+	t.Run("Errors", func(t *testing.T) { testErrors(t, newAEAD) })
+}
+
+func countingBytes(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func testSizes(t *testing.T, newAEAD func([]byte) cipher.AEAD) {
+	a := newAEAD(make([]byte, acorn.KeySize))
+	if n := a.NonceSize(); n != acorn.NonceSize {
+		t.Errorf("NonceSize() = %d, want %d", n, acorn.NonceSize)
+	}
+	if n := a.Overhead(); n != acorn.TagSize {
+		t.Errorf("Overhead() = %d, want %d", n, acorn.TagSize)
+	}
+}
+
+func testKnownAnswers(t *testing.T, newAEAD func([]byte) cipher.AEAD) {
+	a := newAEAD(countingBytes(acorn.KeySize))
+	nonce := countingBytes(acorn.NonceSize)
+	for _, v := range vectors {
+		pt, ad, want := unhex(t, v.pt), unhex(t, v.ad), unhex(t, v.ct)
+		if got := a.Seal(nil, nonce, pt, ad); !bytes.Equal(got, want) {
+			t.Errorf("Seal(pt=%x, ad=%x) = %x, want %x", pt, ad, got, want)
+		}
+		if got, err := a.Open(nil, nonce, want, ad); err != nil || !bytes.Equal(got, pt) {
+			t.Errorf("Open(%x, ad=%x) = %x, %v, want %x", want, ad, got, err, pt)
+		}
+	}
+}
+
+// testReference compares the AEAD with this module's on every length
+// up to 129 bytes, which covers each tail length of every word size.
+func testReference(t *testing.T, newAEAD func([]byte) cipher.AEAD) {
+	r := rand.New(rand.NewSource(1))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		r.Read(b)
+		return b
+	}
+	for n := 0; n <= 129; n++ {
+		key, nonce := random(acorn.KeySize), random(acorn.NonceSize)
+		pt, ad := random(n), random(r.Intn(2*n+1))
+		want := acorn.NewAEAD(key).Seal(nil, nonce, pt, ad)
+		a := newAEAD(key)
+		if got := a.Seal(nil, nonce, pt, ad); !bytes.Equal(got, want) {
+			t.Fatalf("Seal(len=%d, adlen=%d) = %x, want %x", n, len(ad), got, want)
+		}
+		if got, err := a.Open(nil, nonce, want, ad); err != nil || !bytes.Equal(got, pt) {
+			t.Fatalf("Open(len=%d, adlen=%d) = %x, %v, want %x", n, len(ad), got, err, pt)
+		}
+	}
+}
+
+func testAppend(t *testing.T, newAEAD func([]byte) cipher.AEAD) {
+	a := newAEAD(make([]byte, acorn.KeySize))
+	nonce := make([]byte, acorn.NonceSize)
+	pt, ad := countingBytes(37), countingBytes(5)
+	want := a.Seal(nil, nonce, pt, ad)
+	prefix := []byte("prefix")
+
+	// with and without room to grow in place
+	for _, extra := range []int{0, len(want)} {
+		dst := make([]byte, len(prefix), len(prefix)+extra)
+		copy(dst, prefix)
+		got := a.Seal(dst, nonce, pt, ad)
+		if !bytes.Equal(got[:len(prefix)], prefix) || !bytes.Equal(got[len(prefix):], want) {
+			t.Errorf("Seal to dst with %d spare bytes = %x, want %x%x", extra, got, prefix, want)
+		}
+		if extra > 0 && &got[0] != &dst[0] {
+			t.Errorf("Seal reallocated dst although it had room")
+		}
+		dst = make([]byte, len(prefix), len(prefix)+extra)
+		copy(dst, prefix)
+		p, err := a.Open(dst, nonce, want, ad)
+		if err != nil || !bytes.Equal(p[:len(prefix)], prefix) || !bytes.Equal(p[len(prefix):], pt) {
+			t.Errorf("Open to dst with %d spare bytes = %x, %v, want %x%x", extra, p, err, prefix, pt)
+		}
+	}
+}
+
+func testAliasing(t *testing.T, newAEAD func([]byte) cipher.AEAD) {
+	a := newAEAD(make([]byte, acorn.KeySize))
+	nonce := make([]byte, acorn.NonceSize)
+	ad := countingBytes(9)
+	for _, n := range []int{0, 1, 15, 16, 17, 100} {
+		pt := countingBytes(n)
+		want := a.Seal(nil, nonce, pt, ad)
+
+		buf := make([]byte, n, n+acorn.TagSize)
+		copy(buf, pt)
+		c := a.Seal(buf[:0], nonce, buf, ad)
+		if !bytes.Equal(c, want) {
+			t.Errorf("in-place Seal(len=%d) = %x, want %x", n, c, want)
+			continue
+		}
+		p, err := a.Open(c[:0], nonce, c, ad)
+		if err != nil || !bytes.Equal(p, pt) {
+			t.Errorf("in-place Open(len=%d) = %x, %v, want %x", n, p, err, pt)
+		}
+	}
+}
+
+func testErrors(t *testing.T, newAEAD func([]byte) cipher.AEAD) {
+	a := newAEAD(make([]byte, acorn.KeySize))
+	nonce := make([]byte, acorn.NonceSize)
+	pt, ad := countingBytes(20), countingBytes(3)
+	c := a.Seal(nil, nonce, pt, ad)
+
+	flip := func(b []byte, i int) []byte {
+		b = append([]byte(nil), b...)
+		b[i] ^= 1
+		return b
+	}
+	cases := []struct {
+		name         string
+		nonce, c, ad []byte
+	}{
+		{"ciphertext changed", nonce, flip(c, 0), ad},
+		{"tag changed", nonce, flip(c, len(c)-1), ad},
+		{"additional data changed", nonce, c, flip(ad, 0)},
+		{"nonce changed", flip(nonce, 0), c, ad},
+		{"truncated", nonce, c[:len(c)-1], ad},
+		{"shorter than a tag", nonce, c[:acorn.TagSize-1], ad},
+		{"empty", nonce, nil, ad},
+		{"extended", nonce, append(append([]byte(nil), c...), 0), ad},
+	}
+	for _, tc := range cases {
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					t.Errorf("%s: Open panicked: %v", tc.name, err)
+				}
+			}()
+			// cipher.AEAD allows a failed Open to overwrite
+			// dst up to its capacity, but not within its length
+			dst := []byte("dst")
+			p, err := a.Open(dst, tc.nonce, tc.c, tc.ad)
+			if err == nil {
+				t.Errorf("%s: Open succeeded", tc.name)
+			}
+			if len(p) > len(dst) || !bytes.Equal(dst, []byte("dst")) {
+				t.Errorf("%s: Open changed dst", tc.name)
+			}
+		}()
+	}
+}
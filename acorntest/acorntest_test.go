@@ -0,0 +1,20 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorntest
+
+import (
+	"crypto/cipher"
+	"testing"
+
+	"github.com/magical/go-acorn"
+)
+
+func TestAEADGo(t *testing.T) {
+	TestAEAD(t, acorn.NewAEAD)
+}
+
+func TestAEADEngine(t *testing.T) {
+	TestAEAD(t, func(key []byte) cipher.AEAD {
+		return acorn.NewAEADEngine(key, acorn.NewEngine)
+	})
+}
@@ -0,0 +1,152 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorntink
+
+// This file has just enough of the protobuf wire format to read and
+// write the two messages of the key type:
+//
+//	message AcornKey {
+//		uint32 version = 1;
+//		bytes key_value = 2;
+//	}
+//
+//	message AcornKeyFormat {
+//		uint32 version = 1;
+//	}
+
+import "errors"
+
+const (
+	wireVarint = 0
+	wire64     = 1
+	wireBytes  = 2
+	wire32     = 5
+)
+
+var errProto = errors.New("acorntink: malformed protobuf")
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func readVarint(b []byte) (uint64, []byte, error) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << uint(7*i)
+		if b[i] < 0x80 {
+			return v, b[i+1:], nil
+		}
+	}
+	return 0, nil, errProto
+}
+
+// A protoField is a field of a decoded message. Only the
+// wire types that the messages use are kept; others are skipped.
+type protoField struct {
+	num   uint64
+	wire  uint64
+	value uint64 // for wireVarint
+	bytes []byte // for wireBytes
+}
+
+// parseProto splits a message into its fields.
+func parseProto(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		tag, rest, err := readVarint(b)
+		if err != nil {
+			return nil, err
+		}
+		f := protoField{num: tag >> 3, wire: tag & 7}
+		if f.num == 0 {
+			return nil, errProto
+		}
+		switch f.wire {
+		case wireVarint:
+			f.value, rest, err = readVarint(rest)
+		case wireBytes:
+			var n uint64
+			n, rest, err = readVarint(rest)
+			if err == nil && n > uint64(len(rest)) {
+				err = errProto
+			}
+			if err == nil {
+				f.bytes, rest = rest[:n], rest[n:]
+			}
+		case wire64, wire32:
+			n := 8
+			if f.wire == wire32 {
+				n = 4
+			}
+			if len(rest) < n {
+				err = errProto
+			} else {
+				rest = rest[n:]
+			}
+		default:
+			err = errProto
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+		b = rest
+	}
+	return fields, nil
+}
+
+func marshalKey(version uint32, key []byte) []byte {
+	var b []byte
+	if version != 0 {
+		b = appendVarint(b, 1<<3|wireVarint)
+		b = appendVarint(b, uint64(version))
+	}
+	b = appendVarint(b, 2<<3|wireBytes)
+	b = appendVarint(b, uint64(len(key)))
+	return append(b, key...)
+}
+
+func unmarshalKey(b []byte) (version uint32, key []byte, err error) {
+	fields, err := parseProto(b)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, f := range fields {
+		switch {
+		case f.num == 1 && f.wire == wireVarint:
+			version = uint32(f.value)
+		case f.num == 2 && f.wire == wireBytes:
+			key = f.bytes
+		case f.num <= 2:
+			return 0, nil, errProto
+		}
+	}
+	return version, key, nil
+}
+
+func marshalKeyFormat(version uint32) []byte {
+	if version == 0 {
+		return nil
+	}
+	return appendVarint([]byte{1<<3 | wireVarint}, uint64(version))
+}
+
+func unmarshalKeyFormat(b []byte) (version uint32, err error) {
+	fields, err := parseProto(b)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range fields {
+		switch {
+		case f.num == 1 && f.wire == wireVarint:
+			version = uint32(f.value)
+		case f.num == 1:
+			return 0, errProto
+		}
+	}
+	return version, nil
+}
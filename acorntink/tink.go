@@ -0,0 +1,164 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acorntink provides ACORN-128 as a custom AEAD primitive for
+// Tink (https://developers.google.com/tink).
+//
+// AEAD has the methods of Tink's tink.AEAD interface. A ciphertext is
+//
+//	nonce [16]byte || ciphertext || tag [16]byte
+//
+// with a random nonce; Tink adds its own output prefix in front.
+//
+// Keys have the type URL in TypeURL and are serialized as the protobuf
+// message AcornKey, whose key format is AcornKeyFormat:
+//
+//	message AcornKey {
+//		uint32 version = 1;
+//		bytes key_value = 2;
+//	}
+//
+//	message AcornKeyFormat {
+//		uint32 version = 1;
+//	}
+//
+// KeyManager does the work of a Tink key manager for them. Tink's
+// registry.KeyManager interface returns protobuf types, so registering it
+// takes a small adapter in the program that uses Tink:
+//
+//	type acornKeyManager struct{ acorntink.KeyManager }
+//
+//	func (m acornKeyManager) NewKey(format []byte) (proto.Message, error) {
+//		return nil, errors.New("acorn: use NewKeyData")
+//	}
+//
+//	func (m acornKeyManager) NewKeyData(format []byte) (*tinkpb.KeyData, error) {
+//		key, err := m.NewSerializedKey(format)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return &tinkpb.KeyData{
+//			TypeUrl:         acorntink.TypeURL,
+//			Value:           key,
+//			KeyMaterialType: tinkpb.KeyData_SYMMETRIC,
+//		}, nil
+//	}
+//
+//	registry.RegisterKeyManager(acornKeyManager{})
+//
+// Keysets of ACORN keys are then made from the template
+//
+//	&tinkpb.KeyTemplate{
+//		TypeUrl:          acorntink.TypeURL,
+//		Value:            acorntink.KeyFormat(),
+//		OutputPrefixType: tinkpb.OutputPrefixType_TINK,
+//	}
+//
+// and aead.New returns a primitive that seals with ACORN-128.
+package acorntink
+
+import (
+	"crypto/cipher"
+	cryptorand "crypto/rand"
+	"errors"
+	"io"
+
+	"github.com/magical/go-acorn"
+)
+
+// TypeURL is the Tink type URL of ACORN-128 keys.
+const TypeURL = "type.googleapis.com/magical.acorn.AcornKey"
+
+// keyVersion is the version of the key type that this package implements.
+const keyVersion = 0
+
+var (
+	ErrInvalidKey     = errors.New("acorntink: invalid AcornKey")
+	ErrInvalidFormat  = errors.New("acorntink: invalid AcornKeyFormat")
+	ErrAuthentication = errors.New("acorntink: message authentication failed")
+)
+
+// An AEAD is an ACORN-128 key as a Tink AEAD primitive.
+type AEAD struct {
+	aead cipher.AEAD
+}
+
+// NewAEAD returns an AEAD with the given 128-bit key.
+// If the key is not the correct length, NewAEAD will panic.
+func NewAEAD(key []byte) *AEAD {
+	return &AEAD{aead: acorn.NewAEAD(key)}
+}
+
+// Encrypt seals plaintext with associatedData under a random nonce.
+func (a *AEAD) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	out := make([]byte, acorn.NonceSize, acorn.NonceSize+len(plaintext)+acorn.TagSize)
+	if _, err := io.ReadFull(cryptorand.Reader, out); err != nil {
+		return nil, err
+	}
+	return a.aead.Seal(out, out, plaintext, associatedData), nil
+}
+
+// Decrypt opens a ciphertext returned by Encrypt.
+func (a *AEAD) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	if len(ciphertext) < acorn.NonceSize+acorn.TagSize {
+		return nil, ErrAuthentication
+	}
+	nonce, ct := ciphertext[:acorn.NonceSize], ciphertext[acorn.NonceSize:]
+	pt, err := a.aead.Open(nil, nonce, ct, associatedData)
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+	return pt, nil
+}
+
+// KeyFormat returns the serialized AcornKeyFormat for new keys.
+func KeyFormat() []byte {
+	return marshalKeyFormat(keyVersion)
+}
+
+// MarshalKey returns the serialized AcornKey for an existing key,
+// so that it can be imported into a keyset.
+// If the key is not the correct length, MarshalKey will panic.
+func MarshalKey(key []byte) []byte {
+	if len(key) != acorn.KeySize {
+		panic("acorntink: invalid key length")
+	}
+	return marshalKey(keyVersion, key)
+}
+
+// A KeyManager creates keys and primitives for ACORN-128 keys.
+// Its methods are those of Tink's registry.KeyManager that don't
+// involve protobuf types; see the package documentation.
+type KeyManager struct{}
+
+// Primitive returns the *AEAD for a serialized AcornKey.
+func (KeyManager) Primitive(serializedKey []byte) (interface{}, error) {
+	version, key, err := unmarshalKey(serializedKey)
+	if err != nil || version != keyVersion || len(key) != acorn.KeySize {
+		return nil, ErrInvalidKey
+	}
+	return NewAEAD(key), nil
+}
+
+// NewSerializedKey returns a new random key, as a serialized AcornKey,
+// for a serialized AcornKeyFormat.
+func (KeyManager) NewSerializedKey(serializedKeyFormat []byte) ([]byte, error) {
+	version, err := unmarshalKeyFormat(serializedKeyFormat)
+	if err != nil || version != keyVersion {
+		return nil, ErrInvalidFormat
+	}
+	key := make([]byte, acorn.KeySize)
+	if _, err := io.ReadFull(cryptorand.Reader, key); err != nil {
+		return nil, err
+	}
+	return marshalKey(keyVersion, key), nil
+}
+
+// DoesSupport reports whether typeURL is TypeURL.
+func (KeyManager) DoesSupport(typeURL string) bool {
+	return typeURL == TypeURL
+}
+
+// TypeURL returns TypeURL.
+func (KeyManager) TypeURL() string {
+	return TypeURL
+}
@@ -0,0 +1,78 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorntink
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+var testKey = []byte("0123456789abcdef")
+
+func TestAEAD(t *testing.T) {
+	p, err := KeyManager{}.Primitive(MarshalKey(testKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := p.(*AEAD)
+	msg, ad := []byte("hello, tink"), []byte("context")
+	ct, err := a.Encrypt(msg, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ct) != 16+len(msg)+16 {
+		t.Errorf("ciphertext is %d bytes", len(ct))
+	}
+	if got, err := a.Decrypt(ct, ad); err != nil || !bytes.Equal(got, msg) {
+		t.Errorf("Decrypt = %q, %v", got, err)
+	}
+	if _, err := a.Decrypt(ct, nil); err != ErrAuthentication {
+		t.Errorf("Decrypt with the wrong associated data returned %v", err)
+	}
+	if _, err := a.Decrypt(ct[:20], ad); err != ErrAuthentication {
+		t.Errorf("Decrypt of a short ciphertext returned %v", err)
+	}
+}
+
+func TestKeyManager(t *testing.T) {
+	var m KeyManager
+	if !m.DoesSupport(TypeURL) || m.DoesSupport("type.googleapis.com/google.crypto.tink.AesGcmKey") {
+		t.Error("DoesSupport is wrong")
+	}
+	k, err := m.NewSerializedKey(KeyFormat())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Primitive(k); err != nil {
+		t.Error(err)
+	}
+	if _, err := m.NewSerializedKey([]byte{0x08, 0x01}); err != ErrInvalidFormat {
+		t.Errorf("NewSerializedKey with version 1 returned %v", err)
+	}
+
+	// AcornKey{key_value: testKey}, as protoc would encode it,
+	// and with an unknown field appended
+	want := "1210" + hex.EncodeToString(testKey)
+	if got := hex.EncodeToString(MarshalKey(testKey)); got != want {
+		t.Errorf("MarshalKey = %s, want %s", got, want)
+	}
+	unknown, _ := hex.DecodeString(want + "18051a0161")
+	if _, err := m.Primitive(unknown); err != nil {
+		t.Errorf("Primitive with unknown fields: %v", err)
+	}
+
+	for _, bad := range []string{
+		"",                  // no key
+		"120f" + want[4:34], // 15-byte key
+		"0801" + want,       // version 1
+		"1220" + want[4:],   // length past the end
+		"0a",                // truncated
+		"07",                // bad wire type
+	} {
+		b, _ := hex.DecodeString(bad)
+		if _, err := m.Primitive(b); err != ErrInvalidKey {
+			t.Errorf("Primitive(%s) returned %v, want ErrInvalidKey", bad, err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acorntoken implements authenticated, encrypted tokens for web
+// services, in the style of PASETO's local tokens, using ACORN-128.
+//
+// A token is the string "acorn.v1." followed by the unpadded URL-safe
+// base64 encoding of
+//
+//	keyID      [8]byte  ID of the key that sealed the token
+//	nonce      [16]byte random
+//	sealed     []byte   sealed body and 16-byte tag
+//
+// where the body is
+//
+//	issuedAt   int64    big-endian Unix time in seconds
+//	expires    int64    big-endian Unix time in seconds, or 0 for never
+//	payload    []byte
+//
+// The prefix and key ID are passed as additional data. The key ID is
+// visible to anyone holding the token, but the times and payload are not.
+//
+// Keys are held by an agent.Agent, such as the one returned by
+// agent.NewKeyring, and looked up by key ID when a token is opened,
+// so keys can be rotated by adding a new key, sealing new tokens with
+// it, and removing the old key once its tokens have expired.
+package acorntoken
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/magical/go-acorn"
+	"github.com/magical/go-acorn/agent"
+)
+
+// Prefix begins every token.
+const Prefix = "acorn.v1."
+
+// MaxClockSkew is how far in the future a token's issue time may be,
+// to allow for clocks that disagree.
+const MaxClockSkew = time.Minute
+
+const (
+	idSize   = 8
+	bodySize = 16 // issuedAt and expires
+	minSize  = idSize + acorn.NonceSize + bodySize + acorn.TagSize
+)
+
+var (
+	ErrInvalid     = errors.New("acorntoken: invalid token")
+	ErrExpired     = errors.New("acorntoken: token has expired")
+	ErrNotYetValid = errors.New("acorntoken: token issued in the future")
+)
+
+var encoding = base64.RawURLEncoding.Strict()
+
+// A Token holds the contents of an opened token.
+type Token struct {
+	KeyID    [8]byte
+	IssuedAt time.Time
+	Expires  time.Time // zero if the token does not expire
+	Payload  []byte
+}
+
+// Decode unmarshals the JSON payload of a token sealed by SealJSON into v.
+func (t *Token) Decode(v interface{}) error {
+	return json.Unmarshal(t.Payload, v)
+}
+
+// Seal returns a token holding payload, sealed by the agent with the key
+// keyID. If ttl is positive, the token expires after that long;
+// otherwise it never does. Times are rounded down to the second.
+func Seal(a agent.Agent, keyID [8]byte, payload []byte, ttl time.Duration) (string, error) {
+	return sealAt(a, keyID, payload, ttl, time.Now())
+}
+
+// SealJSON is like Seal, but the payload is the JSON encoding of claims.
+func SealJSON(a agent.Agent, keyID [8]byte, claims interface{}, ttl time.Duration) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	return Seal(a, keyID, payload, ttl)
+}
+
+func sealAt(a agent.Agent, keyID [8]byte, payload []byte, ttl time.Duration, now time.Time) (string, error) {
+	nonce, err := acorn.GenerateNonce(nil)
+	if err != nil {
+		return "", err
+	}
+	body := make([]byte, bodySize+len(payload))
+	iat := now.Unix()
+	var exp int64
+	if ttl > 0 {
+		exp = now.Add(ttl).Unix()
+	}
+	binary.BigEndian.PutUint64(body[0:], uint64(iat))
+	binary.BigEndian.PutUint64(body[8:], uint64(exp))
+	copy(body[bodySize:], payload)
+	sealed, err := a.Seal(keyID, nonce, body, additionalData(keyID))
+	if err != nil {
+		return "", err
+	}
+	raw := make([]byte, 0, idSize+len(nonce)+len(sealed))
+	raw = append(raw, keyID[:]...)
+	raw = append(raw, nonce...)
+	raw = append(raw, sealed...)
+	return Prefix + encoding.EncodeToString(raw), nil
+}
+
+func additionalData(keyID [8]byte) []byte {
+	return append([]byte(Prefix), keyID[:]...)
+}
+
+// Open verifies and decrypts a token using the agent's keys,
+// and checks that it is valid at the current time.
+func Open(a agent.Agent, token string) (*Token, error) {
+	return OpenAt(a, token, time.Now())
+}
+
+// OpenAt is like Open but checks that the token is valid at the given time.
+// It returns ErrInvalid for any token that is malformed or not authentic,
+// including one sealed with a key the agent does not have.
+func OpenAt(a agent.Agent, token string, now time.Time) (*Token, error) {
+	if !strings.HasPrefix(token, Prefix) {
+		return nil, ErrInvalid
+	}
+	raw, err := encoding.DecodeString(token[len(Prefix):])
+	if err != nil || len(raw) < minSize {
+		return nil, ErrInvalid
+	}
+	t := new(Token)
+	copy(t.KeyID[:], raw)
+	nonce := raw[idSize : idSize+acorn.NonceSize]
+	body, err := a.Open(t.KeyID, nonce, raw[idSize+acorn.NonceSize:], additionalData(t.KeyID))
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	iat := int64(binary.BigEndian.Uint64(body[0:]))
+	exp := int64(binary.BigEndian.Uint64(body[8:]))
+	if iat < 0 || exp < 0 || (exp != 0 && exp < iat) {
+		return nil, ErrInvalid
+	}
+	t.IssuedAt = time.Unix(iat, 0)
+	if exp != 0 {
+		t.Expires = time.Unix(exp, 0)
+		if !now.Before(t.Expires) {
+			return nil, ErrExpired
+		}
+	}
+	if t.IssuedAt.After(now.Add(MaxClockSkew)) {
+		return nil, ErrNotYetValid
+	}
+	t.Payload = body[bodySize:]
+	return t, nil
+}
@@ -0,0 +1,121 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorntoken
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magical/go-acorn/agent"
+)
+
+var (
+	testID  = [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	testKey = []byte(strings.Repeat("password", 2))
+)
+
+func testKeyring(t *testing.T) agent.Agent {
+	r := agent.NewKeyring()
+	if err := r.Add(testID, testKey); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRoundTrip(t *testing.T) {
+	r := testKeyring(t)
+	type claims struct {
+		User  string `json:"user"`
+		Admin bool   `json:"admin"`
+	}
+	tok, err := SealJSON(r, testID, claims{"alice", true}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(tok, Prefix) || strings.ContainsAny(tok[len(Prefix):], "+/=.") {
+		t.Errorf("token %q is not URL-safe", tok)
+	}
+	got, err := Open(r, tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c claims
+	if err := got.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c != (claims{"alice", true}) {
+		t.Errorf("got claims %+v", c)
+	}
+	if got.KeyID != testID {
+		t.Errorf("got key ID %x, want %x", got.KeyID, testID)
+	}
+	if d := got.Expires.Sub(got.IssuedAt); d != time.Hour {
+		t.Errorf("lifetime = %v, want %v", d, time.Hour)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	r := testKeyring(t)
+	now := time.Unix(1500000000, 0)
+	tok, err := sealAt(r, testID, []byte("x"), time.Minute, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		at  time.Time
+		err error
+	}{
+		{now, nil},
+		{now.Add(59 * time.Second), nil},
+		{now.Add(time.Minute), ErrExpired},
+		{now.Add(-MaxClockSkew), nil},
+		{now.Add(-MaxClockSkew - time.Second), ErrNotYetValid},
+	} {
+		if _, err := OpenAt(r, tok, tt.at); err != tt.err {
+			t.Errorf("at %v: got error %v, want %v", tt.at.Sub(now), err, tt.err)
+		}
+	}
+	forever, err := sealAt(r, testID, []byte("x"), 0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := OpenAt(r, forever, now.Add(100*365*24*time.Hour))
+	if err != nil || !got.Expires.IsZero() {
+		t.Errorf("got expiry %v, error %v", got.Expires, err)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	r := testKeyring(t)
+	tok, err := Seal(r, testID, []byte("hello"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := agent.NewKeyring()
+	other.Add(testID, []byte(strings.Repeat("PASSWORD", 2)))
+	if _, err := Open(other, tok); err != ErrInvalid {
+		t.Errorf("wrong key: got error %v, want %v", err, ErrInvalid)
+	}
+	bad := []string{
+		"",
+		Prefix,
+		"acorn.v2." + tok[len(Prefix):],
+		tok + "=",
+		tok + ".",
+		tok[:len(tok)-1],
+		tok[:len(Prefix)+10],
+	}
+	for i := len(Prefix); i < len(tok); i++ {
+		c := byte('A')
+		if tok[i] == 'A' {
+			c = 'B'
+		}
+		bad = append(bad, tok[:i]+string(c)+tok[i+1:])
+	}
+	for _, s := range bad {
+		if _, err := Open(r, s); err != ErrInvalid {
+			t.Errorf("%q: got error %v, want %v", s, err, ErrInvalid)
+		}
+	}
+}
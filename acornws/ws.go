@@ -0,0 +1,161 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package acornws seals individual WebSocket messages with ACORN-128.
+//
+// Each side of a connection has a Session. Messages are sealed under a
+// key derived from the shared key, the connection ID, and the direction,
+// with the message's sequence number in that direction as the nonce and
+// the connection ID as additional data. WebSocket delivers messages
+// reliably and in order, so sequence numbers are not sent; a message that
+// is dropped, replayed, reordered, or moved to another connection fails
+// to open.
+//
+// The connection ID must never be reused with the same key. A server
+// can pick one with NewConnID and send it to the client in the clear,
+// for instance in the URL or the first message.
+//
+// ReadMessage and WriteMessage work with github.com/gorilla/websocket
+// connections directly. With other libraries, such as nhooyr.io/websocket,
+// call Seal and Open and send the results as binary messages:
+//
+//	err = c.Write(ctx, websocket.MessageBinary, s.Seal(nil, msg))
+//	...
+//	_, data, err := c.Read(ctx)
+//	msg, err := s.Open(nil, data)
+package acornws
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/magical/go-acorn"
+)
+
+// ConnIDSize is the length of connection IDs returned by NewConnID.
+const ConnIDSize = 16
+
+// binaryMessage is the gorilla/websocket (and RFC 6455) binary message type.
+const binaryMessage = 2
+
+var (
+	ErrAuthentication = errors.New("acornws: message authentication failed")
+	errMessageType    = errors.New("acornws: message is not binary")
+	errSequence       = errors.New("acornws: sequence number exhausted")
+)
+
+// NewConnID returns a random connection ID.
+func NewConnID() ([]byte, error) {
+	// A nonce is also 16 random bytes.
+	return acorn.GenerateNonce(nil)
+}
+
+// A Session seals and opens the messages of one WebSocket connection.
+// Seal and Open may be called concurrently with each other,
+// but not with themselves.
+type Session struct {
+	id   []byte
+	send direction
+	recv direction
+}
+
+type direction struct {
+	mu    sync.Mutex
+	aead  cipher.AEAD
+	seq   uint64
+	nonce [acorn.NonceSize]byte
+}
+
+// Client returns the Session for the client side of the connection
+// with the given ID, using the 16-byte shared key.
+func Client(key, connID []byte) *Session {
+	return newSession(key, connID, "client", "server")
+}
+
+// Server returns the Session for the server side of the connection
+// with the given ID, using the 16-byte shared key.
+func Server(key, connID []byte) *Session {
+	return newSession(key, connID, "server", "client")
+}
+
+func newSession(key, connID []byte, us, them string) *Session {
+	if len(key) != acorn.KeySize {
+		panic("acornws: invalid key length")
+	}
+	s := &Session{id: append([]byte(nil), connID...)}
+	s.send.aead = acorn.NewAEAD(deriveKey(key, connID, us))
+	s.recv.aead = acorn.NewAEAD(deriveKey(key, connID, them))
+	return s
+}
+
+// deriveKey derives the key for messages sent by the named side.
+func deriveKey(key, connID []byte, sender string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte("acornws " + sender + " key\x00"))
+	m.Write(connID)
+	return m.Sum(nil)[:acorn.KeySize]
+}
+
+// Seal seals the next outgoing message, appends it to dst,
+// and returns the updated slice.
+func (s *Session) Seal(dst, msg []byte) ([]byte, error) {
+	d := &s.send
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.seq == ^uint64(0) {
+		return dst, errSequence
+	}
+	binary.BigEndian.PutUint64(d.nonce[8:], d.seq)
+	d.seq++
+	return d.aead.Seal(dst, d.nonce[:], msg, s.id), nil
+}
+
+// Open opens the next incoming message, appends it to dst,
+// and returns the updated slice. A message that fails to open
+// does not use up a sequence number.
+func (s *Session) Open(dst, msg []byte) ([]byte, error) {
+	d := &s.recv
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.seq == ^uint64(0) {
+		return dst, errSequence
+	}
+	binary.BigEndian.PutUint64(d.nonce[8:], d.seq)
+	out, err := d.aead.Open(dst, d.nonce[:], msg, s.id)
+	if err != nil {
+		return dst, ErrAuthentication
+	}
+	d.seq++
+	return out, nil
+}
+
+// MessageConn is the part of *websocket.Conn from
+// github.com/gorilla/websocket used by ReadMessage and WriteMessage.
+type MessageConn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+}
+
+// WriteMessage seals msg and writes it to c as a binary message.
+func (s *Session) WriteMessage(c MessageConn, msg []byte) error {
+	sealed, err := s.Seal(nil, msg)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(binaryMessage, sealed)
+}
+
+// ReadMessage reads a binary message from c and opens it.
+func (s *Session) ReadMessage(c MessageConn) ([]byte, error) {
+	typ, p, err := c.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	if typ != binaryMessage {
+		return nil, errMessageType
+	}
+	return s.Open(p[:0], p)
+}
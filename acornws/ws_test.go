@@ -0,0 +1,100 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acornws
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var (
+	testKey = []byte(strings.Repeat("password", 2))
+	testID  = []byte("connection 1")
+)
+
+// fakeConn is an in-memory MessageConn.
+type fakeConn struct {
+	types []int
+	msgs  [][]byte
+}
+
+func (c *fakeConn) WriteMessage(typ int, p []byte) error {
+	c.types = append(c.types, typ)
+	c.msgs = append(c.msgs, append([]byte(nil), p...))
+	return nil
+}
+
+func (c *fakeConn) ReadMessage() (int, []byte, error) {
+	typ, p := c.types[0], c.msgs[0]
+	c.types, c.msgs = c.types[1:], c.msgs[1:]
+	return typ, p, nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	client, server := Client(testKey, testID), Server(testKey, testID)
+	var toServer, toClient fakeConn
+	for i, msg := range []string{"hello", "", "world"} {
+		if err := client.WriteMessage(&toServer, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		if err := server.WriteMessage(&toClient, []byte(strings.ToUpper(msg))); err != nil {
+			t.Fatal(err)
+		}
+		if toServer.types[0] != binaryMessage {
+			t.Errorf("message %d: type %d, want %d", i, toServer.types[0], binaryMessage)
+		}
+		got, err := server.ReadMessage(&toServer)
+		if err != nil || string(got) != msg {
+			t.Errorf("message %d: server got %q, %v", i, got, err)
+		}
+		got, err = client.ReadMessage(&toClient)
+		if err != nil || string(got) != strings.ToUpper(msg) {
+			t.Errorf("message %d: client got %q, %v", i, got, err)
+		}
+	}
+}
+
+func TestReject(t *testing.T) {
+	client := Client(testKey, testID)
+	var msgs [][]byte
+	for i := 0; i < 3; i++ {
+		m, _ := client.Seal(nil, []byte{byte(i)})
+		msgs = append(msgs, m)
+	}
+	for name, tt := range map[string]struct {
+		s    *Session
+		msgs [][]byte
+	}{
+		"reflected":  {Client(testKey, testID), msgs[:1]},
+		"other conn": {Server(testKey, []byte("connection 2")), msgs[:1]},
+		"reordered":  {Server(testKey, testID), [][]byte{msgs[1]}},
+		"replayed":   {Server(testKey, testID), [][]byte{msgs[0], msgs[0]}},
+		"dropped":    {Server(testKey, testID), [][]byte{msgs[0], msgs[2]}},
+	} {
+		var err error
+		for _, m := range tt.msgs {
+			if _, err = tt.s.Open(nil, m); err != nil {
+				break
+			}
+		}
+		if err != ErrAuthentication {
+			t.Errorf("%s: got error %v, want %v", name, err, ErrAuthentication)
+		}
+	}
+
+	server := Server(testKey, testID)
+	bad := append([]byte(nil), msgs[0]...)
+	bad[0] ^= 1
+	if _, err := server.Open(nil, bad); err == nil {
+		t.Error("tampered message accepted")
+	}
+	if got, err := server.Open(nil, msgs[0]); err != nil || !bytes.Equal(got, []byte{0}) {
+		t.Errorf("after forgery: got %x, %v", got, err)
+	}
+
+	conn := &fakeConn{types: []int{1}, msgs: [][]byte{msgs[1]}}
+	if _, err := server.ReadMessage(conn); err != errMessageType {
+		t.Errorf("text message: got error %v, want %v", err, errMessageType)
+	}
+}
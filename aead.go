@@ -30,6 +30,7 @@ import (
 	"crypto/subtle"
 	"encoding/binary"
 	"errors"
+	"io"
 )
 
 const (
@@ -44,17 +45,28 @@ type aead struct {
 
 // New returns a ACORN instance that uses the given 128-bit key.
 // If the key is not the correct length, NewAEAD will panic.
+// If an Engine has been registered with RegisterEngine, the instance uses it.
+//
+// The instance is safe for concurrent use: any number of goroutines
+// may call Seal, Open, and the Batch methods on it at once. Nothing is
+// cached in it after it is created, and that must stay true of any
+// future precomputation, such as of the state after the key is loaded.
 func NewAEAD(key []byte) cipher.AEAD {
 	if len(key) != KeySize {
 		panic("acorn: invalid key length")
 	}
-	return &aead{
-		key: [4]uint32{
-			binary.LittleEndian.Uint32(key[0*4:]),
-			binary.LittleEndian.Uint32(key[1*4:]),
-			binary.LittleEndian.Uint32(key[2*4:]),
-			binary.LittleEndian.Uint32(key[3*4:]),
-		},
+	if newEngine := registeredEngine(); newEngine != nil {
+		return NewAEADEngine(key, newEngine)
+	}
+	return &aead{key: loadKey(key)}
+}
+
+func loadKey(key []byte) [4]uint32 {
+	return [4]uint32{
+		binary.LittleEndian.Uint32(key[0*4:]),
+		binary.LittleEndian.Uint32(key[1*4:]),
+		binary.LittleEndian.Uint32(key[2*4:]),
+		binary.LittleEndian.Uint32(key[3*4:]),
 	}
 }
 
@@ -73,38 +85,59 @@ func (a *aead) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
 	}
 	s.init(&a.key, nonce)
 	s.process(additionalData)
-	i := len(dst)
-	j := i + len(plaintext)
-	k := j + TagSize
-	dst = append(dst, make([]byte, len(plaintext)+TagSize)...)
-	s.crypt(dst[i:j], plaintext, 0)
-	s.finalize(dst[j:k])
-	return dst
+	ret, out := sliceForAppend(dst, len(plaintext)+TagSize)
+	s.encrypt(out[:len(plaintext)], plaintext)
+	s.finalize(out[len(plaintext):])
+	return ret
 }
 
-var errDecryption = errors.New("acorn: decryption failed")
+// ErrAuthentication is returned by Open when the ciphertext,
+// nonce, and additional data do not authenticate.
+var ErrAuthentication = errors.New("acorn: message authentication failed")
 
 func (a *aead) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
 	var s state
+	if len(ciphertext) < TagSize {
+		reportFailure(&a.key, len(ciphertext), len(additionalData))
+		return dst, ErrAuthentication
+	}
 	s.init(&a.key, nonce)
 	s.process(additionalData)
 	n := len(ciphertext) - TagSize
 	data := ciphertext[:n]
 	tag := ciphertext[n:]
-	pl := make([]byte, n)
-	s.crypt(pl, data, one)
-	expectedTag := s.finalize(make([]byte, TagSize))
-	if subtle.ConstantTimeCompare(tag, expectedTag) == 0 {
-		return dst, errDecryption
+	ret, out := sliceForAppend(dst, n)
+	s.decrypt(out, data)
+	var expectedTag [TagSize]byte
+	s.finalize(expectedTag[:])
+	if subtle.ConstantTimeCompare(tag, expectedTag[:]) == 0 {
+		// don't leave unauthenticated plaintext lying around
+		for i := range out {
+			out[i] = 0
+		}
+		reportFailure(&a.key, len(ciphertext), len(additionalData))
+		return dst, ErrAuthentication
 	}
-	dst = append(dst, pl...)
-	return dst, nil
+	return ret, nil
+}
+
+// sliceForAppend extends in by n bytes, reallocating if necessary,
+// and returns the extended slice and the new n bytes.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
 }
 
 // RandomKey returns a securely-generated random 16-byte key.
+// It panics if crypto/rand fails; see GenerateKey.
 func RandomKey() []uint8 {
-	k := make([]byte, 16)
-	_, err := cryptorand.Read(k)
+	k, err := GenerateKey(nil)
 	if err != nil {
 		panic(err)
 	}
@@ -113,13 +146,38 @@ func RandomKey() []uint8 {
 
 // RandomNonce returns a securely-generated random 16-byte nonce
 // suitable for passing to Seal.
+// It panics if crypto/rand fails; see GenerateNonce.
 func RandomNonce() []uint8 {
-	// ACORN-128 uses a 128-bit nonce, which is large enough that
-	// it can be selected randomly without worrying about repeats.
-	iv := make([]byte, 16)
-	_, err := cryptorand.Read(iv)
+	iv, err := GenerateNonce(nil)
 	if err != nil {
 		panic(err)
 	}
 	return iv
 }
+
+// GenerateKey returns a random 16-byte key read from rand,
+// or from crypto/rand if rand is nil. Unlike RandomKey, it reports
+// failure instead of panicking, which matters on platforms such as
+// js/wasm and TinyGo targets where crypto/rand may be unavailable.
+func GenerateKey(rand io.Reader) ([]uint8, error) {
+	return readRandom(rand, KeySize)
+}
+
+// GenerateNonce returns a random 16-byte nonce read from rand,
+// or from crypto/rand if rand is nil. See GenerateKey.
+func GenerateNonce(rand io.Reader) ([]uint8, error) {
+	// ACORN-128 uses a 128-bit nonce, which is large enough that
+	// it can be selected randomly without worrying about repeats.
+	return readRandom(rand, NonceSize)
+}
+
+func readRandom(rand io.Reader, n int) ([]uint8, error) {
+	if rand == nil {
+		rand = cryptorand.Reader
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
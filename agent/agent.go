@@ -0,0 +1,202 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package agent implements a key agent for ACORN-128, in the style of
+// ssh-agent: a long-running process that holds keys in memory and performs
+// Seal and Open on behalf of clients that connect to it over a unix socket,
+// so that the keys never have to be stored by the tools that use them.
+//
+// Keys are referred to by an 8-byte key ID, such as the one stored
+// in a key file. AddKey adds a key under the ID from acorn.KeyID.
+//
+// The protocol is a sequence of requests and responses, each framed as a
+// 4-byte big-endian length followed by a message type byte and its
+// arguments. Byte strings are encoded as a 4-byte big-endian length
+// followed by the bytes.
+package agent
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/magical/go-acorn"
+)
+
+// An Agent holds keys and uses them to seal and open messages.
+// Both the in-memory keyring and the client implement Agent.
+type Agent interface {
+	// List returns the IDs of the keys held by the agent.
+	List() ([][8]byte, error)
+
+	// Add adds a key to the agent, replacing any key with the same ID.
+	Add(id [8]byte, key []byte) error
+
+	// Remove removes a key from the agent.
+	Remove(id [8]byte) error
+
+	// Seal seals a message with the given key.
+	// It returns the ciphertext and tag, like cipher.AEAD's Seal.
+	Seal(id [8]byte, nonce, plaintext, additionalData []byte) ([]byte, error)
+
+	// Open opens a message sealed with the given key.
+	Open(id [8]byte, nonce, ciphertext, additionalData []byte) ([]byte, error)
+}
+
+// AddKey adds key to a under the ID given by acorn.KeyID,
+// and returns the ID.
+func AddKey(a Agent, key []byte) ([8]byte, error) {
+	if len(key) != acorn.KeySize {
+		return [8]byte{}, errKeySize
+	}
+	id := acorn.KeyID(key)
+	return id, a.Add(id, key)
+}
+
+var (
+	ErrNotFound       = errors.New("agent: key not found")
+	ErrAuthentication = errors.New("agent: message authentication failed")
+	errKeySize        = errors.New("agent: invalid key length")
+	errNonceSize      = errors.New("agent: invalid nonce length")
+	errErased         = errors.New("agent: keys have been erased")
+)
+
+type keyring struct {
+	limits acorn.Limits
+
+	mu     sync.RWMutex
+	keys   map[[8]byte]*keyEntry
+	cancel func()
+}
+
+type keyEntry struct {
+	aead  *acorn.StoredAEAD
+	meter *acorn.Meter
+}
+
+// NewKeyring returns an Agent that holds keys in memory.
+// It is safe for concurrent use.
+//
+// acorn.Shutdown erases the keys, after which the keyring is empty
+// and refuses to add more. The keyring is also an io.Closer, whose
+// Close does the same for this keyring alone.
+func NewKeyring() Agent {
+	return NewLimitedKeyring(acorn.Limits{})
+}
+
+// NewLimitedKeyring is like NewKeyring, but Seal returns
+// acorn.ErrKeyExhausted once a key has sealed as much as limits allow.
+// Adding a key, even one already held, starts its count over.
+func NewLimitedKeyring(limits acorn.Limits) Agent {
+	r := &keyring{limits: limits, keys: make(map[[8]byte]*keyEntry)}
+	r.cancel = acorn.OnShutdown(r.erase)
+	return r
+}
+
+// Close erases the keys and unregisters the keyring from
+// acorn.Shutdown. It is safe to call more than once.
+func (r *keyring) Close() error {
+	r.erase()
+	r.cancel()
+	return nil
+}
+
+func (r *keyring) erase() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.keys {
+		e.aead.Close()
+	}
+	r.keys = nil
+}
+
+func (r *keyring) List() ([][8]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([][8]byte, 0, len(r.keys))
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return string(ids[i][:]) < string(ids[j][:])
+	})
+	return ids, nil
+}
+
+func (r *keyring) Add(id [8]byte, key []byte) error {
+	if len(key) != acorn.KeySize {
+		return errKeySize
+	}
+	a, err := acorn.NewAEADStore(key, nil)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.keys == nil {
+		a.Close()
+		return errErased
+	}
+	if old, ok := r.keys[id]; ok {
+		old.aead.Close()
+	}
+	r.keys[id] = &keyEntry{aead: a, meter: acorn.NewMeter(r.limits)}
+	return nil
+}
+
+func (r *keyring) Remove(id [8]byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.keys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	e.aead.Close()
+	delete(r.keys, id)
+	return nil
+}
+
+// get returns the key with the given ID, with r read-locked so that it
+// cannot be closed while in use. The caller must call r.mu.RUnlock.
+func (r *keyring) get(id [8]byte) (*keyEntry, error) {
+	r.mu.RLock()
+	e, ok := r.keys[id]
+	if !ok {
+		r.mu.RUnlock()
+		return nil, ErrNotFound
+	}
+	return e, nil
+}
+
+func (r *keyring) Seal(id [8]byte, nonce, plaintext, additionalData []byte) ([]byte, error) {
+	e, err := r.get(id)
+	if err != nil {
+		return nil, err
+	}
+	defer r.mu.RUnlock()
+	if len(nonce) != acorn.NonceSize {
+		return nil, errNonceSize
+	}
+	if err := e.meter.Use(len(plaintext)); err != nil {
+		return nil, err
+	}
+	return e.aead.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+func (r *keyring) Open(id [8]byte, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	e, err := r.get(id)
+	if err != nil {
+		return nil, err
+	}
+	defer r.mu.RUnlock()
+	if len(nonce) != acorn.NonceSize {
+		return nil, errNonceSize
+	}
+	if len(ciphertext) < acorn.TagSize {
+		return nil, ErrAuthentication
+	}
+	p, err := e.aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+	return p, nil
+}
@@ -0,0 +1,182 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package agent
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/magical/go-acorn"
+)
+
+var (
+	testID  = [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	testKey = []byte(strings.Repeat("password", 2))
+)
+
+func testAgent(t *testing.T, a Agent) {
+	if err := a.Add(testID, testKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Add([8]byte{9}, testKey[:5]); err == nil {
+		t.Errorf("Add accepted a short key")
+	}
+	ids, err := a.List()
+	if err != nil || len(ids) != 1 || ids[0] != testID {
+		t.Errorf("List() = %x, %v; want [%x]", ids, err, testID)
+	}
+
+	nonce := make([]byte, acorn.NonceSize)
+	want := acorn.NewAEAD(testKey).Seal(nil, nonce, []byte("message"), []byte("ad"))
+	got, err := a.Seal(testID, nonce, []byte("message"), []byte("ad"))
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Seal = %x, %v; want %x", got, err, want)
+	}
+	p, err := a.Open(testID, nonce, got, []byte("ad"))
+	if err != nil || string(p) != "message" {
+		t.Errorf("Open = %q, %v; want %q", p, err, "message")
+	}
+	if _, err := a.Open(testID, nonce, got, []byte("bad")); err != ErrAuthentication {
+		t.Errorf("Open with wrong ad: got %v, want %v", err, ErrAuthentication)
+	}
+	if _, err := a.Open(testID, nonce, got[:3], nil); err != ErrAuthentication {
+		t.Errorf("Open with short ciphertext: got %v, want %v", err, ErrAuthentication)
+	}
+	if _, err := a.Seal(testID, nonce[:4], nil, nil); err == nil {
+		t.Errorf("Seal accepted a short nonce")
+	}
+	if _, err := a.Seal([8]byte{}, nonce, nil, nil); err != ErrNotFound {
+		t.Errorf("Seal with unknown key: got %v, want %v", err, ErrNotFound)
+	}
+
+	if err := a.Remove(testID); err != nil {
+		t.Errorf("Remove: %v", err)
+	}
+	if err := a.Remove(testID); err != ErrNotFound {
+		t.Errorf("Remove twice: got %v, want %v", err, ErrNotFound)
+	}
+	if ids, err := a.List(); err != nil || len(ids) != 0 {
+		t.Errorf("List() = %x, %v; want []", ids, err)
+	}
+
+	id, err := AddKey(a, testKey)
+	if err != nil || id != acorn.KeyID(testKey) {
+		t.Errorf("AddKey = %x, %v; want %x", id, err, acorn.KeyID(testKey))
+	}
+	if _, err := a.Seal(id, nonce, nil, nil); err != nil {
+		t.Errorf("Seal with the key from AddKey: %v", err)
+	}
+	a.Remove(id)
+}
+
+func TestKeyring(t *testing.T) {
+	testAgent(t, NewKeyring())
+}
+
+func TestClient(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- ServeAgent(NewKeyring(), c2)
+		c2.Close()
+	}()
+	testAgent(t, NewClient(c1))
+	c1.Close()
+	if err := <-errc; err != nil {
+		t.Errorf("ServeAgent: %v", err)
+	}
+}
+
+func TestSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agent.sock")
+	l, err := Listen(path)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+	go Serve(NewKeyring(), l)
+
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, want %v", fi.Mode().Perm(), os.FileMode(0600))
+	}
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	testAgent(t, NewClient(c))
+}
+
+func TestMalformed(t *testing.T) {
+	for _, req := range [][]byte{
+		{},
+		{0},
+		{msgList, 0},
+		{msgRemove, 1, 2, 3},
+		{msgSeal, 1, 2, 3, 4, 5, 6, 7, 8, 0xff, 0xff, 0xff, 0xff},
+		{msgOpen, 1, 2, 3, 4, 5, 6, 7, 8, 0, 0, 0, 0, 0, 0, 0, 0},
+	} {
+		if _, err := handle(NewKeyring(), req); err != errProtocol {
+			t.Errorf("handle(%x): got %v, want %v", req, err, errProtocol)
+		}
+	}
+}
+
+func TestKeyringErase(t *testing.T) {
+	r := NewKeyring().(*keyring)
+	if err := r.Add(testID, testKey); err != nil {
+		t.Fatal(err)
+	}
+	r.erase() // as acorn.Shutdown does
+	if _, err := r.Seal(testID, make([]byte, acorn.NonceSize), nil, nil); err != ErrNotFound {
+		t.Errorf("Seal after erasing returned %v, want ErrNotFound", err)
+	}
+	if err := r.Add(testID, testKey); err == nil {
+		t.Errorf("Add after erasing succeeded")
+	}
+
+	c, ok := NewKeyring().(io.Closer)
+	if !ok {
+		t.Fatal("keyring is not an io.Closer")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.(Agent).Add(testID, testKey); err == nil {
+		t.Errorf("Add after Close succeeded")
+	}
+}
+
+func TestLimitedKeyring(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	go func() {
+		ServeAgent(NewLimitedKeyring(acorn.Limits{Messages: 1}), c2)
+		c2.Close()
+	}()
+	// through the client, to check that the error survives the trip
+	a := NewClient(c1)
+	if err := a.Add(testID, testKey); err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, acorn.NonceSize)
+	if _, err := a.Seal(testID, nonce, []byte("one"), nil); err != nil {
+		t.Fatal(err)
+	}
+	nonce[0] = 1
+	if _, err := a.Seal(testID, nonce, []byte("two"), nil); err != acorn.ErrKeyExhausted {
+		t.Errorf("Seal past the limit returned %v, want acorn.ErrKeyExhausted", err)
+	}
+}
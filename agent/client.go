@@ -0,0 +1,107 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package agent
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/magical/go-acorn"
+)
+
+type client struct {
+	mu sync.Mutex
+	c  io.ReadWriter
+}
+
+// NewClient returns an Agent that forwards requests to an agent
+// listening on the other end of c, typically a connection to the
+// agent's unix socket. It is safe for concurrent use;
+// requests are sent one at a time.
+func NewClient(c io.ReadWriter) Agent {
+	return &client{c: c}
+}
+
+// call sends a request and returns the body of a successful response.
+func (c *client) call(req []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := writeFrame(c.c, req); err != nil {
+		return nil, err
+	}
+	resp, err := readFrame(c.c)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{b: resp}
+	switch p.byte() {
+	case msgSuccess:
+		return p.b, nil
+	case msgFailure:
+		code, msg := p.byte(), p.bytes()
+		if err := p.done(); err != nil {
+			return nil, err
+		}
+		switch code {
+		case failNotFound:
+			return nil, ErrNotFound
+		case failAuth:
+			return nil, ErrAuthentication
+		case failExhausted:
+			return nil, acorn.ErrKeyExhausted
+		}
+		return nil, errors.New(string(msg))
+	}
+	return nil, errProtocol
+}
+
+func (c *client) List() ([][8]byte, error) {
+	resp, err := c.call([]byte{msgList})
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{b: resp}
+	n := p.uint32()
+	if uint64(n)*8 != uint64(len(p.b)) {
+		return nil, errProtocol
+	}
+	ids := make([][8]byte, n)
+	for i := range ids {
+		ids[i] = p.id()
+	}
+	return ids, p.done()
+}
+
+func (c *client) Add(id [8]byte, key []byte) error {
+	b := builder{msgAdd}
+	b.id(id)
+	b.bytes(key)
+	_, err := c.call(b)
+	return err
+}
+
+func (c *client) Remove(id [8]byte) error {
+	b := builder{msgRemove}
+	b.id(id)
+	_, err := c.call(b)
+	return err
+}
+
+func (c *client) Seal(id [8]byte, nonce, plaintext, additionalData []byte) ([]byte, error) {
+	b := builder{msgSeal}
+	b.id(id)
+	b.bytes(nonce)
+	b.bytes(plaintext)
+	b.bytes(additionalData)
+	return c.call(b)
+}
+
+func (c *client) Open(id [8]byte, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	b := builder{msgOpen}
+	b.id(id)
+	b.bytes(nonce)
+	b.bytes(ciphertext)
+	b.bytes(additionalData)
+	return c.call(b)
+}
@@ -0,0 +1,132 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package agent
+
+import (
+	"io"
+	"net"
+	"os"
+
+	"github.com/magical/go-acorn"
+)
+
+// ServeAgent serves the agent protocol on c, answering requests
+// with a, until c is closed or a protocol error occurs.
+// It returns nil when the client hangs up cleanly.
+func ServeAgent(a Agent, c io.ReadWriter) error {
+	for {
+		req, err := readFrame(c)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		resp, err := handle(a, req)
+		if err != nil {
+			return err
+		}
+		if err := writeFrame(c, resp); err != nil {
+			return err
+		}
+	}
+}
+
+// handle answers a single request.
+// It returns an error only if the request is malformed.
+func handle(a Agent, req []byte) ([]byte, error) {
+	p := &parser{b: req}
+	var result []byte
+	var err error
+	switch p.byte() {
+	case msgList:
+		if err := p.done(); err != nil {
+			return nil, err
+		}
+		var ids [][8]byte
+		ids, err = a.List()
+		var b builder
+		b.uint32(uint32(len(ids)))
+		for _, id := range ids {
+			b.id(id)
+		}
+		result = b
+	case msgAdd:
+		id, key := p.id(), p.bytes()
+		if err := p.done(); err != nil {
+			return nil, err
+		}
+		err = a.Add(id, key)
+	case msgRemove:
+		id := p.id()
+		if err := p.done(); err != nil {
+			return nil, err
+		}
+		err = a.Remove(id)
+	case msgSeal:
+		id, nonce, plaintext, ad := p.id(), p.bytes(), p.bytes(), p.bytes()
+		if err := p.done(); err != nil {
+			return nil, err
+		}
+		result, err = a.Seal(id, nonce, plaintext, ad)
+	case msgOpen:
+		id, nonce, ciphertext, ad := p.id(), p.bytes(), p.bytes(), p.bytes()
+		if err := p.done(); err != nil {
+			return nil, err
+		}
+		result, err = a.Open(id, nonce, ciphertext, ad)
+	default:
+		return nil, errProtocol
+	}
+
+	var b builder
+	if err != nil {
+		code := uint8(failOther)
+		switch err {
+		case ErrNotFound:
+			code = failNotFound
+		case ErrAuthentication:
+			code = failAuth
+		case acorn.ErrKeyExhausted:
+			code = failExhausted
+		}
+		b.byte(msgFailure)
+		b.byte(code)
+		b.bytes([]byte(err.Error()))
+		return b, nil
+	}
+	b.byte(msgSuccess)
+	b = append(b, result...)
+	return b, nil
+}
+
+// Serve accepts connections on l and serves each one with a,
+// until l is closed.
+func Serve(a Agent, l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer c.Close()
+			ServeAgent(a, c)
+		}()
+	}
+}
+
+// Listen creates a unix socket at path that only the current user
+// can connect to. Like ssh-agent, callers should put the socket in a
+// directory that is private to the user, since the socket's permissions
+// can only be restricted after it has been created.
+func Listen(path string) (net.Listener, error) {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
@@ -0,0 +1,143 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package agent
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// message types
+const (
+	msgList    = 1
+	msgAdd     = 2
+	msgRemove  = 3
+	msgSeal    = 4
+	msgOpen    = 5
+	msgSuccess = 0x80
+	msgFailure = 0x81
+)
+
+// failure codes
+const (
+	failOther     = 0
+	failNotFound  = 1
+	failAuth      = 2
+	failExhausted = 3
+)
+
+// maxFrameSize bounds the size of a single request or response,
+// so that a misbehaving peer can't make us allocate without limit.
+const maxFrameSize = 16<<20 + 4096
+
+var errProtocol = errors.New("agent: protocol error")
+
+func writeFrame(w io.Writer, msg []byte) error {
+	if len(msg) > maxFrameSize {
+		return errors.New("agent: message too large")
+	}
+	b := make([]byte, 4+len(msg))
+	binary.BigEndian.PutUint32(b, uint32(len(msg)))
+	copy(b[4:], msg)
+	_, err := w.Write(b)
+	return err
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var n [4]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(n[:])
+	if size == 0 || size > maxFrameSize {
+		return nil, errProtocol
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// A builder appends encoded values to a message.
+type builder []byte
+
+func (b *builder) byte(x uint8) {
+	*b = append(*b, x)
+}
+
+func (b *builder) uint32(x uint32) {
+	*b = append(*b, uint8(x>>24), uint8(x>>16), uint8(x>>8), uint8(x))
+}
+
+func (b *builder) id(id [8]byte) {
+	*b = append(*b, id[:]...)
+}
+
+func (b *builder) bytes(p []byte) {
+	b.uint32(uint32(len(p)))
+	*b = append(*b, p...)
+}
+
+// A parser consumes encoded values from a message.
+// Once an error occurs, all further reads fail.
+type parser struct {
+	b   []byte
+	err error
+}
+
+func (p *parser) next(n int) []byte {
+	if p.err != nil {
+		return nil
+	}
+	if n < 0 || len(p.b) < n {
+		p.err = errProtocol
+		return nil
+	}
+	x := p.b[:n:n]
+	p.b = p.b[n:]
+	return x
+}
+
+func (p *parser) byte() uint8 {
+	b := p.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (p *parser) uint32() uint32 {
+	b := p.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (p *parser) id() (id [8]byte) {
+	copy(id[:], p.next(8))
+	return id
+}
+
+func (p *parser) bytes() []byte {
+	n := p.uint32()
+	if n > maxFrameSize {
+		p.err = errProtocol
+		return nil
+	}
+	return p.next(int(n))
+}
+
+// done returns the first error encountered,
+// or errProtocol if there are unconsumed bytes.
+func (p *parser) done() error {
+	if p.err == nil && len(p.b) != 0 {
+		p.err = errProtocol
+	}
+	return p.err
+}
@@ -0,0 +1,174 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"math"
+	"math/bits"
+	"strconv"
+	"testing"
+)
+
+// The avalanche tests flip single input bits and check that about half
+// of the output bits change. A bit of key or nonce must affect every
+// output bit after the 1792 initialization steps; a bit of plaintext or
+// additional data must affect the tag and, once it has moved far enough
+// through the state to reach the keystream taps, the ciphertext after
+// it. A wiring mistake in an optimized path usually shows up as a
+// flip that changes far too few bits.
+
+// avalancheSealers seal a list of messages under one key,
+// each in a different way.
+var avalancheSealers = []struct {
+	name string
+	seal func(key []byte, nonces, plaintexts, ads [][]byte) [][]byte
+}{
+	{"aead", func(key []byte, nonces, plaintexts, ads [][]byte) [][]byte {
+		a := NewAEAD(key)
+		out := make([][]byte, len(nonces))
+		for i := range out {
+			out[i] = a.Seal(nil, nonces[i], plaintexts[i], ads[i])
+		}
+		return out
+	}},
+	{"engine", func(key []byte, nonces, plaintexts, ads [][]byte) [][]byte {
+		a := NewAEADEngine(key, NewEngine)
+		out := make([][]byte, len(nonces))
+		for i := range out {
+			out[i] = a.Seal(nil, nonces[i], plaintexts[i], ads[i])
+		}
+		return out
+	}},
+	{"batch", func(key []byte, nonces, plaintexts, ads [][]byte) [][]byte {
+		out := make([][]byte, len(nonces))
+		NewAEAD(key).(Batch).SealBatch(out, nonces, plaintexts, ads)
+		return out
+	}},
+}
+
+func hamming(a, b []byte) int {
+	d := 0
+	for i := range a {
+		d += bits.OnesCount8(a[i] ^ b[i])
+	}
+	return d
+}
+
+func flipBit(b []byte, i int) []byte {
+	b = append([]byte(nil), b...)
+	b[i/8] ^= 1 << uint(i%8)
+	return b
+}
+
+// checkHalf reports an error unless d of n bits differing is within
+// 7 standard deviations of n/2, which a correct cipher never fails.
+func checkHalf(t *testing.T, what string, d, n int) {
+	t.Helper()
+	mean := float64(n) / 2
+	sd := math.Sqrt(float64(n)) / 2
+	if float64(d) < mean-7*sd || float64(d) > mean+7*sd {
+		t.Errorf("%s changed %d of %d bits, want about %d", what, d, n, n/2)
+	}
+}
+
+// TestAvalancheKeyNonce flips each bit of the key and of the nonce.
+func TestAvalancheKeyNonce(t *testing.T) {
+	key := []byte("avalanche-key-01")
+	nonce := []byte("avalanche-nonce1")
+	p := make([]byte, 48)
+	ad := []byte("ad")
+
+	// all nonce flips go in one batch, so that they run through
+	// the batch backends together
+	nonces := [][]byte{nonce}
+	for i := 0; i < NonceSize*8; i++ {
+		nonces = append(nonces, flipBit(nonce, i))
+	}
+	plaintexts := make([][]byte, len(nonces))
+	ads := make([][]byte, len(nonces))
+	for i := range plaintexts {
+		plaintexts[i], ads[i] = p, ad
+	}
+
+	for _, s := range avalancheSealers {
+		outBits := (len(p) + TagSize) * 8
+		// flips[j] counts how often output bit j changed
+		flips := make([]int, outBits)
+		count := func(a, b []byte) {
+			for j := 0; j < outBits; j++ {
+				flips[j] += int((a[j/8] ^ b[j/8]) >> uint(j%8) & 1)
+			}
+		}
+
+		out := s.seal(key, nonces, plaintexts, ads)
+		for i, c := range out[1:] {
+			checkHalf(t, s.name+": flipping nonce bit "+strconv.Itoa(i), hamming(c, out[0]), outBits)
+			count(c, out[0])
+		}
+		for i := 0; i < KeySize*8; i++ {
+			c := s.seal(flipBit(key, i), nonces[:1], plaintexts[:1], ads[:1])[0]
+			checkHalf(t, s.name+": flipping key bit "+strconv.Itoa(i), hamming(c, out[0]), outBits)
+			count(c, out[0])
+		}
+
+		// every output bit should depend on every input bit
+		trials := (KeySize + NonceSize) * 8
+		for j, f := range flips {
+			checkHalf(t, s.name+": output bit "+strconv.Itoa(j)+" over all flips", f, trials)
+		}
+	}
+}
+
+// TestAvalanchePlaintext flips bits of the plaintext and of the
+// additional data.
+func TestAvalanchePlaintext(t *testing.T) {
+	key := []byte("avalanche-key-02")
+	nonce := []byte("avalanche-nonce2")
+	p := make([]byte, 128)
+	ad := make([]byte, 16)
+
+	// a bit entering the state at position 292 reaches the first
+	// keystream tap, at 244, after 48 steps; allow a byte more
+	const lag = 56
+
+	var nonces, plaintexts, ads [][]byte
+	add := func(p, ad []byte) {
+		nonces = append(nonces, nonce)
+		plaintexts = append(plaintexts, p)
+		ads = append(ads, ad)
+	}
+	add(p, ad)
+	pbits := []int{0, 1, 7, 8, 31, 32, 100, 255, 256, 511, 512, 513}
+	for _, i := range pbits {
+		add(flipBit(p, i), ad)
+	}
+	for i := 0; i < len(ad)*8; i++ {
+		add(p, flipBit(ad, i))
+	}
+
+	for _, s := range avalancheSealers {
+		out := s.seal(key, nonces, plaintexts, ads)
+		base := out[0]
+		n := len(p)
+		for k, i := range pbits {
+			c := out[1+k]
+			name := s.name + ": flipping plaintext bit " + strconv.Itoa(i)
+			// a stream cipher: nothing before the flip changes,
+			// and the flipped bit itself changes
+			if hamming(c[:i/8], base[:i/8]) != 0 {
+				t.Errorf("%s changed the ciphertext before it", name)
+			}
+			if (c[i/8]^base[i/8])>>uint(i%8)&1 != 1 {
+				t.Errorf("%s did not flip the ciphertext bit", name)
+			}
+			checkHalf(t, name+": tag", hamming(c[n:], base[n:]), TagSize*8)
+			if start := (i + lag + 8) / 8; n-start >= 64 {
+				checkHalf(t, name+": ciphertext after it", hamming(c[start:n], base[start:n]), (n-start)*8)
+			}
+		}
+		for i := 0; i < len(ad)*8; i++ {
+			c := out[1+len(pbits)+i]
+			checkHalf(t, s.name+": flipping ad bit "+strconv.Itoa(i), hamming(c, base), len(c)*8)
+		}
+	}
+}
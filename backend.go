@@ -0,0 +1,116 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// A backend is an implementation of the multi-message engine
+// behind SealBatch and OpenBatch. Single messages always use
+// the portable code in this package.
+//
+// Backends written in assembly should live in files guarded by
+//
+//	//go:build !purego && !noasm && !tinygo
+//
+// and add themselves to backends in an init function. Building with
+// either tag then leaves only the pure Go backend, for users who can't
+// or don't want to use assembly. TinyGo can't assemble Go assembly,
+// so it always gets the pure Go backend.
+//
+// The acorn_small build tag leaves out every backend, including the
+// pure Go one, to save code space; batches are then sealed and opened
+// one message at a time.
+type backend struct {
+	name string
+
+	// lanes is the most messages that seal and open take at once.
+	// All the messages in a call have the same plaintext length
+	// and the same additional data length.
+	lanes int
+
+	// minLanes and maxBytes say when it is worth using the backend
+	// instead of sealing the messages one at a time: when there are at
+	// least minLanes messages with at most maxBytes of plaintext and
+	// additional data each.
+	minLanes int
+	maxBytes int
+
+	// available reports whether the backend can run on this machine.
+	// If nil, it always can.
+	available func() bool
+
+	seal func(k *[4]uint32, dst, nonces, plaintexts, ads [][]byte)
+	open func(k *[4]uint32, dst, nonces, ciphertexts, ads [][]byte, ok []bool)
+}
+
+var usable struct {
+	once     sync.Once
+	backends []*backend
+}
+
+// batchBackends returns the backends that can run on this machine,
+// in order of preference. It is computed on first use, since the CPU
+// features that it depends on are detected in init functions.
+func batchBackends() []*backend {
+	usable.once.Do(func() {
+		for _, b := range backends {
+			if b.available == nil || b.available() {
+				usable.backends = append(usable.backends, b)
+			}
+		}
+	})
+	return usable.backends
+}
+
+// Backends returns the names of the implementations that SealBatch and
+// OpenBatch can use on this machine, in order of preference. The first
+// is the one that Backend returns. With the acorn_small build tag
+// there are none.
+func Backends() []string {
+	var names []string
+	for _, b := range batchBackends() {
+		names = append(names, b.name)
+	}
+	return names
+}
+
+// NewAEADBackend returns an ACORN-128 instance like NewAEAD, except
+// that its SealBatch and OpenBatch use only the named backend, one of
+// those returned by Backends, for every group of messages with the same
+// lengths, however few or long they are. Messages left over from a group
+// are sealed one at a time. It is for benchmarking and testing backends
+// against each other; NewAEAD already picks the fastest.
+//
+// NewAEADBackend returns an error if the backend can't run on this
+// machine. If the key is not the correct length, it panics.
+func NewAEADBackend(key []byte, name string) (Batch, error) {
+	if len(key) != KeySize {
+		panic("acorn: invalid key length")
+	}
+	for _, b := range batchBackends() {
+		if b.name == name {
+			forced := *b
+			forced.minLanes = 1
+			forced.maxBytes = maxInt
+			return &backendAEAD{aead{loadKey(key)}, []*backend{&forced}}, nil
+		}
+	}
+	return nil, errors.New("acorn: unknown batch backend " + strconv.Quote(name))
+}
+
+type backendAEAD struct {
+	aead
+	bs []*backend
+}
+
+func (a *backendAEAD) SealBatch(dst [][]byte, nonces, plaintexts, ads [][]byte) {
+	a.sealBatch(a.bs, dst, nonces, plaintexts, ads)
+}
+
+func (a *backendAEAD) OpenBatch(dst [][]byte, nonces, ciphertexts, ads [][]byte, parallel bool) []error {
+	return a.openBatch(a.bs, dst, nonces, ciphertexts, ads, parallel)
+}
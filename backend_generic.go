@@ -0,0 +1,31 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build !acorn_small
+// +build !acorn_small
+
+package acorn
+
+// genericBackend is the portable bitsliced engine.
+// It costs about the same however many lanes are in use,
+// and more per byte than the scalar code, so it only pays off for
+// large groups of short messages. The cutoffs were picked by
+// benchmarking on amd64.
+var genericBackend = &backend{
+	name:     "generic",
+	lanes:    slicedLanes,
+	minLanes: 32,
+	maxBytes: 256,
+	seal: func(k *[4]uint32, dst, nonces, plaintexts, ads [][]byte) {
+		var s slicedState
+		sealSliced(&s, k, dst, nonces, plaintexts, ads)
+	},
+	open: func(k *[4]uint32, dst, nonces, ciphertexts, ads [][]byte, ok []bool) {
+		var s slicedState
+		r := openSliced(&s, k, dst, nonces, ciphertexts, ads)
+		copy(ok, r[:])
+	},
+}
+
+// backends lists the backends in order of preference.
+// Backends for particular CPUs add themselves in init functions.
+var backends = []*backend{genericBackend}
@@ -0,0 +1,210 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"crypto/cipher"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Batch is implemented by the AEADs returned by NewAEAD.
+// It seals and opens many messages in one call, which lets the
+// implementation process several messages at once.
+type Batch interface {
+	cipher.AEAD
+
+	// SealBatch seals each plaintexts[i] with nonces[i] and ads[i] and
+	// appends the result to dst[i], storing the updated slice back in dst[i].
+	// All four slices must have the same length.
+	SealBatch(dst [][]byte, nonces, plaintexts, ads [][]byte)
+
+	// OpenBatch opens each ciphertexts[i] with nonces[i] and ads[i].
+	// If it is authentic, the plaintext is appended to dst[i] and the
+	// updated slice stored back in dst[i]; otherwise dst[i] is unchanged
+	// and the i'th error is non-nil. All four slices must have the same
+	// length. If parallel is true, the work is spread across GOMAXPROCS
+	// goroutines.
+	OpenBatch(dst [][]byte, nonces, ciphertexts, ads [][]byte, parallel bool) []error
+}
+
+func (a *aead) SealBatch(dst [][]byte, nonces, plaintexts, ads [][]byte) {
+	a.sealBatch(batchBackends(), dst, nonces, plaintexts, ads)
+}
+
+func (a *aead) OpenBatch(dst [][]byte, nonces, ciphertexts, ads [][]byte, parallel bool) []error {
+	return a.openBatch(batchBackends(), dst, nonces, ciphertexts, ads, parallel)
+}
+
+// sealBatch and openBatch implement SealBatch and OpenBatch
+// with the backends bs.
+
+func (a *aead) sealBatch(bs []*backend, dst [][]byte, nonces, plaintexts, ads [][]byte) {
+	checkBatch(dst, nonces, plaintexts, ads)
+	for _, job := range planBatch(bs, plaintexts, ads, 0) {
+		if job.b == nil {
+			i := job.idx[0]
+			dst[i] = a.Seal(dst[i], nonces[i], plaintexts[i], ads[i])
+			continue
+		}
+		n := len(plaintexts[job.idx[0]])
+		out := make([][]byte, len(job.idx))
+		for j, i := range job.idx {
+			dst[i], out[j] = sliceForAppend(dst[i], n+TagSize)
+		}
+		ns, ps, as := gatherBatch(job.idx, nonces, plaintexts, ads)
+		job.b.seal(&a.key, out, ns, ps, as)
+	}
+}
+
+func (a *aead) openBatch(bs []*backend, dst [][]byte, nonces, ciphertexts, ads [][]byte, parallel bool) []error {
+	checkBatch(dst, nonces, ciphertexts, ads)
+	errs := make([]error, len(dst))
+	jobs := planBatch(bs, ciphertexts, ads, TagSize)
+	run := func(job batchJob) {
+		if job.b == nil {
+			i := job.idx[0]
+			dst[i], errs[i] = a.Open(dst[i], nonces[i], ciphertexts[i], ads[i])
+			return
+		}
+		n := len(ciphertexts[job.idx[0]]) - TagSize
+		out := make([][]byte, len(job.idx))
+		ok := make([]bool, len(job.idx))
+		orig := make([]int, len(job.idx))
+		for j, i := range job.idx {
+			orig[j] = len(dst[i])
+			dst[i], out[j] = sliceForAppend(dst[i], n)
+		}
+		ns, cs, as := gatherBatch(job.idx, nonces, ciphertexts, ads)
+		job.b.open(&a.key, out, ns, cs, as, ok)
+		for j, i := range job.idx {
+			if !ok[j] {
+				// don't leave unauthenticated plaintext lying around
+				for k := range out[j] {
+					out[j][k] = 0
+				}
+				dst[i] = dst[i][:orig[j]]
+				errs[i] = ErrAuthentication
+				reportFailure(&a.key, len(ciphertexts[i]), len(ads[i]))
+			}
+		}
+	}
+
+	workers := 1
+	if parallel {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	if workers <= 1 {
+		for _, job := range jobs {
+			run(job)
+		}
+		return errs
+	}
+	var next int32 = -1
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				j := int(atomic.AddInt32(&next, 1))
+				if j >= len(jobs) {
+					return
+				}
+				run(jobs[j])
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func checkBatch(dst, nonces, texts, ads [][]byte) {
+	if len(nonces) != len(dst) || len(texts) != len(dst) || len(ads) != len(dst) {
+		panic("acorn: batch slices have different lengths")
+	}
+	for _, nonce := range nonces {
+		if len(nonce) != NonceSize {
+			panic("acorn: invalid nonce length")
+		}
+	}
+}
+
+// A batchJob is either a single message, to be handled by Seal or Open,
+// or a group of messages with the same lengths, to be handled by a backend.
+type batchJob struct {
+	b   *backend // nil for a single message
+	idx []int
+}
+
+// planBatch splits a batch into jobs, giving each group of messages
+// with the same lengths to the first of bs that wants it.
+// overhead is how much longer each text is than its plaintext.
+func planBatch(bs []*backend, texts, ads [][]byte, overhead int) []batchJob {
+	var jobs []batchJob
+	for _, group := range groupBatch(texts, ads) {
+		n := len(texts[group[0]]) - overhead
+		size := n + len(ads[group[0]])
+		if n >= 0 {
+			for _, b := range bs {
+				if size > b.maxBytes {
+					continue
+				}
+				for len(group) >= b.minLanes {
+					k := len(group)
+					if k > b.lanes {
+						k = b.lanes
+					}
+					jobs = append(jobs, batchJob{b, group[:k:k]})
+					group = group[k:]
+				}
+			}
+		}
+		for i := range group {
+			jobs = append(jobs, batchJob{nil, group[i : i+1 : i+1]})
+		}
+	}
+	return jobs
+}
+
+func gatherBatch(job []int, nonces, texts, ads [][]byte) (ns, ts, as [][]byte) {
+	ns = make([][]byte, len(job))
+	ts = make([][]byte, len(job))
+	as = make([][]byte, len(job))
+	for j, i := range job {
+		ns[j], ts[j], as[j] = nonces[i], texts[i], ads[i]
+	}
+	return
+}
+
+// groupBatch returns the indexes of the messages,
+// grouped by plaintext and additional data length.
+func groupBatch(texts, ads [][]byte) [][]int {
+	idx := make([]int, len(texts))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(x, y int) bool {
+		i, j := idx[x], idx[y]
+		if len(texts[i]) != len(texts[j]) {
+			return len(texts[i]) < len(texts[j])
+		}
+		return len(ads[i]) < len(ads[j])
+	})
+	var groups [][]int
+	for len(idx) > 0 {
+		i := idx[0]
+		n := 1
+		for n < len(idx) && len(texts[idx[n]]) == len(texts[i]) && len(ads[idx[n]]) == len(ads[i]) {
+			n++
+		}
+		groups = append(groups, idx[:n:n])
+		idx = idx[n:]
+	}
+	return groups
+}
@@ -0,0 +1,190 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// randomBatch returns a batch with a large group of short messages
+// of the same length, so that every backend gets used,
+// mixed in with messages of assorted lengths.
+func randomBatch(r *rand.Rand) (nonces, plaintexts, ads [][]byte) {
+	add := func(n, adlen int) {
+		nonce := make([]byte, NonceSize)
+		p := make([]byte, n)
+		ad := make([]byte, adlen)
+		r.Read(nonce)
+		r.Read(p)
+		r.Read(ad)
+		nonces = append(nonces, nonce)
+		plaintexts = append(plaintexts, p)
+		ads = append(ads, ad)
+	}
+	for i := 0; i < 600; i++ {
+		add(20, 5)
+	}
+	for i := 0; i < 30; i++ {
+		add(r.Intn(300), r.Intn(20))
+	}
+	r.Shuffle(len(nonces), func(i, j int) {
+		nonces[i], nonces[j] = nonces[j], nonces[i]
+		plaintexts[i], plaintexts[j] = plaintexts[j], plaintexts[i]
+		ads[i], ads[j] = ads[j], ads[i]
+	})
+	return
+}
+
+func TestSealBatch(t *testing.T) {
+	key := []byte(strings.Repeat("password", 2))
+	a := NewAEAD(key).(Batch)
+	r := rand.New(rand.NewSource(1))
+	nonces, plaintexts, ads := randomBatch(r)
+	dst := make([][]byte, len(nonces))
+	for i := range dst {
+		dst[i] = []byte("prefix")
+	}
+	a.SealBatch(dst, nonces, plaintexts, ads)
+	for i := range dst {
+		want := a.Seal([]byte("prefix"), nonces[i], plaintexts[i], ads[i])
+		if !bytes.Equal(dst[i], want) {
+			t.Errorf("message %d: got %x, want %x", i, dst[i], want)
+		}
+	}
+}
+
+// Batches that a backend consumes exactly must not trip up the planner.
+func TestSealBatchExact(t *testing.T) {
+	a := NewAEAD(make([]byte, KeySize)).(Batch)
+	for _, n := range []int{64, 256, 512} {
+		nonces := make([][]byte, n)
+		plaintexts := make([][]byte, n)
+		ads := make([][]byte, n)
+		for i := range nonces {
+			nonces[i] = make([]byte, NonceSize)
+			nonces[i][0] = byte(i)
+			plaintexts[i] = make([]byte, 10)
+		}
+		dst := make([][]byte, n)
+		a.SealBatch(dst, nonces, plaintexts, ads)
+		for i := range dst {
+			want := a.Seal(nil, nonces[i], plaintexts[i], ads[i])
+			if !bytes.Equal(dst[i], want) {
+				t.Errorf("n=%d: message %d: got %x, want %x", n, i, dst[i], want)
+			}
+		}
+	}
+}
+
+func TestOpenBatch(t *testing.T) {
+	key := []byte(strings.Repeat("password", 2))
+	a := NewAEAD(key).(Batch)
+	for _, parallel := range []bool{false, true} {
+		r := rand.New(rand.NewSource(1))
+		nonces, plaintexts, ads := randomBatch(r)
+		ciphertexts := make([][]byte, len(nonces))
+		bad := make([]bool, len(nonces))
+		for i := range ciphertexts {
+			ciphertexts[i] = a.Seal(nil, nonces[i], plaintexts[i], ads[i])
+			if r.Intn(10) == 0 {
+				ciphertexts[i][r.Intn(len(ciphertexts[i]))] ^= 1
+				bad[i] = true
+			}
+		}
+		ciphertexts[0] = ciphertexts[0][:TagSize-1]
+		bad[0] = true
+
+		dst := make([][]byte, len(nonces))
+		for i := range dst {
+			dst[i] = []byte("prefix")
+		}
+		errs := a.OpenBatch(dst, nonces, ciphertexts, ads, parallel)
+		for i := range dst {
+			if bad[i] {
+				if errs[i] == nil {
+					t.Errorf("parallel=%v: message %d: expected error", parallel, i)
+				}
+				if string(dst[i]) != "prefix" {
+					t.Errorf("parallel=%v: message %d: dst = %x, want unchanged", parallel, i, dst[i])
+				}
+				continue
+			}
+			if errs[i] != nil {
+				t.Errorf("parallel=%v: message %d: unexpected error: %v", parallel, i, errs[i])
+			}
+			want := append([]byte("prefix"), plaintexts[i]...)
+			if !bytes.Equal(dst[i], want) {
+				t.Errorf("parallel=%v: message %d: got %x, want %x", parallel, i, dst[i], want)
+			}
+		}
+	}
+}
+
+func BenchmarkSealBatch(b *testing.B) {
+	key := []byte(strings.Repeat("password", 2))
+	a := NewAEAD(key).(Batch)
+	const size = 64
+	nonces := make([][]byte, 256)
+	plaintexts := make([][]byte, len(nonces))
+	ads := make([][]byte, len(nonces))
+	dst := make([][]byte, len(nonces))
+	for i := range nonces {
+		nonces[i] = make([]byte, NonceSize)
+		plaintexts[i] = make([]byte, size)
+		dst[i] = make([]byte, 0, size+TagSize)
+	}
+	b.SetBytes(int64(size * len(nonces)))
+	for i := 0; i < b.N; i++ {
+		for j := range dst {
+			dst[j] = dst[j][:0]
+		}
+		a.SealBatch(dst, nonces, plaintexts, ads)
+	}
+}
+
+func TestBackend(t *testing.T) {
+	name := Backend()
+	if len(backends) == 0 && name == "none" {
+		return
+	}
+	for _, b := range backends {
+		if b.name == name {
+			return
+		}
+	}
+	t.Errorf("Backend() = %q, which is not in the backend list", name)
+}
+
+// TestAEADBackend runs the batch test through each backend by name,
+// including for groups below its usual cutoffs.
+func TestAEADBackend(t *testing.T) {
+	key := []byte(strings.Repeat("password", 2))
+	ref := NewAEAD(key)
+	r := rand.New(rand.NewSource(1))
+	nonces, plaintexts, ads := randomBatch(r)
+	for _, name := range Backends() {
+		a, err := NewAEADBackend(key, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst := make([][]byte, len(nonces))
+		a.SealBatch(dst, nonces, plaintexts, ads)
+		for i := range dst {
+			if want := ref.Seal(nil, nonces[i], plaintexts[i], ads[i]); !bytes.Equal(dst[i], want) {
+				t.Fatalf("%s: message %d: got %x, want %x", name, i, dst[i], want)
+			}
+		}
+		out := make([][]byte, len(dst))
+		for i, err := range a.OpenBatch(out, nonces, dst, ads, false) {
+			if err != nil || !bytes.Equal(out[i], plaintexts[i]) {
+				t.Fatalf("%s: OpenBatch message %d: %x, %v", name, i, out[i], err)
+			}
+		}
+	}
+	if _, err := NewAEADBackend(key, "none"); err == nil {
+		t.Errorf("NewAEADBackend accepted an unknown backend")
+	}
+}
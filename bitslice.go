@@ -0,0 +1,285 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build !acorn_small
+// +build !acorn_small
+
+package acorn
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+)
+
+// This file implements a bitsliced engine which runs up to 64 independent
+// ACORN instances at once, one per bit of a uint64.
+// Word i of the state holds bit i of all 64 states, so each boolean
+// operation in the update function advances every instance by one step.
+//
+// All instances must go through the same sequence of control bits,
+// so every message in a batch must have the same plaintext length and
+// the same additional data length. They share a key but may have
+// different nonces.
+
+const slicedLanes = 64
+
+// slicedWindow is how far the state may slide along buf before it is
+// copied back to the start.
+const slicedWindow = 512
+
+type slicedState struct {
+	h   int // index of bit 0 in buf
+	buf [293 + slicedWindow]uint64
+}
+
+func (s *slicedState) reset() {
+	s.h = 0
+	for i := range s.buf[:293] {
+		s.buf[i] = 0
+	}
+}
+
+// step performs one state update on all lanes and returns the keystream bits.
+// m is the message bit for each lane; ca and cb are the control bits,
+// and are either 0 or all ones.
+func (s *slicedState) step(m, ca, cb uint64) uint64 {
+	x := s.buf[s.h : s.h+294]
+
+	// feedback the 6 LFSRs
+	x[289] ^= x[235] ^ x[230]
+	x[230] ^= x[196] ^ x[193]
+	x[193] ^= x[160] ^ x[154]
+	x[154] ^= x[111] ^ x[107]
+	x[107] ^= x[66] ^ x[61]
+	x[61] ^= x[23] ^ x[0]
+
+	ks := x[12] ^ x[154] ^ maj64(x[235], x[61], x[193]) ^ ch64(x[230], x[111], x[66])
+	f := x[0] ^ ^x[107] ^ maj64(x[244], x[23], x[160]) ^ (ca & x[196]) ^ (cb & ks)
+
+	// shift in the new bit
+	x[293] = f ^ m
+	s.h++
+	if s.h == slicedWindow {
+		copy(s.buf[:293], s.buf[slicedWindow:])
+		s.h = 0
+	}
+	return ks
+}
+
+// maj64 and ch64 are the same as maj and ch.
+
+func maj64(x, y, z uint64) uint64 {
+	return (x & y) ^ (z & (x ^ y))
+}
+
+func ch64(x, y, z uint64) uint64 {
+	return z ^ (x & (y ^ z))
+}
+
+// broadcast returns a word with every lane set to bit i of x.
+func broadcast(x uint64, i uint) uint64 {
+	return -(x >> i & 1)
+}
+
+// transpose64 transposes a 64×64 bit matrix in place,
+// so that bit j of a[i] is swapped with bit i of a[j].
+func transpose64(a *[64]uint64) {
+	m := uint64(0x00000000FFFFFFFF)
+	for j := uint(32); j != 0; j, m = j>>1, m^(m<<(j>>1)) {
+		for k := uint(0); k < 64; k = (k | j + 1) &^ j {
+			t := (a[k]>>j ^ a[k|j]) & m
+			a[k] ^= t << j
+			a[k|j] ^= t
+		}
+	}
+}
+
+// load64 reads up to 8 bytes of each lane's message, starting at off,
+// and transposes them so that m[i] holds bit i for every lane.
+func load64(m *[64]uint64, msgs [][]byte, off int) {
+	for j := range m {
+		m[j] = 0
+	}
+	for j, msg := range msgs {
+		m[j] = loadPartial(msg[off:])
+	}
+	transpose64(m)
+}
+
+// store64 transposes the keystream bits in ks and XORs up to 8 bytes
+// of them into each lane of dst, starting at off.
+func store64(dst, src [][]byte, ks *[64]uint64, off int) {
+	transpose64(ks)
+	for j := range dst {
+		x := loadPartial(src[j][off:]) ^ ks[j]
+		storePartial(dst[j][off:], x)
+	}
+}
+
+func loadPartial(b []byte) uint64 {
+	if len(b) >= 8 {
+		return binary.LittleEndian.Uint64(b)
+	}
+	var x uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		x = x<<8 | uint64(b[i])
+	}
+	return x
+}
+
+func storePartial(b []byte, x uint64) {
+	if len(b) >= 8 {
+		binary.LittleEndian.PutUint64(b, x)
+		return
+	}
+	for i := range b {
+		b[i] = uint8(x >> (8 * uint(i)))
+	}
+}
+
+// init runs the initialization phase for all lanes.
+func (s *slicedState) init(k *[4]uint32, nonces [][]byte) {
+	var m [64]uint64
+	s.reset()
+	for i := uint(0); i < 128; i++ {
+		s.step(broadcast(uint64(k[i/32]), i%32), allOnes, allOnes)
+	}
+	for off := 0; off < NonceSize; off += 8 {
+		load64(&m, nonces, off)
+		for i := range m {
+			s.step(m[i], allOnes, allOnes)
+		}
+	}
+	for i := uint(0); i < 1536; i++ {
+		kbit := broadcast(uint64(k[i%128/32]), i%32)
+		if i == 0 {
+			kbit = ^kbit
+		}
+		s.step(kbit, allOnes, allOnes)
+	}
+}
+
+const allOnes = ^uint64(0)
+
+func (s *slicedState) pad(cb uint64) {
+	s.step(allOnes, allOnes, cb)
+	for i := 1; i < 128; i++ {
+		s.step(0, allOnes, cb)
+	}
+	for i := 128; i < 256; i++ {
+		s.step(0, 0, cb)
+	}
+}
+
+// process absorbs the additional data of each lane.
+func (s *slicedState) process(ads [][]byte, n int) {
+	var m [64]uint64
+	for off := 0; off < n; off += 8 {
+		load64(&m, ads, off)
+		bits := 64
+		if n-off < 8 {
+			bits = (n - off) * 8
+		}
+		for i := 0; i < bits; i++ {
+			s.step(m[i], allOnes, allOnes)
+		}
+	}
+	s.pad(allOnes)
+}
+
+// encrypt encrypts the plaintext of each lane into dst.
+func (s *slicedState) encrypt(dst, src [][]byte, n int) {
+	var m, ks [64]uint64
+	for off := 0; off < n; off += 8 {
+		load64(&m, src, off)
+		bits := 64
+		if n-off < 8 {
+			bits = (n - off) * 8
+		}
+		for i := 0; i < bits; i++ {
+			ks[i] = s.step(m[i], allOnes, 0)
+		}
+		store64(dst, src, &ks, off)
+	}
+	s.pad(0)
+}
+
+// decrypt decrypts the ciphertext of each lane into dst.
+// As in state.decrypt, the ciphertext is fed back with cb set,
+// which cancels out the keystream.
+func (s *slicedState) decrypt(dst, src [][]byte, n int) {
+	var c, ks [64]uint64
+	for off := 0; off < n; off += 8 {
+		load64(&c, src, off)
+		bits := 64
+		if n-off < 8 {
+			bits = (n - off) * 8
+		}
+		for i := 0; i < bits; i++ {
+			ks[i] = s.step(c[i], allOnes, allOnes)
+		}
+		store64(dst, src, &ks, off)
+	}
+	s.pad(0)
+}
+
+// finalize computes the tag of each lane and XORs it into tags.
+// Since tags is normally zeroed, this is the same as storing it,
+// and it lets the tag be checked by XORing it with the expected one.
+func (s *slicedState) finalize(tags [][]byte) {
+	for i := 0; i < 640; i++ {
+		s.step(0, allOnes, allOnes)
+	}
+	var ks [64]uint64
+	for off := 0; off < TagSize; off += 8 {
+		for i := range ks {
+			ks[i] = s.step(0, allOnes, allOnes)
+		}
+		store64(tags, tags, &ks, off)
+	}
+}
+
+// sealSliced seals up to 64 messages which all have the same plaintext
+// length and the same additional data length. Each dst[i] must have room
+// for exactly len(plaintexts[i])+TagSize bytes and must not overlap
+// its plaintext unless they are the same.
+func sealSliced(s *slicedState, k *[4]uint32, dst, nonces, plaintexts, ads [][]byte) {
+	n := len(plaintexts[0])
+	var ptDst, tags [slicedLanes][]byte
+	for i := range dst {
+		ptDst[i] = dst[i][:n]
+		tags[i] = dst[i][n:]
+		for j := range tags[i] {
+			tags[i][j] = 0
+		}
+	}
+	s.init(k, nonces)
+	s.process(ads, len(ads[0]))
+	s.encrypt(ptDst[:len(dst)], plaintexts, n)
+	s.finalize(tags[:len(dst)])
+	*s = slicedState{}
+}
+
+// openSliced opens up to 64 messages which all have the same ciphertext
+// length and the same additional data length. Each dst[i] must have room
+// for exactly len(ciphertexts[i])-TagSize bytes. It reports which messages
+// were authentic; dst holds garbage for the ones that were not.
+func openSliced(s *slicedState, k *[4]uint32, dst, nonces, ciphertexts, ads [][]byte) (ok [slicedLanes]bool) {
+	n := len(ciphertexts[0]) - TagSize
+	var ct, tags [slicedLanes][]byte
+	var buf [slicedLanes * TagSize]byte
+	for i := range dst {
+		ct[i] = ciphertexts[i][:n]
+		tags[i] = buf[i*TagSize : (i+1)*TagSize]
+		copy(tags[i], ciphertexts[i][n:])
+	}
+	s.init(k, nonces)
+	s.process(ads, len(ads[0]))
+	s.decrypt(dst, ct[:len(dst)], n)
+	s.finalize(tags[:len(dst)])
+	*s = slicedState{}
+	var zero [TagSize]byte
+	for i := range dst {
+		ok[i] = subtle.ConstantTimeCompare(tags[i], zero[:]) == 1
+	}
+	return ok
+}
@@ -0,0 +1,255 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build amd64 && !purego && !noasm && !tinygo && !acorn_small
+// +build amd64,!purego,!noasm,!tinygo,!acorn_small
+
+package acorn
+
+import "crypto/subtle"
+
+// This file implements a 512-lane version of the bitsliced engine
+// using AVX-512. Each state bit is a wideWord of eight uint64s, one per
+// group of 64 lanes, so that one ZMM register holds bit i of all 512
+// states. The bit-twiddling is the same as in bitslice.go, except that
+// the update loop is in assembly.
+
+const (
+	wideGroups = 8
+	wideLanes  = 64 * wideGroups
+	wideWindow = 256
+)
+
+type wideWord [wideGroups]uint64
+
+type wideState struct {
+	h   int
+	buf [293 + wideWindow]wideWord
+}
+
+// stepsAVX512 performs n state updates. x points to bit 0 of the state,
+// which must have room for n more bits after bit 292. m[i] holds the
+// message bits for the i'th update, and the keystream bits are written
+// to ks[i]. ca and cb are either 0 or all ones.
+//
+//go:noescape
+func stepsAVX512(x *wideWord, m *wideWord, ks *wideWord, n int, ca, cb uint64)
+
+// AVX-512 is worth using only for large batches. Besides the cost of
+// transposing eight groups at a time, heavy use of 512-bit instructions
+// can lower the clock speed on some processors, which slows down
+// everything else running on that core for a while afterwards.
+var avx512Backend = &backend{
+	name:      "avx512",
+	lanes:     wideLanes,
+	minLanes:  256,
+	maxBytes:  1024,
+	available: func() bool { return cpu.hasAVX512F },
+	seal: func(k *[4]uint32, dst, nonces, plaintexts, ads [][]byte) {
+		var s wideState
+		sealWide(&s, k, dst, nonces, plaintexts, ads)
+	},
+	open: func(k *[4]uint32, dst, nonces, ciphertexts, ads [][]byte, ok []bool) {
+		var s wideState
+		openWide(&s, k, dst, nonces, ciphertexts, ads, ok)
+	},
+}
+
+func init() {
+	backends = append([]*backend{avx512Backend}, backends...)
+}
+
+func (s *wideState) reset() {
+	s.h = 0
+	for i := range s.buf[:293] {
+		s.buf[i] = wideWord{}
+	}
+}
+
+// steps performs len(m) state updates, like stepsAVX512,
+// sliding the state back to the start of buf as needed.
+func (s *wideState) steps(m, ks []wideWord, ca, cb uint64) {
+	for len(m) > 0 {
+		n := wideWindow - s.h
+		if n > len(m) {
+			n = len(m)
+		}
+		stepsAVX512(&s.buf[s.h], &m[0], &ks[0], n, ca, cb)
+		s.h += n
+		m, ks = m[n:], ks[n:]
+		if s.h == wideWindow {
+			copy(s.buf[:293], s.buf[wideWindow:])
+			s.h = 0
+		}
+	}
+}
+
+func broadcastWide(x uint64, i uint) wideWord {
+	b := broadcast(x, i)
+	return wideWord{b, b, b, b, b, b, b, b}
+}
+
+// loadWide reads up to 8 bytes of each lane's message, starting at off,
+// and transposes them so that m[i] holds bit i for every lane.
+func loadWide(m *[64]wideWord, msgs [][]byte, off int) {
+	var t [64]uint64
+	for g := 0; g < wideGroups; g++ {
+		lo, hi := g*64, (g+1)*64
+		if lo >= len(msgs) {
+			for i := range m {
+				m[i][g] = 0
+			}
+			continue
+		}
+		if hi > len(msgs) {
+			hi = len(msgs)
+		}
+		load64(&t, msgs[lo:hi], off)
+		for i := range t {
+			m[i][g] = t[i]
+		}
+	}
+}
+
+// storeWide transposes the keystream bits in ks and XORs up to 8 bytes
+// of them into each lane of dst, starting at off.
+func storeWide(dst, src [][]byte, ks *[64]wideWord, off int) {
+	var t [64]uint64
+	for g := 0; g*64 < len(dst); g++ {
+		lo, hi := g*64, (g+1)*64
+		if hi > len(dst) {
+			hi = len(dst)
+		}
+		for i := range t {
+			t[i] = ks[i][g]
+		}
+		store64(dst[lo:hi], src[lo:hi], &t, off)
+	}
+}
+
+func (s *wideState) init(k *[4]uint32, nonces [][]byte) {
+	var m, ks [64]wideWord
+	s.reset()
+	for half := uint(0); half < 128; half += 64 {
+		for i := uint(0); i < 64; i++ {
+			m[i] = broadcastWide(uint64(k[(half+i)/32]), (half+i)%32)
+		}
+		s.steps(m[:], ks[:], allOnes, allOnes)
+	}
+	for off := 0; off < NonceSize; off += 8 {
+		loadWide(&m, nonces, off)
+		s.steps(m[:], ks[:], allOnes, allOnes)
+	}
+	for j := uint(0); j < 1536; j += 64 {
+		for i := uint(0); i < 64; i++ {
+			m[i] = broadcastWide(uint64(k[(j+i)%128/32]), (j+i)%32)
+		}
+		if j == 0 {
+			for g := range m[0] {
+				m[0][g] = ^m[0][g]
+			}
+		}
+		s.steps(m[:], ks[:], allOnes, allOnes)
+	}
+}
+
+func (s *wideState) pad(cb uint64) {
+	var m, ks [64]wideWord
+	m[0] = wideWord{allOnes, allOnes, allOnes, allOnes, allOnes, allOnes, allOnes, allOnes}
+	s.steps(m[:], ks[:], allOnes, cb)
+	m[0] = wideWord{}
+	s.steps(m[:], ks[:], allOnes, cb)
+	s.steps(m[:], ks[:], 0, cb)
+	s.steps(m[:], ks[:], 0, cb)
+}
+
+func bitsAt(n, off int) int {
+	if n-off < 8 {
+		return (n - off) * 8
+	}
+	return 64
+}
+
+func (s *wideState) process(ads [][]byte, n int) {
+	var m, ks [64]wideWord
+	for off := 0; off < n; off += 8 {
+		loadWide(&m, ads, off)
+		bits := bitsAt(n, off)
+		s.steps(m[:bits], ks[:bits], allOnes, allOnes)
+	}
+	s.pad(allOnes)
+}
+
+func (s *wideState) encrypt(dst, src [][]byte, n int) {
+	var m, ks [64]wideWord
+	for off := 0; off < n; off += 8 {
+		loadWide(&m, src, off)
+		bits := bitsAt(n, off)
+		s.steps(m[:bits], ks[:bits], allOnes, 0)
+		storeWide(dst, src, &ks, off)
+	}
+	s.pad(0)
+}
+
+func (s *wideState) decrypt(dst, src [][]byte, n int) {
+	var c, ks [64]wideWord
+	for off := 0; off < n; off += 8 {
+		loadWide(&c, src, off)
+		bits := bitsAt(n, off)
+		s.steps(c[:bits], ks[:bits], allOnes, allOnes)
+		storeWide(dst, src, &ks, off)
+	}
+	s.pad(0)
+}
+
+func (s *wideState) finalize(tags [][]byte) {
+	var m, ks [64]wideWord
+	for i := 0; i < 640; i += 64 {
+		s.steps(m[:], ks[:], allOnes, allOnes)
+	}
+	for off := 0; off < TagSize; off += 8 {
+		s.steps(m[:], ks[:], allOnes, allOnes)
+		storeWide(tags, tags, &ks, off)
+	}
+}
+
+// sealWide is like sealSliced, but takes up to 512 messages.
+func sealWide(s *wideState, k *[4]uint32, dst, nonces, plaintexts, ads [][]byte) {
+	n := len(plaintexts[0])
+	ptDst := make([][]byte, len(dst))
+	tags := make([][]byte, len(dst))
+	for i := range dst {
+		ptDst[i] = dst[i][:n]
+		tags[i] = dst[i][n:]
+		for j := range tags[i] {
+			tags[i][j] = 0
+		}
+	}
+	s.init(k, nonces)
+	s.process(ads, len(ads[0]))
+	s.encrypt(ptDst, plaintexts, n)
+	s.finalize(tags)
+	*s = wideState{}
+}
+
+// openWide is like openSliced, but takes up to 512 messages
+// and reports which were authentic in ok.
+func openWide(s *wideState, k *[4]uint32, dst, nonces, ciphertexts, ads [][]byte, ok []bool) {
+	n := len(ciphertexts[0]) - TagSize
+	ct := make([][]byte, len(dst))
+	tags := make([][]byte, len(dst))
+	buf := make([]byte, len(dst)*TagSize)
+	for i := range dst {
+		ct[i] = ciphertexts[i][:n]
+		tags[i] = buf[i*TagSize : (i+1)*TagSize]
+		copy(tags[i], ciphertexts[i][n:])
+	}
+	s.init(k, nonces)
+	s.process(ads, len(ads[0]))
+	s.decrypt(dst, ct, n)
+	s.finalize(tags)
+	*s = wideState{}
+	var zero [TagSize]byte
+	for i := range dst {
+		ok[i] = subtle.ConstantTimeCompare(tags[i], zero[:]) == 1
+	}
+}
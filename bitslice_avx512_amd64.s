@@ -0,0 +1,90 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build amd64 && !purego && !noasm && !tinygo && !acorn_small
+// +build amd64,!purego,!noasm,!tinygo,!acorn_small
+
+#include "textflag.h"
+
+// Each state bit is a 64-byte wideWord, so bit i is at offset i*64.
+#define X(i) (i*64)(DI)
+
+// VPTERNLOGQ truth tables, for dst = f(dst, b, c) in Go operand order
+// VPTERNLOGQ $imm, c, b, dst.
+#define XOR3 $0x96 // dst ^ b ^ c
+#define XNOR3 $0x69 // ^(dst ^ b ^ c)
+#define MAJ $0xe8 // majority(dst, b, c)
+#define CH $0xca // dst ? b : c
+#define XORAND $0x78 // dst ^ (b & c)
+
+// func stepsAVX512(x *wideWord, m *wideWord, ks *wideWord, n int, ca, cb uint64)
+TEXT ·stepsAVX512(SB), NOSPLIT, $0-48
+	MOVQ x+0(FP), DI
+	MOVQ m+8(FP), SI
+	MOVQ ks+16(FP), DX
+	MOVQ n+24(FP), CX
+	VPBROADCASTQ ca+32(FP), Z30
+	VPBROADCASTQ cb+40(FP), Z31
+	TESTQ CX, CX
+	JZ done
+
+loop:
+	// feedback the 6 LFSRs; each uses the old value of the next one down
+	VMOVDQU64 X(235), Z0
+	VMOVDQU64 X(230), Z1
+	VMOVDQU64 X(289), Z2
+	VPTERNLOGQ XOR3, Z1, Z0, Z2
+	VMOVDQU64 Z2, X(289)
+
+	VMOVDQU64 X(196), Z3
+	VMOVDQU64 X(193), Z4
+	VPTERNLOGQ XOR3, Z4, Z3, Z1 // Z1 = x230
+	VMOVDQU64 Z1, X(230)
+
+	VMOVDQU64 X(160), Z5
+	VMOVDQU64 X(154), Z6
+	VPTERNLOGQ XOR3, Z6, Z5, Z4 // Z4 = x193
+	VMOVDQU64 Z4, X(193)
+
+	VMOVDQU64 X(111), Z7
+	VMOVDQU64 X(107), Z8
+	VPTERNLOGQ XOR3, Z8, Z7, Z6 // Z6 = x154
+	VMOVDQU64 Z6, X(154)
+
+	VMOVDQU64 X(66), Z9
+	VMOVDQU64 X(61), Z10
+	VPTERNLOGQ XOR3, Z10, Z9, Z8 // Z8 = x107
+	VMOVDQU64 Z8, X(107)
+
+	VMOVDQU64 X(23), Z11
+	VMOVDQU64 X(0), Z12
+	VPTERNLOGQ XOR3, Z12, Z11, Z10 // Z10 = x61
+	VMOVDQU64 Z10, X(61)
+
+	// ks = x12 ^ x154 ^ maj(x235, x61, x193) ^ ch(x230, x111, x66)
+	VPTERNLOGQ MAJ, Z4, Z10, Z0 // Z0 = maj
+	VPTERNLOGQ CH, Z9, Z7, Z1   // Z1 = ch
+	VMOVDQU64 X(12), Z13
+	VPTERNLOGQ XOR3, Z0, Z6, Z13
+	VPXORQ Z1, Z13, Z13         // Z13 = ks
+	VMOVDQU64 Z13, (DX)
+
+	// f = x0 ^ ^x107 ^ maj(x244, x23, x160) ^ (ca & x196) ^ (cb & ks)
+	VMOVDQU64 X(244), Z14
+	VPTERNLOGQ MAJ, Z5, Z11, Z14
+	VPTERNLOGQ XNOR3, Z14, Z8, Z12
+	VPTERNLOGQ XORAND, Z3, Z30, Z12
+	VPTERNLOGQ XORAND, Z13, Z31, Z12
+
+	// shift in the new bit
+	VPXORQ (SI), Z12, Z12
+	VMOVDQU64 Z12, X(293)
+
+	ADDQ $64, DI
+	ADDQ $64, SI
+	ADDQ $64, DX
+	DECQ CX
+	JNZ loop
+
+done:
+	VZEROUPPER
+	RET
@@ -0,0 +1,93 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build amd64 && !purego && !noasm && !tinygo && !acorn_small
+// +build amd64,!purego,!noasm,!tinygo,!acorn_small
+
+package acorn
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestWide(t *testing.T) {
+	if !cpu.hasAVX512F {
+		t.Skip("AVX-512 not available")
+	}
+	key := []byte(strings.Repeat("password", 2))
+	a := NewAEAD(key).(*aead)
+	r := rand.New(rand.NewSource(1))
+	var s wideState
+	for _, lanes := range []int{1, 65, 300, 512} {
+		for _, n := range []int{0, 7, 100} {
+			for _, adlen := range []int{0, 9} {
+				nonces := make([][]byte, lanes)
+				plaintexts := make([][]byte, lanes)
+				ads := make([][]byte, lanes)
+				dst := make([][]byte, lanes)
+				for i := 0; i < lanes; i++ {
+					nonces[i] = make([]byte, NonceSize)
+					plaintexts[i] = make([]byte, n)
+					ads[i] = make([]byte, adlen)
+					dst[i] = make([]byte, n+TagSize)
+					r.Read(nonces[i])
+					r.Read(plaintexts[i])
+					r.Read(ads[i])
+				}
+				sealWide(&s, &a.key, dst, nonces, plaintexts, ads)
+				for i := range dst {
+					want := a.Seal(nil, nonces[i], plaintexts[i], ads[i])
+					if !bytes.Equal(dst[i], want) {
+						t.Fatalf("lanes=%d len=%d adlen=%d: lane %d: got %x, want %x", lanes, n, adlen, i, dst[i], want)
+					}
+				}
+
+				bad := r.Intn(lanes)
+				dst[bad][r.Intn(n+TagSize)] ^= 1
+				out := make([][]byte, lanes)
+				for i := range out {
+					out[i] = make([]byte, n)
+				}
+				ok := make([]bool, lanes)
+				openWide(&s, &a.key, out, nonces, dst, ads, ok)
+				for i := range out {
+					if ok[i] != (i != bad) {
+						t.Errorf("lanes=%d len=%d adlen=%d: lane %d: ok = %v", lanes, n, adlen, i, ok[i])
+					}
+					if ok[i] && !bytes.Equal(out[i], plaintexts[i]) {
+						t.Errorf("lanes=%d len=%d adlen=%d: lane %d: got %x, want %x", lanes, n, adlen, i, out[i], plaintexts[i])
+					}
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkWide(b *testing.B) {
+	if !cpu.hasAVX512F {
+		b.Skip("AVX-512 not available")
+	}
+	bench := func(b *testing.B, size int) {
+		key := []byte(strings.Repeat("password", 2))
+		a := NewAEAD(key).(*aead)
+		nonces := make([][]byte, wideLanes)
+		plaintexts := make([][]byte, wideLanes)
+		ads := make([][]byte, wideLanes)
+		dst := make([][]byte, wideLanes)
+		for i := range dst {
+			nonces[i] = make([]byte, NonceSize)
+			plaintexts[i] = make([]byte, size)
+			dst[i] = make([]byte, size+TagSize)
+		}
+		var s wideState
+		b.SetBytes(int64(size * wideLanes))
+		for i := 0; i < b.N; i++ {
+			sealWide(&s, &a.key, dst, nonces, plaintexts, ads)
+		}
+	}
+	b.Run("8", func(b *testing.B) { bench(b, 8) })
+	b.Run("100", func(b *testing.B) { bench(b, 100) })
+	b.Run("1024", func(b *testing.B) { bench(b, 1024) })
+}
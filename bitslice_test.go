@@ -0,0 +1,104 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build !acorn_small
+// +build !acorn_small
+
+package acorn
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestTranspose64(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var a, b [64]uint64
+	for i := range a {
+		a[i] = r.Uint64()
+	}
+	b = a
+	transpose64(&b)
+	for i := uint(0); i < 64; i++ {
+		for j := uint(0); j < 64; j++ {
+			if a[i]>>j&1 != b[j]>>i&1 {
+				t.Fatalf("bit %d of a[%d] != bit %d of b[%d]", j, i, i, j)
+			}
+		}
+	}
+}
+
+func TestSliced(t *testing.T) {
+	key := []byte(strings.Repeat("password", 2))
+	a := NewAEAD(key).(*aead)
+	r := rand.New(rand.NewSource(1))
+	var s slicedState
+	for _, lanes := range []int{1, 2, 32, 63, 64} {
+		for _, n := range []int{0, 1, 7, 8, 9, 100} {
+			for _, adlen := range []int{0, 3, 16} {
+				nonces := make([][]byte, lanes)
+				plaintexts := make([][]byte, lanes)
+				ads := make([][]byte, lanes)
+				dst := make([][]byte, lanes)
+				for i := 0; i < lanes; i++ {
+					nonces[i] = make([]byte, NonceSize)
+					plaintexts[i] = make([]byte, n)
+					ads[i] = make([]byte, adlen)
+					dst[i] = make([]byte, n+TagSize)
+					r.Read(nonces[i])
+					r.Read(plaintexts[i])
+					r.Read(ads[i])
+				}
+				sealSliced(&s, &a.key, dst, nonces, plaintexts, ads)
+				for i := range dst {
+					want := a.Seal(nil, nonces[i], plaintexts[i], ads[i])
+					if !bytes.Equal(dst[i], want) {
+						t.Errorf("lanes=%d len=%d adlen=%d: lane %d: got %x, want %x", lanes, n, adlen, i, dst[i], want)
+					}
+				}
+
+				// corrupt one lane
+				bad := r.Intn(lanes)
+				dst[bad][r.Intn(n+TagSize)] ^= 1
+				out := make([][]byte, lanes)
+				for i := range out {
+					out[i] = make([]byte, n)
+				}
+				ok := openSliced(&s, &a.key, out, nonces, dst, ads)
+				for i := range out {
+					if ok[i] != (i != bad) {
+						t.Errorf("lanes=%d len=%d adlen=%d: lane %d: ok = %v", lanes, n, adlen, i, ok[i])
+					}
+					if ok[i] && !bytes.Equal(out[i], plaintexts[i]) {
+						t.Errorf("lanes=%d len=%d adlen=%d: lane %d: got %x, want %x", lanes, n, adlen, i, out[i], plaintexts[i])
+					}
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkSliced(b *testing.B) {
+	bench := func(b *testing.B, size int) {
+		key := []byte(strings.Repeat("password", 2))
+		a := NewAEAD(key).(*aead)
+		nonces := make([][]byte, slicedLanes)
+		plaintexts := make([][]byte, slicedLanes)
+		ads := make([][]byte, slicedLanes)
+		dst := make([][]byte, slicedLanes)
+		for i := range dst {
+			nonces[i] = make([]byte, NonceSize)
+			plaintexts[i] = make([]byte, size)
+			dst[i] = make([]byte, size+TagSize)
+		}
+		var s slicedState
+		b.SetBytes(int64(size * slicedLanes))
+		for i := 0; i < b.N; i++ {
+			sealSliced(&s, &a.key, dst, nonces, plaintexts, ads)
+		}
+	}
+	b.Run("8", func(b *testing.B) { bench(b, 8) })
+	b.Run("100", func(b *testing.B) { bench(b, 100) })
+	b.Run("1024", func(b *testing.B) { bench(b, 1024) })
+}
@@ -0,0 +1,76 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"errors"
+	"strconv"
+)
+
+// KeySizeError is returned by NewCheckedAEAD for a key of the wrong length.
+type KeySizeError int
+
+func (k KeySizeError) Error() string {
+	return "acorn: invalid key size " + strconv.Itoa(int(k))
+}
+
+// NonceSizeError is returned by the CheckedAEAD methods
+// for a nonce of the wrong length.
+type NonceSizeError int
+
+func (n NonceSizeError) Error() string {
+	return "acorn: invalid nonce size " + strconv.Itoa(int(n))
+}
+
+// ErrMessageTooLarge is returned by CheckedAEAD.Seal when the
+// sealed message would be too long to fit in a slice.
+var ErrMessageTooLarge = errors.New("acorn: message too large")
+
+const maxInt = int(^uint(0) >> 1)
+
+// A CheckedAEAD is an ACORN-128 instance whose methods report bad input
+// as errors instead of panicking, for services which handle keys, nonces,
+// and messages from the network and cannot afford to crash on them.
+//
+// Errors for bad lengths are of type KeySizeError and NonceSizeError,
+// a message that would overflow is ErrMessageTooLarge, and a ciphertext
+// that is too short or does not authenticate is ErrAuthentication.
+//
+// It always uses the Go implementation, since an Engine may panic, and
+// does not implement cipher.AEAD or Batch. It is safe for concurrent use.
+type CheckedAEAD struct {
+	a aead
+}
+
+// NewCheckedAEAD returns a CheckedAEAD that uses the given 128-bit key.
+func NewCheckedAEAD(key []byte) (*CheckedAEAD, error) {
+	if len(key) != KeySize {
+		return nil, KeySizeError(len(key))
+	}
+	return &CheckedAEAD{aead{key: loadKey(key)}}, nil
+}
+
+// Seal is like cipher.AEAD's Seal, but returns an error if the nonce is
+// not NonceSize bytes or the result would be too large. On error, it
+// returns dst unchanged.
+func (c *CheckedAEAD) Seal(dst, nonce, plaintext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != NonceSize {
+		return dst, NonceSizeError(len(nonce))
+	}
+	if len(plaintext) > maxInt-TagSize-len(dst) {
+		return dst, ErrMessageTooLarge
+	}
+	return c.a.Seal(dst, nonce, plaintext, additionalData), nil
+}
+
+// Open is like cipher.AEAD's Open, but returns an error if the nonce is
+// not NonceSize bytes, as well as if the ciphertext does not authenticate.
+func (c *CheckedAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != NonceSize {
+		return dst, NonceSizeError(len(nonce))
+	}
+	if len(ciphertext)-TagSize > maxInt-len(dst) {
+		return dst, ErrMessageTooLarge
+	}
+	return c.a.Open(dst, nonce, ciphertext, additionalData)
+}
@@ -0,0 +1,47 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCheckedAEAD(t *testing.T) {
+	for _, n := range []int{0, 15, 17, 32} {
+		if _, err := NewCheckedAEAD(make([]byte, n)); err != KeySizeError(n) {
+			t.Errorf("NewCheckedAEAD with a %d-byte key returned %v", n, err)
+		}
+	}
+	key, nonce := countUp(KeySize), countUp(NonceSize)
+	c, err := NewCheckedAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := NewAEAD(key).Seal(nil, nonce, []byte("hello"), nil)
+	ct, err := c.Seal(nil, nonce, []byte("hello"), nil)
+	if err != nil || !bytes.Equal(ct, want) {
+		t.Errorf("Seal = %x, %v; want %x", ct, err, want)
+	}
+	if pt, err := c.Open(nil, nonce, ct, nil); err != nil || string(pt) != "hello" {
+		t.Errorf("Open = %q, %v", pt, err)
+	}
+
+	dst := []byte("dst")
+	for _, n := range []int{0, 8, 15, 17} {
+		if out, err := c.Seal(dst, make([]byte, n), nil, nil); err != NonceSizeError(n) || string(out) != "dst" {
+			t.Errorf("Seal with a %d-byte nonce = %q, %v", n, out, err)
+		}
+		if out, err := c.Open(dst, make([]byte, n), ct, nil); err != NonceSizeError(n) || string(out) != "dst" {
+			t.Errorf("Open with a %d-byte nonce = %q, %v", n, out, err)
+		}
+	}
+	for n := 0; n < TagSize; n++ {
+		if _, err := c.Open(nil, nonce, ct[:n], nil); err != ErrAuthentication {
+			t.Errorf("Open of %d bytes returned %v, want ErrAuthentication", n, err)
+		}
+	}
+	if err := KeySizeError(3).Error(); err != "acorn: invalid key size 3" {
+		t.Errorf("KeySizeError(3).Error() = %q", err)
+	}
+}
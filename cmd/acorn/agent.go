@@ -0,0 +1,59 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/magical/go-acorn/agent"
+	"github.com/magical/go-acorn/keyfile"
+)
+
+func runAgent(args []string) error {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: acorn agent -a socket [keyfile...]\n\n")
+		fmt.Fprintf(os.Stderr, "Agent loads the given keys into memory and serves Seal and Open\n")
+		fmt.Fprintf(os.Stderr, "requests on a unix socket until interrupted. Clients may add and\n")
+		fmt.Fprintf(os.Stderr, "remove keys over the socket as well.\n\n")
+		fs.PrintDefaults()
+	}
+	addr := fs.String("a", "", "listen on the unix socket at `path`")
+	fs.Parse(args)
+	if *addr == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	keyring := agent.NewKeyring()
+	defer keyring.(io.Closer).Close()
+	for _, name := range fs.Args() {
+		k, err := keyfile.Read(name, passphrase)
+		if err != nil {
+			return err
+		}
+		if err := keyring.Add(k.ID, k.Key); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "added key %x\n", k.ID)
+	}
+
+	l, err := agent.Listen(*addr)
+	if err != nil {
+		return err
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		l.Close()
+	}()
+	fmt.Fprintf(os.Stderr, "listening on %s\n", *addr)
+	agent.Serve(keyring, l)
+	return nil
+}
@@ -0,0 +1,279 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/magical/go-acorn"
+)
+
+type benchBackend struct {
+	name string
+	new  func(key []byte) cipher.AEAD
+}
+
+var benchBackends = []benchBackend{
+	{"generic", acorn.NewAEAD},
+}
+
+// compareBackends are other AEADs to measure alongside ACORN with -compare.
+// ChaCha20-Poly1305 is not included because it isn't in the standard library.
+var compareBackends = []benchBackend{
+	{"aes-128-gcm", newGCM},
+}
+
+func newGCM(key []byte) cipher.AEAD {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	a, err := cipher.NewGCM(b)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// batchMessages is the number of messages in each batch that the batch
+// backends are measured with, enough to fill every backend's lanes.
+// Batch backends are meant for short messages, so sizes above
+// batchMaxSize are skipped to keep the memory needed reasonable.
+const (
+	batchMessages = 512
+	batchMaxSize  = 64 << 10
+)
+
+type benchResult struct {
+	Backend  string  `json:"backend"`
+	Op       string  `json:"op"`
+	Size     int     `json:"size"`
+	N        int     `json:"n"`
+	NsPerOp  float64 `json:"ns_per_op"`
+	MBPerSec float64 `json:"mb_per_sec"`
+}
+
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: acorn bench [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Bench measures Seal and Open throughput over a range of message sizes.\n")
+		fmt.Fprintf(os.Stderr, "Sizes start at -min and grow by a factor of 4 up to -max.\n")
+		fmt.Fprintf(os.Stderr, "Each batch backend is measured too, as batch-<name>, with SealBatch\n")
+		fmt.Fprintf(os.Stderr, "and OpenBatch on %d messages at a time, for sizes up to %s;\n", batchMessages, formatSize(batchMaxSize))
+		fmt.Fprintf(os.Stderr, "its ns/op is per message.\n")
+		fmt.Fprintf(os.Stderr, "With -compare, AES-128-GCM is measured too, for reference.\n\n")
+		fs.PrintDefaults()
+	}
+	jsonOut := fs.Bool("json", false, "write results as JSON")
+	compare := fs.Bool("compare", false, "also measure AES-128-GCM")
+	benchtime := fs.Duration("time", 1*time.Second, "minimum run time for each measurement")
+	minFlag := fs.String("min", "16", "smallest message `size`")
+	maxFlag := fs.String("max", "16M", "largest message `size`")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	minSize, err := parseSize(*minFlag)
+	if err != nil {
+		return err
+	}
+	maxSize, err := parseSize(*maxFlag)
+	if err != nil {
+		return err
+	}
+	if minSize <= 0 || maxSize < minSize {
+		return errors.New("invalid size range")
+	}
+
+	var tw *tabwriter.Writer
+	if !*jsonOut {
+		tw = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintf(tw, "backend\top\tsize\tns/op\tMB/s\t\n")
+	}
+	backends := benchBackends
+	if *compare {
+		backends = append(backends[:len(backends):len(backends)], compareBackends...)
+	}
+	var results []benchResult
+	report := func(rs []benchResult) {
+		for _, r := range rs {
+			if tw != nil {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%.0f\t%.2f\t\n", r.Backend, r.Op, formatSize(r.Size), r.NsPerOp, r.MBPerSec)
+			}
+			results = append(results, r)
+		}
+	}
+	for _, b := range backends {
+		for size := minSize; size <= maxSize; size *= 4 {
+			report(benchSize(b, size, *benchtime))
+		}
+	}
+	for _, name := range acorn.Backends() {
+		for size := minSize; size <= maxSize && size <= batchMaxSize; size *= 4 {
+			report(benchBatch(name, size, *benchtime))
+		}
+	}
+	if *jsonOut {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		return e.Encode(results)
+	}
+	return tw.Flush()
+}
+
+func benchSize(b benchBackend, size int, d time.Duration) []benchResult {
+	key := make([]byte, acorn.KeySize)
+	a := b.new(key)
+	nonce := make([]byte, a.NonceSize())
+	plaintext := make([]byte, size)
+	sealed := a.Seal(nil, nonce, plaintext, nil)
+	dst := make([]byte, 0, len(sealed))
+
+	seal := func() {
+		a.Seal(dst[:0], nonce, plaintext, nil)
+	}
+	open := func() {
+		if _, err := a.Open(dst[:0], nonce, sealed, nil); err != nil {
+			panic(err)
+		}
+	}
+	return []benchResult{
+		result(b.name, "seal", size, d, seal),
+		result(b.name, "open", size, d, open),
+	}
+}
+
+// benchBatch measures SealBatch and OpenBatch with the named batch backend.
+func benchBatch(name string, size int, d time.Duration) []benchResult {
+	a, err := acorn.NewAEADBackend(make([]byte, acorn.KeySize), name)
+	if err != nil {
+		panic(err) // name came from acorn.Backends
+	}
+	nonces := make([][]byte, batchMessages)
+	plaintexts := make([][]byte, batchMessages)
+	ads := make([][]byte, batchMessages)
+	sealed := make([][]byte, batchMessages)
+	dst := make([][]byte, batchMessages)
+	for i := range nonces {
+		nonces[i] = make([]byte, acorn.NonceSize)
+		nonces[i][0], nonces[i][1] = byte(i), byte(i>>8)
+		plaintexts[i] = make([]byte, size)
+		dst[i] = make([]byte, 0, size+acorn.TagSize)
+	}
+	a.SealBatch(sealed, nonces, plaintexts, ads)
+
+	reset := func() {
+		for i := range dst {
+			dst[i] = dst[i][:0]
+		}
+	}
+	seal := func() {
+		reset()
+		a.SealBatch(dst, nonces, plaintexts, ads)
+	}
+	open := func() {
+		reset()
+		for _, err := range a.OpenBatch(dst, nonces, sealed, ads, false) {
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+	return []benchResult{
+		resultN("batch-"+name, "seal", size, batchMessages, d, seal),
+		resultN("batch-"+name, "open", size, batchMessages, d, open),
+	}
+}
+
+func result(backend, op string, size int, d time.Duration, f func()) benchResult {
+	return resultN(backend, op, size, 1, d, f)
+}
+
+// resultN measures f, which processes count messages of the given size,
+// and reports the time per message.
+func resultN(backend, op string, size, count int, d time.Duration, f func()) benchResult {
+	n, elapsed := measure(d, f)
+	ns := float64(elapsed.Nanoseconds()) / float64(n) / float64(count)
+	return benchResult{
+		Backend:  backend,
+		Op:       op,
+		Size:     size,
+		N:        n,
+		NsPerOp:  ns,
+		MBPerSec: float64(size) * 1e3 / ns,
+	}
+}
+
+// measure calls f repeatedly until at least d has elapsed,
+// and returns the number of calls and the time they took.
+// Like the testing package, it grows the iteration count
+// based on how long the previous run took.
+func measure(d time.Duration, f func()) (int, time.Duration) {
+	n := 1
+	for {
+		start := time.Now()
+		for i := 0; i < n; i++ {
+			f()
+		}
+		elapsed := time.Since(start)
+		if elapsed >= d || n >= 1e9 {
+			return n, elapsed
+		}
+		next := 100 * n
+		if elapsed > 0 {
+			next = int(int64(n) * int64(d) / int64(elapsed) * 6 / 5)
+		}
+		if next > 100*n {
+			next = 100 * n
+		}
+		if next <= n {
+			next = n + 1
+		}
+		n = next
+	}
+}
+
+// parseSize parses a byte count with an optional K, M, or G suffix.
+func parseSize(s string) (int, error) {
+	shift := uint(0)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		shift = 10
+	case strings.HasSuffix(s, "M"):
+		shift = 20
+	case strings.HasSuffix(s, "G"):
+		shift = 30
+	}
+	num := s
+	if shift != 0 {
+		num = s[:len(s)-1]
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n << shift, nil
+}
+
+func formatSize(n int) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return strconv.Itoa(n>>20) + "MiB"
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return strconv.Itoa(n>>10) + "KiB"
+	}
+	return strconv.Itoa(n) + "B"
+}
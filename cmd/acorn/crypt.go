@@ -0,0 +1,275 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/magical/go-acorn/acornstream"
+	"github.com/magical/go-acorn/keyfile"
+)
+
+const ext = ".acorn"
+
+func runEncrypt(args []string) error {
+	fs := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: acorn encrypt -k keyfile [-o output] [-tag tagfile] [input]\n\n")
+		fmt.Fprintf(os.Stderr, "Encrypt encrypts a file, or a whole directory as a tar archive.\n")
+		fmt.Fprintf(os.Stderr, "The output defaults to the input name with %s appended.\n", ext)
+		fmt.Fprintf(os.Stderr, "If the input is - or omitted, encrypt reads standard input\n")
+		fmt.Fprintf(os.Stderr, "and writes to standard output.\n")
+		fmt.Fprintf(os.Stderr, "With -tag, authentication tags are written to a separate file.\n\n")
+		fs.PrintDefaults()
+	}
+	keyFlag := fs.String("k", "", "read the key from `keyfile`")
+	outFlag := fs.String("o", "", "write the ciphertext to `output` (- for standard output)")
+	tagFlag := fs.String("tag", "", "write authentication tags to `tagfile` instead of the output")
+	fs.Parse(args)
+	if fs.NArg() > 1 || *keyFlag == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	key, err := readKey(*keyFlag)
+	if err != nil {
+		return err
+	}
+	input := fs.Arg(0)
+	output := *outFlag
+	if output == "" && !isStdio(input) {
+		output = strings.TrimSuffix(input, string(os.PathSeparator)) + ext
+	}
+
+	// write is called with the stream writer to produce the plaintext
+	var write func(w io.Writer) error
+	var mode os.FileMode
+	if fi, err := os.Stat(input); err == nil && fi.IsDir() {
+		write = func(w io.Writer) error {
+			return acornstream.WriteDir(w, input)
+		}
+		mode = 0644
+	} else {
+		in, inMode, err := openInput(input)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		write = func(w io.Writer) error {
+			_, err := io.Copy(w, in)
+			return err
+		}
+		mode = inMode
+	}
+
+	out, err := createOutput(output, mode, true)
+	if err != nil {
+		return err
+	}
+	config := &acornstream.Config{KeyID: key.ID}
+	if *tagFlag == "" {
+		return out.finish(encrypt(out, key.Key, config, write))
+	}
+	tags, err := createOutput(*tagFlag, mode, true)
+	if err != nil {
+		return out.finish(err)
+	}
+	config.Tags = tags
+	err = encrypt(out, key.Key, config, write)
+	// Commit the tags first, so that a ciphertext is never left in
+	// place without them. If the ciphertext then can't be committed,
+	// the new tags match nothing, so remove them.
+	if err := tags.finish(err); err != nil {
+		return out.finish(err)
+	}
+	if err := out.finish(nil); err != nil {
+		if !isStdio(*tagFlag) {
+			os.Remove(*tagFlag)
+		}
+		return err
+	}
+	return nil
+}
+
+// encrypt writes an encrypted stream to w, with the plaintext
+// supplied by write.
+func encrypt(w io.Writer, key []byte, config *acornstream.Config, write func(io.Writer) error) error {
+	sw, err := acornstream.NewWriterConfig(w, key, config)
+	if err != nil {
+		return err
+	}
+	if err := write(sw); err != nil {
+		return err
+	}
+	return sw.Close()
+}
+
+func runDecrypt(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: acorn decrypt -k keyfile [-o output | -C dir] [-tag tagfile] [input]\n\n")
+		fmt.Fprintf(os.Stderr, "Decrypt decrypts a file produced by acorn encrypt.\n")
+		fmt.Fprintf(os.Stderr, "The output defaults to the input name with %s removed.\n", ext)
+		fmt.Fprintf(os.Stderr, "If the input is - or omitted, decrypt reads standard input\n")
+		fmt.Fprintf(os.Stderr, "and writes to standard output.\n")
+		fmt.Fprintf(os.Stderr, "Encrypted directories are extracted with -C.\n")
+		fmt.Fprintf(os.Stderr, "Detached tags are read from -tag, or the input name with .tag appended.\n\n")
+		fmt.Fprintf(os.Stderr, "When writing to standard output, plaintext is written as it is\n")
+		fmt.Fprintf(os.Stderr, "decrypted. If the input turns out to be truncated or corrupt,\n")
+		fmt.Fprintf(os.Stderr, "decrypt exits with a non-zero status and the output must be discarded.\n\n")
+		fs.PrintDefaults()
+	}
+	keyFlag := fs.String("k", "", "read the key from `keyfile`")
+	outFlag := fs.String("o", "", "write the plaintext to `output` (- for standard output)")
+	dirFlag := fs.String("C", "", "extract an encrypted directory to `dir`")
+	tagFlag := fs.String("tag", "", "read detached authentication tags from `tagfile`")
+	fs.Parse(args)
+	if fs.NArg() > 1 || *keyFlag == "" || (*outFlag != "" && *dirFlag != "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	key, err := readKey(*keyFlag)
+	if err != nil {
+		return err
+	}
+	input := fs.Arg(0)
+
+	in, mode, err := openInput(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	sr, err := newReader(in, key, input, *tagFlag)
+	if err != nil {
+		return err
+	}
+	if *dirFlag != "" {
+		return acornstream.ExtractDir(sr, *dirFlag)
+	}
+
+	output := *outFlag
+	if output == "" && !isStdio(input) {
+		if !strings.HasSuffix(input, ext) || len(input) == len(ext) {
+			return fmt.Errorf("%s: unknown suffix; use -o", input)
+		}
+		output = strings.TrimSuffix(input, ext)
+	}
+	out, err := createOutput(output, mode, false)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, sr)
+	return out.finish(err)
+}
+
+// newReader returns a Reader for the encrypted stream in r,
+// which came from the named input. If the stream has detached tags,
+// they are read from tagfile or, by default, the input name with
+// .tag appended. If the header names a key other than key,
+// newReader says so, rather than leaving Read to fail to authenticate.
+func newReader(r io.Reader, key *keyfile.Key, input, tagfile string) (*acornstream.Reader, error) {
+	br := bufio.NewReader(r)
+	// A short input is left for ParseHeader to report.
+	b, err := br.Peek(acornstream.HeaderSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	h, err := acornstream.ParseHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	if h.KeyID != ([8]byte{}) && h.KeyID != key.ID {
+		return nil, fmt.Errorf("input was encrypted with key id %x, not %x", h.KeyID, key.ID)
+	}
+	if !h.Detached {
+		if tagfile != "" {
+			return nil, errors.New("input does not have detached tags")
+		}
+		return acornstream.NewReader(br, key.Key)
+	}
+	if tagfile == "" {
+		if isStdio(input) {
+			return nil, errors.New("input has detached tags; use -tag")
+		}
+		tagfile = input + ".tag"
+	}
+	// The tag file stays open until the process exits.
+	tags, err := os.Open(tagfile)
+	if err != nil {
+		return nil, err
+	}
+	return acornstream.NewDetachedReader(br, bufio.NewReader(tags), key.Key)
+}
+
+// isStdio reports whether name refers to standard input or output.
+func isStdio(name string) bool {
+	return name == "" || name == "-"
+}
+
+// openInput opens the named input file, or standard input if name is
+// empty or "-". It also returns the file's permissions, which are
+// carried over to the output.
+func openInput(name string) (io.ReadCloser, os.FileMode, error) {
+	if isStdio(name) {
+		if isTerminal(os.Stdin) {
+			return nil, 0, errors.New("refusing to read from a terminal; give an input file")
+		}
+		return ioutil.NopCloser(os.Stdin), 0600, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, fi.Mode(), nil
+}
+
+type output interface {
+	io.Writer
+	// finish completes the output if err is nil and discards it otherwise,
+	// and returns err or the first error encountered while finishing.
+	finish(err error) error
+}
+
+// createOutput creates the named output file, or returns standard output
+// if name is empty or "-". Binary output is never written to a terminal.
+func createOutput(name string, mode os.FileMode, binary bool) (output, error) {
+	if isStdio(name) {
+		if binary && isTerminal(os.Stdout) {
+			return nil, errors.New("refusing to write ciphertext to a terminal; use -o")
+		}
+		return stdout{}, nil
+	}
+	return createAtomic(name, mode)
+}
+
+// stdout is an output that writes to standard output.
+// Data written to it cannot be taken back.
+type stdout struct{}
+
+func (stdout) Write(p []byte) (int, error) { return os.Stdout.Write(p) }
+func (stdout) finish(err error) error      { return err }
+
+// readKey reads a key file. If the key is protected by a passphrase,
+// the passphrase is taken from the ACORN_PASSPHRASE environment variable.
+func readKey(name string) (*keyfile.Key, error) {
+	return keyfile.Read(name, passphrase)
+}
+
+func passphrase() ([]byte, error) {
+	p := os.Getenv("ACORN_PASSPHRASE")
+	if p == "" {
+		return nil, errors.New("key is protected by a passphrase; set ACORN_PASSPHRASE")
+	}
+	return []byte(p), nil
+}
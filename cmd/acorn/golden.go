@@ -0,0 +1,327 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// A goldenFile is a saved set of benchmark measurements.
+type goldenFile struct {
+	GoVersion string         `json:"go_version"`
+	GOOS      string         `json:"goos"`
+	GOARCH    string         `json:"goarch"`
+	Results   []goldenResult `json:"results"`
+}
+
+// A goldenResult holds repeated measurements of one benchmark,
+// in nanoseconds per operation.
+type goldenResult struct {
+	Backend string    `json:"backend"`
+	Op      string    `json:"op"`
+	Size    int       `json:"size"`
+	Samples []float64 `json:"samples"`
+}
+
+func (r *goldenResult) name() string {
+	return r.Backend + "/" + r.Op + "/" + formatSize(r.Size)
+}
+
+func runGolden(args []string) error {
+	fs := flag.NewFlagSet("golden", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: acorn golden [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Golden runs the Seal and Open benchmarks -count times each.\n")
+		fmt.Fprintf(os.Stderr, "With -save, it writes the measurements to a golden JSON file.\n")
+		fmt.Fprintf(os.Stderr, "With -baseline, it compares them against an earlier golden file,\n")
+		fmt.Fprintf(os.Stderr, "using a Mann-Whitney U test as benchstat does, and fails if any\n")
+		fmt.Fprintf(os.Stderr, "benchmark is significantly slower by more than -threshold.\n\n")
+		fs.PrintDefaults()
+	}
+	save := fs.String("save", "", "write the measurements to `file`")
+	baseline := fs.String("baseline", "", "compare against the measurements in `file`")
+	count := fs.Int("count", 10, "measure each benchmark `n` times")
+	benchtime := fs.Duration("time", 100*time.Millisecond, "minimum run time for each measurement")
+	minFlag := fs.String("min", "16", "smallest message `size`")
+	maxFlag := fs.String("max", "64K", "largest message `size`")
+	alpha := fs.Float64("alpha", 0.05, "significance level")
+	threshold := fs.Float64("threshold", 5, "largest tolerated slowdown, in `percent`")
+	fs.Parse(args)
+	if fs.NArg() != 0 || *count < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	minSize, err := parseSize(*minFlag)
+	if err != nil {
+		return err
+	}
+	maxSize, err := parseSize(*maxFlag)
+	if err != nil {
+		return err
+	}
+	if minSize <= 0 || maxSize < minSize {
+		return errors.New("invalid size range")
+	}
+
+	var base *goldenFile
+	if *baseline != "" {
+		// read it first, so that a bad file is found before the long wait
+		if base, err = readGolden(*baseline); err != nil {
+			return err
+		}
+	}
+
+	g := &goldenFile{
+		GoVersion: runtime.Version(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+	}
+	index := map[string]int{}
+	// Measure every benchmark once per round, rather than each one
+	// count times in a row, so that drift in the machine's speed
+	// spreads across all of them instead of skewing a few.
+	for round := 0; round < *count; round++ {
+		for _, b := range benchBackends {
+			for size := minSize; size <= maxSize; size *= 4 {
+				for _, r := range benchSize(b, size, *benchtime) {
+					gr := goldenResult{Backend: r.Backend, Op: r.Op, Size: r.Size}
+					i, ok := index[gr.name()]
+					if !ok {
+						i = len(g.Results)
+						index[gr.name()] = i
+						g.Results = append(g.Results, gr)
+					}
+					g.Results[i].Samples = append(g.Results[i].Samples, r.NsPerOp)
+				}
+			}
+		}
+	}
+
+	if *save != "" {
+		if err := writeGolden(*save, g); err != nil {
+			return err
+		}
+	}
+	if base == nil {
+		if *save == "" {
+			return writeGoldenTo(os.Stdout, g)
+		}
+		return nil
+	}
+	rows := compareGolden(base, g, *alpha)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "name\told ns/op\tnew ns/op\tdelta\t\n")
+	regressed := 0
+	for _, c := range rows {
+		fmt.Fprintf(tw, "%s\t%.0f\t%.0f\t%s\t\n", c.name, c.old, c.new, c.delta())
+		if c.significant && c.change() > *threshold {
+			regressed++
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if regressed > 0 {
+		return fmt.Errorf("%d benchmarks are more than %g%% slower than %s", regressed, *threshold, *baseline)
+	}
+	return nil
+}
+
+func readGolden(name string) (*goldenFile, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	g := new(goldenFile)
+	if err := json.Unmarshal(b, g); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return g, nil
+}
+
+func writeGolden(name string, g *goldenFile) error {
+	f, err := createAtomic(name, 0644)
+	if err != nil {
+		return err
+	}
+	return f.finish(writeGoldenTo(f, g))
+}
+
+func writeGoldenTo(w io.Writer, g *goldenFile) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(g)
+}
+
+// A comparison is one row of the comparison table.
+type comparison struct {
+	name        string
+	old, new    float64 // medians
+	p           float64
+	n1, n2      int
+	significant bool
+}
+
+// change returns how much slower new is than old, in percent.
+func (c *comparison) change() float64 {
+	return (c.new/c.old - 1) * 100
+}
+
+// delta formats the change like benchstat: "~" if it is not
+// significant, and with the p-value and sample sizes either way.
+func (c *comparison) delta() string {
+	if !c.significant {
+		return fmt.Sprintf("~ (p=%.3f n=%d+%d)", c.p, c.n1, c.n2)
+	}
+	return fmt.Sprintf("%+.2f%% (p=%.3f n=%d+%d)", c.change(), c.p, c.n1, c.n2)
+}
+
+// compareGolden compares the benchmarks found in both old and new.
+func compareGolden(old, new *goldenFile, alpha float64) []comparison {
+	olds := map[string]*goldenResult{}
+	for i := range old.Results {
+		olds[old.Results[i].name()] = &old.Results[i]
+	}
+	var rows []comparison
+	for i := range new.Results {
+		r := &new.Results[i]
+		o, ok := olds[r.name()]
+		if !ok || len(o.Samples) == 0 || len(r.Samples) == 0 {
+			continue
+		}
+		p := mannWhitneyU(o.Samples, r.Samples)
+		rows = append(rows, comparison{
+			name:        r.name(),
+			old:         median(o.Samples),
+			new:         median(r.Samples),
+			p:           p,
+			n1:          len(o.Samples),
+			n2:          len(r.Samples),
+			significant: p < alpha,
+		})
+	}
+	return rows
+}
+
+func median(x []float64) float64 {
+	s := append([]float64(nil), x...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// mannWhitneyU returns the two-sided p-value of the Mann-Whitney U test
+// that x and y come from the same distribution. Like benchstat, it uses
+// the exact distribution of U for small samples without ties, and the
+// normal approximation, corrected for ties, otherwise.
+func mannWhitneyU(x, y []float64) float64 {
+	m, n := len(x), len(y)
+
+	// rank the pooled samples, giving ties their average rank
+	type obs struct {
+		v     float64
+		fromX bool
+	}
+	all := make([]obs, 0, m+n)
+	for _, v := range x {
+		all = append(all, obs{v, true})
+	}
+	for _, v := range y {
+		all = append(all, obs{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+	var rankX, tieTerm float64
+	ties := false
+	for i := 0; i < len(all); {
+		j := i + 1
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // ranks are 1-based
+		for k := i; k < j; k++ {
+			if all[k].fromX {
+				rankX += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties = true
+			tieTerm += t*t*t - t
+		}
+		i = j
+	}
+	u := rankX - float64(m*(m+1))/2
+
+	if !ties && m <= 50 && n <= 50 {
+		return math.Min(1, 2*math.Min(uCDF(m, n, u), 1-uCDF(m, n, u-1)))
+	}
+	N := float64(m + n)
+	mean := float64(m*n) / 2
+	variance := float64(m*n) / 12 * ((N + 1) - tieTerm/(N*(N-1)))
+	if variance == 0 {
+		return 1
+	}
+	z := (math.Abs(u-mean) - 0.5) / math.Sqrt(variance)
+	if z < 0 {
+		z = 0
+	}
+	return math.Min(1, math.Erfc(z/math.Sqrt2))
+}
+
+// uCDF returns P(U <= u) for the U statistic of samples of sizes m and n
+// without ties, counting the arrangements with the recurrence
+// c(m, n, u) = c(m-1, n, u-n) + c(m, n-1, u).
+func uCDF(m, n int, u float64) float64 {
+	if u < 0 {
+		return 0
+	}
+	max := m * n
+	if u >= float64(max) {
+		return 1
+	}
+	// c[j][k] holds the count for the current number of x samples,
+	// j y samples, and U = k.
+	c := make([][]float64, n+1)
+	for j := range c {
+		c[j] = make([]float64, max+1)
+		c[j][0] = 1 // no x samples: U is always 0
+	}
+	for i := 1; i <= m; i++ {
+		next := make([][]float64, n+1)
+		for j := range next {
+			next[j] = make([]float64, max+1)
+			for k := 0; k <= i*j; k++ {
+				// the largest observation is either an x,
+				// which beats all j y's, or a y
+				if k >= j {
+					next[j][k] = c[j][k-j]
+				}
+				if j > 0 {
+					next[j][k] += next[j-1][k]
+				}
+			}
+		}
+		c = next
+	}
+	var below, total float64
+	for k, v := range c[n] {
+		if float64(k) <= u {
+			below += v
+		}
+		total += v
+	}
+	return below / total
+}
@@ -0,0 +1,61 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMannWhitneyU(t *testing.T) {
+	tests := []struct {
+		x, y []float64
+		p    float64
+	}{
+		// completely separated: the most extreme of C(10,5) = 252 orders
+		{[]float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 2.0 / 252},
+		{[]float64{6, 7, 8, 9, 10}, []float64{1, 2, 3, 4, 5}, 2.0 / 252},
+		// interleaved: as unremarkable as it gets
+		{[]float64{1, 4, 5, 8}, []float64{2, 3, 6, 7}, 1},
+		// U = 1 for sizes 3 and 3: 2 of 20 orders have U <= 1
+		{[]float64{1, 2, 4}, []float64{3, 5, 6}, 2 * 2.0 / 20},
+		// all tied
+		{[]float64{5, 5, 5}, []float64{5, 5, 5}, 1},
+	}
+	for _, tt := range tests {
+		if p := mannWhitneyU(tt.x, tt.y); math.Abs(p-tt.p) > 1e-9 {
+			t.Errorf("mannWhitneyU(%v, %v) = %v, want %v", tt.x, tt.y, p, tt.p)
+		}
+	}
+
+	// With ties, the normal approximation is used. Here U = 1,
+	// the mean is 32, and the tie-corrected variance is
+	// 64/12 * (17 - 54/240), so z = 30.5/9.459 and p = erfc(z/√2).
+	x := []float64{1, 2, 2, 3, 3, 4, 5, 5}
+	y := []float64{5, 6, 6, 7, 8, 8, 9, 9}
+	if p := mannWhitneyU(x, y); math.Abs(p-0.00126) > 0.00001 {
+		t.Errorf("mannWhitneyU with ties = %v, want 0.00126", p)
+	}
+}
+
+func TestCompareGolden(t *testing.T) {
+	old := &goldenFile{Results: []goldenResult{
+		{Backend: "generic", Op: "seal", Size: 16, Samples: []float64{100, 101, 99, 100, 102, 98, 100, 101}},
+		{Backend: "generic", Op: "open", Size: 16, Samples: []float64{100, 101, 99, 100, 102, 98, 100, 101}},
+	}}
+	new := &goldenFile{Results: []goldenResult{
+		{Backend: "generic", Op: "seal", Size: 16, Samples: []float64{120, 121, 119, 120, 122, 118, 120, 121}},
+		{Backend: "generic", Op: "open", Size: 16, Samples: []float64{101, 99, 100, 102, 98, 100, 101, 100}},
+		{Backend: "generic", Op: "seal", Size: 64, Samples: []float64{1}},
+	}}
+	rows := compareGolden(old, new, 0.05)
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	if r := rows[0]; !r.significant || math.Abs(r.change()-20) > 0.01 {
+		t.Errorf("seal: significant=%v change=%v, want a significant 20%% slowdown", r.significant, r.change())
+	}
+	if r := rows[1]; r.significant {
+		t.Errorf("open: p=%v, want no significant change", r.p)
+	}
+}
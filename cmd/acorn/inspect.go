@@ -0,0 +1,92 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+
+	"github.com/magical/go-acorn/acornstream"
+	"github.com/magical/go-acorn/keyfile"
+)
+
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: acorn inspect [-k keyfile] [input]\n\n")
+		fmt.Fprintf(os.Stderr, "Inspect prints the header of an encrypted file without decrypting it.\n")
+		fmt.Fprintf(os.Stderr, "With -k, it also says whether the key id in the header is keyfile's.\n")
+		fmt.Fprintf(os.Stderr, "If the input is - or omitted, inspect reads standard input.\n\n")
+		fs.PrintDefaults()
+	}
+	keyFlag := fs.String("k", "", "compare the key id with the one in `keyfile`")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var key *keyfile.Key
+	if *keyFlag != "" {
+		var err error
+		if key, err = readKey(*keyFlag); err != nil {
+			return err
+		}
+	}
+	input := fs.Arg(0)
+	in, _, err := openInput(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	br := bufio.NewReader(in)
+	h, err := acornstream.ReadHeader(br)
+	if err != nil {
+		return err
+	}
+	// Count the rest of the input rather than trusting Stat,
+	// so that pipes work too.
+	n, err := io.Copy(ioutil.Discard, br)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+	if !isStdio(input) {
+		fmt.Fprintf(tw, "file:\t%s\n", input)
+	}
+	fmt.Fprintf(tw, "version:\t%d\n", h.Version)
+	fmt.Fprintf(tw, "chunk size:\t%d\n", h.ChunkSize)
+	if h.KeyID == ([8]byte{}) {
+		fmt.Fprintf(tw, "key id:\tnone\n")
+	} else {
+		fmt.Fprintf(tw, "key id:\t%x\n", h.KeyID)
+	}
+	if key != nil {
+		switch h.KeyID {
+		case [8]byte{}:
+			fmt.Fprintf(tw, "key file:\tunknown; header has no key id\n")
+		case key.ID:
+			fmt.Fprintf(tw, "key file:\tmatches\n")
+		default:
+			fmt.Fprintf(tw, "key file:\tdoes not match (key id %x)\n", key.ID)
+		}
+	}
+	fmt.Fprintf(tw, "nonce prefix:\t%x\n", h.Prefix)
+	if h.Detached {
+		fmt.Fprintf(tw, "tags:\tdetached\n")
+	} else {
+		fmt.Fprintf(tw, "tags:\tattached\n")
+	}
+	if size, err := h.PlaintextSize(acornstream.HeaderSize + n); err != nil {
+		fmt.Fprintf(tw, "plaintext size:\tinvalid (%v)\n", err)
+	} else {
+		fmt.Fprintf(tw, "plaintext size:\t%d\n", size)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,46 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/magical/go-acorn/keyfile"
+)
+
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: acorn keygen [-c comment] [-p] keyfile\n\n")
+		fmt.Fprintf(os.Stderr, "Keygen generates a new random key and writes it to keyfile,\n")
+		fmt.Fprintf(os.Stderr, "which must not already exist.\n")
+		fmt.Fprintf(os.Stderr, "With -p, the key is protected by the passphrase in ACORN_PASSPHRASE.\n\n")
+		fs.PrintDefaults()
+	}
+	comment := fs.String("c", "", "store `comment` in the key file")
+	protect := fs.Bool("p", false, "protect the key with a passphrase")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var pass []byte
+	if *protect {
+		var err error
+		if pass, err = passphrase(); err != nil {
+			return err
+		}
+	}
+	k, err := keyfile.Generate()
+	if err != nil {
+		return err
+	}
+	k.Comment = *comment
+	if err := keyfile.Write(fs.Arg(0), k, pass); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "key id %x\n", k.ID)
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Command acorn is a command-line tool for the ACORN-128 cipher.
+//
+// Usage:
+//
+//	acorn <command> [arguments]
+//
+// The commands are:
+//
+//	agent    hold keys in memory and serve Seal and Open requests
+//	bench    measure Seal and Open throughput
+//	decrypt  decrypt a file or directory
+//	encrypt  encrypt a file or directory
+//	golden   save benchmark results and compare them with a baseline
+//	inspect  print the header of an encrypted file
+//	keygen   generate a new key file
+//	vectors  write test vectors as JSON
+//
+// Run "acorn <command> -h" for help with a specific command.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	short string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"agent", "hold keys in memory and serve Seal and Open requests", runAgent},
+	{"bench", "measure Seal and Open throughput", runBench},
+	{"decrypt", "decrypt a file or directory", runDecrypt},
+	{"encrypt", "encrypt a file or directory", runEncrypt},
+	{"golden", "save benchmark results and compare them with a baseline", runGolden},
+	{"inspect", "print the header of an encrypted file", runInspect},
+	{"keygen", "generate a new key file", runKeygen},
+	{"vectors", "write test vectors as JSON", runVectors},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: acorn <command> [arguments]\n\n")
+	fmt.Fprintf(os.Stderr, "The commands are:\n\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "    %-8s %s\n", c.name, c.short)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	name := os.Args[1]
+	for _, c := range commands {
+		if c.name == name {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "acorn %s: %v\n", name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "acorn: unknown command %q\n", name)
+	usage()
+}
@@ -0,0 +1,81 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// An atomicFile is an output file that is written under a temporary name
+// and renamed into place only once it is complete, so that a crash or
+// error partway through never leaves a truncated file behind.
+type atomicFile struct {
+	*os.File
+	name string // final name
+}
+
+// createAtomic creates a temporary file in the same directory as name,
+// so that it can later be renamed over name.
+func createAtomic(name string, mode os.FileMode) (*atomicFile, error) {
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(mode.Perm()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &atomicFile{File: f, name: name}, nil
+}
+
+// Commit flushes the file to stable storage and renames it into place.
+func (f *atomicFile) Commit() error {
+	if err := f.Sync(); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+	if err := os.Rename(f.File.Name(), f.name); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+	return syncDir(filepath.Dir(f.name))
+}
+
+// Abort discards the file.
+func (f *atomicFile) Abort() {
+	f.File.Close()
+	os.Remove(f.File.Name())
+}
+
+// finish commits the file if err is nil and aborts it otherwise.
+func (f *atomicFile) finish(err error) error {
+	if err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
+
+// syncDir flushes a directory entry to stable storage,
+// so that a completed rename survives a crash.
+func syncDir(name string) error {
+	d, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	// Not every platform can sync a directory,
+	// so errors from Sync are ignored.
+	d.Sync()
+	return d.Close()
+}
@@ -0,0 +1,67 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acorn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "out")
+
+	// an aborted file leaves nothing behind
+	f, err := createAtomic(name, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("partial")
+	if err := f.finish(errors.New("oops")); err == nil {
+		t.Errorf("finish returned nil error")
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("aborted file left %d entries behind", len(entries))
+	}
+
+	// a committed file appears all at once with the requested mode
+	f, err = createAtomic(name, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("complete")
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("output exists before commit")
+	}
+	if err := f.finish(nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil || string(b) != "complete" {
+		t.Errorf("ReadFile = %q, %v; want %q", b, err, "complete")
+	}
+	if fi, err := os.Stat(name); err != nil || fi.Mode().Perm() != 0640 {
+		t.Errorf("mode = %v, want %v", fi.Mode().Perm(), os.FileMode(0640))
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("found %d entries, want 1", len(entries))
+	}
+}
+
+func TestIsTerminalDevNull(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer f.Close()
+	if isTerminal(f) {
+		t.Errorf("isTerminal(%s) = true", os.DevNull)
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd,!windows
+
+package main
+
+import "os"
+
+// isTerminal reports whether f is probably a terminal. Without a way to
+// ask, it guesses that any character device other than os.DevNull is.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(fi, null)
+}
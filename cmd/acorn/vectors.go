@@ -0,0 +1,163 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+
+	"github.com/magical/go-acorn"
+	"github.com/magical/go-acorn/acornstream"
+)
+
+// vectorFile is the JSON document written by acorn vectors.
+// Byte strings are hex encoded.
+type vectorFile struct {
+	Algorithm string         `json:"algorithm"`
+	KeySize   int            `json:"key_size"`
+	NonceSize int            `json:"nonce_size"`
+	TagSize   int            `json:"tag_size"`
+	AEAD      []aeadVector   `json:"aead"`
+	Stream    []streamVector `json:"stream"`
+}
+
+type aeadVector struct {
+	ID    int    `json:"id"`
+	Key   string `json:"key"`
+	Nonce string `json:"nonce"`
+	AD    string `json:"ad"`
+	PT    string `json:"pt"`
+	CT    string `json:"ct"`
+	Tag   string `json:"tag"`
+}
+
+// A streamVector is an acornstream stream. Stream is the whole
+// encrypted stream, header included; Tags holds the tags if they
+// are detached, and is empty otherwise.
+type streamVector struct {
+	ID        int    `json:"id"`
+	Key       string `json:"key"`
+	ChunkSize int    `json:"chunk_size"`
+	KeyID     string `json:"key_id"`
+	Detached  bool   `json:"detached"`
+	PT        string `json:"pt"`
+	Stream    string `json:"stream"`
+	Tags      string `json:"tags"`
+}
+
+func runVectors(args []string) error {
+	fs := flag.NewFlagSet("vectors", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: acorn vectors [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Vectors writes test vectors for the AEAD and the stream format as JSON,\n")
+		fmt.Fprintf(os.Stderr, "for checking other implementations against this one. The inputs are\n")
+		fmt.Fprintf(os.Stderr, "pseudo-random, so the same seed always gives the same vectors.\n\n")
+		fs.PrintDefaults()
+	}
+	seed := fs.Int64("seed", 1, "seed for the pseudo-random inputs")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	v, err := makeVectors(*seed)
+	if err != nil {
+		return err
+	}
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	return e.Encode(v)
+}
+
+// The message lengths cover every tail length of a 4-byte word,
+// the boundaries around a tag and a few larger sizes.
+var (
+	vectorPTSizes = []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 15, 16, 17, 31, 32, 33, 64, 100, 255, 256, 1024}
+	vectorADSizes = []int{0, 1, 4, 13, 16, 33}
+)
+
+func makeVectors(seed int64) (*vectorFile, error) {
+	r := rand.New(rand.NewSource(seed))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		r.Read(b)
+		return b
+	}
+	v := &vectorFile{
+		Algorithm: "ACORN-128",
+		KeySize:   acorn.KeySize,
+		NonceSize: acorn.NonceSize,
+		TagSize:   acorn.TagSize,
+		AEAD:      []aeadVector{},
+		Stream:    []streamVector{},
+	}
+	for _, n := range vectorPTSizes {
+		for _, adlen := range vectorADSizes {
+			key, nonce := random(acorn.KeySize), random(acorn.NonceSize)
+			ad, pt := random(adlen), random(n)
+			c := acorn.NewAEAD(key).Seal(nil, nonce, pt, ad)
+			v.AEAD = append(v.AEAD, aeadVector{
+				ID:    len(v.AEAD) + 1,
+				Key:   hex.EncodeToString(key),
+				Nonce: hex.EncodeToString(nonce),
+				AD:    hex.EncodeToString(ad),
+				PT:    hex.EncodeToString(pt),
+				CT:    hex.EncodeToString(c[:n]),
+				Tag:   hex.EncodeToString(c[n:]),
+			})
+		}
+	}
+	for _, chunk := range []int{1, 16, 64} {
+		for _, n := range []int{0, 1, chunk - 1, chunk, chunk + 1, 3*chunk + 5} {
+			for _, detached := range []bool{false, true} {
+				sv, err := streamVectorFor(r, chunk, random(n), detached)
+				if err != nil {
+					return nil, err
+				}
+				sv.ID = len(v.Stream) + 1
+				v.Stream = append(v.Stream, sv)
+			}
+		}
+	}
+	return v, nil
+}
+
+func streamVectorFor(r io.Reader, chunk int, pt []byte, detached bool) (streamVector, error) {
+	key := make([]byte, acorn.KeySize)
+	c := &acornstream.Config{ChunkSize: chunk, Rand: r}
+	if _, err := io.ReadFull(r, key); err != nil {
+		return streamVector{}, err
+	}
+	if _, err := io.ReadFull(r, c.KeyID[:]); err != nil {
+		return streamVector{}, err
+	}
+	var out, tags bytes.Buffer
+	if detached {
+		c.Tags = &tags
+	}
+	w, err := acornstream.NewWriterConfig(&out, key, c)
+	if err != nil {
+		return streamVector{}, err
+	}
+	if _, err := w.Write(pt); err != nil {
+		return streamVector{}, err
+	}
+	if err := w.Close(); err != nil {
+		return streamVector{}, err
+	}
+	return streamVector{
+		Key:       hex.EncodeToString(key),
+		ChunkSize: chunk,
+		KeyID:     hex.EncodeToString(c.KeyID[:]),
+		Detached:  detached,
+		PT:        hex.EncodeToString(pt),
+		Stream:    hex.EncodeToString(out.Bytes()),
+		Tags:      hex.EncodeToString(tags.Bytes()),
+	}, nil
+}
@@ -0,0 +1,68 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/magical/go-acorn"
+	"github.com/magical/go-acorn/acornstream"
+)
+
+// TestVectors checks that the generated vectors survive a JSON round
+// trip, are the same every time, and decrypt to their plaintexts.
+func TestVectors(t *testing.T) {
+	v, err := makeVectors(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got vectorFile
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := makeVectors(1)
+	if !reflect.DeepEqual(&got, again) {
+		t.Fatal("vectors differ between runs with the same seed")
+	}
+
+	unhex := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	for _, tv := range got.AEAD {
+		c := append(unhex(tv.CT), unhex(tv.Tag)...)
+		p, err := acorn.NewAEAD(unhex(tv.Key)).Open(nil, unhex(tv.Nonce), c, unhex(tv.AD))
+		if err != nil || !bytes.Equal(p, unhex(tv.PT)) {
+			t.Errorf("aead vector %d: Open = %x, %v", tv.ID, p, err)
+		}
+	}
+	for _, tv := range got.Stream {
+		in := bytes.NewReader(unhex(tv.Stream))
+		var r *acornstream.Reader
+		if tv.Detached {
+			r, err = acornstream.NewDetachedReader(in, bytes.NewReader(unhex(tv.Tags)), unhex(tv.Key))
+		} else {
+			r, err = acornstream.NewReader(in, unhex(tv.Key))
+		}
+		if err != nil {
+			t.Errorf("stream vector %d: %v", tv.ID, err)
+			continue
+		}
+		p, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(p, unhex(tv.PT)) {
+			t.Errorf("stream vector %d: read %x, %v", tv.ID, p, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Command age-plugin-acorn is an age plugin for ACORN-128 keys.
+//
+// It lets age (https://age-encryption.org) wrap the file keys of
+// age-encrypted files with ACORN-128 keys, so that files can be shared
+// with anyone who holds an acorn key, using the tools they already have
+// for age. Install it somewhere in $PATH, and create an identity with
+//
+//	age-plugin-acorn -generate > key.txt
+//
+// or from an existing acorn key file with
+//
+//	age-plugin-acorn -convert keyfile > key.txt
+//
+// ACORN keys are symmetric, so there is no public recipient to share;
+// both encrypting and decrypting need the identity:
+//
+//	age -e -i key.txt -o secret.age secret
+//	age -d -i key.txt -o secret secret.age
+//
+// The identity is the key, Bech32-encoded with the prefix
+// AGE-PLUGIN-ACORN-. Each file key is sealed in a stanza
+//
+//	-> acorn <nonce>
+//	<ciphertext and tag>
+//
+// with a random nonce, and the additional data "age-plugin-acorn file key".
+//
+// If the key file is protected by a passphrase, -convert takes it
+// from the ACORN_PASSPHRASE environment variable.
+package main
+
+import (
+	"bufio"
+	cryptorand "crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/magical/go-acorn"
+	"github.com/magical/go-acorn/keyfile"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: age-plugin-acorn -generate\n")
+		fmt.Fprintf(os.Stderr, "       age-plugin-acorn -convert keyfile\n\n")
+		fmt.Fprintf(os.Stderr, "Age-plugin-acorn prints an age identity for a new random key,\n")
+		fmt.Fprintf(os.Stderr, "or for the key in an acorn key file. It is otherwise run by age.\n\n")
+		flag.PrintDefaults()
+	}
+	state := flag.String("age-plugin", "", "run the plugin `state machine` (used by age)")
+	generate := flag.Bool("generate", false, "generate a new identity")
+	convert := flag.String("convert", "", "print the identity for the key in `keyfile`")
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch {
+	case *state != "":
+		c := &conn{r: bufio.NewReader(os.Stdin), w: os.Stdout}
+		switch *state {
+		case "recipient-v1":
+			err = recipientV1(c)
+		case "identity-v1":
+			err = identityV1(c)
+		default:
+			err = fmt.Errorf("unknown state machine %q", *state)
+		}
+	case *generate:
+		key := make([]byte, acorn.KeySize)
+		if _, err = io.ReadFull(cryptorand.Reader, key); err == nil {
+			err = printIdentity(key, "")
+		}
+	case *convert != "":
+		var k *keyfile.Key
+		if k, err = keyfile.Read(*convert, passphrase); err == nil {
+			err = printIdentity(k.Key, fmt.Sprintf("# acorn key id: %x\n", k.ID))
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "age-plugin-acorn: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// printIdentity prints the identity for key, in the format of age-keygen.
+func printIdentity(key []byte, comment string) error {
+	if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprintf(os.Stderr, "age-plugin-acorn: warning: writing a secret key to a terminal\n")
+	}
+	_, err := fmt.Printf("# created: %s\n%s%s\n",
+		time.Now().Format(time.RFC3339), comment, formatIdentity(key))
+	return err
+}
+
+func passphrase() ([]byte, error) {
+	p := os.Getenv("ACORN_PASSPHRASE")
+	if p == "" {
+		return nil, errors.New("key is protected by a passphrase; set ACORN_PASSPHRASE")
+	}
+	return []byte(p), nil
+}
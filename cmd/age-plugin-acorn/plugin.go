@@ -0,0 +1,256 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package main
+
+import (
+	"bufio"
+	"crypto/cipher"
+	cryptorand "crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/magical/go-acorn"
+)
+
+const (
+	identityHRP  = "AGE-PLUGIN-ACORN-"
+	recipientHRP = "age1acorn"
+
+	// stanzaType is the type of the stanzas in age headers
+	// that hold a file key sealed with an ACORN key.
+	stanzaType = "acorn"
+
+	// fileKeySize is the size of an age file key.
+	fileKeySize = 16
+)
+
+// stanzaAD is the additional data for sealing file keys,
+// so that they can't be confused with other uses of the key.
+var stanzaAD = []byte("age-plugin-acorn file key")
+
+// parseIdentity returns the key in an identity.
+func parseIdentity(s string) ([]byte, error) {
+	hrp, key, err := bech32Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if hrp != strings.ToLower(identityHRP) || len(key) != acorn.KeySize {
+		return nil, errors.New("not an acorn identity")
+	}
+	return key, nil
+}
+
+// formatIdentity returns the identity for key.
+func formatIdentity(key []byte) string {
+	return strings.ToUpper(bech32Encode(identityHRP, key))
+}
+
+// A conn is one side of a plugin protocol session, talking to age.
+type conn struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+// read reads a command from age.
+func (c *conn) read() (*stanza, error) {
+	return readStanza(c.r)
+}
+
+// send sends a command to age in the second phase of the protocol
+// and waits for its response.
+func (c *conn) send(typ string, body []byte, args ...string) error {
+	if err := writeStanza(c.w, &stanza{Type: typ, Args: args, Body: body}); err != nil {
+		return err
+	}
+	resp, err := c.read()
+	if err != nil {
+		return err
+	}
+	if resp.Type != "ok" {
+		return fmt.Errorf("age responded %q to %s", resp.Type, typ)
+	}
+	return nil
+}
+
+// done ends the second phase of the protocol.
+func (c *conn) done() error {
+	return writeStanza(c.w, &stanza{Type: "done"})
+}
+
+// A pluginError is an error to report to age, about the input
+// identified by args, such as "identity 0".
+type pluginError struct {
+	args []string
+	msg  string
+}
+
+// sendErrors reports errs to age and ends the session.
+func (c *conn) sendErrors(errs []pluginError) error {
+	for _, e := range errs {
+		if err := c.send("error", []byte(e.msg), e.args...); err != nil {
+			return err
+		}
+	}
+	return c.done()
+}
+
+// recipientV1 runs the recipient-v1 state machine, which wraps file keys.
+// Since ACORN keys are secret, files can only be encrypted to identities,
+// which age sends when it is run with -e -i.
+func recipientV1(c *conn) error {
+	var keys, fileKeys [][]byte
+	var errs []pluginError
+	recipients := 0
+	for {
+		s, err := c.read()
+		if err != nil {
+			return err
+		}
+		if s.Type == "done" {
+			break
+		}
+		switch s.Type {
+		case "add-recipient":
+			errs = append(errs, pluginError{
+				[]string{"recipient", strconv.Itoa(recipients)},
+				"acorn keys are secret; encrypt to an identity with -i instead",
+			})
+			recipients++
+		case "add-identity":
+			var key []byte
+			if len(s.Args) == 1 {
+				key, err = parseIdentity(s.Args[0])
+			} else {
+				err = errMalformed
+			}
+			if err != nil {
+				errs = append(errs, pluginError{
+					[]string{"identity", strconv.Itoa(len(keys))}, err.Error(),
+				})
+			}
+			keys = append(keys, key)
+		case "wrap-file-key":
+			if len(s.Body) != fileKeySize {
+				errs = append(errs, pluginError{[]string{"internal"}, "file key has the wrong length"})
+			}
+			fileKeys = append(fileKeys, s.Body)
+		}
+	}
+	if len(errs) != 0 {
+		return c.sendErrors(errs)
+	}
+
+	aeads := make([]cipher.AEAD, len(keys))
+	for i, key := range keys {
+		aeads[i] = acorn.NewAEAD(key)
+	}
+	for i, fk := range fileKeys {
+		for _, a := range aeads {
+			nonce := make([]byte, acorn.NonceSize)
+			if _, err := io.ReadFull(cryptorand.Reader, nonce); err != nil {
+				return err
+			}
+			body := a.Seal(nil, nonce, fk, stanzaAD)
+			if err := c.send("recipient-stanza", body, strconv.Itoa(i), stanzaType, b64.EncodeToString(nonce)); err != nil {
+				return err
+			}
+		}
+	}
+	return c.done()
+}
+
+// fileStanza is a stanza from the header of the file with index file.
+type fileStanza struct {
+	file, index int
+	*stanza
+}
+
+// identityV1 runs the identity-v1 state machine, which unwraps file keys.
+func identityV1(c *conn) error {
+	var keys [][]byte
+	var errs []pluginError
+	var stanzas []fileStanza
+	counts := make(map[int]int) // stanzas seen per file
+	for {
+		s, err := c.read()
+		if err != nil {
+			return err
+		}
+		if s.Type == "done" {
+			break
+		}
+		switch s.Type {
+		case "add-identity":
+			var key []byte
+			if len(s.Args) == 1 {
+				key, err = parseIdentity(s.Args[0])
+			} else {
+				err = errMalformed
+			}
+			if err != nil {
+				errs = append(errs, pluginError{
+					[]string{"identity", strconv.Itoa(len(keys))}, err.Error(),
+				})
+			}
+			keys = append(keys, key)
+		case "recipient-stanza":
+			if len(s.Args) < 2 {
+				continue
+			}
+			file, err := strconv.Atoi(s.Args[0])
+			if err != nil || file < 0 {
+				continue
+			}
+			index := counts[file]
+			counts[file]++
+			if s.Args[1] == stanzaType {
+				stanzas = append(stanzas, fileStanza{file, index,
+					&stanza{Type: s.Args[1], Args: s.Args[2:], Body: s.Body}})
+			}
+		}
+	}
+
+	if len(errs) != 0 {
+		return c.sendErrors(errs)
+	}
+
+	aeads := make([]cipher.AEAD, len(keys))
+	for i, key := range keys {
+		aeads[i] = acorn.NewAEAD(key)
+	}
+	sort.SliceStable(stanzas, func(i, j int) bool { return stanzas[i].file < stanzas[j].file })
+	unwrapped := make(map[int]bool)
+	for _, s := range stanzas {
+		if unwrapped[s.file] {
+			continue
+		}
+		var nonce []byte
+		if len(s.Args) == 1 {
+			nonce, _ = b64.DecodeString(s.Args[0])
+		}
+		if len(nonce) != acorn.NonceSize || len(s.Body) != fileKeySize+acorn.TagSize {
+			err := c.send("error", []byte("malformed acorn stanza"),
+				"stanza", strconv.Itoa(s.file), strconv.Itoa(s.index))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		for _, a := range aeads {
+			fk, err := a.Open(nil, nonce, s.Body, stanzaAD)
+			if err != nil {
+				continue
+			}
+			if err := c.send("file-key", fk, strconv.Itoa(s.file)); err != nil {
+				return err
+			}
+			unwrapped[s.file] = true
+			break
+		}
+	}
+	return c.done()
+}
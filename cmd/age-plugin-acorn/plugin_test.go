@@ -0,0 +1,157 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBech32(t *testing.T) {
+	// valid checksums from BIP 173
+	for _, s := range []string{
+		"A12UEL5L",
+		"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+	} {
+		if _, _, err := bech32Decode(s); err != nil {
+			t.Errorf("bech32Decode(%q): %v", s, err)
+		}
+	}
+	for _, s := range []string{"A1G7SGD8", "10a06t8", "1qzzfhee", "abcdef1QPZRY9x8gf2tvdw0s3jn54khce6mua7lmqqqxw"} {
+		if _, _, err := bech32Decode(s); err == nil {
+			t.Errorf("bech32Decode(%q) succeeded", s)
+		}
+	}
+
+	key := []byte("0123456789abcdef")
+	id := formatIdentity(key)
+	if !strings.HasPrefix(id, "AGE-PLUGIN-ACORN-1") {
+		t.Errorf("identity %s has the wrong prefix", id)
+	}
+	if got, err := parseIdentity(id); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("parseIdentity(%s) = %x, %v", id, got, err)
+	}
+}
+
+func TestStanza(t *testing.T) {
+	for _, n := range []int{0, 1, 47, 48, 49, 96, 100} {
+		s := &stanza{Type: "t", Args: []string{"a", "b"}, Body: bytes.Repeat([]byte{'x'}, n)}
+		var buf bytes.Buffer
+		if err := writeStanza(&buf, s); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readStanza(bufio.NewReader(&buf))
+		if err != nil {
+			t.Fatalf("%d byte body: %v", n, err)
+		}
+		if got.Type != s.Type || strings.Join(got.Args, " ") != "a b" || !bytes.Equal(got.Body, s.Body) {
+			t.Errorf("%d byte body: read %+v", n, got)
+		}
+	}
+	for _, s := range []string{"", "-> \n\n", "->  a\n\n", "-> a\n", "-> a\n!!\n"} {
+		if _, err := readStanza(bufio.NewReader(strings.NewReader(s))); err == nil {
+			t.Errorf("readStanza(%q) succeeded", s)
+		}
+	}
+}
+
+// session runs a plugin state machine, playing age: it sends cmds,
+// then answers every command from the plugin with ok until it is done,
+// and returns those commands.
+func session(t *testing.T, run func(*conn) error, cmds []*stanza) []*stanza {
+	toPlugin, ageW := io.Pipe()
+	ageR, fromPlugin := io.Pipe()
+	c := &conn{r: bufio.NewReader(toPlugin), w: fromPlugin}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- run(c)
+		fromPlugin.Close()
+	}()
+	go func() {
+		for _, s := range cmds {
+			writeStanza(ageW, s)
+		}
+	}()
+	var got []*stanza
+	r := bufio.NewReader(ageR)
+	for {
+		s, err := readStanza(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Type == "done" {
+			break
+		}
+		got = append(got, s)
+		writeStanza(ageW, &stanza{Type: "ok"})
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	id := formatIdentity(key)
+	fileKey := []byte("file key 16 byte")
+
+	wrapped := session(t, recipientV1, []*stanza{
+		{Type: "add-identity", Args: []string{id}},
+		{Type: "wrap-file-key", Body: fileKey},
+		{Type: "done"},
+	})
+	if len(wrapped) != 1 || wrapped[0].Type != "recipient-stanza" {
+		t.Fatalf("recipient-v1 returned %+v", wrapped)
+	}
+	rs := wrapped[0]
+	if rs.Args[0] != "0" || rs.Args[1] != stanzaType {
+		t.Fatalf("recipient-stanza args = %q", rs.Args)
+	}
+
+	unwrapped := session(t, identityV1, []*stanza{
+		{Type: "add-identity", Args: []string{id}},
+		{Type: "recipient-stanza", Args: []string{"0", "X25519", "abc"}, Body: []byte("other")},
+		{Type: "recipient-stanza", Args: rs.Args, Body: rs.Body},
+		{Type: "done"},
+	})
+	if len(unwrapped) != 1 || unwrapped[0].Type != "file-key" || !bytes.Equal(unwrapped[0].Body, fileKey) {
+		t.Fatalf("identity-v1 returned %+v", unwrapped)
+	}
+
+	// a different key finds nothing
+	other := formatIdentity([]byte("fedcba9876543210"))
+	if got := session(t, identityV1, []*stanza{
+		{Type: "add-identity", Args: []string{other}},
+		{Type: "recipient-stanza", Args: rs.Args, Body: rs.Body},
+		{Type: "done"},
+	}); len(got) != 0 {
+		t.Errorf("identity-v1 with the wrong key returned %+v", got)
+	}
+
+	// a malformed stanza is reported by its position in the file
+	got := session(t, identityV1, []*stanza{
+		{Type: "add-identity", Args: []string{id}},
+		{Type: "recipient-stanza", Args: []string{"0", "X25519", "abc"}, Body: []byte("other")},
+		{Type: "recipient-stanza", Args: rs.Args, Body: rs.Body[1:]},
+		{Type: "done"},
+	})
+	if len(got) != 1 || got[0].Type != "error" || strings.Join(got[0].Args, " ") != "stanza 0 1" {
+		t.Errorf("identity-v1 with a malformed stanza returned %+v", got)
+	}
+
+	// recipients are refused
+	got = session(t, recipientV1, []*stanza{
+		{Type: "add-recipient", Args: []string{"age1acorn1xyz"}},
+		{Type: "wrap-file-key", Body: fileKey},
+		{Type: "done"},
+	})
+	if len(got) != 1 || got[0].Type != "error" || strings.Join(got[0].Args, " ") != "recipient 0" {
+		t.Errorf("recipient-v1 with a recipient returned %+v", got)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+// A stanza is the unit of the age plugin protocol, and of age headers:
+//
+//	-> type arg...
+//	base64 body, wrapped at 64 columns
+//
+// The body always ends with a line shorter than 64 columns,
+// which is empty if the body fills its last line exactly.
+type stanza struct {
+	Type string
+	Args []string
+	Body []byte
+}
+
+const stanzaColumns = 64
+
+var b64 = base64.RawStdEncoding.Strict()
+
+var errMalformed = errors.New("malformed stanza")
+
+// readStanza reads the next stanza from r.
+func readStanza(r *bufio.Reader) (*stanza, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "-> ") {
+		return nil, errMalformed
+	}
+	f := strings.Split(line[len("-> "):], " ")
+	for _, a := range f {
+		if a == "" {
+			return nil, errMalformed
+		}
+	}
+	s := &stanza{Type: f[0], Args: f[1:]}
+	for {
+		line, err := readLine(r)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(line) > stanzaColumns {
+			return nil, errMalformed
+		}
+		b, err := b64.DecodeString(line)
+		if err != nil {
+			return nil, errMalformed
+		}
+		s.Body = append(s.Body, b...)
+		if len(line) < stanzaColumns {
+			return s, nil
+		}
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return "", err
+	}
+	return line[:len(line)-1], nil
+}
+
+// writeStanza writes s to w.
+func writeStanza(w io.Writer, s *stanza) error {
+	var b strings.Builder
+	b.WriteString("-> ")
+	b.WriteString(strings.Join(append([]string{s.Type}, s.Args...), " "))
+	b.WriteByte('\n')
+	body := b64.EncodeToString(s.Body)
+	for len(body) >= stanzaColumns {
+		b.WriteString(body[:stanzaColumns])
+		b.WriteByte('\n')
+		body = body[stanzaColumns:]
+	}
+	b.WriteString(body)
+	b.WriteByte('\n')
+	_, err := io.WriteString(w, b.String())
+	return err
+}
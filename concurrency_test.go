@@ -0,0 +1,120 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentUse shares one AEAD between many goroutines, each
+// sealing and opening its own messages. It is most useful under -race.
+func TestConcurrentUse(t *testing.T) {
+	key := make([]byte, KeySize)
+	for name, a := range contractAEADs(key) {
+		t.Run(name, func(t *testing.T) {
+			testConcurrentUse(t, a)
+		})
+	}
+}
+
+func testConcurrentUse(t *testing.T, a interface {
+	Seal(dst, nonce, plaintext, ad []byte) []byte
+	Open(dst, nonce, ciphertext, ad []byte) ([]byte, error)
+}) {
+	const goroutines = 16
+	iters := 200
+	if testing.Short() {
+		iters = 20
+	}
+	// Work out the expected results serially first.
+	message := func(g, i int) (nonce, p, ad []byte) {
+		nonce = make([]byte, NonceSize)
+		nonce[0], nonce[1] = byte(g), byte(i)
+		p = bytes.Repeat([]byte{byte(g)}, (g*7+i)%300)
+		ad = []byte(fmt.Sprint(g, i))
+		return
+	}
+	want := make([][][]byte, goroutines)
+	for g := range want {
+		for i := 0; i < iters; i++ {
+			nonce, p, ad := message(g, i)
+			want[g] = append(want[g], a.Seal(nil, nonce, p, ad))
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			var dst []byte
+			for i := 0; i < iters; i++ {
+				nonce, p, ad := message(g, i)
+				dst = a.Seal(dst[:0], nonce, p, ad)
+				if !bytes.Equal(dst, want[g][i]) {
+					errs <- fmt.Errorf("goroutine %d: Seal #%d gave a different result", g, i)
+					return
+				}
+				out, err := a.Open(nil, nonce, dst, ad)
+				if err != nil || !bytes.Equal(out, p) {
+					errs <- fmt.Errorf("goroutine %d: Open #%d = %v", g, i, err)
+					return
+				}
+				dst[0] ^= 1
+				if _, err := a.Open(nil, nonce, dst, ad); err == nil {
+					errs <- fmt.Errorf("goroutine %d: Open #%d accepted a tampered message", g, i)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// TestConcurrentBatch runs parallel OpenBatch calls, which themselves
+// spread work over several goroutines, on one shared AEAD.
+func TestConcurrentBatch(t *testing.T) {
+	a := NewAEAD(make([]byte, KeySize)).(Batch)
+	const n = 100
+	nonces := make([][]byte, n)
+	plaintexts := make([][]byte, n)
+	ads := make([][]byte, n)
+	sealed := make([][]byte, n)
+	for i := range nonces {
+		nonces[i] = make([]byte, NonceSize)
+		nonces[i][0] = byte(i)
+		plaintexts[i] = bytes.Repeat([]byte{byte(i)}, i%3*17)
+		ads[i] = []byte{byte(i)}
+	}
+	a.SealBatch(sealed, nonces, plaintexts, ads)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dst := make([][]byte, n)
+			for i, err := range a.OpenBatch(dst, nonces, sealed, ads, true) {
+				if err != nil || !bytes.Equal(dst[i], plaintexts[i]) {
+					t.Errorf("OpenBatch message %d = %x, %v", i, dst[i], err)
+				}
+			}
+			out := make([][]byte, n)
+			a.SealBatch(out, nonces, plaintexts, ads)
+			for i := range out {
+				if !bytes.Equal(out[i], sealed[i]) {
+					t.Errorf("SealBatch message %d differs", i)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,123 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"math/rand"
+	"testing"
+	"testing/quick"
+)
+
+// These tests check the cipher.AEAD contract, which is easy to break
+// with an optimization that slices dst or src slightly wrong.
+
+func contractAEADs(key []byte) map[string]cipher.AEAD {
+	return map[string]cipher.AEAD{
+		"aead":   NewAEAD(key),
+		"engine": NewAEADEngine(key, NewEngine),
+	}
+}
+
+// TestQuickRoundTrip checks that Open undoes Seal and that both
+// append to dst without disturbing what is already there.
+func TestQuickRoundTrip(t *testing.T) {
+	for name, a := range contractAEADs(make([]byte, KeySize)) {
+		f := func(nonce [NonceSize]byte, prefix, p, ad []byte) bool {
+			prefix = append([]byte(nil), prefix...)
+			sealed := a.Seal(prefix, nonce[:], p, ad)
+			if !bytes.Equal(sealed[:len(prefix)], prefix) || len(sealed) != len(prefix)+len(p)+TagSize {
+				return false
+			}
+			c := sealed[len(prefix):]
+			opened, err := a.Open(prefix, nonce[:], c, ad)
+			return err == nil && bytes.Equal(opened[:len(prefix)], prefix) && bytes.Equal(opened[len(prefix):], p)
+		}
+		if err := quick.Check(f, nil); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+// TestContractLengths checks every plaintext and additional data length
+// from 0 to 129, so that every tail length of every word size is covered,
+// with dst reused at exactly the capacity needed and aliased with src.
+func TestContractLengths(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	key := make([]byte, KeySize)
+	r.Read(key)
+	nonce := make([]byte, NonceSize)
+	for name, a := range contractAEADs(key) {
+		for n := 0; n <= 129; n++ {
+			for _, adlen := range []int{0, 1, 3, 4, 5, 16, 33, n} {
+				r.Read(nonce)
+				p := make([]byte, n)
+				ad := make([]byte, adlen)
+				r.Read(p)
+				r.Read(ad)
+				want := a.Seal(nil, nonce, p, ad)
+
+				// dst with exactly the capacity needed must be used, not reallocated
+				dst := make([]byte, 3, 3+n+TagSize)
+				dst[0], dst[1], dst[2] = 1, 2, 3
+				got := a.Seal(dst, nonce, p, ad)
+				if &got[0] != &dst[0] || !bytes.Equal(got[:3], []byte{1, 2, 3}) || !bytes.Equal(got[3:], want) {
+					t.Fatalf("%s: Seal(len=%d, adlen=%d) into exact-capacity dst = %x, want 010203%x", name, n, adlen, got, want)
+				}
+				opened, err := a.Open(dst[:3], nonce, want, ad)
+				if err != nil || &opened[0] != &dst[0] || !bytes.Equal(opened[3:], p) {
+					t.Fatalf("%s: Open(len=%d, adlen=%d) into reused dst = %x, %v", name, n, adlen, opened, err)
+				}
+
+				// in place: dst is src[:0], with room for the tag
+				buf := make([]byte, n, n+TagSize)
+				copy(buf, p)
+				sealed := a.Seal(buf[:0], nonce, buf, ad)
+				if !bytes.Equal(sealed, want) {
+					t.Fatalf("%s: in-place Seal(len=%d, adlen=%d) = %x, want %x", name, n, adlen, sealed, want)
+				}
+				opened, err = a.Open(sealed[:0], nonce, sealed, ad)
+				if err != nil || !bytes.Equal(opened, p) {
+					t.Fatalf("%s: in-place Open(len=%d, adlen=%d) = %x, %v, want %x", name, n, adlen, opened, err, p)
+				}
+
+				// failed Open leaves dst as it was and returns no plaintext
+				bad := append([]byte(nil), want...)
+				bad[r.Intn(len(bad))] ^= 0x80
+				dst = make([]byte, 1, 1+n)
+				dst[0] = 9
+				out, err := a.Open(dst, nonce, bad, ad)
+				if err == nil || len(out) != 1 || out[0] != 9 {
+					t.Fatalf("%s: Open(len=%d, adlen=%d) of tampered message = %x, %v", name, n, adlen, out, err)
+				}
+				if spare := dst[1:cap(dst)]; n > 0 && !bytes.Equal(spare, make([]byte, n)) {
+					t.Fatalf("%s: Open(len=%d, adlen=%d) of tampered message left %x in dst", name, n, adlen, spare)
+				}
+			}
+		}
+	}
+}
+
+// TestContractEmpty checks that nil and empty slices are interchangeable.
+func TestContractEmpty(t *testing.T) {
+	nonce := make([]byte, NonceSize)
+	for name, a := range contractAEADs(make([]byte, KeySize)) {
+		want := a.Seal(nil, nonce, nil, nil)
+		if len(want) != TagSize {
+			t.Fatalf("%s: Seal of nothing = %x", name, want)
+		}
+		if got := a.Seal([]byte{}, nonce, []byte{}, []byte{}); !bytes.Equal(got, want) {
+			t.Errorf("%s: Seal with empty slices = %x, want %x", name, got, want)
+		}
+		for _, ad := range [][]byte{nil, {}} {
+			p, err := a.Open(nil, nonce, want, ad)
+			if err != nil || len(p) != 0 {
+				t.Errorf("%s: Open(ad=%#v) = %x, %v", name, ad, p, err)
+			}
+		}
+		if _, err := a.Open(nil, nonce, want, []byte{0}); err == nil {
+			t.Errorf("%s: Open accepted the wrong additional data", name)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import "encoding/binary"
+
+// CounterSaltSize is the length of the salt in a counter nonce.
+const CounterSaltSize = 7
+
+// CounterNonce returns the nonce for message number seq, for protocols
+// which number their messages instead of choosing nonces at random.
+// The layout is
+//
+//	salt [7]byte || direction byte || seq uint64, big-endian
+//
+// The salt, which may be nil for all zeros, can hold a per-session
+// value, and the direction keeps the two sides of a connection which
+// share a key apart. With both zero, the nonce is seq in the last 8 bytes
+// after 8 zero bytes, as in packages acornconn, acorndgram, and acornws.
+//
+// It panics if salt is longer than CounterSaltSize; a shorter salt
+// is padded with zeros at the end. As always, a nonce must not repeat
+// under one key: the caller must stop before seq wraps around.
+func CounterNonce(salt []byte, direction byte, seq uint64) []byte {
+	nonce := make([]byte, NonceSize)
+	PutCounterNonce(nonce, salt, direction, seq)
+	return nonce
+}
+
+// PutCounterNonce writes the nonce returned by CounterNonce into nonce,
+// which must be NonceSize bytes long, for callers that reuse a buffer.
+func PutCounterNonce(nonce, salt []byte, direction byte, seq uint64) {
+	if len(nonce) != NonceSize {
+		panic("acorn: invalid nonce length")
+	}
+	if len(salt) > CounterSaltSize {
+		panic("acorn: counter nonce salt too long")
+	}
+	n := copy(nonce, salt)
+	for i := n; i < CounterSaltSize; i++ {
+		nonce[i] = 0
+	}
+	nonce[CounterSaltSize] = direction
+	binary.BigEndian.PutUint64(nonce[CounterSaltSize+1:], seq)
+}
+
+// ParseCounterNonce splits a nonce in the layout of CounterNonce into
+// its parts. It panics if the nonce is not NonceSize bytes long.
+func ParseCounterNonce(nonce []byte) (salt [CounterSaltSize]byte, direction byte, seq uint64) {
+	if len(nonce) != NonceSize {
+		panic("acorn: invalid nonce length")
+	}
+	copy(salt[:], nonce)
+	return salt, nonce[CounterSaltSize], binary.BigEndian.Uint64(nonce[CounterSaltSize+1:])
+}
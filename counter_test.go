@@ -0,0 +1,46 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestCounterNonce(t *testing.T) {
+	for _, tc := range []struct {
+		salt      []byte
+		direction byte
+		seq       uint64
+		want      string
+	}{
+		{nil, 0, 0, "00000000000000000000000000000000"},
+		{nil, 0, 0x0102030405060708, "00000000000000000102030405060708"},
+		{nil, 1, 1, "00000000000000010000000000000001"},
+		{[]byte{0xaa, 0xbb}, 0, ^uint64(0), "aabb000000000000ffffffffffffffff"},
+		{[]byte("saltsal"), 2, 256, "73616c7473616c020000000000000100"},
+	} {
+		nonce := CounterNonce(tc.salt, tc.direction, tc.seq)
+		if got := hex.EncodeToString(nonce); got != tc.want {
+			t.Errorf("CounterNonce(%x, %d, %d) = %s, want %s", tc.salt, tc.direction, tc.seq, got, tc.want)
+		}
+		salt, dir, seq := ParseCounterNonce(nonce)
+		if string(salt[:len(tc.salt)]) != string(tc.salt) || dir != tc.direction || seq != tc.seq {
+			t.Errorf("ParseCounterNonce(%x) = %x, %d, %d", nonce, salt, dir, seq)
+		}
+	}
+
+	// PutCounterNonce overwrites whatever was in the buffer
+	buf := []byte("0123456789abcdef")
+	PutCounterNonce(buf, []byte{1}, 0, 2)
+	if got := hex.EncodeToString(buf); got != "01000000000000000000000000000002" {
+		t.Errorf("PutCounterNonce left %s", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("CounterNonce accepted an 8-byte salt")
+		}
+	}()
+	CounterNonce(make([]byte, 8), 0, 0)
+}
@@ -0,0 +1,25 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+// cpu records the CPU features that backends depend on. It is filled in
+// by cpu_x86.go, in the manner of golang.org/x/sys/cpu; a feature is
+// only detected once a backend uses it. Everything is false under the purego
+// and noasm build tags and with TinyGo, since the features are only of
+// use to assembly.
+var cpu struct {
+	hasAVX512F bool // x86 AVX-512 Foundation, with OS support for the ZMM registers
+}
+
+// Backend returns the name of the implementation that SealBatch and
+// OpenBatch prefer on this machine, such as "generic" or "avx512".
+// Batches too small for it may use a different one.
+// With the acorn_small build tag there are no backends,
+// and it returns "none".
+func Backend() string {
+	b := batchBackends()
+	if len(b) == 0 {
+		return "none"
+	}
+	return b[0].name
+}
@@ -0,0 +1,35 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build amd64 && !purego && !noasm && !tinygo
+// +build amd64,!purego,!noasm,!tinygo
+
+package acorn
+
+// implemented in cpu_amd64.s
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+func xgetbv() (eax, edx uint32)
+
+func init() {
+	maxID, _, _, _ := cpuid(0, 0)
+	if maxID < 7 {
+		return
+	}
+	_, _, ecx1, _ := cpuid(1, 0)
+	const osxsave = 1 << 27
+	if ecx1&osxsave == 0 {
+		return
+	}
+	// Check that the OS saves the vector registers on context switches.
+	xcr0, _ := xgetbv()
+	const (
+		sseState    = 1 << 1
+		avxState    = 1 << 2
+		opmaskState = 1 << 5
+		zmmState    = 3 << 6
+	)
+	osYMM := xcr0&(sseState|avxState) == sseState|avxState
+	osZMM := osYMM && xcr0&(opmaskState|zmmState) == opmaskState|zmmState
+
+	_, ebx7, _, _ := cpuid(7, 0)
+	cpu.hasAVX512F = osZMM && ebx7&(1<<16) != 0
+}
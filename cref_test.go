@@ -0,0 +1,159 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build acorn_cref && cgo
+// +build acorn_cref,cgo
+
+package acorn
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/magical/go-acorn/internal/cref"
+)
+
+var updateKAT = flag.Bool("update-kat", false, "regenerate "+katFile+" from the reference C code")
+
+// TestReferenceKAT checks the known-answer tests against the reference
+// C code, or rewrites them if the -update-kat flag is given.
+func TestReferenceKAT(t *testing.T) {
+	vs := katInputs()
+	for i, v := range vs {
+		vs[i].ct = cref.Seal(v.key, v.nonce, v.pt, v.ad)
+	}
+	if *updateKAT {
+		f, err := os.Create(katFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeKAT(f, vs); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	f, err := os.Open(katFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := parseKAT(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(vs) {
+		t.Fatalf("%s has %d tests, want %d", katFile, len(got), len(vs))
+	}
+	for i, v := range vs {
+		if !bytes.Equal(got[i].ct, v.ct) {
+			t.Errorf("Count = %d: CT = %X, reference gives %X", v.count, got[i].ct, v.ct)
+		}
+	}
+}
+
+var updateInterop = flag.Bool("update-interop", false, "regenerate the reference C vectors in "+interopDir)
+
+// TestReferenceInterop writes the reference C code's file of the interop
+// corpus when the -update-interop flag is given.
+func TestReferenceInterop(t *testing.T) {
+	if !*updateInterop {
+		t.Skip("use -update-interop to regenerate")
+	}
+	r := rand.New(rand.NewSource(2))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		r.Read(b)
+		return b
+	}
+	f := interopFile{Source: "CAESAR reference C code, built from internal/cref"}
+	for i := 0; i < 64; i++ {
+		key, nonce := random(KeySize), random(NonceSize)
+		p, ad := random(r.Intn(200)), random(r.Intn(600))
+		c := cref.Seal(key, nonce, p, ad)
+		f.AEAD = append(f.AEAD, interopVector{
+			ID:    i + 1,
+			Key:   hex.EncodeToString(key),
+			Nonce: hex.EncodeToString(nonce),
+			AD:    hex.EncodeToString(ad),
+			PT:    hex.EncodeToString(p),
+			CT:    hex.EncodeToString(c[:len(p)]),
+			Tag:   hex.EncodeToString(c[len(p):]),
+		})
+	}
+	b, err := json.MarshalIndent(&f, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(interopDir, "cref.json"), append(b, '\n'), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestReference checks Seal and Open against the reference C code
+// on random inputs. Run it with go test -tags acorn_cref.
+func TestReference(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		r.Read(b)
+		return b
+	}
+	sizes := func() int {
+		switch r.Intn(4) {
+		case 0:
+			return r.Intn(8)
+		case 1:
+			return r.Intn(130)
+		case 2:
+			return r.Intn(1024)
+		}
+		return 4096 + r.Intn(4096)
+	}
+	n := 300
+	if testing.Short() {
+		n = 30
+	}
+	for i := 0; i < n; i++ {
+		key, nonce := random(KeySize), random(NonceSize)
+		p, ad := random(sizes()), random(sizes())
+		want := cref.Seal(key, nonce, p, ad)
+		got := NewAEAD(key).Seal(nil, nonce, p, ad)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("Seal(len(p)=%d, len(ad)=%d) differs from reference:\ngot  %x\nwant %x", len(p), len(ad), got, want)
+		}
+		opened, err := cref.Open(key, nonce, got, ad)
+		if err != nil || !bytes.Equal(opened, p) {
+			t.Fatalf("reference Open(len(p)=%d, len(ad)=%d) failed: %v", len(p), len(ad), err)
+		}
+		got[r.Intn(len(got))] ^= 1 << uint(r.Intn(8))
+		if _, err := cref.Open(key, nonce, got, ad); err == nil {
+			t.Fatalf("reference Open accepted a tampered message")
+		}
+		if _, err := NewAEAD(key).Open(nil, nonce, got, ad); err == nil {
+			t.Fatalf("Open accepted a tampered message")
+		}
+	}
+}
+
+// TestReferenceGolden checks the golden corpus against the reference C code.
+func TestReferenceGolden(t *testing.T) {
+	key := countUp(KeySize)
+	want := goldenRows(t, NewAEAD(key).Seal)
+	got := goldenRows(t, func(dst, nonce, p, ad []byte) []byte {
+		return append(dst, cref.Seal(key, nonce, p, ad)...)
+	})
+	for i := range want {
+		if !bytes.Equal(got[i].ct, want[i].ct) || got[i].tags != want[i].tags {
+			t.Errorf("adlen=%d: reference C code disagrees", want[i].adlen)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build (386 || arm || mips || mipsle) && !acorn_small
+// +build 386 arm mips mipsle
+// +build !acorn_small
+
+package acorn
+
+// This file holds the hot loops for 32-bit platforms.
+// They are the same as the ones in crypt64.go, except that each state
+// word is kept as a pair of uint32 halves, so that the compiler doesn't
+// have to emulate 64-bit shifts. Shifting a word right by 32 is then
+// just a matter of dropping the low half.
+
+// ones32 runs one update32 with ca = cb = 1 for each word of m,
+// replacing it with the keystream.
+func (s *state) ones32(m []uint32) {
+	l230, h230 := uint32(s.s230), uint32(s.s230>>32)
+	l193, h193 := uint32(s.s193), uint32(s.s193>>32)
+	l154, h154 := uint32(s.s154), uint32(s.s154>>32)
+	l107, h107 := uint32(s.s107), uint32(s.s107>>32)
+	l61, h61 := uint32(s.s61), uint32(s.s61>>32)
+	l0, h0 := uint32(s.s0), uint32(s.s0>>32)
+	for i := range m {
+		s244 := l230>>14 | h230<<18
+		s235 := l230>>5 | h230<<27
+		s196 := l193>>3 | h193<<29
+		s160 := l154>>6 | h154<<26
+		s111 := l107>>4 | h107<<28
+		s66 := l61>>5 | h61<<27
+		s23 := l0>>23 | h0<<9
+		s12 := l0>>12 | h0<<20
+		s0 := l0
+
+		x289 := s235 ^ l230
+		s230 := l230 ^ s196 ^ l193
+		s193 := l193 ^ s160 ^ l154
+		s154 := l154 ^ s111 ^ l107
+		s107 := l107 ^ s66 ^ l61
+		s61 := l61 ^ s23 ^ s0
+
+		ks := s12 ^ s154 ^ maj(s235, s61, s193) ^ ch(s230, s111, s66)
+		f := s0 ^ ^s107 ^ maj(s244, s23, s160) ^ s196 ^ ks
+		s293 := f ^ m[i]
+
+		l230, h230 = h230^x289<<(289-230-32)^s293<<(293-230-32), x289>>(32-(289-230-32))^s293>>(32-(293-230-32))
+		l193, h193 = h193^s230<<(230-193-32), s230>>(32-(230-193-32))
+		l154, h154 = h154^s193<<(193-154-32), s193>>(32-(193-154-32))
+		l107, h107 = h107^s154<<(154-107-32), s154>>(32-(154-107-32))
+		l61, h61 = h61^s107<<(107-61-32), s107>>(32-(107-61-32))
+		l0, h0 = h0^s61<<(61-32), s61>>(32-(61-32))
+
+		m[i] = ks
+	}
+	s.s230 = uint64(h230)<<32 | uint64(l230)
+	s.s193 = uint64(h193)<<32 | uint64(l193)
+	s.s154 = uint64(h154)<<32 | uint64(l154)
+	s.s107 = uint64(h107)<<32 | uint64(l107)
+	s.s61 = uint64(h61)<<32 | uint64(l61)
+	s.s0 = uint64(h0)<<32 | uint64(l0)
+}
+
+// encrypt encrypts src into dst with cb = 0.
+func (s *state) encrypt(dst, src []uint8) {
+	l230, h230 := uint32(s.s230), uint32(s.s230>>32)
+	l193, h193 := uint32(s.s193), uint32(s.s193>>32)
+	l154, h154 := uint32(s.s154), uint32(s.s154>>32)
+	l107, h107 := uint32(s.s107), uint32(s.s107>>32)
+	l61, h61 := uint32(s.s61), uint32(s.s61>>32)
+	l0, h0 := uint32(s.s0), uint32(s.s0>>32)
+	i := 0
+	for ; i+4 <= len(src); i += 4 {
+		m := load32(src[i:])
+
+		s244 := l230>>14 | h230<<18
+		s235 := l230>>5 | h230<<27
+		s196 := l193>>3 | h193<<29
+		s160 := l154>>6 | h154<<26
+		s111 := l107>>4 | h107<<28
+		s66 := l61>>5 | h61<<27
+		s23 := l0>>23 | h0<<9
+		s12 := l0>>12 | h0<<20
+		s0 := l0
+
+		x289 := s235 ^ l230
+		s230 := l230 ^ s196 ^ l193
+		s193 := l193 ^ s160 ^ l154
+		s154 := l154 ^ s111 ^ l107
+		s107 := l107 ^ s66 ^ l61
+		s61 := l61 ^ s23 ^ s0
+
+		ks := s12 ^ s154 ^ maj(s235, s61, s193) ^ ch(s230, s111, s66)
+		f := s0 ^ ^s107 ^ maj(s244, s23, s160) ^ s196
+		s293 := f ^ m
+
+		l230, h230 = h230^x289<<(289-230-32)^s293<<(293-230-32), x289>>(32-(289-230-32))^s293>>(32-(293-230-32))
+		l193, h193 = h193^s230<<(230-193-32), s230>>(32-(230-193-32))
+		l154, h154 = h154^s193<<(193-154-32), s193>>(32-(193-154-32))
+		l107, h107 = h107^s154<<(154-107-32), s154>>(32-(154-107-32))
+		l61, h61 = h61^s107<<(107-61-32), s107>>(32-(107-61-32))
+		l0, h0 = h0^s61<<(61-32), s61>>(32-(61-32))
+
+		store32(dst[i:], m^ks)
+	}
+	s.s230 = uint64(h230)<<32 | uint64(l230)
+	s.s193 = uint64(h193)<<32 | uint64(l193)
+	s.s154 = uint64(h154)<<32 | uint64(l154)
+	s.s107 = uint64(h107)<<32 | uint64(l107)
+	s.s61 = uint64(h61)<<32 | uint64(l61)
+	s.s0 = uint64(h0)<<32 | uint64(l0)
+	for ; i < len(src); i++ {
+		x := src[i]
+		ks := s.update8(uint32(x), one, 0)
+		dst[i] = x ^ uint8(ks)
+	}
+	s.pad(0)
+}
+
+// decrypt decrypts src into dst with cb = 1.
+func (s *state) decrypt(dst, src []uint8) {
+	l230, h230 := uint32(s.s230), uint32(s.s230>>32)
+	l193, h193 := uint32(s.s193), uint32(s.s193>>32)
+	l154, h154 := uint32(s.s154), uint32(s.s154>>32)
+	l107, h107 := uint32(s.s107), uint32(s.s107>>32)
+	l61, h61 := uint32(s.s61), uint32(s.s61>>32)
+	l0, h0 := uint32(s.s0), uint32(s.s0>>32)
+	i := 0
+	for ; i+4 <= len(src); i += 4 {
+		m := load32(src[i:])
+
+		s244 := l230>>14 | h230<<18
+		s235 := l230>>5 | h230<<27
+		s196 := l193>>3 | h193<<29
+		s160 := l154>>6 | h154<<26
+		s111 := l107>>4 | h107<<28
+		s66 := l61>>5 | h61<<27
+		s23 := l0>>23 | h0<<9
+		s12 := l0>>12 | h0<<20
+		s0 := l0
+
+		x289 := s235 ^ l230
+		s230 := l230 ^ s196 ^ l193
+		s193 := l193 ^ s160 ^ l154
+		s154 := l154 ^ s111 ^ l107
+		s107 := l107 ^ s66 ^ l61
+		s61 := l61 ^ s23 ^ s0
+
+		ks := s12 ^ s154 ^ maj(s235, s61, s193) ^ ch(s230, s111, s66)
+		f := s0 ^ ^s107 ^ maj(s244, s23, s160) ^ s196 ^ ks
+		s293 := f ^ m
+
+		l230, h230 = h230^x289<<(289-230-32)^s293<<(293-230-32), x289>>(32-(289-230-32))^s293>>(32-(293-230-32))
+		l193, h193 = h193^s230<<(230-193-32), s230>>(32-(230-193-32))
+		l154, h154 = h154^s193<<(193-154-32), s193>>(32-(193-154-32))
+		l107, h107 = h107^s154<<(154-107-32), s154>>(32-(154-107-32))
+		l61, h61 = h61^s107<<(107-61-32), s107>>(32-(107-61-32))
+		l0, h0 = h0^s61<<(61-32), s61>>(32-(61-32))
+
+		store32(dst[i:], m^ks)
+	}
+	s.s230 = uint64(h230)<<32 | uint64(l230)
+	s.s193 = uint64(h193)<<32 | uint64(l193)
+	s.s154 = uint64(h154)<<32 | uint64(l154)
+	s.s107 = uint64(h107)<<32 | uint64(l107)
+	s.s61 = uint64(h61)<<32 | uint64(l61)
+	s.s0 = uint64(h0)<<32 | uint64(l0)
+	for ; i < len(src); i++ {
+		x := src[i]
+		ks := s.update8(uint32(x), one, one)
+		dst[i] = x ^ uint8(ks)
+	}
+	s.pad(0)
+}
@@ -0,0 +1,146 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build !386 && !arm && !mips && !mipsle && !acorn_small
+// +build !386,!arm,!mips,!mipsle,!acorn_small
+
+package acorn
+
+// This file holds the hot loops for 64-bit platforms.
+// See crypt32.go for 32-bit platforms.
+
+// ones32 runs one update32 with ca = cb = 1 for each word of m,
+// replacing it with the keystream. This is what init and finalize
+// spend nearly all their time doing, so like encrypt it keeps the
+// state in locals and lets the control bits fold away.
+func (s *state) ones32(m []uint32) {
+	r230, r193, r154, r107, r61, r0 := s.s230, s.s193, s.s154, s.s107, s.s61, s.s0
+	for i := range m {
+		s244 := uint32(r230 >> 14)
+		s235 := uint32(r230 >> 5)
+		s196 := uint32(r193 >> 3)
+		s160 := uint32(r154 >> 6)
+		s111 := uint32(r107 >> 4)
+		s66 := uint32(r61 >> 5)
+		s23 := uint32(r0 >> 23)
+		s12 := uint32(r0 >> 12)
+		s0 := uint32(r0)
+
+		x289 := s235 ^ uint32(r230)
+		s230 := uint32(r230) ^ s196 ^ uint32(r193)
+		s193 := uint32(r193) ^ s160 ^ uint32(r154)
+		s154 := uint32(r154) ^ s111 ^ uint32(r107)
+		s107 := uint32(r107) ^ s66 ^ uint32(r61)
+		s61 := uint32(r61) ^ s23 ^ s0
+
+		ks := s12 ^ s154 ^ maj(s235, s61, s193) ^ ch(s230, s111, s66)
+		f := s0 ^ ^s107 ^ maj(s244, s23, s160) ^ s196 ^ ks
+		s293 := f ^ m[i]
+
+		r230 = r230>>32 ^ uint64(x289)<<(289-230-32) ^ uint64(s293)<<(293-230-32)
+		r193 = r193>>32 ^ uint64(s230)<<(230-193-32)
+		r154 = r154>>32 ^ uint64(s193)<<(193-154-32)
+		r107 = r107>>32 ^ uint64(s154)<<(154-107-32)
+		r61 = r61>>32 ^ uint64(s107)<<(107-61-32)
+		r0 = r0>>32 ^ uint64(s61)<<(61-32)
+
+		m[i] = ks
+	}
+	s.s230, s.s193, s.s154, s.s107, s.s61, s.s0 = r230, r193, r154, r107, r61, r0
+}
+
+// encrypt encrypts src into dst with cb = 0.
+func (s *state) encrypt(dst, src []uint8) {
+	// This is update32 inlined into the loop, so that the state
+	// can stay in registers instead of going through s every time,
+	// and with cb constant so that its masking folds away.
+	r230, r193, r154, r107, r61, r0 := s.s230, s.s193, s.s154, s.s107, s.s61, s.s0
+	i := 0
+	for ; i+4 <= len(src); i += 4 {
+		m := load32(src[i:])
+
+		s244 := uint32(r230 >> 14)
+		s235 := uint32(r230 >> 5)
+		s196 := uint32(r193 >> 3)
+		s160 := uint32(r154 >> 6)
+		s111 := uint32(r107 >> 4)
+		s66 := uint32(r61 >> 5)
+		s23 := uint32(r0 >> 23)
+		s12 := uint32(r0 >> 12)
+		s0 := uint32(r0)
+
+		x289 := s235 ^ uint32(r230)
+		s230 := uint32(r230) ^ s196 ^ uint32(r193)
+		s193 := uint32(r193) ^ s160 ^ uint32(r154)
+		s154 := uint32(r154) ^ s111 ^ uint32(r107)
+		s107 := uint32(r107) ^ s66 ^ uint32(r61)
+		s61 := uint32(r61) ^ s23 ^ s0
+
+		ks := s12 ^ s154 ^ maj(s235, s61, s193) ^ ch(s230, s111, s66)
+		f := s0 ^ ^s107 ^ maj(s244, s23, s160) ^ s196
+		s293 := f ^ m
+
+		r230 = r230>>32 ^ uint64(x289)<<(289-230-32) ^ uint64(s293)<<(293-230-32)
+		r193 = r193>>32 ^ uint64(s230)<<(230-193-32)
+		r154 = r154>>32 ^ uint64(s193)<<(193-154-32)
+		r107 = r107>>32 ^ uint64(s154)<<(154-107-32)
+		r61 = r61>>32 ^ uint64(s107)<<(107-61-32)
+		r0 = r0>>32 ^ uint64(s61)<<(61-32)
+
+		store32(dst[i:], m^ks)
+	}
+	s.s230, s.s193, s.s154, s.s107, s.s61, s.s0 = r230, r193, r154, r107, r61, r0
+	for ; i < len(src); i++ {
+		x := src[i]
+		ks := s.update8(uint32(x), one, 0)
+		dst[i] = x ^ uint8(ks)
+	}
+	s.pad(0)
+}
+
+// decrypt decrypts src into dst with cb = 1, which cancels out
+// the keystream that the ciphertext was fed back with.
+func (s *state) decrypt(dst, src []uint8) {
+	// Same as encrypt, but with cb = 1.
+	r230, r193, r154, r107, r61, r0 := s.s230, s.s193, s.s154, s.s107, s.s61, s.s0
+	i := 0
+	for ; i+4 <= len(src); i += 4 {
+		m := load32(src[i:])
+
+		s244 := uint32(r230 >> 14)
+		s235 := uint32(r230 >> 5)
+		s196 := uint32(r193 >> 3)
+		s160 := uint32(r154 >> 6)
+		s111 := uint32(r107 >> 4)
+		s66 := uint32(r61 >> 5)
+		s23 := uint32(r0 >> 23)
+		s12 := uint32(r0 >> 12)
+		s0 := uint32(r0)
+
+		x289 := s235 ^ uint32(r230)
+		s230 := uint32(r230) ^ s196 ^ uint32(r193)
+		s193 := uint32(r193) ^ s160 ^ uint32(r154)
+		s154 := uint32(r154) ^ s111 ^ uint32(r107)
+		s107 := uint32(r107) ^ s66 ^ uint32(r61)
+		s61 := uint32(r61) ^ s23 ^ s0
+
+		ks := s12 ^ s154 ^ maj(s235, s61, s193) ^ ch(s230, s111, s66)
+		f := s0 ^ ^s107 ^ maj(s244, s23, s160) ^ s196 ^ ks
+		s293 := f ^ m
+
+		r230 = r230>>32 ^ uint64(x289)<<(289-230-32) ^ uint64(s293)<<(293-230-32)
+		r193 = r193>>32 ^ uint64(s230)<<(230-193-32)
+		r154 = r154>>32 ^ uint64(s193)<<(193-154-32)
+		r107 = r107>>32 ^ uint64(s154)<<(154-107-32)
+		r61 = r61>>32 ^ uint64(s107)<<(107-61-32)
+		r0 = r0>>32 ^ uint64(s61)<<(61-32)
+
+		store32(dst[i:], m^ks)
+	}
+	s.s230, s.s193, s.s154, s.s107, s.s61, s.s0 = r230, r193, r154, r107, r61, r0
+	for ; i < len(src); i++ {
+		x := src[i]
+		ks := s.update8(uint32(x), one, one)
+		dst[i] = x ^ uint8(ks)
+	}
+	s.pad(0)
+}
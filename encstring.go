@@ -0,0 +1,39 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import "encoding/base64"
+
+// EncryptString seals s under key with a random nonce, and returns the
+// nonce, ciphertext, and tag in unpadded URL-safe base64, for small values
+// such as configuration settings or URL parameters. The result is about
+// 43 characters longer than s. It returns KeySizeError for a key of the
+// wrong length, or an error if crypto/rand fails.
+func EncryptString(key []byte, s string) (string, error) {
+	if len(key) != KeySize {
+		return "", KeySizeError(len(key))
+	}
+	sealed, err := SealWithRandomNonce(&aead{key: loadKey(key)}, nil, []byte(s), nil)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptString reverses EncryptString. It returns ErrAuthentication
+// if s is not valid base64, or was not encrypted under key, or has
+// been modified.
+func DecryptString(key []byte, s string) (string, error) {
+	if len(key) != KeySize {
+		return "", KeySizeError(len(key))
+	}
+	sealed, err := base64.RawURLEncoding.Strict().DecodeString(s)
+	if err != nil {
+		return "", ErrAuthentication
+	}
+	p, err := OpenWithNonce(&aead{key: loadKey(key)}, nil, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(p), nil
+}
@@ -0,0 +1,48 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestEncryptString(t *testing.T) {
+	key := countUp(KeySize)
+	for _, s := range []string{"", "x", "postgres://user:secret@db/prod", strings.Repeat("é", 100)} {
+		enc, err := EncryptString(key, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if url.QueryEscape(enc) != enc {
+			t.Errorf("EncryptString(%q) = %q, which is not URL-safe", s, enc)
+		}
+		if want := (NonceSize+len(s)+TagSize)*4/3 + 1; len(enc) > want {
+			t.Errorf("EncryptString(%q) is %d characters, want at most %d", s, len(enc), want)
+		}
+		if dec, err := DecryptString(key, enc); err != nil || dec != s {
+			t.Errorf("DecryptString(EncryptString(%q)) = %q, %v", s, dec, err)
+		}
+	}
+
+	enc, _ := EncryptString(key, "value")
+	other := countUp(KeySize)
+	other[0] = 1
+	flipped := []byte(enc)
+	flipped[5] ^= 'A' ^ 'B'
+	for _, bad := range []string{string(flipped), enc + "=", "!" + enc[1:], "", "AAAA"} {
+		if _, err := DecryptString(key, bad); err != ErrAuthentication {
+			t.Errorf("DecryptString(%q) returned %v, want ErrAuthentication", bad, err)
+		}
+	}
+	if _, err := DecryptString(other, enc); err != ErrAuthentication {
+		t.Errorf("DecryptString under the wrong key returned %v", err)
+	}
+	if _, err := EncryptString(key[:5], "x"); err != KeySizeError(5) {
+		t.Errorf("EncryptString with a short key returned %v", err)
+	}
+	if _, err := DecryptString(key[:5], enc); err != KeySizeError(5) {
+		t.Errorf("DecryptString with a short key returned %v", err)
+	}
+}
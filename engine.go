@@ -0,0 +1,155 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"sync"
+)
+
+// An Engine computes ACORN-128 for one message at a time.
+// It lets alternative implementations, such as hardware crypto engines
+// reached through cgo or a vendor SDK, stand in for the Go code.
+//
+// For each message, Init is called first, then Absorb, Crypt, and
+// Finalize exactly once each, in that order. An Engine is only used by
+// one goroutine at a time, but may be reused for further messages.
+type Engine interface {
+	// Init loads a 16-byte key and a 16-byte nonce.
+	Init(key, nonce []byte)
+
+	// Absorb processes the additional data.
+	Absorb(ad []byte)
+
+	// Crypt encrypts src into dst, or decrypts it if decrypt is true.
+	// dst and src have the same length and either overlap exactly or not at all.
+	Crypt(dst, src []byte, decrypt bool)
+
+	// Finalize writes the 16-byte tag to tag.
+	Finalize(tag []byte)
+}
+
+// NewEngine returns the package's own implementation of Engine.
+// It is the default, and is useful for testing other engines against.
+func NewEngine() Engine {
+	return new(goEngine)
+}
+
+type goEngine struct {
+	s state
+}
+
+func (e *goEngine) Init(key, nonce []byte) {
+	if len(key) != KeySize {
+		panic("acorn: invalid key length")
+	}
+	k := loadKey(key)
+	e.s.init(&k, nonce)
+}
+
+func (e *goEngine) Absorb(ad []byte) { e.s.process(ad) }
+
+func (e *goEngine) Crypt(dst, src []byte, decrypt bool) {
+	if decrypt {
+		e.s.decrypt(dst, src)
+	} else {
+		e.s.encrypt(dst, src)
+	}
+}
+
+func (e *goEngine) Finalize(tag []byte) { e.s.finalize(tag) }
+
+var registered struct {
+	sync.RWMutex
+	newEngine func() Engine
+}
+
+// RegisterEngine makes NewAEAD use engines created by newEngine instead
+// of the Go implementation. It is meant to be called from an init function
+// by the package providing the engine. Passing nil restores the default.
+//
+// The AEADs returned by NewAEAD while an engine is registered do not
+// implement Batch.
+func RegisterEngine(newEngine func() Engine) {
+	registered.Lock()
+	registered.newEngine = newEngine
+	registered.Unlock()
+}
+
+func registeredEngine() func() Engine {
+	registered.RLock()
+	defer registered.RUnlock()
+	return registered.newEngine
+}
+
+// NewAEADEngine returns an ACORN instance that uses the given 128-bit key
+// and runs on engines created by newEngine. Each call to Seal or Open
+// uses a fresh engine, so newEngine must be safe for concurrent use
+// if the AEAD is. If the key is not the correct length, NewAEADEngine will panic.
+func NewAEADEngine(key []byte, newEngine func() Engine) cipher.AEAD {
+	if len(key) != KeySize {
+		panic("acorn: invalid key length")
+	}
+	return &engineAEAD{
+		key:       append([]byte(nil), key...),
+		newEngine: newEngine,
+	}
+}
+
+type engineAEAD struct {
+	key       []byte
+	newEngine func() Engine
+}
+
+func (a *engineAEAD) NonceSize() int {
+	return NonceSize
+}
+
+func (a *engineAEAD) Overhead() int {
+	return TagSize
+}
+
+func (a *engineAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != NonceSize {
+		panic("acorn: invalid nonce length")
+	}
+	e := a.newEngine()
+	e.Init(a.key, nonce)
+	e.Absorb(additionalData)
+	ret, out := sliceForAppend(dst, len(plaintext)+TagSize)
+	e.Crypt(out[:len(plaintext)], plaintext, false)
+	e.Finalize(out[len(plaintext):])
+	return ret
+}
+
+func (a *engineAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != NonceSize {
+		panic("acorn: invalid nonce length")
+	}
+	if len(ciphertext) < TagSize {
+		a.reportFailure(ciphertext, additionalData)
+		return dst, ErrAuthentication
+	}
+	e := a.newEngine()
+	e.Init(a.key, nonce)
+	e.Absorb(additionalData)
+	n := len(ciphertext) - TagSize
+	ret, out := sliceForAppend(dst, n)
+	e.Crypt(out, ciphertext[:n], true)
+	var expectedTag [TagSize]byte
+	e.Finalize(expectedTag[:])
+	if subtle.ConstantTimeCompare(ciphertext[n:], expectedTag[:]) == 0 {
+		for i := range out {
+			out[i] = 0
+		}
+		a.reportFailure(ciphertext, additionalData)
+		return dst, ErrAuthentication
+	}
+	return ret, nil
+}
+
+func (a *engineAEAD) reportFailure(ciphertext, additionalData []byte) {
+	k := loadKey(a.key)
+	reportFailure(&k, len(ciphertext), len(additionalData))
+}
@@ -0,0 +1,49 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"testing"
+)
+
+// countingEngine wraps the Go engine and counts the calls made to it.
+type countingEngine struct {
+	Engine
+	calls *int
+}
+
+func (e countingEngine) Crypt(dst, src []byte, decrypt bool) {
+	*e.calls++
+	e.Engine.Crypt(dst, src, decrypt)
+}
+
+func TestEngine(t *testing.T) {
+	calls := 0
+	newEngine := func() Engine { return countingEngine{NewEngine(), &calls} }
+	for i, tt := range testVectors {
+		a := NewAEADEngine(tt.key, newEngine)
+		want := append(append([]byte(nil), tt.ciphertext...), tt.tag...)
+		got := a.Seal(nil, tt.iv, tt.plaintext, tt.authdata)
+		if !bytes.Equal(got, want) {
+			t.Errorf("Seal test #%d: got %x, want %x", i, got, want)
+		}
+		p, err := a.Open(nil, tt.iv, got, tt.authdata)
+		if err != nil || !bytes.Equal(p, tt.plaintext) {
+			t.Errorf("Open test #%d: got %x, %v, want %x", i, p, err, tt.plaintext)
+		}
+		got[0] ^= 1
+		if _, err := a.Open(nil, tt.iv, got, tt.authdata); err == nil {
+			t.Errorf("Open test #%d: tampered message accepted", i)
+		}
+	}
+	if calls != 3*len(testVectors) {
+		t.Errorf("engine was called %d times, want %d", calls, 3*len(testVectors))
+	}
+
+	RegisterEngine(newEngine)
+	defer RegisterEngine(nil)
+	if _, ok := NewAEAD(make([]byte, KeySize)).(*engineAEAD); !ok {
+		t.Errorf("NewAEAD did not use the registered engine")
+	}
+}
@@ -0,0 +1,13 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import "crypto/subtle"
+
+// KeysEqual reports whether a and b are the same key, taking time that
+// depends only on their lengths, so that comparing a secret key with
+// another does not leak how many leading bytes they share.
+// Keys of different lengths are not equal.
+func KeysEqual(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
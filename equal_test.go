@@ -0,0 +1,40 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import "testing"
+
+func TestKeysEqual(t *testing.T) {
+	k := countUp(KeySize)
+	other := countUp(KeySize)
+	other[KeySize-1] ^= 1
+	if !KeysEqual(k, countUp(KeySize)) || KeysEqual(k, other) || KeysEqual(k, k[:8]) {
+		t.Error("KeysEqual is wrong")
+	}
+
+	s1, _ := NewAEADStore(k, nil)
+	s2, _ := NewAEADStore(k, nil)
+	s3, _ := NewAEADStore(other, nil)
+	if !s1.Equal(s2) || !s1.Equal(s1) || s1.Equal(s3) {
+		t.Error("StoredAEAD.Equal is wrong")
+	}
+	s2.Close()
+	if s1.Equal(s2) || s2.Equal(s1) {
+		t.Error("StoredAEAD.Equal is true of a closed AEAD")
+	}
+	s1.Close()
+	s3.Close()
+
+	p1, _ := NewAEADSplit(k, nil)
+	p2, _ := NewAEADSplit(k, nil)
+	p3, _ := NewAEADSplit(other, nil)
+	if !p1.Equal(p2) || !p1.Equal(p1) || p1.Equal(p3) {
+		t.Error("SplitAEAD.Equal is wrong")
+	}
+	p2.Close()
+	if p1.Equal(p2) || p2.Equal(p1) {
+		t.Error("SplitAEAD.Equal is true of a closed AEAD")
+	}
+	p1.Close()
+	p3.Close()
+}
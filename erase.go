@@ -0,0 +1,112 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// The shutdown registry holds functions which erase keys, so that
+// Shutdown can erase every key held by the types which manage them:
+// StoredAEAD and SplitAEAD here, and the keyrings in other packages
+// of this module, which register themselves when they are created.
+//
+// The AEADs returned by NewAEAD are not managed, since they have no
+// Close method and would otherwise stay registered forever. Programs
+// which want their keys erased should use NewAEADStore instead.
+var shutdown registry
+
+type registry struct {
+	sync.Mutex
+	next  uint64
+	funcs map[uint64]func()
+	done  bool
+}
+
+// OnShutdown registers erase to be called by Shutdown, and returns a
+// function which unregisters it. Types which hold keys call it when they
+// are created, and call the returned function when they are closed.
+// If Shutdown has already run, erase is called at once.
+//
+// Shutdown calls the functions in the order they were registered, so a
+// keyring registered before the AEADs it holds is erased before them,
+// and never sees them closed underneath it.
+func OnShutdown(erase func()) (cancel func()) {
+	return shutdown.add(erase)
+}
+
+func (r *registry) add(erase func()) (cancel func()) {
+	r.Lock()
+	if r.done {
+		r.Unlock()
+		erase()
+		return func() {}
+	}
+	if r.funcs == nil {
+		r.funcs = make(map[uint64]func())
+	}
+	id := r.next
+	r.next++
+	r.funcs[id] = erase
+	r.Unlock()
+	return func() {
+		r.Lock()
+		delete(r.funcs, id)
+		r.Unlock()
+	}
+}
+
+// Shutdown erases every key registered with OnShutdown. Afterward, the
+// StoredAEADs and SplitAEADs panic if used, keyrings report that they
+// hold no keys, and any key registered later is erased immediately.
+// Shutdown is safe to call more than once, and from any goroutine.
+func Shutdown() {
+	shutdown.run()
+}
+
+func (r *registry) run() {
+	r.Lock()
+	r.done = true
+	ids := make([]uint64, 0, len(r.funcs))
+	for id := range r.funcs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	funcs := make([]func(), len(ids))
+	for i, id := range ids {
+		funcs[i] = r.funcs[id]
+	}
+	r.funcs = nil
+	r.Unlock()
+	for _, f := range funcs {
+		f()
+	}
+}
+
+// ShutdownOnSignal arranges for Shutdown to be called when the process
+// receives one of the given signals, or SIGINT or SIGTERM if none are
+// given. After erasing the keys, it restores the signal's default
+// behavior and sends the signal again, so that the process exits as it
+// would have without the handler. It is meant for containers which are
+// checkpointed or killed often, so that the keys do not outlive the
+// process in a snapshot of its memory.
+func ShutdownOnSignal(sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+	go func() {
+		sig := <-c
+		Shutdown()
+		signal.Reset(sigs...)
+		if p, err := os.FindProcess(os.Getpid()); err == nil && p.Signal(sig) == nil {
+			select {} // wait for the signal to end the process
+		}
+		os.Exit(1)
+	}()
+}
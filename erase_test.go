@@ -0,0 +1,62 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShutdownRegistry(t *testing.T) {
+	var r registry
+	var calls []int
+	r.add(func() { calls = append(calls, 1) })
+	cancel := r.add(func() { calls = append(calls, 2) })
+	r.add(func() { calls = append(calls, 3) })
+	cancel()
+	r.run()
+	if fmt.Sprint(calls) != "[1 3]" {
+		t.Errorf("Shutdown called %v, want [1 3]", calls)
+	}
+	r.run()
+	if len(calls) != 2 {
+		t.Errorf("a second Shutdown called the functions again")
+	}
+	r.add(func() { calls = append(calls, 4) })
+	if fmt.Sprint(calls) != "[1 3 4]" {
+		t.Errorf("registering after Shutdown did not erase at once: %v", calls)
+	}
+}
+
+func TestShutdownErasesAEADs(t *testing.T) {
+	registered := func() int {
+		shutdown.Lock()
+		defer shutdown.Unlock()
+		return len(shutdown.funcs)
+	}
+	n := registered()
+	stored, err := NewAEADStore(countUp(KeySize), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	split, err := NewAEADSplit(countUp(KeySize), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registered() != n+2 {
+		t.Fatalf("%d functions registered, want %d", registered(), n+2)
+	}
+
+	// what Shutdown would do, without erasing the other tests' keys
+	key := stored.key
+	stored.erase()
+	split.erase()
+	if *key != ([KeySize]byte{}) || stored.key != nil || split.a != nil {
+		t.Errorf("the keys were not erased")
+	}
+	stored.Close()
+	split.Close()
+	if registered() != n {
+		t.Errorf("Close did not unregister: %d functions registered, want %d", registered(), n)
+	}
+}
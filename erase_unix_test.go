@@ -0,0 +1,39 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package acorn
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestShutdownOnSignal runs itself in a subprocess, which sends itself
+// SIGTERM and should erase its keys and then die of the signal.
+func TestShutdownOnSignal(t *testing.T) {
+	if os.Getenv("ACORN_TEST_SIGNAL") == "1" {
+		ShutdownOnSignal()
+		OnShutdown(func() { fmt.Println("erased") })
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		time.Sleep(10 * time.Second)
+		fmt.Println("still running")
+		os.Exit(0)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestShutdownOnSignal$")
+	cmd.Env = append(os.Environ(), "ACORN_TEST_SIGNAL=1")
+	out, err := cmd.Output()
+	if strings.TrimSpace(string(out)) != "erased" {
+		t.Errorf("the subprocess printed %q, want \"erased\"", out)
+	}
+	ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if err == nil || !ok || !ws.Signaled() || ws.Signal() != syscall.SIGTERM {
+		t.Errorf("the subprocess exited with %v, want to be killed by SIGTERM", err)
+	}
+}
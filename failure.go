@@ -0,0 +1,54 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"sync"
+	"time"
+)
+
+// An AuthFailure describes a message which failed to open. It holds
+// nothing secret, so that it can be logged or exported as a metric.
+type AuthFailure struct {
+	KeyID             [8]byte // the KeyID of the key
+	CiphertextLen     int     // including the tag
+	AdditionalDataLen int
+	Time              time.Time
+}
+
+var failureHook struct {
+	sync.RWMutex
+	f func(AuthFailure)
+}
+
+// SetAuthFailureHook arranges for f to be called whenever Open or OpenBatch
+// on an AEAD from this package fails to authenticate a message, so that a
+// service can alert on tampering or misconfigured peers without wrapping
+// every call site. Passing nil removes the hook.
+//
+// f is called synchronously, from whichever goroutine called Open, so it
+// should be quick and must be safe for concurrent use. Engines registered
+// with RegisterEngine report failures too; a custom cipher.AEAD wrapped
+// by this package, such as with VerifyAfterSeal, reports only its own.
+func SetAuthFailureHook(f func(AuthFailure)) {
+	failureHook.Lock()
+	failureHook.f = f
+	failureHook.Unlock()
+}
+
+// reportFailure calls the hook, if there is one, for a message under key
+// k which failed to open. The key ID is only computed if it is needed.
+func reportFailure(k *[4]uint32, ciphertextLen, additionalDataLen int) {
+	failureHook.RLock()
+	f := failureHook.f
+	failureHook.RUnlock()
+	if f == nil {
+		return
+	}
+	f(AuthFailure{
+		KeyID:             keyID(k),
+		CiphertextLen:     ciphertextLen,
+		AdditionalDataLen: additionalDataLen,
+		Time:              time.Now(),
+	})
+}
@@ -0,0 +1,60 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestAuthFailureHook(t *testing.T) {
+	var mu sync.Mutex
+	var got []AuthFailure
+	SetAuthFailureHook(func(f AuthFailure) {
+		mu.Lock()
+		got = append(got, f)
+		mu.Unlock()
+	})
+	defer SetAuthFailureHook(nil)
+
+	key, nonce := countUp(KeySize), countUp(NonceSize)
+	ad := []byte("additional")
+	ct := NewAEAD(key).Seal(nil, nonce, make([]byte, 40), ad)
+	bad := append([]byte(nil), ct...)
+	bad[0] ^= 1
+
+	a := NewAEAD(key)
+	a.Open(nil, nonce, ct, ad) // succeeds, and is not reported
+	a.Open(nil, nonce, bad, ad)
+	a.Open(nil, nonce, bad[:5], ad)
+	NewAEADEngine(key, NewEngine).Open(nil, nonce, bad, ad)
+	m, err := NewAEADMasked(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Open(nil, nonce, bad, ad)
+	m.Open(nil, nonce, bad[:5], ad)
+	// enough messages of one length for the batch backends
+	const n = 70
+	dst := make([][]byte, n)
+	nonces, cts, ads := make([][]byte, n), make([][]byte, n), make([][]byte, n)
+	for i := range dst {
+		nonces[i], cts[i], ads[i] = nonce, ct, ad
+	}
+	cts[3] = bad
+	a.(Batch).OpenBatch(dst, nonces, cts, ads, false)
+
+	wantLens := []int{len(bad), 5, len(bad), len(bad), 5, len(bad)}
+	if len(got) != len(wantLens) {
+		t.Fatalf("the hook was called %d times, want %d", len(got), len(wantLens))
+	}
+	want := keyID(&[4]uint32{0x03020100, 0x07060504, 0x0b0a0908, 0x0f0e0d0c})
+	for i, f := range got {
+		if f.KeyID != want || f.CiphertextLen != wantLens[i] || f.AdditionalDataLen != len(ad) || f.Time.IsZero() {
+			t.Errorf("failure %d: got %+v", i, f)
+		}
+	}
+	if other := keyID(&[4]uint32{1}); other == want {
+		t.Errorf("two keys have the same ID %x", want)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"crypto/subtle"
+	"strconv"
+)
+
+// A BufferSizeError is returned by the Fixed methods
+// for a buffer which is the wrong length.
+type BufferSizeError struct {
+	Buffer string // "out" or "tag"
+	Len    int    // the length passed
+	Want   int    // the length needed, or the least length for out
+}
+
+func (e *BufferSizeError) Error() string {
+	return "acorn: " + e.Buffer + " buffer is " + strconv.Itoa(e.Len) +
+		" bytes, need " + strconv.Itoa(e.Want)
+}
+
+// Scratch is working memory for the Fixed methods. Its contents
+// are secret while a call is in progress, and are wiped before the
+// call returns. The zero value is ready to use.
+type Scratch struct {
+	s state
+}
+
+// A Fixed is an ACORN-128 key for code that must run within a static
+// memory budget, such as firmware built with TinyGo. Its methods never
+// allocate or append: the caller supplies the output, the tag, and the
+// scratch memory for the cipher state, and buffers of the wrong size are
+// reported as a *BufferSizeError rather than grown. Besides those, only
+// a few hundred bytes of stack are used. A Fixed can be declared as a
+// package variable, and the zero value is a valid, all-zero key.
+//
+// A Fixed always uses the Go implementation. It is safe for concurrent
+// use as long as each call has its own Scratch.
+type Fixed struct {
+	key [4]uint32
+}
+
+// NewFixed returns a Fixed for the given 128-bit key. It returns
+// a KeySizeError if the key is not the correct length.
+func NewFixed(key []byte) (Fixed, error) {
+	if len(key) != KeySize {
+		return Fixed{}, KeySizeError(len(key))
+	}
+	return Fixed{loadKey(key)}, nil
+}
+
+// Wipe overwrites the key with zeros.
+func (f *Fixed) Wipe() {
+	f.key = [4]uint32{}
+}
+
+// SealDetached encrypts plaintext into out[:len(plaintext)] and writes
+// the tag into tag, which must be TagSize bytes. out may be plaintext
+// itself, to encrypt in place, but must not otherwise overlap it.
+func (f *Fixed) SealDetached(out, tag, nonce, plaintext, additionalData []byte, scratch *Scratch) error {
+	if err := checkFixed(out, tag, nonce, len(plaintext)); err != nil {
+		return err
+	}
+	s := &scratch.s
+	s.init(&f.key, nonce)
+	s.process(additionalData)
+	s.encrypt(out[:len(plaintext)], plaintext)
+	s.finalize(tag)
+	return nil
+}
+
+// OpenDetached decrypts ciphertext into out[:len(ciphertext)] if it
+// authenticates with tag, and returns ErrAuthentication, with that part
+// of out zeroed, if it does not. out may be ciphertext itself, to decrypt
+// in place, but must not otherwise overlap it.
+func (f *Fixed) OpenDetached(out, nonce, ciphertext, tag, additionalData []byte, scratch *Scratch) error {
+	if err := checkFixed(out, tag, nonce, len(ciphertext)); err != nil {
+		return err
+	}
+	s := &scratch.s
+	s.init(&f.key, nonce)
+	s.process(additionalData)
+	out = out[:len(ciphertext)]
+	s.decrypt(out, ciphertext)
+	var expectedTag [TagSize]byte
+	s.finalize(expectedTag[:])
+	if subtle.ConstantTimeCompare(tag, expectedTag[:]) == 0 {
+		for i := range out {
+			out[i] = 0
+		}
+		reportFailure(&f.key, len(ciphertext)+TagSize, len(additionalData))
+		return ErrAuthentication
+	}
+	return nil
+}
+
+func checkFixed(out, tag, nonce []byte, n int) error {
+	if len(nonce) != NonceSize {
+		return NonceSizeError(len(nonce))
+	}
+	if len(tag) != TagSize {
+		return &BufferSizeError{"tag", len(tag), TagSize}
+	}
+	if len(out) < n {
+		return &BufferSizeError{"out", len(out), n}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFixed(t *testing.T) {
+	key, nonce := countUp(KeySize), countUp(NonceSize)
+	msg, ad := []byte("no heap on this board"), []byte("sensor 3")
+	f, err := NewFixed(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scratch Scratch
+	out := make([]byte, len(msg)+10)
+	tag := make([]byte, TagSize)
+	if err := f.SealDetached(out, tag, nonce, msg, ad, &scratch); err != nil {
+		t.Fatal(err)
+	}
+	want := NewAEAD(key).Seal(nil, nonce, msg, ad)
+	if got := append(out[:len(msg):len(msg)], tag...); !bytes.Equal(got, want) {
+		t.Errorf("SealDetached = %x, want %x", got, want)
+	}
+	if scratch != (Scratch{}) {
+		t.Errorf("scratch was not wiped")
+	}
+
+	// in place
+	ct := append([]byte(nil), out[:len(msg)]...)
+	if err := f.OpenDetached(ct, nonce, ct, tag, ad, &scratch); err != nil || !bytes.Equal(ct, msg) {
+		t.Errorf("OpenDetached = %q, %v", ct, err)
+	}
+	copy(ct, out)
+	tag[0] ^= 1
+	if err := f.OpenDetached(ct, nonce, ct, tag, ad, &scratch); err != ErrAuthentication {
+		t.Errorf("OpenDetached with a bad tag returned %v", err)
+	}
+	if !bytes.Equal(ct, make([]byte, len(ct))) {
+		t.Errorf("output not zeroed after failure: %x", ct)
+	}
+
+	if _, err := NewFixed(key[:5]); err != KeySizeError(5) {
+		t.Errorf("NewFixed with a short key returned %v", err)
+	}
+	if err := f.SealDetached(out, tag, nonce[:12], msg, ad, &scratch); err != NonceSizeError(12) {
+		t.Errorf("short nonce: got %v", err)
+	}
+	err = f.SealDetached(out[:3], tag, nonce, msg, ad, &scratch)
+	if e, ok := err.(*BufferSizeError); !ok || e.Buffer != "out" || e.Len != 3 || e.Want != len(msg) {
+		t.Errorf("short out: got %v", err)
+	}
+	err = f.OpenDetached(out, nonce, ct, tag[:8], ad, &scratch)
+	if e, ok := err.(*BufferSizeError); !ok || e.Buffer != "tag" {
+		t.Errorf("short tag: got %v", err)
+	}
+}
+
+func TestFixedAllocs(t *testing.T) {
+	f, _ := NewFixed(countUp(KeySize))
+	nonce, msg := countUp(NonceSize), countUp(300)
+	out, tag := make([]byte, len(msg)), make([]byte, TagSize)
+	var scratch Scratch
+	n := testing.AllocsPerRun(10, func() {
+		f.SealDetached(out, tag, nonce, msg, nil, &scratch)
+		f.OpenDetached(out, nonce, out, tag, nil, &scratch)
+	})
+	if n != 0 {
+		t.Errorf("allocated %v times per round trip, want 0", n)
+	}
+}
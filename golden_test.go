@@ -0,0 +1,133 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "rewrite "+goldenFile+" from the current implementation")
+
+// goldenFile locks down the output for every plaintext length from 0 to
+// goldenMaxPT and every additional data length from 0 to goldenMaxAD,
+// under the key and nonce 000102...0f, with plaintext and additional
+// data counting up from zero, as in the known-answer tests.
+//
+// Storing all 33345 messages would take megabytes, so each line covers
+// one additional data length:
+//
+//	ad=N ct=<hex> tags=<hex>
+//
+// ct is the ciphertext of the longest plaintext, of which every shorter
+// ciphertext must be a prefix, and tags is the SHA-256 of the tags for
+// each plaintext length in order.
+const goldenFile = "testdata/golden_short.txt"
+
+const (
+	goldenMaxPT = 512
+	goldenMaxAD = 64
+)
+
+type goldenRow struct {
+	adlen int
+	ct    []byte
+	tags  [sha256.Size]byte
+}
+
+// goldenRows computes the golden rows with seal, and checks on the way
+// that each ciphertext is a prefix of the longest.
+func goldenRows(t *testing.T, seal func(dst, nonce, p, ad []byte) []byte) []goldenRow {
+	nonce := countUp(NonceSize)
+	pt := countUp(goldenMaxPT)
+	var rows []goldenRow
+	var dst []byte
+	for adlen := 0; adlen <= goldenMaxAD; adlen++ {
+		ad := countUp(adlen)
+		full := seal(nil, nonce, pt, ad)[:goldenMaxPT]
+		h := sha256.New()
+		for n := 0; n <= goldenMaxPT; n++ {
+			dst = seal(dst[:0], nonce, pt[:n], ad)
+			if !bytes.Equal(dst[:n], full[:n]) {
+				t.Fatalf("len=%d adlen=%d: ciphertext is not a prefix of the longest one", n, adlen)
+			}
+			h.Write(dst[n:])
+		}
+		row := goldenRow{adlen: adlen, ct: full}
+		h.Sum(row.tags[:0])
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func countUp(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+func TestGolden(t *testing.T) {
+	key := countUp(KeySize)
+	rows := goldenRows(t, NewAEAD(key).Seal)
+	if engineRows := goldenRows(t, NewAEADEngine(key, NewEngine).Seal); !reflect.DeepEqual(engineRows, rows) {
+		t.Errorf("the Engine-backed AEAD disagrees with NewAEAD")
+	}
+	if *updateGolden {
+		var buf bytes.Buffer
+		for _, r := range rows {
+			fmt.Fprintf(&buf, "ad=%d ct=%x tags=%x\n", r.adlen, r.ct, r.tags)
+		}
+		if err := ioutil.WriteFile(goldenFile, buf.Bytes(), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	f, err := os.Open(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	i := 0
+	for ; sc.Scan(); i++ {
+		var adlen int
+		var ct, tags string
+		if _, err := fmt.Sscanf(sc.Text(), "ad=%d ct=%s tags=%s", &adlen, &ct, &tags); err != nil {
+			t.Fatalf("%s:%d: %v", goldenFile, i+1, err)
+		}
+		if i >= len(rows) || adlen != rows[i].adlen {
+			t.Fatalf("%s:%d: unexpected line for ad=%d", goldenFile, i+1, adlen)
+		}
+		r := rows[i]
+		if got := hex.EncodeToString(r.ct); got != ct {
+			// find the first length whose ciphertext differs
+			want, _ := hex.DecodeString(ct)
+			n := 0
+			for n < len(want) && n < len(r.ct) && want[n] == r.ct[n] {
+				n++
+			}
+			t.Errorf("adlen=%d: ciphertext differs from byte %d on", adlen, n)
+		}
+		if got := hex.EncodeToString(r.tags[:]); got != tags {
+			t.Errorf("adlen=%d: the tags differ for some plaintext length", adlen)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if i != len(rows) {
+		t.Errorf("%s has %d lines, want %d", goldenFile, i, len(rows))
+	}
+}
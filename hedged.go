@@ -0,0 +1,59 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+)
+
+// A HedgedNonceSource generates nonces which do not rely on the random
+// number generator alone. Each nonce is 16 random bytes with a counter
+// XORed into the last 8. The counter goes up by at least one for every
+// nonce, and jumps forward to the wall clock, in nanoseconds, whenever
+// the clock is ahead of it.
+//
+// With a good random number generator the nonces are uniformly random.
+// If the generator instead returns the same bytes over and over, the
+// counter still keeps the nonces from one source distinct, and the clock
+// keeps apart those from a restarted process or a virtual machine resumed
+// from a snapshot, as long as the clock has moved on. A nonce repeats only
+// if the generator and the clock both fail at once.
+//
+// A HedgedNonceSource is safe for concurrent use.
+type HedgedNonceSource struct {
+	mu    sync.Mutex
+	rand  io.Reader
+	now   func() time.Time
+	count uint64
+}
+
+// NewHedgedNonceSource returns a HedgedNonceSource which reads
+// randomness from rand, or from crypto/rand if rand is nil.
+func NewHedgedNonceSource(rand io.Reader) *HedgedNonceSource {
+	if rand == nil {
+		rand = cryptorand.Reader
+	}
+	return &HedgedNonceSource{rand: rand, now: time.Now}
+}
+
+// Nonce returns a new 16-byte nonce.
+// It returns an error only if reading randomness fails.
+func (s *HedgedNonceSource) Nonce() ([]byte, error) {
+	nonce := make([]byte, NonceSize)
+	if _, err := io.ReadFull(s.rand, nonce); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.count++
+	if t := uint64(s.now().UnixNano()); t > s.count {
+		s.count = t
+	}
+	c := s.count
+	s.mu.Unlock()
+	binary.LittleEndian.PutUint64(nonce[8:], binary.LittleEndian.Uint64(nonce[8:])^c)
+	return nonce, nil
+}
@@ -0,0 +1,80 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// constReader is a broken random number generator.
+type constReader byte
+
+func (r constReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+func TestHedgedNonceSource(t *testing.T) {
+	s := NewHedgedNonceSource(constReader(0xa5))
+	clock := time.Unix(1000, 0)
+	s.now = func() time.Time { return clock }
+
+	seen := map[string]bool{}
+	next := func() []byte {
+		t.Helper()
+		n, err := s.Nonce()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(n) != NonceSize {
+			t.Fatalf("nonce is %d bytes, want %d", len(n), NonceSize)
+		}
+		if seen[string(n)] {
+			t.Fatalf("nonce %x repeated", n)
+		}
+		seen[string(n)] = true
+		return n
+	}
+
+	// a stopped clock and a constant generator: the counter alone
+	for i := 0; i < 1000; i++ {
+		next()
+	}
+
+	// a snapshot resumed later, with the counter rolled back
+	snapshot := s.count
+	next()
+	s.count = snapshot
+	clock = clock.Add(time.Second)
+	n := next()
+	if !bytes.Equal(n[:8], bytes.Repeat([]byte{0xa5}, 8)) {
+		t.Errorf("the counter reached the first half of the nonce: %x", n)
+	}
+
+	// a clock that goes backward does not pull the counter back
+	clock = time.Unix(0, 0)
+	next()
+}
+
+func TestHedgedNonceSourceRandom(t *testing.T) {
+	s := NewHedgedNonceSource(nil)
+	a, err := s.Nonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.Nonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// with a working generator, the random half differs too
+	if bytes.Equal(a[:8], b[:8]) {
+		t.Errorf("nonces %x and %x share their random half", a, b)
+	}
+	if _, err := NewHedgedNonceSource(failReader{}).Nonce(); err == nil {
+		t.Errorf("Nonce succeeded without randomness")
+	}
+}
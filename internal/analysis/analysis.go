@@ -0,0 +1,176 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package analysis is a harness for cryptanalytic experiments on this
+// implementation of ACORN-128, such as state recovery and searching for
+// bias in the keystream.
+//
+// It models the state bit by bit, exactly as in the specification, so
+// that experiments can set and read any bit, and can run the cipher
+// backward as well as forward: the update function is invertible once
+// the message and control bits are known. Save and Restore move states
+// between the model and an acorn.State, so that results carry over to
+// the real implementation, and acorn.State's Schedule and Keystream
+// cover variants and raw keystream.
+//
+// Nothing here is constant time or fast. It is internal so that the API
+// can change with the needs of the experiments.
+package analysis
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/magical/go-acorn"
+)
+
+// Bits is the 293-bit ACORN state, one bit per byte,
+// numbered as in the specification.
+type Bits [293]uint8
+
+// Random returns a state with bits from r.
+func Random(r *rand.Rand) Bits {
+	var b Bits
+	for i := range b {
+		b[i] = uint8(r.Intn(2))
+	}
+	return b
+}
+
+// Save returns the bits of s.
+func Save(s *acorn.State) Bits {
+	enc, _ := s.MarshalBinary()
+	var b Bits
+	for i := range b {
+		b[i] = enc[i/8] >> uint(i%8) & 1
+	}
+	return b
+}
+
+// Restore sets the bits of s to b. Only the low bit of each
+// element of b is used.
+func Restore(s *acorn.State, b *Bits) {
+	enc := make([]byte, acorn.StateSize)
+	for i, bit := range b {
+		enc[i/8] |= (bit & 1) << uint(i%8)
+	}
+	if err := s.UnmarshalBinary(enc); err != nil {
+		panic(err) // can't happen
+	}
+}
+
+func maj(x, y, z uint8) uint8 { return x&y ^ x&z ^ y&z }
+func ch(x, y, z uint8) uint8  { return x&y ^ (x^1)&z }
+
+// keystream is the keystream bit of a state which has had
+// the LFSR feedback applied.
+func (b *Bits) keystream() uint8 {
+	return b[12] ^ b[154] ^ maj(b[235], b[61], b[193]) ^ ch(b[230], b[111], b[66])
+}
+
+// Step performs one state update with message bit m and control
+// bits ca and cb, and returns the keystream bit.
+func (b *Bits) Step(m, ca, cb uint8) (ks uint8) {
+	b[289] ^= b[235] ^ b[230]
+	b[230] ^= b[196] ^ b[193]
+	b[193] ^= b[160] ^ b[154]
+	b[154] ^= b[111] ^ b[107]
+	b[107] ^= b[66] ^ b[61]
+	b[61] ^= b[23] ^ b[0]
+
+	ks = b.keystream()
+	f := b[0] ^ b[107] ^ 1 ^ maj(b[244], b[23], b[160]) ^ ca&b[196] ^ cb&ks
+
+	copy(b[:], b[1:])
+	b[292] = f ^ m
+	return ks
+}
+
+// Unstep undoes a call to Step with the same m, ca, and cb,
+// and returns the keystream bit that the step produced.
+func (b *Bits) Unstep(m, ca, cb uint8) (ks uint8) {
+	last := b[292]
+	copy(b[1:], b[:292])
+	b[0] = 0
+
+	// Bit 0 is the only one shifted out, and it is the only unknown
+	// in the feedback bit, so it can be solved for.
+	ks = b.keystream()
+	b[0] = last ^ m ^ b[107] ^ 1 ^ maj(b[244], b[23], b[160]) ^ ca&b[196] ^ cb&ks
+
+	// Each LFSR's feedback uses the bit below it from before the
+	// update, so undo them from the bottom up.
+	b[61] ^= b[23] ^ b[0]
+	b[107] ^= b[66] ^ b[61]
+	b[154] ^= b[111] ^ b[107]
+	b[193] ^= b[160] ^ b[154]
+	b[230] ^= b[196] ^ b[193]
+	b[289] ^= b[235] ^ b[230]
+	return ks
+}
+
+// Keystream fills dst with keystream in the same way as
+// acorn.State.Keystream, low bit first: each bit comes from a step with
+// a zero message bit and the control bits used for encryption.
+func (b *Bits) Keystream(dst []byte) {
+	for i := range dst {
+		var x uint8
+		for j := uint(0); j < 8; j++ {
+			x |= b.Step(0, 1, 0) << j
+		}
+		dst[i] = x
+	}
+}
+
+// Rewind undoes a call to Keystream which produced n bytes.
+func (b *Bits) Rewind(n int) {
+	for i := 0; i < 8*n; i++ {
+		b.Unstep(0, 1, 0)
+	}
+}
+
+// Bias counts how often each bit of a sample is set, over many samples.
+type Bias struct {
+	Ones    []int // the number of samples with each bit set
+	Samples int
+}
+
+// MeasureBias calls sample the given number of times, each time with a
+// fresh, zeroed buffer of n bytes to fill, and counts the bits which
+// are set. Bit i of the buffer is bit i%8 of byte i/8, as in Keystream.
+func MeasureBias(samples, n int, sample func(dst []byte)) *Bias {
+	b := &Bias{Ones: make([]int, 8*n), Samples: samples}
+	buf := make([]byte, n)
+	for s := 0; s < samples; s++ {
+		for i := range buf {
+			buf[i] = 0
+		}
+		sample(buf)
+		for i := range b.Ones {
+			b.Ones[i] += int(buf[i/8] >> uint(i%8) & 1)
+		}
+	}
+	return b
+}
+
+// Bias returns how far the probability of bit i being set is from 1/2.
+func (b *Bias) Bias(i int) float64 {
+	return float64(b.Ones[i])/float64(b.Samples) - 0.5
+}
+
+// ZScore returns the bias of bit i in standard deviations of the bias of
+// a uniformly random bit over the same number of samples. Values beyond
+// about 4 are worth a second look, taking into account how many bits
+// were measured.
+func (b *Bias) ZScore(i int) float64 {
+	return b.Bias(i) / (0.5 / math.Sqrt(float64(b.Samples)))
+}
+
+// Max returns the bit with the largest bias in either direction.
+func (b *Bias) Max() (bit int, bias float64) {
+	for i := range b.Ones {
+		if x := b.Bias(i); math.Abs(x) > math.Abs(bias) {
+			bit, bias = i, x
+		}
+	}
+	return bit, bias
+}
@@ -0,0 +1,77 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package analysis
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/magical/go-acorn"
+)
+
+func TestUnstep(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 1000; n++ {
+		b := Random(r)
+		orig := b
+		m, ca, cb := uint8(r.Intn(2)), uint8(r.Intn(2)), uint8(r.Intn(2))
+		ks := b.Step(m, ca, cb)
+		if got := b.Unstep(m, ca, cb); got != ks || b != orig {
+			t.Fatalf("Unstep(%d, %d, %d) did not undo Step: ks %d, want %d", m, ca, cb, got, ks)
+		}
+	}
+}
+
+// TestImplementation checks the model against acorn.State,
+// going through Save and Restore.
+func TestImplementation(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	var s acorn.State
+	s.Init(key, key)
+	b := Save(&s)
+
+	want := make([]byte, 40)
+	s.Keystream(want)
+	got := make([]byte, len(want))
+	b.Keystream(got)
+	if !bytes.Equal(got, want) {
+		t.Errorf("Keystream = %x, want %x", got, want)
+	}
+	if Save(&s) != b {
+		t.Errorf("model and implementation states differ after Keystream")
+	}
+
+	// rewind both and go again
+	b.Rewind(len(want))
+	Restore(&s, &b)
+	s.Keystream(got)
+	if !bytes.Equal(got, want) {
+		t.Errorf("Keystream after Rewind = %x, want %x", got, want)
+	}
+}
+
+func TestBias(t *testing.T) {
+	ones := MeasureBias(100, 2, func(dst []byte) { dst[0] = 0x01 })
+	if bit, bias := ones.Max(); bit != 0 || bias != 0.5 || ones.Bias(1) != -0.5 {
+		t.Errorf("Max() = %d, %v; want 0, 0.5", bit, bias)
+	}
+	if z := ones.ZScore(0); z != 10 {
+		t.Errorf("ZScore(0) = %v, want 10", z)
+	}
+
+	// full ACORN-128, with random nonces, shouldn't show anything
+	key := []byte("0123456789abcdef")
+	r := rand.New(rand.NewSource(1))
+	nonce := make([]byte, acorn.NonceSize)
+	ks := MeasureBias(2000, 8, func(dst []byte) {
+		r.Read(nonce)
+		var s acorn.State
+		s.Init(key, nonce)
+		s.Keystream(dst)
+	})
+	if bit, _ := ks.Max(); math.Abs(ks.ZScore(bit)) > 5 {
+		t.Errorf("keystream bit %d has z-score %v", bit, ks.ZScore(bit))
+	}
+}
@@ -0,0 +1,190 @@
+//go:build acorn_cref && cgo
+
+/*
+ * ACORN-128 v3, reference implementation.
+ * Follows the reference code submitted to the CAESAR competition by
+ * Hongjun Wu: one byte per state bit, one state update per bit.
+ */
+
+#include <string.h>
+#include "acorn128.h"
+
+#define maj(x, y, z)  ( ((x) & (y)) ^ ((x) & (z)) ^ ((y) & (z)) )
+#define ch(x, y, z)   ( ((x) & (y)) ^ (((x) ^ 1) & (z)) )
+
+static unsigned char KSG128(unsigned char *state)
+{
+    return ( state[12] ^ state[154] ^ maj(state[235], state[61], state[193]) ^ ch(state[230], state[111], state[66]) );
+}
+
+static unsigned char FBK128(unsigned char *state, unsigned char *ks, unsigned char ca, unsigned char cb)
+{
+    unsigned char f;
+    *ks = KSG128(state);
+    f = state[0] ^ (state[107] ^ 1) ^ maj(state[244], state[23], state[160]) ^ (ca & state[196]) ^ (cb & (*ks));
+    return f;
+}
+
+/* the state update for encryption; ciphertextbit may be NULL */
+static void Encrypt_StateUpdate128(unsigned char *state, unsigned char plaintextbit,
+                                   unsigned char *ciphertextbit, unsigned char *ks,
+                                   unsigned char ca, unsigned char cb)
+{
+    unsigned int i;
+    unsigned char f;
+
+    state[289] ^= state[235] ^ state[230];
+    state[230] ^= state[196] ^ state[193];
+    state[193] ^= state[160] ^ state[154];
+    state[154] ^= state[111] ^ state[107];
+    state[107] ^= state[66]  ^ state[61];
+    state[61]  ^= state[23]  ^ state[0];
+
+    f = FBK128(state, ks, ca, cb);
+
+    for (i = 0; i <= 291; i++) state[i] = state[i+1];
+    state[292] = f ^ plaintextbit;
+    if (ciphertextbit != NULL) *ciphertextbit = *ks ^ plaintextbit;
+}
+
+/* the state update for decryption */
+static void Decrypt_StateUpdate128(unsigned char *state, unsigned char *plaintextbit,
+                                   unsigned char ciphertextbit, unsigned char *ks,
+                                   unsigned char ca, unsigned char cb)
+{
+    unsigned int i;
+    unsigned char f;
+
+    state[289] ^= state[235] ^ state[230];
+    state[230] ^= state[196] ^ state[193];
+    state[193] ^= state[160] ^ state[154];
+    state[154] ^= state[111] ^ state[107];
+    state[107] ^= state[66]  ^ state[61];
+    state[61]  ^= state[23]  ^ state[0];
+
+    f = FBK128(state, ks, ca, cb);
+
+    for (i = 0; i <= 291; i++) state[i] = state[i+1];
+    *plaintextbit = *ks ^ ciphertextbit;
+    state[292] = f ^ *plaintextbit;
+}
+
+static void acorn128_initialization(const unsigned char *key, const unsigned char *iv, unsigned char *state)
+{
+    int i, j;
+    unsigned char m[1792], ks;
+
+    for (i = 0; i < 293; i++) state[i] = 0;
+
+    for (i = 0; i < 16; i++) {
+        for (j = 0; j < 8; j++) {
+            m[8*i+j]       = (key[i] >> j) & 1;
+            m[8*i+j+128]   = (iv[i]  >> j) & 1;
+        }
+    }
+    for (i = 256; i < 1792; i++) m[i] = m[(i-256) & 127];
+    m[256] ^= 1;
+
+    for (i = 0; i < 1792; i++) Encrypt_StateUpdate128(state, m[i], NULL, &ks, 1, 1);
+}
+
+/* absorb the associated data, then pad: one 1 bit and 255 zero bits */
+static void acorn128_ad(const unsigned char *ad, unsigned long long adlen, unsigned char *state)
+{
+    unsigned long long i;
+    int j;
+    unsigned char ks;
+
+    for (i = 0; i < adlen; i++)
+        for (j = 0; j < 8; j++)
+            Encrypt_StateUpdate128(state, (ad[i] >> j) & 1, NULL, &ks, 1, 1);
+
+    Encrypt_StateUpdate128(state, 1, NULL, &ks, 1, 1);
+    for (j = 1; j < 128; j++) Encrypt_StateUpdate128(state, 0, NULL, &ks, 1, 1);
+    for (j = 128; j < 256; j++) Encrypt_StateUpdate128(state, 0, NULL, &ks, 0, 1);
+}
+
+/* pad after the message: one 1 bit and 255 zero bits, with cb = 0 */
+static void acorn128_pad(unsigned char *state)
+{
+    int j;
+    unsigned char ks;
+
+    Encrypt_StateUpdate128(state, 1, NULL, &ks, 1, 0);
+    for (j = 1; j < 128; j++) Encrypt_StateUpdate128(state, 0, NULL, &ks, 1, 0);
+    for (j = 128; j < 256; j++) Encrypt_StateUpdate128(state, 0, NULL, &ks, 0, 0);
+}
+
+static void acorn128_tag_generation(unsigned char *tag, unsigned char *state)
+{
+    int i, j;
+    unsigned char ks;
+
+    for (i = 0; i < 640; i++) Encrypt_StateUpdate128(state, 0, NULL, &ks, 1, 1);
+
+    memset(tag, 0, 16);
+    for (i = 0; i < 16; i++) {
+        for (j = 0; j < 8; j++) {
+            Encrypt_StateUpdate128(state, 0, NULL, &ks, 1, 1);
+            tag[i] |= ks << j;
+        }
+    }
+}
+
+int crypto_aead_encrypt(unsigned char *c, unsigned long long *clen,
+                        const unsigned char *m, unsigned long long mlen,
+                        const unsigned char *ad, unsigned long long adlen,
+                        const unsigned char *nsec, const unsigned char *npub,
+                        const unsigned char *k)
+{
+    unsigned long long i;
+    int j;
+    unsigned char state[293], ks, cbit;
+    (void)nsec;
+
+    acorn128_initialization(k, npub, state);
+    acorn128_ad(ad, adlen, state);
+
+    for (i = 0; i < mlen; i++) {
+        c[i] = 0;
+        for (j = 0; j < 8; j++) {
+            Encrypt_StateUpdate128(state, (m[i] >> j) & 1, &cbit, &ks, 1, 0);
+            c[i] |= cbit << j;
+        }
+    }
+    acorn128_pad(state);
+    acorn128_tag_generation(c + mlen, state);
+    *clen = mlen + 16;
+    return 0;
+}
+
+int crypto_aead_decrypt(unsigned char *m, unsigned long long *mlen,
+                        unsigned char *nsec,
+                        const unsigned char *c, unsigned long long clen,
+                        const unsigned char *ad, unsigned long long adlen,
+                        const unsigned char *npub, const unsigned char *k)
+{
+    unsigned long long i;
+    int j, check = 0;
+    unsigned char state[293], ks, pbit, tag[16];
+    (void)nsec;
+
+    if (clen < 16) return -1;
+    *mlen = clen - 16;
+
+    acorn128_initialization(k, npub, state);
+    acorn128_ad(ad, adlen, state);
+
+    for (i = 0; i < *mlen; i++) {
+        m[i] = 0;
+        for (j = 0; j < 8; j++) {
+            Decrypt_StateUpdate128(state, &pbit, (c[i] >> j) & 1, &ks, 1, 0);
+            m[i] |= pbit << j;
+        }
+    }
+    acorn128_pad(state);
+    acorn128_tag_generation(tag, state);
+
+    for (j = 0; j < 16; j++) check |= tag[j] ^ c[*mlen + j];
+    return check == 0 ? 0 : -1;
+}
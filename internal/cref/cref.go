@@ -0,0 +1,54 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build acorn_cref && cgo
+// +build acorn_cref,cgo
+
+package cref
+
+// #include "acorn128.h"
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+var errDecryption = errors.New("cref: message authentication failed")
+
+// ptr returns a pointer to the first byte of b,
+// or to a dummy byte if b is empty.
+func ptr(b []byte) *C.uchar {
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	return (*C.uchar)(unsafe.Pointer(&b[0]))
+}
+
+// Seal encrypts and authenticates plaintext and returns
+// the ciphertext followed by the tag.
+func Seal(key, nonce, plaintext, ad []byte) []byte {
+	c := make([]byte, len(plaintext)+16)
+	var clen C.ulonglong
+	C.crypto_aead_encrypt(ptr(c), &clen,
+		ptr(plaintext), C.ulonglong(len(plaintext)),
+		ptr(ad), C.ulonglong(len(ad)),
+		nil, ptr(nonce), ptr(key))
+	return c[:clen]
+}
+
+// Open decrypts and authenticates ciphertext.
+func Open(key, nonce, ciphertext, ad []byte) ([]byte, error) {
+	if len(ciphertext) < 16 {
+		return nil, errDecryption
+	}
+	m := make([]byte, len(ciphertext)-16)
+	var mlen C.ulonglong
+	r := C.crypto_aead_decrypt(ptr(m), &mlen, nil,
+		ptr(ciphertext), C.ulonglong(len(ciphertext)),
+		ptr(ad), C.ulonglong(len(ad)),
+		ptr(nonce), ptr(key))
+	if r != 0 {
+		return nil, errDecryption
+	}
+	return m[:mlen], nil
+}
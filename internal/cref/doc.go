@@ -0,0 +1,9 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package cref wraps the ACORN-128 reference implementation from the
+// CAESAR competition, so that the tests can check the Go code against it.
+//
+// It is only built with the acorn_cref build tag, and needs cgo:
+//
+//	go test -tags acorn_cref
+package cref
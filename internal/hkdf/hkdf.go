@@ -0,0 +1,38 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package hkdf implements HKDF-SHA256 (RFC 5869), for deriving session
+// keys in the packages that set up connections.
+package hkdf
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+// Key returns n bytes of HKDF-SHA256 output for the given
+// input keying material, salt, and info.
+func Key(secret, salt, info []byte, n int) []byte {
+	return Expand(Extract(secret, salt), info, n)
+}
+
+// Extract returns the pseudorandom key for secret and salt, which
+// Expand can derive any number of keys from without repeating it.
+func Extract(secret, salt []byte) []byte {
+	m := hmac.New(sha256.New, salt)
+	m.Write(secret)
+	return m.Sum(nil)
+}
+
+// Expand returns n bytes of output for the pseudorandom key prk and info.
+func Expand(prk, info []byte, n int) []byte {
+	var out, t []byte
+	for i := byte(1); len(out) < n; i++ {
+		m := hmac.New(sha256.New, prk)
+		m.Write(t)
+		m.Write(info)
+		m.Write([]byte{i})
+		t = m.Sum(nil)
+		out = append(out, t...)
+	}
+	return out[:n]
+}
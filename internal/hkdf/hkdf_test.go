@@ -0,0 +1,20 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package hkdf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestKey(t *testing.T) {
+	// RFC 5869, test case 1
+	ikm := bytes.Repeat([]byte{0x0b}, 22)
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	want := "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865"
+	if got := hex.EncodeToString(Key(ikm, salt, info, 42)); got != want {
+		t.Errorf("Key = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Smoketest is a minimal program for checking that the acorn package
+// builds and works on platforms where go test is awkward to run,
+// such as js/wasm and TinyGo targets:
+//
+//	GOOS=js GOARCH=wasm go run -exec=$(go env GOROOT)/lib/wasm/go_js_wasm_exec ./internal/smoketest
+//	tinygo run ./internal/smoketest
+//
+// It checks a known answer, a round trip through Seal and Open,
+// and that the random number generator works, and exits with a
+// non-zero status if anything fails.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/magical/go-acorn"
+)
+
+func main() {
+	ok := true
+	check := func(what string, err error) {
+		if err != nil {
+			fmt.Printf("FAIL %s: %v\n", what, err)
+			ok = false
+		} else {
+			fmt.Printf("ok   %s\n", what)
+		}
+	}
+
+	check("known answer", knownAnswer())
+	check("round trip", roundTrip())
+	_, err := acorn.GenerateNonce(nil)
+	check("random nonce", err)
+
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func knownAnswer() error {
+	key := make([]byte, acorn.KeySize)
+	nonce := make([]byte, acorn.NonceSize)
+	want, _ := hex.DecodeString("2b4b60640e26f0a99dd01f93bf634997cb")
+	got := acorn.NewAEAD(key).Seal(nil, nonce, []byte{0x01}, nil)
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("got %x, want %x", got, want)
+	}
+	return nil
+}
+
+func roundTrip() error {
+	key := []byte("0123456789abcdef")
+	nonce := []byte("fedcba9876543210")
+	a := acorn.NewAEAD(key)
+	msg := []byte("hello from acorn")
+	sealed := a.Seal(nil, nonce, msg, []byte("ad"))
+	opened, err := a.Open(nil, nonce, sealed, []byte("ad"))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(opened, msg) {
+		return fmt.Errorf("got %q, want %q", opened, msg)
+	}
+	sealed[0] ^= 1
+	if _, err := a.Open(nil, nonce, sealed, []byte("ad")); err == nil {
+		return fmt.Errorf("tampered message was accepted")
+	}
+	return nil
+}
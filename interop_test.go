@@ -0,0 +1,90 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// The interop corpus is a set of vector files, one for each independent
+// implementation, in testdata/interop. Each file is JSON of the form
+//
+//	{
+//	  "source": "where the vectors came from",
+//	  "aead": [
+//	    {"id": 1, "key": "...", "nonce": "...", "ad": "...", "pt": "...", "ct": "...", "tag": "..."},
+//	    ...
+//	  ]
+//	}
+//
+// with byte strings in hex, as written by the acorn vectors command.
+// To add an implementation, have it encrypt the inputs of an existing
+// file, or its own, and add the result as a new file.
+const interopDir = "testdata/interop"
+
+type interopFile struct {
+	Source string          `json:"source"`
+	AEAD   []interopVector `json:"aead"`
+}
+
+type interopVector struct {
+	ID    int    `json:"id"`
+	Key   string `json:"key"`
+	Nonce string `json:"nonce"`
+	AD    string `json:"ad"`
+	PT    string `json:"pt"`
+	CT    string `json:"ct"`
+	Tag   string `json:"tag"`
+}
+
+func TestInterop(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(interopDir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no vector files in %s", interopDir)
+	}
+	for _, name := range files {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var f interopFile
+		if err := json.Unmarshal(b, &f); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if len(f.AEAD) == 0 {
+			t.Errorf("%s: no vectors", name)
+		}
+		for _, v := range f.AEAD {
+			var key, nonce, ad, pt, ct, tag []byte
+			for _, x := range []struct {
+				dst *[]byte
+				s   string
+			}{{&key, v.Key}, {&nonce, v.Nonce}, {&ad, v.AD}, {&pt, v.PT}, {&ct, v.CT}, {&tag, v.Tag}} {
+				if *x.dst, err = hex.DecodeString(x.s); err != nil {
+					break
+				}
+			}
+			if err != nil || len(key) != KeySize || len(nonce) != NonceSize || len(ct) != len(pt) || len(tag) != TagSize {
+				t.Errorf("%s: vector %d is malformed", name, v.ID)
+				continue
+			}
+			a := NewAEAD(key)
+			want := append(ct, tag...)
+			if got := a.Seal(nil, nonce, pt, ad); !bytes.Equal(got, want) {
+				t.Errorf("%s (%s): vector %d: Seal = %x, want %x", name, f.Source, v.ID, got, want)
+			}
+			if got, err := a.Open(nil, nonce, want, ad); err != nil || !bytes.Equal(got, pt) {
+				t.Errorf("%s (%s): vector %d: Open = %x, %v, want %x", name, f.Source, v.ID, got, err, pt)
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// katFile holds the known-answer tests in the format written by the
+// CAESAR genkat_aead.c program: every combination of 0 to 32 bytes of
+// plaintext and 0 to 32 bytes of additional data, with the key, nonce,
+// plaintext, and additional data each counting up from zero.
+const katFile = "testdata/acorn128v3_kat.txt"
+
+type katVector struct {
+	count                  int
+	key, nonce, pt, ad, ct []byte
+}
+
+// parseKAT reads known-answer tests in the genkat_aead.c format:
+// blank-line separated records of "Name = value" lines, where the
+// values are hex strings except for Count.
+func parseKAT(r io.Reader) ([]katVector, error) {
+	var vs []katVector
+	var v *katVector
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		i := strings.Index(text, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: missing '='", line)
+		}
+		name := strings.TrimSpace(text[:i])
+		value := strings.TrimSpace(text[i+1:])
+		if name == "Count" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			vs = append(vs, katVector{count: n})
+			v = &vs[len(vs)-1]
+			continue
+		}
+		if v == nil {
+			return nil, fmt.Errorf("line %d: %s before Count", line, name)
+		}
+		b, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		switch name {
+		case "Key":
+			v.key = b
+		case "Nonce":
+			v.nonce = b
+		case "PT":
+			v.pt = b
+		case "AD":
+			v.ad = b
+		case "CT":
+			v.ct = b
+		default:
+			return nil, fmt.Errorf("line %d: unknown field %s", line, name)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for _, v := range vs {
+		if len(v.key) != KeySize || len(v.nonce) != NonceSize || len(v.ct) != len(v.pt)+TagSize {
+			return nil, fmt.Errorf("Count = %d: incomplete or malformed test", v.count)
+		}
+	}
+	return vs, nil
+}
+
+// writeKAT writes vs in the genkat_aead.c format.
+func writeKAT(w io.Writer, vs []katVector) error {
+	bw := bufio.NewWriter(w)
+	for _, v := range vs {
+		fmt.Fprintf(bw, "Count = %d\n", v.count)
+		fmt.Fprintf(bw, "Key = %X\n", v.key)
+		fmt.Fprintf(bw, "Nonce = %X\n", v.nonce)
+		fmt.Fprintf(bw, "PT = %X\n", v.pt)
+		fmt.Fprintf(bw, "AD = %X\n", v.ad)
+		fmt.Fprintf(bw, "CT = %X\n\n", v.ct)
+	}
+	return bw.Flush()
+}
+
+// katInputs returns the inputs of the complete vector set,
+// in the order genkat_aead.c produces them, with ct unset.
+func katInputs() []katVector {
+	var vs []katVector
+	for mlen := 0; mlen <= 32; mlen++ {
+		for adlen := 0; adlen <= 32; adlen++ {
+			vs = append(vs, katVector{
+				count: len(vs) + 1,
+				key:   countUp(KeySize),
+				nonce: countUp(NonceSize),
+				pt:    countUp(mlen),
+				ad:    countUp(adlen),
+			})
+		}
+	}
+	return vs
+}
+
+func TestKAT(t *testing.T) {
+	f, err := os.Open(katFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	vs, err := parseKAT(f)
+	if err != nil {
+		t.Fatalf("%s: %v", katFile, err)
+	}
+	if want := len(katInputs()); len(vs) != want {
+		t.Errorf("%s has %d tests, want %d", katFile, len(vs), want)
+	}
+	for _, v := range vs {
+		a := NewAEAD(v.key)
+		ct := a.Seal(nil, v.nonce, v.pt, v.ad)
+		if !bytes.Equal(ct, v.ct) {
+			t.Errorf("Count = %d: Seal = %X, want %X", v.count, ct, v.ct)
+			continue
+		}
+		pt, err := a.Open(nil, v.nonce, v.ct, v.ad)
+		if err != nil || !bytes.Equal(pt, v.pt) {
+			t.Errorf("Count = %d: Open = %X, %v, want %X", v.count, pt, err, v.pt)
+		}
+	}
+}
+
+func TestParseKAT(t *testing.T) {
+	var buf bytes.Buffer
+	vs := katInputs()[:3]
+	for i := range vs {
+		vs[i].ct = make([]byte, len(vs[i].pt)+TagSize)
+	}
+	if err := writeKAT(&buf, vs); err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseKAT(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(vs) {
+		t.Fatalf("parsed %d tests, want %d", len(got), len(vs))
+	}
+	for _, bad := range []string{
+		"Key = 00\n",
+		"Count = x\n",
+		"Count = 1\nKey\n",
+		"Count = 1\nKey = 0g\n",
+		"Count = 1\nTag = 00\n",
+		"Count = 1\nKey = 000102030405060708090A0B0C0D0E0F\n",
+	} {
+		if _, err := parseKAT(strings.NewReader(bad)); err == nil {
+			t.Errorf("parseKAT(%q) succeeded, want error", bad)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+// Package keyfile reads and writes ACORN-128 key files.
+//
+// A key file is a text file made of "name: value" lines.
+// Blank lines and lines beginning with # are comments.
+// A plain key file looks like
+//
+//	# backup key for db01
+//	id: bdfd31132a5da0ed
+//	key: 000102030405060708090a0b0c0d0e0f
+//
+// The id is an 8-byte identifier which tools can record alongside
+// ciphertexts to tell which key was used, without revealing the key.
+// Generate derives it from the key with acorn.KeyID. Key files written
+// before that have random ids, which are kept as they are.
+//
+// A passphrase-protected key file replaces the key line with
+//
+//	kdf: pbkdf2-sha256 <iterations> <salt>
+//	sealed-key: <nonce><ciphertext><tag>
+//
+// where the key is sealed with ACORN-128 under a key derived from the
+// passphrase, with the id as additional data.
+//
+// Key files hold secrets, so Read refuses to load a file that
+// is readable or writable by anyone other than its owner.
+package keyfile
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/magical/go-acorn"
+)
+
+// A Key is an ACORN-128 key along with its metadata.
+type Key struct {
+	ID      [8]byte
+	Key     []byte
+	Comment string // may span multiple lines
+}
+
+var (
+	ErrPassphrase         = errors.New("keyfile: incorrect passphrase")
+	ErrPassphraseRequired = errors.New("keyfile: key is protected by a passphrase")
+)
+
+// A PermissionError is returned by Read when a key file
+// is accessible by users other than its owner.
+type PermissionError struct {
+	Name string
+	Mode os.FileMode
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("keyfile: %s: permissions %v are too open; must not be accessible by group or others", e.Name, e.Mode.Perm())
+}
+
+// iterations is the PBKDF2 iteration count for new passphrase-protected keys.
+var iterations = 600000
+
+const (
+	saltSize      = 16
+	maxIterations = 1 << 30
+)
+
+// Generate returns a new random key, with the ID given by acorn.KeyID.
+func Generate() (*Key, error) {
+	k := &Key{Key: make([]byte, acorn.KeySize)}
+	if _, err := cryptorand.Read(k.Key); err != nil {
+		return nil, err
+	}
+	k.ID = acorn.KeyID(k.Key)
+	return k, nil
+}
+
+// Read reads a key file, checking that it has safe permissions.
+// If the key is protected by a passphrase, passphrase is called to get it;
+// passphrase may be nil if no protected keys are expected.
+func Read(name string, passphrase func() ([]byte, error)) (*Key, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMode(name, fi.Mode()); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	k, err := Parse(b, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return k, nil
+}
+
+func checkMode(name string, mode os.FileMode) error {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		// permission bits don't mean much here
+		return nil
+	}
+	if mode.Perm()&0077 != 0 {
+		return &PermissionError{Name: name, Mode: mode}
+	}
+	return nil
+}
+
+// Write writes k to a new file with owner-only permissions.
+// If passphrase is not empty, the key is protected with it.
+// It is an error if the file already exists.
+func Write(name string, k *Key, passphrase []byte) error {
+	var b []byte
+	var err error
+	if len(passphrase) == 0 {
+		b, err = k.Marshal()
+	} else {
+		b, err = k.MarshalPassphrase(passphrase)
+	}
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(name)
+		return err
+	}
+	return f.Close()
+}
+
+// Equal reports whether k and other hold the same key, comparing the
+// keys in constant time. The IDs and comments are not compared.
+func (k *Key) Equal(other *Key) bool {
+	return acorn.KeysEqual(k.Key, other.Key)
+}
+
+// Marshal encodes k as an unprotected key file.
+func (k *Key) Marshal() ([]byte, error) {
+	if len(k.Key) != acorn.KeySize {
+		return nil, errors.New("keyfile: invalid key length")
+	}
+	var buf bytes.Buffer
+	k.writeHeader(&buf)
+	fmt.Fprintf(&buf, "key: %x\n", k.Key)
+	return buf.Bytes(), nil
+}
+
+// MarshalPassphrase encodes k as a key file protected by passphrase.
+func (k *Key) MarshalPassphrase(passphrase []byte) ([]byte, error) {
+	if len(k.Key) != acorn.KeySize {
+		return nil, errors.New("keyfile: invalid key length")
+	}
+	salt := make([]byte, saltSize)
+	if _, err := cryptorand.Read(salt); err != nil {
+		return nil, err
+	}
+	nonce, err := acorn.GenerateNonce(nil)
+	if err != nil {
+		return nil, err
+	}
+	kek := pbkdf2(passphrase, salt, iterations, acorn.KeySize)
+	sealed := acorn.NewAEAD(kek).Seal(nonce, nonce, k.Key, k.ID[:])
+
+	var buf bytes.Buffer
+	k.writeHeader(&buf)
+	fmt.Fprintf(&buf, "kdf: pbkdf2-sha256 %d %x\n", iterations, salt)
+	fmt.Fprintf(&buf, "sealed-key: %x\n", sealed)
+	return buf.Bytes(), nil
+}
+
+func (k *Key) writeHeader(buf *bytes.Buffer) {
+	if k.Comment != "" {
+		for _, line := range strings.Split(k.Comment, "\n") {
+			buf.WriteString(strings.TrimRight("# "+line, " "))
+			buf.WriteByte('\n')
+		}
+	}
+	fmt.Fprintf(buf, "id: %x\n", k.ID)
+}
+
+// Parse decodes a key file.
+// If the key is protected by a passphrase, passphrase is called to get it.
+func Parse(b []byte, passphrase func() ([]byte, error)) (*Key, error) {
+	k := new(Key)
+	var comments []string
+	fields := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for lineno := 1; s.Scan(); lineno++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		if line[0] == '#' {
+			comments = append(comments, strings.TrimSpace(line[1:]))
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return nil, fmt.Errorf("keyfile: line %d: missing colon", lineno)
+		}
+		name, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		switch name {
+		case "id", "key", "kdf", "sealed-key":
+		default:
+			return nil, fmt.Errorf("keyfile: line %d: unknown field %q", lineno, name)
+		}
+		if _, ok := fields[name]; ok {
+			return nil, fmt.Errorf("keyfile: line %d: duplicate field %q", lineno, name)
+		}
+		fields[name] = value
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	k.Comment = strings.Join(comments, "\n")
+
+	id, err := hex.DecodeString(fields["id"])
+	if err != nil || len(id) != len(k.ID) {
+		return nil, errors.New("keyfile: missing or invalid id")
+	}
+	copy(k.ID[:], id)
+
+	if v, ok := fields["key"]; ok {
+		if _, ok := fields["sealed-key"]; ok {
+			return nil, errors.New("keyfile: both key and sealed-key present")
+		}
+		k.Key, err = hex.DecodeString(v)
+		if err != nil || len(k.Key) != acorn.KeySize {
+			return nil, errors.New("keyfile: invalid key")
+		}
+		return k, nil
+	}
+
+	sealed, err := hex.DecodeString(fields["sealed-key"])
+	if err != nil || len(sealed) != acorn.NonceSize+acorn.KeySize+acorn.TagSize {
+		return nil, errors.New("keyfile: missing or invalid key")
+	}
+	kdf := strings.Fields(fields["kdf"])
+	if len(kdf) != 3 || kdf[0] != "pbkdf2-sha256" {
+		return nil, errors.New("keyfile: missing or unsupported kdf")
+	}
+	iter, err := strconv.Atoi(kdf[1])
+	if err != nil || iter <= 0 || iter > maxIterations {
+		return nil, errors.New("keyfile: invalid kdf iterations")
+	}
+	salt, err := hex.DecodeString(kdf[2])
+	if err != nil || len(salt) == 0 {
+		return nil, errors.New("keyfile: invalid kdf salt")
+	}
+	if passphrase == nil {
+		return nil, ErrPassphraseRequired
+	}
+	pass, err := passphrase()
+	if err != nil {
+		return nil, err
+	}
+	kek := pbkdf2(pass, salt, iter, acorn.KeySize)
+	nonce, ciphertext := sealed[:acorn.NonceSize], sealed[acorn.NonceSize:]
+	k.Key, err = acorn.NewAEAD(kek).Open(nil, nonce, ciphertext, k.ID[:])
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+	return k, nil
+}
+
+// pbkdf2 implements PBKDF2 with HMAC-SHA256 as described in RFC 8018.
+func pbkdf2(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var out []byte
+	var buf [4]byte
+	u := make([]byte, 0, sha256.Size)
+	t := make([]byte, sha256.Size)
+	for block := uint32(1); len(out) < keyLen; block++ {
+		binary.BigEndian.PutUint32(buf[:], block)
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(buf[:])
+		u = prf.Sum(u[:0])
+		copy(t, u)
+		for i := 1; i < iter; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:keyLen]
+}
@@ -0,0 +1,141 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package keyfile
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/magical/go-acorn"
+)
+
+func init() {
+	// keep the tests fast
+	iterations = 1000
+}
+
+func TestPBKDF2(t *testing.T) {
+	// test vectors from RFC 7914, section 11
+	for _, tt := range []struct {
+		password, salt string
+		iter           int
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	} {
+		got := hex.EncodeToString(pbkdf2([]byte(tt.password), []byte(tt.salt), tt.iter, 64))
+		if got != tt.want {
+			t.Errorf("pbkdf2(%q, %q, %d) = %s, want %s", tt.password, tt.salt, tt.iter, got, tt.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	k, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.ID != acorn.KeyID(k.Key) {
+		t.Errorf("Generate returned ID %x, want acorn.KeyID %x", k.ID, acorn.KeyID(k.Key))
+	}
+	k.Comment = "test key\nsecond line"
+
+	b, err := k.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := Parse(b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k2.ID != k.ID || !k2.Equal(k) || k2.Comment != k.Comment {
+		t.Errorf("Parse(Marshal(k)) = %+v, want %+v", k2, k)
+	}
+
+	pass := []byte("correct horse")
+	b, err = k.MarshalPassphrase(pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte(hex.EncodeToString(k.Key))) {
+		t.Errorf("protected key file contains the key")
+	}
+	if _, err := Parse(b, nil); err != ErrPassphraseRequired {
+		t.Errorf("no passphrase: got %v, want %v", err, ErrPassphraseRequired)
+	}
+	wrong := func() ([]byte, error) { return []byte("battery staple"), nil }
+	if _, err := Parse(b, wrong); err != ErrPassphrase {
+		t.Errorf("wrong passphrase: got %v, want %v", err, ErrPassphrase)
+	}
+	right := func() ([]byte, error) { return pass, nil }
+	k2, err = Parse(b, right)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k2.ID != k.ID || !bytes.Equal(k2.Key, k.Key) {
+		t.Errorf("Parse(MarshalPassphrase(k)) = %+v, want %+v", k2, k)
+	}
+
+	// the id is authenticated
+	b = bytes.Replace(b, []byte(hex.EncodeToString(k.ID[:])), []byte("0000000000000000"), 1)
+	if _, err := Parse(b, right); err != ErrPassphrase {
+		t.Errorf("modified id: got %v, want %v", err, ErrPassphrase)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"id: 0011223344556677\n",
+		"key: 000102030405060708090a0b0c0d0e0f\n",
+		"id: 00112233\nkey: 000102030405060708090a0b0c0d0e0f\n",
+		"id: 0011223344556677\nkey: 0001020304\n",
+		"id: 0011223344556677\nid: 0011223344556677\nkey: 000102030405060708090a0b0c0d0e0f\n",
+		"id: 0011223344556677\nkey: 000102030405060708090a0b0c0d0e0f\nfoo: bar\n",
+		"id: 0011223344556677\n000102030405060708090a0b0c0d0e0f\n",
+	} {
+		if _, err := Parse([]byte(s), nil); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("permissions are not checked on " + runtime.GOOS)
+	}
+	dir, err := ioutil.TempDir("", "keyfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "key")
+
+	k, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(name, k, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(name, k, nil); err == nil {
+		t.Errorf("Write overwrote an existing file")
+	}
+	if _, err := Read(name, nil); err != nil {
+		t.Errorf("Read: unexpected error: %v", err)
+	}
+	for _, mode := range []os.FileMode{0640, 0604, 0620, 0602} {
+		os.Chmod(name, mode)
+		if _, err := Read(name, nil); err == nil {
+			t.Errorf("Read succeeded on file with mode %v", mode)
+		} else if _, ok := err.(*PermissionError); !ok {
+			t.Errorf("mode %v: got %v, want a PermissionError", mode, err)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+// keyIDNonce is the nonce under which keyID seals an empty message.
+var keyIDNonce = []byte("acorn-128 key id")
+
+// KeyID returns an 8-byte identifier for key, which can be stored or
+// shown alongside ciphertexts to tell which key they need without
+// revealing the key. It is the first 8 bytes of the tag of an empty
+// message with no additional data, sealed under key with the nonce
+// "acorn-128 key id", so it is stable and, since ACORN-128 is a PRF
+// for the tag, does not help to recover the key.
+//
+// Key files from package keyfile, the agent, the headers of acornstream
+// streams, and the acorn command all use it to name keys, as does the
+// AuthFailure hook. If the key is not the correct length, KeyID will panic.
+func KeyID(key []byte) [8]byte {
+	if len(key) != KeySize {
+		panic("acorn: invalid key length")
+	}
+	k := loadKey(key)
+	return keyID(&k)
+}
+
+// keyID is KeyID for a loaded key.
+func keyID(k *[4]uint32) [8]byte {
+	var s state
+	var tag [TagSize]byte
+	s.init(k, keyIDNonce)
+	s.process(nil)
+	s.encrypt(nil, nil)
+	s.finalize(tag[:])
+	var id [8]byte
+	copy(id[:], tag[:])
+	return id
+}
@@ -0,0 +1,25 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKeyID(t *testing.T) {
+	key := countUp(KeySize)
+	id := KeyID(key)
+	// the definition, in terms of the public API
+	tag := NewAEAD(key).Seal(nil, []byte("acorn-128 key id"), nil, nil)
+	if !bytes.Equal(id[:], tag[:8]) {
+		t.Errorf("KeyID = %x, want %x", id, tag[:8])
+	}
+	if k := loadKey(key); keyID(&k) != id {
+		t.Error("keyID disagrees with KeyID")
+	}
+	key[0] ^= 1
+	if KeyID(key) == id {
+		t.Error("different keys have the same ID")
+	}
+}
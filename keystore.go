@@ -0,0 +1,153 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"crypto/cipher"
+	"errors"
+	"sync"
+)
+
+// A KeyStore provides memory to keep keys in, such as pages which are
+// locked into RAM and left out of core dumps. See package acornlock
+// for one that does this on platforms which support it.
+type KeyStore interface {
+	// Alloc returns zeroed memory for one key.
+	// It stays valid until it is passed to Free.
+	Alloc() (*[KeySize]byte, error)
+
+	// Free wipes and releases memory returned by Alloc.
+	Free(key *[KeySize]byte)
+}
+
+// A StoredAEAD is an ACORN-128 instance whose key lives in memory
+// from a KeyStore. It implements cipher.AEAD, but not Batch.
+//
+// The key is only copied out of the store onto the stack for the
+// length of each call to Seal or Open, and wiped from there afterward.
+// It always uses the Go implementation, even if an Engine is registered,
+// since an engine may keep copies of the key that the store cannot reach.
+type StoredAEAD struct {
+	mu     sync.RWMutex
+	key    *[KeySize]byte
+	ks     KeyStore
+	cancel func() // unregisters from Shutdown
+}
+
+var _ cipher.AEAD = (*StoredAEAD)(nil)
+
+// errClosed is the panic value for using a StoredAEAD after Close.
+const errClosed = "acorn: use of closed StoredAEAD"
+
+// NewAEADStore returns an ACORN instance which copies the given 128-bit
+// key into memory from store, or into ordinary memory if store is nil.
+// If the key is not the correct length, NewAEADStore will panic.
+// The caller should wipe its own copy of the key afterward, and call
+// Close when done with the instance. Until then, Shutdown erases the key.
+func NewAEADStore(key []byte, store KeyStore) (*StoredAEAD, error) {
+	if len(key) != KeySize {
+		panic("acorn: invalid key length")
+	}
+	if store == nil {
+		store = heapStore{}
+	}
+	k, err := store.Alloc()
+	if err != nil {
+		return nil, err
+	}
+	if k == nil {
+		return nil, errors.New("acorn: KeyStore returned no memory")
+	}
+	copy(k[:], key)
+	a := &StoredAEAD{key: k, ks: store}
+	a.cancel = OnShutdown(a.erase)
+	return a, nil
+}
+
+// heapStore is the KeyStore for ordinary memory.
+type heapStore struct{}
+
+func (heapStore) Alloc() (*[KeySize]byte, error) { return new([KeySize]byte), nil }
+func (heapStore) Free(*[KeySize]byte)            {}
+
+func (a *StoredAEAD) NonceSize() int {
+	return NonceSize
+}
+
+func (a *StoredAEAD) Overhead() int {
+	return TagSize
+}
+
+// load returns an aead holding the key, and must be followed by
+// a call to done. It panics if a has been closed.
+func (a *StoredAEAD) load() aead {
+	a.mu.RLock()
+	if a.key == nil {
+		a.mu.RUnlock()
+		panic(errClosed)
+	}
+	return aead{key: loadKey(a.key[:])}
+}
+
+func (a *StoredAEAD) done(k *aead) {
+	*k = aead{}
+	a.mu.RUnlock()
+}
+
+func (a *StoredAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	k := a.load()
+	defer a.done(&k)
+	return k.Seal(dst, nonce, plaintext, additionalData)
+}
+
+func (a *StoredAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	k := a.load()
+	defer a.done(&k)
+	return k.Open(dst, nonce, ciphertext, additionalData)
+}
+
+// Equal reports whether a and b hold the same key, comparing them
+// in constant time. It is false if either has been closed.
+func (a *StoredAEAD) Equal(b *StoredAEAD) bool {
+	var k [KeySize]byte
+	defer func() { k = [KeySize]byte{} }()
+	// Copy one key out rather than hold both locks,
+	// so that a.Equal(b) and b.Equal(a) can't deadlock.
+	if !a.copyKey(&k) {
+		return false
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.key != nil && KeysEqual(k[:], b.key[:])
+}
+
+// copyKey copies the key into k, and reports whether a is still open.
+func (a *StoredAEAD) copyKey(k *[KeySize]byte) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.key == nil {
+		return false
+	}
+	*k = *a.key
+	return true
+}
+
+// Close wipes the key and returns its memory to the store.
+// It waits for calls to Seal and Open in progress to finish;
+// later calls panic. Close is safe to call more than once.
+func (a *StoredAEAD) Close() error {
+	a.erase()
+	a.cancel()
+	return nil
+}
+
+// erase wipes the key, and is what Shutdown calls.
+func (a *StoredAEAD) erase() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.key != nil {
+		*a.key = [KeySize]byte{}
+		a.ks.Free(a.key)
+		a.key = nil
+	}
+}
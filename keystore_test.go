@@ -0,0 +1,92 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// countingStore is a KeyStore that hands out ordinary memory
+// and remembers what it has handed out.
+type countingStore struct {
+	live  map[*[KeySize]byte]bool
+	freed []*[KeySize]byte
+	err   error
+}
+
+func (s *countingStore) Alloc() (*[KeySize]byte, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	k := new([KeySize]byte)
+	if s.live == nil {
+		s.live = map[*[KeySize]byte]bool{}
+	}
+	s.live[k] = true
+	return k, nil
+}
+
+func (s *countingStore) Free(k *[KeySize]byte) {
+	if !s.live[k] {
+		panic("Free of memory not from Alloc")
+	}
+	if *k != ([KeySize]byte{}) {
+		panic("key was not wiped before Free")
+	}
+	delete(s.live, k)
+	s.freed = append(s.freed, k)
+}
+
+func TestAEADStore(t *testing.T) {
+	key := countUp(KeySize)
+	nonce := countUp(NonceSize)
+	store := new(countingStore)
+	a, err := NewAEADStore(key, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.live) != 1 {
+		t.Fatalf("%d keys allocated, want 1", len(store.live))
+	}
+	for k := range store.live {
+		if !bytes.Equal(k[:], key) {
+			t.Errorf("stored key is %x, want %x", k[:], key)
+		}
+	}
+
+	want := NewAEAD(key).Seal(nil, nonce, []byte("plaintext"), []byte("ad"))
+	ct := a.Seal(nil, nonce, []byte("plaintext"), []byte("ad"))
+	if !bytes.Equal(ct, want) {
+		t.Errorf("Seal = %x, want %x", ct, want)
+	}
+	if pt, err := a.Open(nil, nonce, ct, []byte("ad")); err != nil || string(pt) != "plaintext" {
+		t.Errorf("Open = %q, %v", pt, err)
+	}
+	ct[0] ^= 1
+	if _, err := a.Open(nil, nonce, ct, []byte("ad")); err != ErrAuthentication {
+		t.Errorf("Open of a forgery returned %v, want ErrAuthentication", err)
+	}
+
+	a.Close()
+	a.Close()
+	if len(store.live) != 0 || len(store.freed) != 1 {
+		t.Errorf("after Close: %d keys live and %d freed, want 0 and 1", len(store.live), len(store.freed))
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Seal after Close did not panic")
+			}
+		}()
+		a.Seal(nil, nonce, nil, nil)
+	}()
+}
+
+func TestAEADStoreError(t *testing.T) {
+	want := errors.New("out of locked memory")
+	if _, err := NewAEADStore(countUp(KeySize), &countingStore{err: want}); err != want {
+		t.Errorf("NewAEADStore returned %v, want %v", err, want)
+	}
+}
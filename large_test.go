@@ -0,0 +1,165 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build amd64 || arm64 || loong64 || mips64 || mips64le || ppc64 || ppc64le || riscv64 || s390x
+// +build amd64 arm64 loong64 mips64 mips64le ppc64 ppc64le riscv64 s390x
+
+package acorn
+
+import (
+	"bytes"
+	"flag"
+	"testing"
+)
+
+var large = flag.Bool("large", false, "run tests on messages larger than 4 GiB")
+
+// largeSize is just over 4 GiB, and not a multiple of 4, so that any
+// length or index that is truncated to 32 bits goes wrong. It doesn't
+// fit in an int on 32-bit platforms, hence the build constraint.
+const largeSize = 1<<32 + 37
+
+// largeBuffer returns a largeSize buffer with room for a tag,
+// holding a pattern that differs every 4 GiB.
+func largeBuffer(t *testing.T) []byte {
+	if !*large || testing.Short() {
+		t.Skip("needs more than 4 GiB of memory; use -large to run")
+	}
+	b := make([]byte, largeSize, largeSize+TagSize)
+	for i := 0; i < len(b); i += 1 << 20 {
+		b[i] = byte(i >> 20)
+	}
+	b[len(b)-1] = 0xff
+	return b
+}
+
+// stepBytes runs b through one update32 or update8 per word or byte,
+// and XORs the keystream into b if cb is 0. Unlike the crypt loops,
+// it does no padding, so a message can be fed to it in pieces.
+func (s *state) stepBytes(b []byte, cb uint32) {
+	for len(b) >= 4 {
+		ks := s.update32(load32(b), one, cb)
+		if cb == 0 {
+			store32(b, load32(b)^ks)
+		}
+		b = b[4:]
+	}
+	for i := range b {
+		ks := s.update8(uint32(b[i]), one, cb)
+		if cb == 0 {
+			b[i] ^= uint8(ks)
+		}
+	}
+}
+
+// sample returns the bytes of b around each 1 GiB boundary and at the end.
+func sample(b []byte) [][]byte {
+	var out [][]byte
+	for i := 1 << 30; i < len(b); i += 1 << 30 {
+		out = append(out, b[i-8:i+8])
+	}
+	return append(out, b[len(b)-16:])
+}
+
+func TestLargePlaintext(t *testing.T) {
+	b := largeBuffer(t)
+	key := make([]byte, KeySize)
+	nonce := make([]byte, NonceSize)
+	ad := []byte("large")
+
+	// Work out the expected ciphertext of a copy of the sampled parts
+	// one step at a time. The copies are made first, since the
+	// plaintext is needed again afterwards.
+	var s state
+	k := loadKey(key)
+	s.init(&k, nonce)
+	s.process(ad)
+	var want [][]byte
+	samples := sample(b)
+	var off [][2]int
+	for _, x := range samples {
+		want = append(want, append([]byte(nil), x...))
+		i := cap(b) - cap(x)
+		off = append(off, [2]int{i, i + len(x)})
+	}
+	prev := 0
+	scratch := make([]byte, 1<<20)
+	for j, o := range off {
+		for i := prev; i < o[0]; i += len(scratch) {
+			n := copy(scratch, b[i:o[0]])
+			s.stepBytes(scratch[:n], 0)
+		}
+		s.stepBytes(want[j], 0)
+		prev = o[1]
+	}
+	s.pad(0)
+	wantTag := s.finalize(make([]byte, TagSize))
+
+	a := NewAEAD(key)
+	c := a.Seal(b[:0], nonce, b, ad)
+	if len(c) != largeSize+TagSize {
+		t.Fatalf("Seal returned %d bytes, want %d", len(c), largeSize+TagSize)
+	}
+	for j, o := range off {
+		if got := c[o[0]:o[1]]; !bytes.Equal(got, want[j]) {
+			t.Errorf("ciphertext at %#x = %x, want %x", o[0], got, want[j])
+		}
+	}
+	if got := c[largeSize:]; !bytes.Equal(got, wantTag) {
+		t.Errorf("tag = %x, want %x", got, wantTag)
+	}
+
+	p, err := a.Open(c[:0], nonce, c, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != largeSize {
+		t.Fatalf("Open returned %d bytes, want %d", len(p), largeSize)
+	}
+	for i := range p {
+		want := byte(0)
+		if i%(1<<20) == 0 {
+			want = byte(i >> 20)
+		}
+		if i == len(p)-1 {
+			want = 0xff
+		}
+		if p[i] != want {
+			t.Fatalf("plaintext[%#x] = %#x, want %#x", i, p[i], want)
+		}
+	}
+}
+
+func TestLargeAdditionalData(t *testing.T) {
+	ad := largeBuffer(t)
+	key := make([]byte, KeySize)
+	nonce := make([]byte, NonceSize)
+	p := []byte("small")
+
+	var s state
+	k := loadKey(key)
+	s.init(&k, nonce)
+	for i := 0; i < len(ad); i += 1 << 20 {
+		j := i + 1<<20
+		if j > len(ad) {
+			j = len(ad)
+		}
+		s.stepBytes(ad[i:j], one)
+	}
+	s.pad(one)
+	want := make([]byte, len(p)+TagSize)
+	s.encrypt(want, p)
+	s.finalize(want[len(p):])
+
+	a := NewAEAD(key)
+	c := a.Seal(nil, nonce, p, ad)
+	if !bytes.Equal(c, want) {
+		t.Fatalf("Seal = %x, want %x", c, want)
+	}
+	if _, err := a.Open(nil, nonce, c, ad); err != nil {
+		t.Fatal(err)
+	}
+	ad[1<<32] ^= 1
+	if _, err := a.Open(nil, nonce, c, ad); err == nil {
+		t.Fatal("Open accepted additional data changed after the first 4 GiB")
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build !acorn_unsafe || !(386 || amd64 || arm64 || ppc64le || riscv64 || wasm)
+// +build !acorn_unsafe !386,!amd64,!arm64,!ppc64le,!riscv64,!wasm
+
+package acorn
+
+import "encoding/binary"
+
+// load32 and store32 read and write the little-endian words
+// that the bulk loops process. See le_unsafe.go.
+
+func load32(b []byte) uint32 {
+	return binary.LittleEndian.Uint32(b)
+}
+
+func store32(b []byte, x uint32) {
+	binary.LittleEndian.PutUint32(b, x)
+}
@@ -0,0 +1,26 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build acorn_unsafe && (386 || amd64 || arm64 || ppc64le || riscv64 || wasm)
+// +build acorn_unsafe
+// +build 386 amd64 arm64 ppc64le riscv64 wasm
+
+package acorn
+
+import "unsafe"
+
+// With the acorn_unsafe build tag, load32 and store32 use unaligned
+// loads and stores directly on little-endian platforms that allow them,
+// instead of going through encoding/binary.
+//
+// Recent compilers already turn encoding/binary into a single load or
+// store on these platforms, so measure before relying on this.
+
+func load32(b []byte) uint32 {
+	_ = b[3] // bounds check
+	return *(*uint32)(unsafe.Pointer(&b[0]))
+}
+
+func store32(b []byte, x uint32) {
+	_ = b[3] // bounds check
+	*(*uint32)(unsafe.Pointer(&b[0])) = x
+}
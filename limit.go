@@ -0,0 +1,96 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrKeyExhausted is returned when sealing a message would take a key
+// past its usage limits. The key should be rotated.
+var ErrKeyExhausted = errors.New("acorn: key has reached its usage limit")
+
+// Limits bounds how much one key may seal.
+// A zero field means no limit.
+type Limits struct {
+	Messages uint64 // number of messages
+	Bytes    uint64 // total length of the plaintexts
+}
+
+// A Meter counts the messages and bytes sealed under one key against
+// its Limits. It is safe for concurrent use.
+type Meter struct {
+	limits Limits
+
+	mu       sync.Mutex
+	messages uint64
+	bytes    uint64
+}
+
+// NewMeter returns a Meter with nothing counted yet.
+func NewMeter(limits Limits) *Meter {
+	return &Meter{limits: limits}
+}
+
+// Use counts one message with an n-byte plaintext, or returns
+// ErrKeyExhausted, without counting it, if that would exceed the limits.
+func (m *Meter) Use(n int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := m.limits
+	if l.Messages != 0 && m.messages >= l.Messages {
+		return ErrKeyExhausted
+	}
+	if l.Bytes != 0 && (uint64(n) > l.Bytes || m.bytes > l.Bytes-uint64(n)) {
+		return ErrKeyExhausted
+	}
+	m.messages++
+	m.bytes += uint64(n)
+	return nil
+}
+
+// Usage returns the number of messages and bytes counted so far.
+func (m *Meter) Usage() (messages, bytes uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.messages, m.bytes
+}
+
+// A LimitedAEAD is a CheckedAEAD whose Seal returns ErrKeyExhausted once
+// the key has sealed as much as its Limits allow, so that operators must
+// rotate it rather than silently go past safe bounds. Messages which fail
+// to seal for other reasons do not count. It is safe for concurrent use.
+type LimitedAEAD struct {
+	CheckedAEAD
+	meter *Meter
+}
+
+// NewLimitedAEAD returns a LimitedAEAD that uses the given 128-bit key.
+func NewLimitedAEAD(key []byte, limits Limits) (*LimitedAEAD, error) {
+	c, err := NewCheckedAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &LimitedAEAD{CheckedAEAD: *c, meter: NewMeter(limits)}, nil
+}
+
+// Seal is like CheckedAEAD's Seal, but returns ErrKeyExhausted
+// if the message would exceed the limits.
+func (a *LimitedAEAD) Seal(dst, nonce, plaintext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != NonceSize {
+		return dst, NonceSizeError(len(nonce))
+	}
+	if len(plaintext) > maxInt-TagSize-len(dst) {
+		return dst, ErrMessageTooLarge
+	}
+	if err := a.meter.Use(len(plaintext)); err != nil {
+		return dst, err
+	}
+	return a.CheckedAEAD.Seal(dst, nonce, plaintext, additionalData)
+}
+
+// Usage returns the number of messages and bytes sealed so far.
+func (a *LimitedAEAD) Usage() (messages, bytes uint64) {
+	return a.meter.Usage()
+}
@@ -0,0 +1,53 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import "testing"
+
+func TestMeter(t *testing.T) {
+	m := NewMeter(Limits{Messages: 3, Bytes: 100})
+	for _, tt := range []struct {
+		n   int
+		err error
+	}{
+		{40, nil},
+		{101, ErrKeyExhausted}, // too big on its own
+		{60, nil},
+		{1, ErrKeyExhausted}, // bytes used up
+		{0, nil},
+		{0, ErrKeyExhausted}, // messages used up
+	} {
+		if err := m.Use(tt.n); err != tt.err {
+			t.Errorf("Use(%d) = %v, want %v", tt.n, err, tt.err)
+		}
+	}
+	if msgs, bytes := m.Usage(); msgs != 3 || bytes != 100 {
+		t.Errorf("Usage() = %d, %d; want 3, 100", msgs, bytes)
+	}
+	if err := NewMeter(Limits{}).Use(1 << 30); err != nil {
+		t.Errorf("Use with no limits returned %v", err)
+	}
+}
+
+func TestLimitedAEAD(t *testing.T) {
+	a, err := NewLimitedAEAD(countUp(KeySize), Limits{Messages: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := countUp(NonceSize)
+	if _, err := a.Seal(nil, nonce[:4], nil, nil); err != NonceSizeError(4) {
+		t.Errorf("Seal with a short nonce returned %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		nonce[0] = byte(i)
+		if _, err := a.Seal(nil, nonce, []byte("p"), nil); err != nil {
+			t.Fatalf("Seal %d: %v", i, err)
+		}
+	}
+	if out, err := a.Seal([]byte("dst"), nonce, []byte("p"), nil); err != ErrKeyExhausted || string(out) != "dst" {
+		t.Errorf("Seal past the limit = %q, %v; want ErrKeyExhausted", out, err)
+	}
+	if msgs, _ := a.Usage(); msgs != 2 {
+		t.Errorf("%d messages counted, want 2", msgs)
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"crypto/cipher"
+	cryptorand "crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"io"
+)
+
+// A MaskedAEAD is an ACORN-128 instance which keeps the cipher state
+// XOR-masked while it works, as a countermeasure against simple power
+// and electromagnetic analysis on embedded targets. The state is held
+// as two random shares whose XOR is the real state. The LFSRs are
+// linear, so each share is updated on its own, and the nonlinear
+// functions use masked AND gates with fresh randomness. The key is held
+// as two shares as well, which are fed into the state shares
+// separately, so that it is never recombined.
+//
+// Each call to Seal or Open seeds a small generator from rand for the
+// randomness it needs, picks a random initial mask, and re-masks the
+// state between the initialization, additional data, text, and
+// finalization phases. The keystream is only unmasked where it is
+// XORed into the output, and the tag once it is complete.
+//
+// Masking raises the cost of an attack; it does not rule one out. The
+// Go compiler makes no promises about how it schedules the shares, so
+// check the generated code on the target that matters. A MaskedAEAD
+// is several times slower than NewAEAD, always uses the Go
+// implementation, and implements cipher.AEAD but not Batch.
+type MaskedAEAD struct {
+	k0, k1 [4]uint32
+	rand   io.Reader
+}
+
+var _ cipher.AEAD = (*MaskedAEAD)(nil)
+
+// NewAEADMasked returns a MaskedAEAD for the given 128-bit key, drawing
+// randomness from rand, or from crypto/rand if rand is nil. rand must
+// be safe for concurrent use if the MaskedAEAD is. If the key is not the
+// correct length, NewAEADMasked will panic.
+func NewAEADMasked(key []byte, rand io.Reader) (*MaskedAEAD, error) {
+	if len(key) != KeySize {
+		panic("acorn: invalid key length")
+	}
+	if rand == nil {
+		rand = cryptorand.Reader
+	}
+	var r [KeySize]byte
+	defer func() { r = [KeySize]byte{} }()
+	if _, err := io.ReadFull(rand, r[:]); err != nil {
+		return nil, err
+	}
+	a := &MaskedAEAD{rand: rand}
+	k := loadKey(key)
+	a.k0 = loadKey(r[:])
+	for i := range k {
+		a.k1[i] = k[i] ^ a.k0[i]
+	}
+	k = [4]uint32{}
+	return a, nil
+}
+
+func (a *MaskedAEAD) NonceSize() int {
+	return NonceSize
+}
+
+func (a *MaskedAEAD) Overhead() int {
+	return TagSize
+}
+
+func (a *MaskedAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != NonceSize {
+		panic("acorn: invalid nonce length")
+	}
+	if uint64(len(plaintext)) > uint64(maxInt-len(dst)-TagSize) {
+		panic(ErrMessageTooLarge.Error())
+	}
+	ret, out := sliceForAppend(dst, len(plaintext)+TagSize)
+	var s maskedState
+	a.start(&s, nonce, additionalData)
+	s.crypt(out[:len(plaintext)], plaintext, 0)
+	s.finalize(out[len(plaintext):])
+	return ret
+}
+
+func (a *MaskedAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != NonceSize {
+		panic("acorn: invalid nonce length")
+	}
+	if len(ciphertext) < TagSize {
+		k := a.unmaskedKey()
+		reportFailure(&k, len(ciphertext), len(additionalData))
+		k = [4]uint32{}
+		return dst, ErrAuthentication
+	}
+	n := len(ciphertext) - TagSize
+	ret, out := sliceForAppend(dst, n)
+	var s maskedState
+	a.start(&s, nonce, additionalData)
+	s.crypt(out, ciphertext[:n], one)
+	var tag [TagSize]byte
+	s.finalize(tag[:])
+	if subtle.ConstantTimeCompare(ciphertext[n:], tag[:]) == 0 {
+		for i := range out {
+			out[i] = 0
+		}
+		k := a.unmaskedKey()
+		reportFailure(&k, len(ciphertext), len(additionalData))
+		k = [4]uint32{}
+		return dst, ErrAuthentication
+	}
+	return ret, nil
+}
+
+// unmaskedKey recombines the key, which is only needed to report
+// an authentication failure.
+func (a *MaskedAEAD) unmaskedKey() [4]uint32 {
+	var k [4]uint32
+	for i := range k {
+		k[i] = a.k0[i] ^ a.k1[i]
+	}
+	return k
+}
+
+// start seeds s, initializes it, and processes the additional data.
+func (a *MaskedAEAD) start(s *maskedState, nonce, ad []byte) {
+	var seed [16]byte
+	if _, err := io.ReadFull(a.rand, seed[:]); err != nil {
+		panic("acorn: reading mask randomness: " + err.Error())
+	}
+	s.rng = [2]uint64{binary.LittleEndian.Uint64(seed[:]), binary.LittleEndian.Uint64(seed[8:]) | 1}
+	seed = [16]byte{}
+	s.remask()
+
+	// the key shares are re-masked for this call too
+	var k0, k1 [4]uint32
+	for i := range k0 {
+		r := s.random()
+		k0[i], k1[i] = a.k0[i]^r, a.k1[i]^r
+	}
+	for i := 0; i < 1792/32; i++ {
+		var m0, m1 uint32
+		switch {
+		case i >= 4 && i < 8:
+			m0 = binary.LittleEndian.Uint32(nonce[(i-4)*4:])
+		default:
+			m0, m1 = k0[i%4], k1[i%4]
+		}
+		if i == 8 {
+			m0 ^= 0x01
+		}
+		s.update(32, m0, m1, one, one)
+	}
+	k0, k1 = [4]uint32{}, [4]uint32{}
+	s.remask()
+
+	i := 0
+	for ; i+4 <= len(ad); i += 4 {
+		s.update(32, binary.LittleEndian.Uint32(ad[i:]), 0, one, one)
+	}
+	for ; i < len(ad); i++ {
+		s.update(8, uint32(ad[i]), 0, one, one)
+	}
+	s.pad(one)
+	s.remask()
+}
+
+// A maskedState is a state held as two shares, a and b, whose XOR is
+// the real state, with a generator for the masking randomness.
+type maskedState struct {
+	a, b state
+	rng  [2]uint64 // xorshift128+
+}
+
+func (s *maskedState) random() uint32 {
+	x, y := s.rng[0], s.rng[1]
+	s.rng[0] = y
+	x ^= x << 23
+	s.rng[1] = x ^ y ^ x>>17 ^ y>>26
+	return uint32((s.rng[1] + y) >> 32)
+}
+
+func (s *maskedState) random64() uint64 {
+	return uint64(s.random())<<32 | uint64(s.random())
+}
+
+// remask XORs the same random words into both shares,
+// which leaves the real state as it was.
+func (s *maskedState) remask() {
+	for _, w := range [...]struct{ a, b *uint64 }{
+		{&s.a.s230, &s.b.s230}, {&s.a.s193, &s.b.s193}, {&s.a.s154, &s.b.s154},
+		{&s.a.s107, &s.b.s107}, {&s.a.s61, &s.b.s61}, {&s.a.s0, &s.b.s0},
+	} {
+		r := s.random64()
+		*w.a ^= r
+		*w.b ^= r
+	}
+}
+
+// and returns shares of (x0^x1) & (y0^y1), the first-order
+// masked AND gate of Ishai, Sahai, and Wagner.
+func (s *maskedState) and(x0, x1, y0, y1 uint32) (z0, z1 uint32) {
+	r := s.random()
+	z0 = x0&y0 ^ r
+	z1 = x1&y1 ^ (r ^ x0&y1 ^ x1&y0)
+	return z0, z1
+}
+
+func (s *maskedState) maj(x0, x1, y0, y1, z0, z1 uint32) (uint32, uint32) {
+	p0, p1 := s.and(x0, x1, y0, y1)
+	q0, q1 := s.and(z0, z1, x0^y0, x1^y1)
+	return p0 ^ q0, p1 ^ q1
+}
+
+func (s *maskedState) ch(x0, x1, y0, y1, z0, z1 uint32) (uint32, uint32) {
+	p0, p1 := s.and(x0, x1, y0^z0, y1^z1)
+	return z0 ^ p0, z1 ^ p1
+}
+
+// taps holds the state bits that an update reads, with the LFSR
+// feedback applied, as update8 and update32 compute them.
+type taps struct {
+	s244, s235, s196, s160, s111, s66, s23, s12, s0 uint32
+	x289, s230, s193, s154, s107, s61               uint32
+}
+
+func (t *taps) load(s *state, mask uint32) {
+	t.s244 = uint32(s.s230 >> 14)
+	t.s235 = uint32(s.s230 >> 5)
+	t.s196 = uint32(s.s193 >> 3)
+	t.s160 = uint32(s.s154 >> 6)
+	t.s111 = uint32(s.s107 >> 4)
+	t.s66 = uint32(s.s61 >> 5)
+	t.s23 = uint32(s.s0 >> 23)
+	t.s12 = uint32(s.s0 >> 12)
+	t.s0 = uint32(s.s0)
+
+	t.x289 = (t.s235 ^ uint32(s.s230)) & mask
+	t.s230 = (uint32(s.s230) ^ t.s196 ^ uint32(s.s193)) & mask
+	t.s193 = (uint32(s.s193) ^ t.s160 ^ uint32(s.s154)) & mask
+	t.s154 = (uint32(s.s154) ^ t.s111 ^ uint32(s.s107)) & mask
+	t.s107 = (uint32(s.s107) ^ t.s66 ^ uint32(s.s61)) & mask
+	t.s61 = (uint32(s.s61) ^ t.s23 ^ t.s0) & mask
+}
+
+func (t *taps) store(s *state, n uint, s293 uint32) {
+	s.s230 = s.s230>>n ^ uint64(t.x289)<<(289-230-n) ^ uint64(s293)<<(293-230-n)
+	s.s193 = s.s193>>n ^ uint64(t.s230)<<(230-193-n)
+	s.s154 = s.s154>>n ^ uint64(t.s193)<<(193-154-n)
+	s.s107 = s.s107>>n ^ uint64(t.s154)<<(154-107-n)
+	s.s61 = s.s61>>n ^ uint64(t.s107)<<(107-61-n)
+	s.s0 = s.s0>>n ^ uint64(t.s61)<<(61-n)
+}
+
+// update performs n state updates, where n is 8 or 32, with the
+// message given as shares m0 and m1, and returns the keystream
+// as shares.
+func (s *maskedState) update(n uint, m0, m1, ca, cb uint32) (ks0, ks1 uint32) {
+	mask := ^uint32(0) >> (32 - n)
+	var a, b taps
+	a.load(&s.a, mask)
+	b.load(&s.b, mask)
+
+	ja, jb := s.maj(a.s235, b.s235, a.s61, b.s61, a.s193, b.s193)
+	ha, hb := s.ch(a.s230, b.s230, a.s111, b.s111, a.s66, b.s66)
+	ks0 = (a.s12 ^ a.s154 ^ ja ^ ha) & mask
+	ks1 = (b.s12 ^ b.s154 ^ jb ^ hb) & mask
+
+	ja, jb = s.maj(a.s244, b.s244, a.s23, b.s23, a.s160, b.s160)
+	f0 := a.s0 ^ ^a.s107 ^ ja ^ (ca & a.s196) ^ (cb & ks0)
+	f1 := b.s0 ^ b.s107 ^ jb ^ (ca & b.s196) ^ (cb & ks1)
+
+	a.store(&s.a, n, (f0^m0)&mask)
+	b.store(&s.b, n, (f1^m1)&mask)
+	return ks0, ks1
+}
+
+func (s *maskedState) pad(cb uint32) {
+	s.update(32, 0x01, 0, one, cb)
+	for i := 32; i < 128; i += 32 {
+		s.update(32, 0, 0, one, cb)
+	}
+	for i := 128; i < 256; i += 32 {
+		s.update(32, 0, 0, 0, cb)
+	}
+}
+
+// crypt encrypts src into dst with cb = 0,
+// or decrypts it with cb = one, and pads.
+func (s *maskedState) crypt(dst, src []byte, cb uint32) {
+	i := 0
+	for ; i+4 <= len(src); i += 4 {
+		m := binary.LittleEndian.Uint32(src[i:])
+		ks0, ks1 := s.update(32, m, 0, one, cb)
+		binary.LittleEndian.PutUint32(dst[i:], m^ks0^ks1)
+	}
+	for ; i < len(src); i++ {
+		ks0, ks1 := s.update(8, uint32(src[i]), 0, one, cb)
+		dst[i] = src[i] ^ uint8(ks0) ^ uint8(ks1)
+	}
+	s.pad(0)
+	s.remask()
+}
+
+// finalize writes the tag and wipes s.
+func (s *maskedState) finalize(tag []byte) {
+	for i := 0; i < (640+128)/32; i++ {
+		ks0, ks1 := s.update(32, 0, 0, one, one)
+		if i >= 640/32 {
+			binary.LittleEndian.PutUint32(tag[(i-640/32)*4:], ks0^ks1)
+		}
+	}
+	*s = maskedState{}
+}
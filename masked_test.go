@@ -0,0 +1,83 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMasked(t *testing.T) {
+	key, nonce := countUp(KeySize), countUp(NonceSize)
+	a, err := NewAEADMasked(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.k0 == loadKey(key) || a.k1 == loadKey(key) {
+		t.Errorf("key is not masked")
+	}
+	ref := NewAEAD(key)
+	for _, n := range []int{0, 1, 3, 4, 13, 100} {
+		msg, ad := countUp(n), countUp(n/3)
+		want := ref.Seal(nil, nonce, msg, ad)
+		ct := a.Seal(nil, nonce, msg, ad)
+		if !bytes.Equal(ct, want) {
+			t.Errorf("len %d: Seal = %x, want %x", n, ct, want)
+		}
+		if p, err := a.Open(nil, nonce, ct, ad); err != nil || !bytes.Equal(p, msg) {
+			t.Errorf("len %d: Open = %x, %v", n, p, err)
+		}
+		ct[0] ^= 1
+		if _, err := a.Open(nil, nonce, ct, ad); err != ErrAuthentication {
+			t.Errorf("len %d: Open of a modified message returned %v", n, err)
+		}
+	}
+	dst := []byte("prefix")
+	for _, ct := range [][]byte{a.Seal(nil, nonce, nil, nil)[1:], make([]byte, TagSize)} {
+		if p, err := a.Open(dst, nonce, ct, nil); err != ErrAuthentication || !bytes.Equal(p, dst) {
+			t.Errorf("Open of %d bad bytes = %q, %v; want dst and ErrAuthentication", len(ct), p, err)
+		}
+	}
+}
+
+// TestMaskedShares checks that the shares are re-randomized,
+// and that they combine to the unmasked state.
+func TestMaskedShares(t *testing.T) {
+	k := loadKey(countUp(KeySize))
+	nonce := countUp(NonceSize)
+	var want state
+	want.init(&k, nonce)
+
+	a := &MaskedAEAD{k0: k}
+	seeds := []byte("0123456789abcdefFEDCBA9876543210")
+	var first state
+	for i := 0; i < 2; i++ {
+		a.rand = bytes.NewReader(seeds[i*16:])
+		var s maskedState
+		a.start(&s, nonce, nil)
+		var got state
+		got.s230, got.s193, got.s154 = s.a.s230^s.b.s230, s.a.s193^s.b.s193, s.a.s154^s.b.s154
+		got.s107, got.s61, got.s0 = s.a.s107^s.b.s107, s.a.s61^s.b.s61, s.a.s0^s.b.s0
+		w := want
+		w.process(nil)
+		if got != w {
+			t.Errorf("shares combine to %+v, want %+v", got, w)
+		}
+		if i == 0 {
+			first = s.a
+		} else if s.a == first {
+			t.Errorf("different seeds gave the same shares")
+		}
+	}
+}
+
+func TestMaskedRandError(t *testing.T) {
+	if _, err := NewAEADMasked(countUp(KeySize), errReader{}); err == nil {
+		t.Errorf("NewAEADMasked ignored a failing rand")
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("no randomness") }
@@ -0,0 +1,20 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+// Seal seals plaintext under key with the given nonce and additional
+// data, and returns the ciphertext followed by the tag. It is the same as
+// NewAEAD(key).Seal(nil, nonce, plaintext, additionalData), for one-off
+// use; code sealing many messages under one key should keep an AEAD.
+// Like NewAEAD and Seal, it panics if the key or nonce is the wrong length.
+func Seal(key, nonce, plaintext, additionalData []byte) []byte {
+	return NewAEAD(key).Seal(nil, nonce, plaintext, additionalData)
+}
+
+// Open opens a ciphertext returned by Seal. It is the same as
+// NewAEAD(key).Open(nil, nonce, ciphertext, additionalData), and returns
+// ErrAuthentication if the ciphertext, nonce, and additional data do
+// not authenticate under key.
+func Open(key, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	return NewAEAD(key).Open(nil, nonce, ciphertext, additionalData)
+}
@@ -0,0 +1,38 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestOneShot(t *testing.T) {
+	key, nonce := countUp(KeySize), countUp(NonceSize)
+	msg, ad := []byte("one-off message"), []byte("ad")
+	ct := Seal(key, nonce, msg, ad)
+	if want := NewAEAD(key).Seal(nil, nonce, msg, ad); !bytes.Equal(ct, want) {
+		t.Errorf("Seal = %x, want %x", ct, want)
+	}
+	if got, err := Open(key, nonce, ct, ad); err != nil || !bytes.Equal(got, msg) {
+		t.Errorf("Open = %q, %v", got, err)
+	}
+	if _, err := Open(key, nonce, ct, nil); err != ErrAuthentication {
+		t.Errorf("Open with the wrong additional data returned %v", err)
+	}
+	if _, err := Open(key, nonce, ct[:TagSize-1], ad); err != ErrAuthentication {
+		t.Errorf("Open of a short ciphertext returned %v", err)
+	}
+
+	mustPanic := func(name string, f func()) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s did not panic", name)
+			}
+		}()
+		f()
+	}
+	mustPanic("Seal with a short key", func() { Seal(key[1:], nonce, msg, ad) })
+	mustPanic("Seal with a short nonce", func() { Seal(key, nonce[1:], msg, ad) })
+	mustPanic("Open with a short key", func() { Open(key[1:], nonce, ct, ad) })
+}
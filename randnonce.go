@@ -0,0 +1,40 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"crypto/cipher"
+	cryptorand "crypto/rand"
+	"io"
+)
+
+// SealWithRandomNonce seals plaintext with a under a fresh nonce from
+// crypto/rand, and appends the nonce followed by the ciphertext and tag to
+// dst. It saves callers from choosing nonces themselves, which is where
+// most misuse comes from. The result is a.NonceSize()+a.Overhead() bytes
+// longer than plaintext. dst and plaintext must not overlap.
+//
+// It works with any cipher.AEAD, but is meant for the ones from this
+// package, whose nonces are large enough to choose at random.
+func SealWithRandomNonce(a cipher.AEAD, dst, plaintext, additionalData []byte) ([]byte, error) {
+	return sealWithRandomNonce(a, cryptorand.Reader, dst, plaintext, additionalData)
+}
+
+func sealWithRandomNonce(a cipher.AEAD, rand io.Reader, dst, plaintext, additionalData []byte) ([]byte, error) {
+	ret, nonce := sliceForAppend(dst, a.NonceSize())
+	if _, err := io.ReadFull(rand, nonce); err != nil {
+		return dst, err
+	}
+	return a.Seal(ret, nonce, plaintext, additionalData), nil
+}
+
+// OpenWithNonce opens a message sealed by SealWithRandomNonce and appends
+// the plaintext to dst. It returns ErrAuthentication if sealed is too
+// short to hold a nonce and tag, or otherwise what a.Open returns.
+func OpenWithNonce(a cipher.AEAD, dst, sealed, additionalData []byte) ([]byte, error) {
+	n := a.NonceSize()
+	if len(sealed) < n+a.Overhead() {
+		return dst, ErrAuthentication
+	}
+	return a.Open(dst, sealed[:n], sealed[n:], additionalData)
+}
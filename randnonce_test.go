@@ -0,0 +1,58 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSealWithRandomNonce(t *testing.T) {
+	a := NewAEAD(countUp(KeySize))
+	pt := []byte("attack at dawn")
+	ad := []byte("header")
+	prefix := []byte("prefix")
+
+	sealed, err := SealWithRandomNonce(a, prefix, pt, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sealed) != len(prefix)+NonceSize+len(pt)+TagSize || !bytes.HasPrefix(sealed, prefix) {
+		t.Fatalf("SealWithRandomNonce = %x", sealed)
+	}
+	sealed = sealed[len(prefix):]
+	nonce := sealed[:NonceSize]
+	if want := a.Seal(nil, nonce, pt, ad); !bytes.Equal(sealed[NonceSize:], want) {
+		t.Errorf("ciphertext = %x, want %x", sealed[NonceSize:], want)
+	}
+	got, err := OpenWithNonce(a, nil, sealed, ad)
+	if err != nil || !bytes.Equal(got, pt) {
+		t.Errorf("OpenWithNonce = %q, %v", got, err)
+	}
+
+	again, err := SealWithRandomNonce(a, nil, pt, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again[:NonceSize], nonce) {
+		t.Errorf("the same nonce was chosen twice")
+	}
+
+	for n := 0; n < NonceSize+TagSize; n++ {
+		if _, err := OpenWithNonce(a, nil, sealed[:n], ad); err != ErrAuthentication {
+			t.Errorf("OpenWithNonce of %d bytes returned %v, want ErrAuthentication", n, err)
+		}
+	}
+	sealed[0] ^= 1
+	if _, err := OpenWithNonce(a, nil, sealed, ad); err != ErrAuthentication {
+		t.Errorf("OpenWithNonce with a changed nonce returned %v, want ErrAuthentication", err)
+	}
+}
+
+func TestSealWithRandomNonceError(t *testing.T) {
+	dst := []byte("dst")
+	out, err := sealWithRandomNonce(NewAEAD(countUp(KeySize)), failReader{}, dst, []byte("p"), nil)
+	if err == nil || string(out) != "dst" {
+		t.Errorf("sealWithRandomNonce with failing rand = %q, %v", out, err)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build acorn_reduced
+// +build acorn_reduced
+
+package acorn
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"strconv"
+)
+
+// This file is only built with the acorn_reduced build tag. It is for
+// cryptanalysts running reduced-round experiments against this
+// implementation, and must never be used to protect anything.
+
+// FullInitSteps is the number of initialization steps, after the key
+// and nonce are loaded, that ACORN-128 specifies.
+const FullInitSteps = 1536
+
+// NewAEADReducedInit returns an ACORN-128 instance which runs only
+// steps of the 1536 initialization steps that follow loading the key
+// and nonce, and is otherwise the same as NewAEAD. Those steps load the
+// key again, repeated, with the 1 bit that ends the nonce first, so a
+// variant with no steps at all never loads that bit. steps must be a
+// multiple of 8 from 0 to FullInitSteps; NewAEADReducedInit panics
+// otherwise, or if the key is not 16 bytes.
+func NewAEADReducedInit(key []byte, steps int) cipher.AEAD {
+	if len(key) != KeySize {
+		panic("acorn: invalid key length")
+	}
+	if steps < 0 || steps > FullInitSteps || steps%8 != 0 {
+		panic("acorn: invalid number of initialization steps: " + strconv.Itoa(steps))
+	}
+	return &reducedAEAD{key: loadKey(key), steps: steps}
+}
+
+type reducedAEAD struct {
+	key   [4]uint32
+	steps int
+}
+
+// initSteps is init with only steps of the last 1536 steps.
+func (s *state) initSteps(k *[4]uint32, iv []uint8, steps int) {
+	s.reset()
+	if len(iv)*8 != 128 {
+		panic("acorn: invalid iv length")
+	}
+	var m [1792 / 32]uint32
+	copy(m[:4], k[:])
+	for i := range m[4:8] {
+		m[4+i] = binary.LittleEndian.Uint32(iv[i*4:])
+	}
+	for i := 8; i < len(m); i++ {
+		m[i] = k[i%4]
+	}
+	m[8] ^= 0x01
+	n := (256 + steps) / 32
+	s.ones32(m[:n])
+	if r := (256 + steps) % 32; r != 0 {
+		for i := uint(0); i < uint(r); i += 8 {
+			s.update8(m[n]>>i&0xFF, one, one)
+		}
+	}
+	for i := range m {
+		m[i] = 0
+	}
+}
+
+func (a *reducedAEAD) NonceSize() int {
+	return NonceSize
+}
+
+func (a *reducedAEAD) Overhead() int {
+	return TagSize
+}
+
+func (a *reducedAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	var s state
+	if len(nonce) != NonceSize {
+		panic("acorn: invalid nonce length")
+	}
+	s.initSteps(&a.key, nonce, a.steps)
+	s.process(additionalData)
+	ret, out := sliceForAppend(dst, len(plaintext)+TagSize)
+	s.encrypt(out[:len(plaintext)], plaintext)
+	s.finalize(out[len(plaintext):])
+	return ret
+}
+
+func (a *reducedAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	var s state
+	if len(ciphertext) < TagSize {
+		return dst, ErrAuthentication
+	}
+	s.initSteps(&a.key, nonce, a.steps)
+	s.process(additionalData)
+	n := len(ciphertext) - TagSize
+	ret, out := sliceForAppend(dst, n)
+	s.decrypt(out, ciphertext[:n])
+	var expectedTag [TagSize]byte
+	s.finalize(expectedTag[:])
+	if subtle.ConstantTimeCompare(ciphertext[n:], expectedTag[:]) == 0 {
+		for i := range out {
+			out[i] = 0
+		}
+		return dst, ErrAuthentication
+	}
+	return ret, nil
+}
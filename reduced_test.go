@@ -0,0 +1,63 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build acorn_reduced
+// +build acorn_reduced
+
+package acorn
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReducedInit(t *testing.T) {
+	key, nonce := countUp(KeySize), countUp(NonceSize)
+	msg, ad := []byte("reduced"), []byte("rounds")
+	full := NewAEAD(key).Seal(nil, nonce, msg, ad)
+	if got := NewAEADReducedInit(key, FullInitSteps).Seal(nil, nonce, msg, ad); !bytes.Equal(got, full) {
+		t.Errorf("full initialization = %x, want %x", got, full)
+	}
+
+	// each variant is the full one stopped early
+	seen := map[string]int{}
+	for _, steps := range []int{0, 8, 256, 512, 1000, 1024, 1528} {
+		k := loadKey(key)
+		var s, want state
+		s.initSteps(&k, nonce, steps)
+		for i := 0; i < (256+steps)/8; i++ {
+			b := uint32(i / 4 % 4)
+			m := k[b] >> (uint(i%4) * 8) & 0xFF
+			if i >= 16 && i < 32 {
+				m = uint32(nonce[i-16])
+			}
+			if i == 32 {
+				m ^= 0x01
+			}
+			want.update8(m, one, one)
+		}
+		if s != want {
+			t.Errorf("%d steps: state %+v, want %+v", steps, s, want)
+		}
+
+		a := NewAEADReducedInit(key, steps)
+		ct := a.Seal(nil, nonce, msg, ad)
+		if p, err := a.Open(nil, nonce, ct, ad); err != nil || !bytes.Equal(p, msg) {
+			t.Errorf("%d steps: Open = %q, %v", steps, p, err)
+		}
+		if prev, ok := seen[string(ct)]; ok {
+			t.Errorf("%d and %d steps gave the same ciphertext", prev, steps)
+		}
+		seen[string(ct)] = steps
+	}
+
+	for _, steps := range []int{-8, 3, 1544} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewAEADReducedInit accepted %d steps", steps)
+				}
+			}()
+			NewAEADReducedInit(key, steps)
+		}()
+	}
+}
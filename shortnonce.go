@@ -0,0 +1,61 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import "crypto/cipher"
+
+// ShortNonceSize is the nonce size of the AEADs returned by
+// NewAEADShortNonce: 96 bits, as for AES-GCM and ChaCha20-Poly1305.
+const ShortNonceSize = 12
+
+type shortNonceAEAD struct {
+	aead cipher.AEAD
+}
+
+// NewAEADShortNonce returns an ACORN instance that takes 12-byte nonces,
+// for callers migrating from AES-GCM or ChaCha20-Poly1305 whose storage
+// formats already fix the nonce at 96 bits. A 12-byte nonce is expanded
+// to the 16 bytes that ACORN-128 takes by appending four zero bytes, so
+//
+//	NewAEADShortNonce(key).Seal(dst, n, p, ad)
+//
+// is the same as NewAEAD(key).Seal(dst, append(n, 0, 0, 0, 0), p, ad).
+// Since the expansion loses nothing, the usual rule holds: a nonce must
+// never repeat under one key. Because of the expansion, though, a key
+// used with this instance should not also be used with full-length
+// nonces, since a 16-byte nonce ending in four zero bytes would repeat
+// a short one.
+//
+// Random 96-bit nonces are only safe for about 2^32 messages per key;
+// prefer full-length nonces for new formats. If the key is not the
+// correct length, NewAEADShortNonce will panic. The instance uses a
+// registered Engine if there is one, and does not implement Batch.
+func NewAEADShortNonce(key []byte) cipher.AEAD {
+	return &shortNonceAEAD{aead: NewAEAD(key)}
+}
+
+func (a *shortNonceAEAD) NonceSize() int {
+	return ShortNonceSize
+}
+
+func (a *shortNonceAEAD) Overhead() int {
+	return TagSize
+}
+
+// expandNonce returns the full-length nonce for a short nonce.
+func expandNonce(nonce []byte) []byte {
+	if len(nonce) != ShortNonceSize {
+		panic("acorn: invalid nonce length")
+	}
+	var n [NonceSize]byte
+	copy(n[:], nonce)
+	return n[:]
+}
+
+func (a *shortNonceAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	return a.aead.Seal(dst, expandNonce(nonce), plaintext, additionalData)
+}
+
+func (a *shortNonceAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	return a.aead.Open(dst, expandNonce(nonce), ciphertext, additionalData)
+}
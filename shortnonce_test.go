@@ -0,0 +1,39 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestShortNonce(t *testing.T) {
+	key := countUp(KeySize)
+	a := NewAEADShortNonce(key)
+	if a.NonceSize() != ShortNonceSize || a.Overhead() != TagSize {
+		t.Errorf("sizes = %d, %d", a.NonceSize(), a.Overhead())
+	}
+	nonce := countUp(ShortNonceSize)
+	msg, ad := []byte("migrated from AES-GCM"), []byte("row 12")
+	ct := a.Seal(nil, nonce, msg, ad)
+
+	// the documented expansion
+	full := append(append([]byte(nil), nonce...), 0, 0, 0, 0)
+	if want := NewAEAD(key).Seal(nil, full, msg, ad); !bytes.Equal(ct, want) {
+		t.Errorf("Seal = %x, want %x", ct, want)
+	}
+	if got, err := a.Open(nil, nonce, ct, ad); err != nil || !bytes.Equal(got, msg) {
+		t.Errorf("Open = %q, %v", got, err)
+	}
+	nonce[11] ^= 1
+	if _, err := a.Open(nil, nonce, ct, ad); err != ErrAuthentication {
+		t.Errorf("Open with the wrong nonce returned %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Seal accepted a 16-byte nonce")
+		}
+	}()
+	a.Seal(nil, full, msg, ad)
+}
@@ -0,0 +1,53 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build acorn_small
+// +build acorn_small
+
+package acorn
+
+// With the acorn_small build tag, everything is built on update8,
+// for firmware where flash is scarcer than cycles. The word-at-a-time
+// loops in crypt64.go and crypt32.go, the bitsliced engine, and any
+// assembly are left out; what remains is roughly a quarter of the
+// speed. The output is the same either way.
+
+// backends is empty, so SealBatch and OpenBatch
+// go one message at a time.
+var backends []*backend
+
+// update32 performs 32 state updates as four calls to update8,
+// low byte first.
+func (s *state) update32(m, ca, cb uint32) uint32 {
+	var ks uint32
+	for i := uint(0); i < 32; i += 8 {
+		ks |= s.update8(m>>i&0xFF, ca>>i&0xFF, cb>>i&0xFF) << i
+	}
+	return ks
+}
+
+// ones32 runs one update32 with ca = cb = 1 for each word of m,
+// replacing it with the keystream.
+func (s *state) ones32(m []uint32) {
+	for i := range m {
+		m[i] = s.update32(m[i], one, one)
+	}
+}
+
+// encrypt encrypts src into dst with cb = 0.
+func (s *state) encrypt(dst, src []uint8) {
+	for i, x := range src {
+		ks := s.update8(uint32(x), one, 0)
+		dst[i] = x ^ uint8(ks)
+	}
+	s.pad(0)
+}
+
+// decrypt decrypts src into dst with cb = 1, which cancels out
+// the keystream that the ciphertext was fed back with.
+func (s *state) decrypt(dst, src []uint8) {
+	for i, x := range src {
+		ks := s.update8(uint32(x), one, one)
+		dst[i] = x ^ uint8(ks)
+	}
+	s.pad(0)
+}
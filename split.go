@@ -0,0 +1,168 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"crypto/cipher"
+	cryptorand "crypto/rand"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// splitRefresh is how many calls to Seal and Open a SplitAEAD
+// makes between refreshing its shares.
+const splitRefresh = 1024
+
+// A SplitAEAD is an ACORN-128 instance which holds its key as two random
+// shares, whose XOR is the key, in separately allocated memory. The key
+// is only recombined, on the stack, for the length of each call to Seal
+// or Open, and wiped from there afterward. The shares are re-randomized
+// every 1024 calls and whenever Refresh is called, so that an attacker who
+// can read memory at different times has to catch both shares between
+// two refreshes.
+//
+// This raises the cost of scraping the key from memory; it does not
+// prevent it. It always uses the Go implementation, even if an Engine
+// is registered, and implements cipher.AEAD but not Batch.
+type SplitAEAD struct {
+	mu     sync.RWMutex
+	a, b   *[KeySize]byte
+	rand   io.Reader
+	calls  uint32 // updated atomically
+	cancel func() // unregisters from Shutdown
+}
+
+var _ cipher.AEAD = (*SplitAEAD)(nil)
+
+var errSplitClosed = errors.New("acorn: use of closed SplitAEAD")
+
+// NewAEADSplit returns an ACORN instance which holds the given 128-bit key
+// as two shares, drawing randomness for them from rand, or from crypto/rand
+// if rand is nil. If the key is not the correct length, NewAEADSplit will
+// panic. The caller should wipe its own copy of the key afterward, and
+// call Close when done with the instance. Until then, Shutdown erases it.
+func NewAEADSplit(key []byte, rand io.Reader) (*SplitAEAD, error) {
+	if len(key) != KeySize {
+		panic("acorn: invalid key length")
+	}
+	if rand == nil {
+		rand = cryptorand.Reader
+	}
+	a := &SplitAEAD{a: new([KeySize]byte), b: new([KeySize]byte), rand: rand}
+	if _, err := io.ReadFull(rand, a.a[:]); err != nil {
+		return nil, err
+	}
+	for i := range a.b {
+		a.b[i] = a.a[i] ^ key[i]
+	}
+	a.cancel = OnShutdown(a.erase)
+	return a, nil
+}
+
+// Refresh re-randomizes the shares. If reading randomness fails,
+// the shares are left as they were and the error is returned.
+// It returns an error if a has been closed.
+func (a *SplitAEAD) Refresh() error {
+	var r [KeySize]byte
+	defer func() { r = [KeySize]byte{} }()
+	if _, err := io.ReadFull(a.rand, r[:]); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.a == nil {
+		return errSplitClosed
+	}
+	for i := range r {
+		a.a[i] ^= r[i]
+		a.b[i] ^= r[i]
+	}
+	return nil
+}
+
+func (a *SplitAEAD) NonceSize() int {
+	return NonceSize
+}
+
+func (a *SplitAEAD) Overhead() int {
+	return TagSize
+}
+
+// load recombines the key into an aead, and must be followed by
+// a call to done. It panics if a has been closed.
+func (a *SplitAEAD) load() aead {
+	a.mu.RLock()
+	if a.a == nil {
+		a.mu.RUnlock()
+		panic(errSplitClosed.Error())
+	}
+	x, y := loadKey(a.a[:]), loadKey(a.b[:])
+	k := aead{key: [4]uint32{x[0] ^ y[0], x[1] ^ y[1], x[2] ^ y[2], x[3] ^ y[3]}}
+	return k
+}
+
+func (a *SplitAEAD) done(k *aead) {
+	*k = aead{}
+	a.mu.RUnlock()
+	if atomic.AddUint32(&a.calls, 1)%splitRefresh == 0 {
+		// a failure leaves the old shares, which are no worse
+		// than not refreshing; Refresh reports it to callers who care
+		a.Refresh()
+	}
+}
+
+func (a *SplitAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	k := a.load()
+	defer a.done(&k)
+	return k.Seal(dst, nonce, plaintext, additionalData)
+}
+
+func (a *SplitAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	k := a.load()
+	defer a.done(&k)
+	return k.Open(dst, nonce, ciphertext, additionalData)
+}
+
+// Equal reports whether a and b hold the same key, comparing them
+// in constant time. It is false if either has been closed.
+func (a *SplitAEAD) Equal(b *SplitAEAD) bool {
+	var x, y [KeySize]byte
+	defer func() { x, y = [KeySize]byte{}, [KeySize]byte{} }()
+	// Recombine one key at a time rather than hold both locks,
+	// so that a.Equal(b) and b.Equal(a) can't deadlock.
+	return a.combine(&x) && b.combine(&y) && KeysEqual(x[:], y[:])
+}
+
+// combine recombines the key into k, and reports whether a is still open.
+func (a *SplitAEAD) combine(k *[KeySize]byte) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.a == nil {
+		return false
+	}
+	for i := range k {
+		k[i] = a.a[i] ^ a.b[i]
+	}
+	return true
+}
+
+// Close wipes the shares. It waits for calls to Seal and Open
+// in progress to finish; later calls panic.
+// Close is safe to call more than once.
+func (a *SplitAEAD) Close() error {
+	a.erase()
+	a.cancel()
+	return nil
+}
+
+// erase wipes the shares, and is what Shutdown calls.
+func (a *SplitAEAD) erase() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.a != nil {
+		*a.a, *a.b = [KeySize]byte{}, [KeySize]byte{}
+		a.a, a.b = nil, nil
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type failReader struct{}
+
+func (failReader) Read([]byte) (int, error) { return 0, errors.New("no randomness") }
+
+func TestAEADSplit(t *testing.T) {
+	key := countUp(KeySize)
+	nonce := countUp(NonceSize)
+	a, err := NewAEADSplit(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	share := func() [KeySize]byte { return *a.a }
+	first := share()
+	if bytes.Equal(first[:], key) || bytes.Equal(a.b[:], key) {
+		t.Fatal("a share equals the key")
+	}
+
+	want := NewAEAD(key).Seal(nil, nonce, []byte("plaintext"), nil)
+	for i := 0; i < 2*splitRefresh; i++ {
+		ct := a.Seal(nil, nonce, []byte("plaintext"), nil)
+		if !bytes.Equal(ct, want) {
+			t.Fatalf("call %d: Seal = %x, want %x", i, ct, want)
+		}
+	}
+	if share() == first {
+		t.Errorf("the shares were not refreshed after %d calls", 2*splitRefresh)
+	}
+	if err := a.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if pt, err := a.Open(nil, nonce, want, nil); err != nil || string(pt) != "plaintext" {
+		t.Errorf("Open after Refresh = %q, %v", pt, err)
+	}
+
+	// a failed refresh leaves working shares
+	a.rand = failReader{}
+	before := share()
+	if err := a.Refresh(); err == nil {
+		t.Errorf("Refresh succeeded without randomness")
+	}
+	if share() != before {
+		t.Errorf("a failed Refresh changed the shares")
+	}
+	if ct := a.Seal(nil, nonce, []byte("plaintext"), nil); !bytes.Equal(ct, want) {
+		t.Errorf("Seal after a failed Refresh = %x, want %x", ct, want)
+	}
+
+	shareA, shareB := a.a, a.b
+	a.Close()
+	if *shareA != ([KeySize]byte{}) || *shareB != ([KeySize]byte{}) {
+		t.Errorf("Close did not wipe the shares")
+	}
+	a.rand = bytes.NewReader(make([]byte, KeySize))
+	if err := a.Refresh(); err == nil {
+		t.Errorf("Refresh after Close succeeded")
+	}
+}
+
+func TestAEADSplitRandError(t *testing.T) {
+	if _, err := NewAEADSplit(countUp(KeySize), failReader{}); err == nil {
+		t.Errorf("NewAEADSplit succeeded without randomness")
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import "errors"
+
+// A Phase is one of the parts of ACORN-128's processing of a message.
+type Phase int
+
+const (
+	PhaseInit    Phase = iota // the 1792 steps which load the key and nonce
+	PhaseAD                   // one step per bit of additional data
+	PhasePadAD                // the 256 steps after the additional data
+	PhaseText                 // one step per bit of plaintext
+	PhasePadText              // the 256 steps after the plaintext
+	PhaseFinal                // the 768 steps which make the tag
+)
+
+var phaseNames = [...]string{"init", "ad", "pad-ad", "text", "pad-text", "final"}
+
+func (p Phase) String() string {
+	if p < 0 || int(p) >= len(phaseNames) {
+		return "Phase(?)"
+	}
+	return phaseNames[p]
+}
+
+// A Schedule returns the control bits ca and cb for step i of phase p,
+// counting from zero at the start of each phase. For PhaseText they are
+// the bits used when encrypting; decryption adjusts cb itself.
+type Schedule func(p Phase, i int) (ca, cb bool)
+
+// DefaultSchedule is ACORN-128's schedule of control bits.
+func DefaultSchedule(p Phase, i int) (ca, cb bool) {
+	switch p {
+	case PhasePadAD:
+		return i < 128, true
+	case PhaseText:
+		return true, false
+	case PhasePadText:
+		return i < 128, false
+	}
+	return true, true
+}
+
+// A State is the bare ACORN-128 state, for research and testing.
+// It implements Engine, so NewAEADEngine can turn a variant into an
+// AEAD, and its methods must be called in the order that Engine says.
+// The zero value is ready to use.
+//
+// Setting Schedule replaces the control bits ca and cb, which is
+// enough to try out variants of the frame bits, or to run differential
+// experiments, without forking this package. A State with a Schedule
+// is not ACORN-128, unless the schedule is DefaultSchedule, and is far
+// slower, since it calls the schedule for every step.
+type State struct {
+	// Schedule, if not nil, supplies the control bits.
+	Schedule Schedule
+
+	s        state
+	squeezed int // bytes of keystream taken by Keystream
+}
+
+var _ Engine = (*State)(nil)
+
+// Init loads a 16-byte key and a 16-byte nonce.
+func (s *State) Init(key, nonce []byte) {
+	if len(key) != KeySize {
+		panic("acorn: invalid key length")
+	}
+	if len(nonce) != NonceSize {
+		panic("acorn: invalid nonce length")
+	}
+	s.squeezed = 0
+	if s.Schedule == nil {
+		k := loadKey(key)
+		s.s.init(&k, nonce)
+		k = [4]uint32{}
+		return
+	}
+	s.s.reset()
+	s.run(PhaseInit, 0, 1792/8, func(i int) uint8 {
+		var m uint8
+		switch {
+		case i >= 16 && i < 32:
+			m = nonce[i-16]
+		default:
+			m = key[i%16]
+		}
+		if i == 32 {
+			m ^= 0x01
+		}
+		return m
+	}, nil, false)
+}
+
+// Absorb processes the additional data.
+func (s *State) Absorb(ad []byte) {
+	if s.Schedule == nil {
+		s.s.process(ad)
+		return
+	}
+	s.run(PhaseAD, 0, len(ad), func(i int) uint8 { return ad[i] }, nil, false)
+	s.pad(PhasePadAD)
+}
+
+// Crypt encrypts src into dst, or decrypts it if decrypt is true.
+// dst and src must have the same length.
+func (s *State) Crypt(dst, src []byte, decrypt bool) {
+	if len(dst) != len(src) {
+		panic("acorn: dst and src have different lengths")
+	}
+	if s.Schedule == nil {
+		if decrypt {
+			s.s.decrypt(dst, src)
+		} else {
+			s.s.encrypt(dst, src)
+		}
+		return
+	}
+	// Feeding back the ciphertext with cb flipped is the same as
+	// feeding back the plaintext, which is not known until the
+	// keystream for the step has been computed.
+	s.run(PhaseText, s.squeezed, len(src), func(i int) uint8 { return src[i] },
+		func(i int, ks uint8) { dst[i] = src[i] ^ ks }, decrypt)
+	s.pad(PhasePadText)
+}
+
+// Keystream fills dst with keystream, taken from the steps that would
+// encrypt the next len(dst) bytes of text, but feeding back zeros and
+// without padding afterward. It may be called any number of times after
+// Init or Absorb, and each call continues where the last left off.
+//
+// The keystream is what Crypt would have XORed into a plaintext of zeros,
+// so a later call to Crypt carries on as if those zeros had been part
+// of the text. This is no longer an AEAD, and the keystream must not be
+// used to encrypt anything by hand.
+func (s *State) Keystream(dst []byte) {
+	if s.Schedule == nil {
+		i := 0
+		for ; i+4 <= len(dst); i += 4 {
+			store32(dst[i:], s.s.update32(0, one, 0))
+		}
+		for ; i < len(dst); i++ {
+			dst[i] = uint8(s.s.update8(0, one, 0))
+		}
+	} else {
+		s.run(PhaseText, s.squeezed, len(dst), func(int) uint8 { return 0 },
+			func(i int, ks uint8) { dst[i] = ks }, false)
+	}
+	s.squeezed += len(dst)
+}
+
+// Finalize writes the 16-byte tag to tag, and wipes the state.
+func (s *State) Finalize(tag []byte) {
+	if len(tag) != TagSize {
+		panic("acorn: invalid tag length")
+	}
+	if s.Schedule == nil {
+		s.s.finalize(tag)
+		return
+	}
+	s.run(PhaseFinal, 0, 768/8, func(int) uint8 { return 0 }, func(i int, ks uint8) {
+		if i >= 640/8 {
+			tag[i-640/8] = ks
+		}
+	}, false)
+	s.s.reset()
+}
+
+func (s *State) pad(p Phase) {
+	s.run(p, 0, 256/8, func(i int) uint8 {
+		if i == 0 {
+			return 0x01
+		}
+		return 0
+	}, nil, false)
+}
+
+// run performs 8*n steps of phase p, eight at a time, with message
+// bytes from msg, and passes the keystream bytes to out if it is not
+// nil. Steps are numbered from 8*start. If flip is set, cb is inverted.
+func (s *State) run(p Phase, start, n int, msg func(i int) uint8, out func(i int, ks uint8), flip bool) {
+	for i := 0; i < n; i++ {
+		var ca, cb uint32
+		for j := 0; j < 8; j++ {
+			a, b := s.Schedule(p, 8*(start+i)+j)
+			if a {
+				ca |= 1 << uint(j)
+			}
+			if b != flip {
+				cb |= 1 << uint(j)
+			}
+		}
+		ks := s.s.update8(uint32(msg(i)), ca, cb)
+		if out != nil {
+			out(i, uint8(ks))
+		}
+	}
+}
+
+// StateSize is the length of a State's binary encoding.
+const StateSize = (293 + 7) / 8
+
+var errStateEncoding = errors.New("acorn: invalid State encoding")
+
+// The state words hold the bits from their own index
+// up to the index of the next word.
+var stateBase = [...]uint{0, 61, 107, 154, 193, 230, 293}
+
+func (s *state) words() [6]*uint64 {
+	return [6]*uint64{&s.s0, &s.s61, &s.s107, &s.s154, &s.s193, &s.s230}
+}
+
+// MarshalBinary returns the 293 state bits, numbered as in the
+// specification, packed into StateSize bytes with bit i in bit i%8 of
+// byte i/8. It is for loading states into analysis tools, and never
+// returns an error.
+func (s *State) MarshalBinary() ([]byte, error) {
+	b := make([]byte, StateSize)
+	for w, p := range s.s.words() {
+		for i := stateBase[w]; i < stateBase[w+1]; i++ {
+			b[i/8] |= uint8(*p>>(i-stateBase[w])&1) << (i % 8)
+		}
+	}
+	return b, nil
+}
+
+// UnmarshalBinary sets the state bits from the encoding returned by
+// MarshalBinary, so that experiments can start from any state. It
+// leaves Schedule alone, and restarts the step numbering that Keystream
+// and Crypt give it.
+func (s *State) UnmarshalBinary(b []byte) error {
+	if len(b) != StateSize || b[StateSize-1]>>(293%8) != 0 {
+		return errStateEncoding
+	}
+	s.s.reset()
+	for w, p := range s.s.words() {
+		for i := stateBase[w]; i < stateBase[w+1]; i++ {
+			*p |= uint64(b[i/8]>>(i%8)&1) << (i - stateBase[w])
+		}
+	}
+	s.squeezed = 0
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStateSchedule(t *testing.T) {
+	key, nonce := countUp(KeySize), countUp(NonceSize)
+	msg, ad := countUp(37), countUp(11)
+	want := NewAEAD(key).Seal(nil, nonce, msg, ad)
+
+	for _, sched := range []Schedule{nil, DefaultSchedule} {
+		a := NewAEADEngine(key, func() Engine { return &State{Schedule: sched} })
+		if got := a.Seal(nil, nonce, msg, ad); !bytes.Equal(got, want) {
+			t.Errorf("Seal = %x, want %x", got, want)
+		}
+		if p, err := a.Open(nil, nonce, want, ad); err != nil || !bytes.Equal(p, msg) {
+			t.Errorf("Open = %x, %v", p, err)
+		}
+	}
+
+	// a variant which sets cb during the text, as decryption does
+	flipped := func(p Phase, i int) (ca, cb bool) {
+		ca, cb = DefaultSchedule(p, i)
+		return ca, cb || p == PhaseText
+	}
+	var calls [PhaseFinal + 1]int
+	counting := func(p Phase, i int) (ca, cb bool) {
+		if i != calls[p] {
+			t.Fatalf("%v step %d, want %d", p, i, calls[p])
+		}
+		calls[p]++
+		return flipped(p, i)
+	}
+	a := NewAEADEngine(key, func() Engine { return &State{Schedule: counting} })
+	ct := a.Seal(nil, nonce, msg, ad)
+	if bytes.Equal(ct, want) {
+		t.Errorf("a different schedule gave the same ciphertext")
+	}
+	wantCalls := [...]int{1792, 8 * len(ad), 256, 8 * len(msg), 256, 768}
+	if calls != wantCalls {
+		t.Errorf("schedule called %v times, want %v", calls, wantCalls)
+	}
+	b := NewAEADEngine(key, func() Engine { return &State{Schedule: flipped} })
+	if p, err := b.Open(nil, nonce, ct, ad); err != nil || !bytes.Equal(p, msg) {
+		t.Errorf("Open with the flipped schedule = %x, %v", p, err)
+	}
+	if PhasePadText.String() != "pad-text" {
+		t.Errorf("PhasePadText.String() = %q", PhasePadText.String())
+	}
+}
+
+func TestStateKeystream(t *testing.T) {
+	key, nonce, ad := countUp(KeySize), countUp(NonceSize), []byte("ad")
+	want := make([]byte, 23)
+	var ref State
+	ref.Init(key, nonce)
+	ref.Absorb(ad)
+	ref.Crypt(want, make([]byte, len(want)), false)
+
+	for _, sched := range []Schedule{nil, DefaultSchedule} {
+		s := State{Schedule: sched}
+		s.Init(key, nonce)
+		s.Absorb(ad)
+		got := make([]byte, len(want))
+		s.Keystream(got[:3])
+		s.Keystream(got[3:16])
+		// the rest through Crypt, which carries on from the keystream
+		s.Crypt(got[16:], make([]byte, len(got)-16), false)
+		if !bytes.Equal(got, want) {
+			t.Errorf("keystream = %x, want %x", got, want)
+		}
+		tag, wantTag := make([]byte, TagSize), make([]byte, TagSize)
+		s.Finalize(tag)
+		var r State
+		r.Init(key, nonce)
+		r.Absorb(ad)
+		r.Crypt(make([]byte, len(want)), make([]byte, len(want)), false)
+		r.Finalize(wantTag)
+		if !bytes.Equal(tag, wantTag) {
+			t.Errorf("tag after Keystream = %x, want %x", tag, wantTag)
+		}
+	}
+}
+
+func TestStateMarshal(t *testing.T) {
+	var s State
+	s.Init(countUp(KeySize), countUp(NonceSize))
+	b, _ := s.MarshalBinary()
+	bits := s.s.bits()
+	for i, bit := range bits {
+		if b[i/8]>>uint(i%8)&1 != bit {
+			t.Fatalf("bit %d of the encoding is wrong", i)
+		}
+	}
+	var s2 State
+	if err := s2.UnmarshalBinary(b); err != nil || s2.s != s.s {
+		t.Errorf("UnmarshalBinary(MarshalBinary()) = %+v, %v; want %+v", s2.s, err, s.s)
+	}
+	b[StateSize-1] |= 0x80
+	if err := s2.UnmarshalBinary(b); err == nil {
+		t.Errorf("UnmarshalBinary accepted bits past the end of the state")
+	}
+	if err := s2.UnmarshalBinary(b[:10]); err == nil {
+		t.Errorf("UnmarshalBinary accepted a short encoding")
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"encoding/binary"
+	"flag"
+	"math"
+	"math/bits"
+	"testing"
+)
+
+var stats = flag.Bool("stats", false, "run statistical tests on megabytes of keystream")
+
+// The statistical tests are a smoke test for a new backend that gets the
+// cipher badly wrong while still agreeing with itself, say by leaving
+// part of its state stuck. They are not evidence that ACORN is secure.
+// The inputs are fixed, so the results are the same on every run, and
+// the threshold is set low enough that only a gross bias fails.
+const statsThreshold = 1e-4
+
+// keystreamSources produce keystream by encrypting zeros,
+// through each of the ways there are to run the cipher.
+var keystreamSources = []struct {
+	name string
+	gen  func(key []byte, n int) []byte
+}{
+	{"long message", func(key []byte, n int) []byte {
+		nonce := make([]byte, NonceSize)
+		return NewAEAD(key).Seal(nil, nonce, make([]byte, n), nil)[:n]
+	}},
+	{"short messages", func(key []byte, n int) []byte {
+		// 64 bytes from each of many nonces, which exercises
+		// initialization more than encryption
+		a := NewAEAD(key)
+		nonce := make([]byte, NonceSize)
+		zero := make([]byte, 64)
+		var ks, dst []byte
+		for i := 0; len(ks) < n; i++ {
+			binary.LittleEndian.PutUint64(nonce, uint64(i))
+			dst = a.Seal(dst[:0], nonce, zero, nil)
+			ks = append(ks, dst[:len(zero)]...)
+		}
+		return ks[:n]
+	}},
+	{"batch", func(key []byte, n int) []byte {
+		a := NewAEAD(key).(Batch)
+		const lanes, size = 512, 64
+		var ks []byte
+		for off := uint64(0); len(ks) < n; off += lanes {
+			nonces := make([][]byte, lanes)
+			zeros := make([][]byte, lanes)
+			dst := make([][]byte, lanes)
+			for i := range nonces {
+				nonces[i] = make([]byte, NonceSize)
+				binary.LittleEndian.PutUint64(nonces[i], off+uint64(i))
+				zeros[i] = make([]byte, size)
+			}
+			a.SealBatch(dst, nonces, zeros, make([][]byte, lanes))
+			for _, d := range dst {
+				ks = append(ks, d[:size]...)
+			}
+		}
+		return ks[:n]
+	}},
+	{"engine", func(key []byte, n int) []byte {
+		nonce := make([]byte, NonceSize)
+		return NewAEADEngine(key, NewEngine).Seal(nil, nonce, make([]byte, n), nil)[:n]
+	}},
+}
+
+func TestKeystreamStatistics(t *testing.T) {
+	if !*stats || testing.Short() {
+		t.Skip("use -stats to run")
+	}
+	const n = 4 << 20
+	key := []byte("statistical test")
+	for _, src := range keystreamSources {
+		ks := src.gen(key, n)
+		for _, test := range []struct {
+			name string
+			p    []float64
+		}{
+			{"monobit", []float64{monobitTest(ks)}},
+			{"runs", []float64{runsTest(ks)}},
+			{"serial", serialTest(ks)},
+		} {
+			for _, p := range test.p {
+				if p < statsThreshold {
+					t.Errorf("%s: %s test failed with p = %g", src.name, test.name, p)
+				} else {
+					t.Logf("%s: %s test: p = %.4f", src.name, test.name, p)
+				}
+			}
+		}
+	}
+}
+
+// TestStatisticsCatchBias checks that the tests do reject
+// keystream with obvious flaws.
+func TestStatisticsCatchBias(t *testing.T) {
+	n := 1 << 16
+	stuck := make([]byte, n)
+	for i := range stuck {
+		stuck[i] = 0x01
+	}
+	if p := monobitTest(stuck); p >= statsThreshold {
+		t.Errorf("monobit test passed a mostly-zero keystream: p = %g", p)
+	}
+	alternating := make([]byte, n)
+	for i := range alternating {
+		alternating[i] = 0x55
+	}
+	if p := runsTest(alternating); p >= statsThreshold {
+		t.Errorf("runs test passed an alternating keystream: p = %g", p)
+	}
+	// balanced, but with pairs of bits always equal
+	paired := make([]byte, n)
+	for i := range paired {
+		paired[i] = []byte{0x33, 0xcc, 0x0f, 0xf0}[i*7%4]
+	}
+	if ps := serialTest(paired); ps[0] >= statsThreshold && ps[1] >= statsThreshold {
+		t.Errorf("serial test passed a keystream of paired bits: p = %v", ps)
+	}
+}
+
+// bit returns the i'th bit of b, least significant bit first.
+func bit(b []byte, i int) int {
+	return int(b[i/8] >> uint(i%8) & 1)
+}
+
+// monobitTest is the frequency test of NIST SP 800-22 section 2.1.
+func monobitTest(b []byte) float64 {
+	n := len(b) * 8
+	ones := 0
+	for _, x := range b {
+		ones += bits.OnesCount8(x)
+	}
+	s := float64(2*ones - n)
+	return math.Erfc(math.Abs(s) / math.Sqrt(float64(n)) / math.Sqrt2)
+}
+
+// runsTest is the runs test of NIST SP 800-22 section 2.3.
+func runsTest(b []byte) float64 {
+	n := len(b) * 8
+	ones := 0
+	for _, x := range b {
+		ones += bits.OnesCount8(x)
+	}
+	pi := float64(ones) / float64(n)
+	if math.Abs(pi-0.5) >= 2/math.Sqrt(float64(n)) {
+		return 0 // the frequency prerequisite fails
+	}
+	runs := 1
+	for i := 1; i < n; i++ {
+		if bit(b, i) != bit(b, i-1) {
+			runs++
+		}
+	}
+	num := math.Abs(float64(runs) - 2*float64(n)*pi*(1-pi))
+	den := 2 * math.Sqrt(2*float64(n)) * pi * (1 - pi)
+	return math.Erfc(num / den)
+}
+
+// serialTest is the serial test of NIST SP 800-22 section 2.11 with
+// m = 2, for which both p-values have closed forms: igamc(1, x) is
+// exp(-x) and igamc(1/2, x) is erfc(√x).
+func serialTest(b []byte) []float64 {
+	n := len(b) * 8
+	// psiSq returns ψ²_m over the overlapping m-bit patterns,
+	// wrapping around at the end as the specification says.
+	psiSq := func(m int) float64 {
+		if m == 0 {
+			return 0
+		}
+		counts := make([]int, 1<<uint(m))
+		for i := 0; i < n; i++ {
+			v := 0
+			for j := 0; j < m; j++ {
+				v = v<<1 | bit(b, (i+j)%n)
+			}
+			counts[v]++
+		}
+		sum := 0.0
+		for _, c := range counts {
+			sum += float64(c) * float64(c)
+		}
+		return sum*float64(len(counts))/float64(n) - float64(n)
+	}
+	p2, p1, p0 := psiSq(2), psiSq(1), psiSq(0)
+	d1 := p2 - p1
+	d2 := p2 - 2*p1 + p0
+	return []float64{math.Exp(-d1 / 2), math.Erfc(math.Sqrt(d2 / 2))}
+}
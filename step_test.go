@@ -0,0 +1,108 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// bitState is the 293-bit ACORN state, one bit per byte,
+// as in the specification.
+type bitState [293]uint8
+
+func (s *state) bits() bitState {
+	var b bitState
+	for w, p := range s.words() {
+		for i := stateBase[w]; i < stateBase[w+1]; i++ {
+			b[i] = uint8(*p >> (i - stateBase[w]) & 1)
+		}
+	}
+	return b
+}
+
+func (b *bitState) state() state {
+	var s state
+	for w, p := range s.words() {
+		for i := stateBase[w]; i < stateBase[w+1]; i++ {
+			*p |= uint64(b[i]) << (i - stateBase[w])
+		}
+	}
+	return s
+}
+
+// update1 performs a single state update, written exactly as in the
+// specification. m, ca, and cb are single bits.
+func (s *bitState) update1(m, ca, cb uint8) uint8 {
+	s[289] ^= s[235] ^ s[230]
+	s[230] ^= s[196] ^ s[193]
+	s[193] ^= s[160] ^ s[154]
+	s[154] ^= s[111] ^ s[107]
+	s[107] ^= s[66] ^ s[61]
+	s[61] ^= s[23] ^ s[0]
+
+	maj := func(x, y, z uint8) uint8 { return x&y ^ x&z ^ y&z }
+	ch := func(x, y, z uint8) uint8 { return x&y ^ (x^1)&z }
+	ks := s[12] ^ s[154] ^ maj(s[235], s[61], s[193]) ^ ch(s[230], s[111], s[66])
+	f := s[0] ^ s[107] ^ 1 ^ maj(s[244], s[23], s[160]) ^ ca&s[196] ^ cb&ks
+
+	copy(s[:], s[1:])
+	s[292] = f ^ m
+	return ks
+}
+
+func randomState(r *rand.Rand) bitState {
+	var b bitState
+	for i := range b {
+		b[i] = uint8(r.Intn(2))
+	}
+	return b
+}
+
+// TestStepEquivalence checks that update32, four calls to update8, and
+// 32 calls to the bit-level update1 agree, from random states and with
+// random message and control bits.
+func TestStepEquivalence(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	n := 10000
+	if testing.Short() {
+		n = 1000
+	}
+	for i := 0; i < n; i++ {
+		b := randomState(r)
+		if s := b.state(); s.bits() != b {
+			t.Fatalf("state packing does not round trip")
+		}
+		m, ca, cb := r.Uint32(), r.Uint32(), r.Uint32()
+		switch r.Intn(3) {
+		case 0:
+			// the control bits the cipher actually uses
+			ca, cb = one*uint32(r.Intn(2)), one*uint32(r.Intn(2))
+		case 1:
+			m = 0
+		}
+
+		s32 := b.state()
+		ks32 := s32.update32(m, ca, cb)
+
+		s8 := b.state()
+		var ks8 uint32
+		for j := uint(0); j < 32; j += 8 {
+			ks8 |= s8.update8(m>>j&0xFF, ca>>j&0xFF, cb>>j&0xFF) << j
+		}
+
+		s1 := b
+		var ks1 uint32
+		for j := uint(0); j < 32; j++ {
+			bit := func(x uint32) uint8 { return uint8(x >> j & 1) }
+			ks1 |= uint32(s1.update1(bit(m), bit(ca), bit(cb))) << j
+		}
+
+		if ks8 != ks1 || s8.bits() != s1 {
+			t.Fatalf("update8 differs from update1 from state %v, m=%#x ca=%#x cb=%#x: keystream %#x, want %#x", b, m, ca, cb, ks8, ks1)
+		}
+		if ks32 != ks1 || s32.bits() != s1 {
+			t.Fatalf("update32 differs from update1 from state %v, m=%#x ca=%#x cb=%#x: keystream %#x, want %#x", b, m, ca, cb, ks32, ks1)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"errors"
+	"sync"
+)
+
+// Errors returned by StrictAEAD.Seal for nonces it rejects.
+var (
+	ErrConstantNonce = errors.New("acorn: nonce is a single byte repeated, such as all zeros")
+	ErrRepeatedNonce = errors.New("acorn: nonce was used for a recent message")
+)
+
+// strictRecent is how many recent nonces a StrictAEAD remembers.
+const strictRecent = 1024
+
+// A StrictAEAD is a CheckedAEAD whose Seal also rejects nonces which are
+// obviously dangerous: a single byte repeated, such as all zeros, or one
+// of the last 1024 nonces it sealed with, which catches a nonce that is
+// a constant in the caller's code. It is a guardrail for code written
+// without cryptographic expertise, not a guarantee: it cannot see nonces
+// repeated further apart, or across processes. Use a random nonce, as from
+// SealWithRandomNonce, or a counter that cannot go backward.
+//
+// A StrictAEAD is safe for concurrent use.
+type StrictAEAD struct {
+	CheckedAEAD
+
+	mu     sync.Mutex
+	recent map[[NonceSize]byte]bool
+	ring   [][NonceSize]byte // the same nonces, oldest at next
+	next   int
+}
+
+// NewStrictAEAD returns a StrictAEAD that uses the given 128-bit key.
+func NewStrictAEAD(key []byte) (*StrictAEAD, error) {
+	c, err := NewCheckedAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &StrictAEAD{CheckedAEAD: *c, recent: make(map[[NonceSize]byte]bool)}, nil
+}
+
+// Seal is like CheckedAEAD's Seal, but returns ErrConstantNonce or
+// ErrRepeatedNonce for a nonce it rejects. On error, it returns dst
+// unchanged.
+func (a *StrictAEAD) Seal(dst, nonce, plaintext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != NonceSize {
+		return dst, NonceSizeError(len(nonce))
+	}
+	if err := a.check(nonce); err != nil {
+		return dst, err
+	}
+	return a.CheckedAEAD.Seal(dst, nonce, plaintext, additionalData)
+}
+
+// check checks the nonce, and remembers it if it passes.
+func (a *StrictAEAD) check(nonce []byte) error {
+	constant := true
+	for _, b := range nonce {
+		if b != nonce[0] {
+			constant = false
+			break
+		}
+	}
+	if constant {
+		return ErrConstantNonce
+	}
+	var n [NonceSize]byte
+	copy(n[:], nonce)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.recent[n] {
+		return ErrRepeatedNonce
+	}
+	if len(a.ring) < strictRecent {
+		a.ring = append(a.ring, n)
+	} else {
+		delete(a.recent, a.ring[a.next])
+		a.ring[a.next] = n
+		a.next = (a.next + 1) % strictRecent
+	}
+	a.recent[n] = true
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestStrictAEAD(t *testing.T) {
+	a, err := NewStrictAEAD(countUp(KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := []byte("dst")
+	for _, n := range [][]byte{make([]byte, NonceSize), bytes.Repeat([]byte{0xff}, NonceSize)} {
+		if out, err := a.Seal(dst, n, []byte("p"), nil); err != ErrConstantNonce || string(out) != "dst" {
+			t.Errorf("Seal with nonce %x = %q, %v; want ErrConstantNonce", n, out, err)
+		}
+	}
+	if _, err := a.Seal(nil, make([]byte, 12), nil, nil); err != NonceSizeError(12) {
+		t.Errorf("Seal with a short nonce returned %v", err)
+	}
+
+	nonce := func(i int) []byte {
+		n := countUp(NonceSize)
+		binary.LittleEndian.PutUint64(n, uint64(i))
+		return n
+	}
+	want := NewAEAD(countUp(KeySize)).Seal(nil, nonce(0), []byte("p"), nil)
+	if got, err := a.Seal(nil, nonce(0), []byte("p"), nil); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Seal = %x, %v; want %x", got, err, want)
+	}
+	if _, err := a.Seal(nil, nonce(0), []byte("p"), nil); err != ErrRepeatedNonce {
+		t.Errorf("Seal with the last nonce returned %v, want ErrRepeatedNonce", err)
+	}
+	for i := 1; i < strictRecent; i++ {
+		if _, err := a.Seal(nil, nonce(i), nil, nil); err != nil {
+			t.Fatalf("Seal %d: %v", i, err)
+		}
+	}
+	if _, err := a.Seal(nil, nonce(1), nil, nil); err != ErrRepeatedNonce {
+		t.Errorf("Seal with a recent nonce returned %v, want ErrRepeatedNonce", err)
+	}
+	// one more pushes nonce 0 out of the window
+	if _, err := a.Seal(nil, nonce(strictRecent), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Seal(nil, nonce(0), nil, nil); err != nil {
+		t.Errorf("Seal with a nonce outside the window returned %v", err)
+	}
+	if pt, err := a.Open(nil, nonce(0), want, nil); err != nil || string(pt) != "p" {
+		t.Errorf("Open = %q, %v", pt, err)
+	}
+}
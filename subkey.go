@@ -0,0 +1,86 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+
+	"github.com/magical/go-acorn/internal/hkdf"
+)
+
+// SubkeyNonceSize is the nonce size of the AEADs returned by NewAEADSubkey.
+const SubkeyNonceSize = 8
+
+// subkeyInfo is the HKDF info prefix for per-message subkeys.
+const subkeyInfo = "acorn-128 message subkey"
+
+type subkeyAEAD struct {
+	prk []byte
+}
+
+// NewAEADSubkey returns an ACORN instance that encrypts each message
+// under its own key, derived with HKDF-SHA256 from the master key and
+// the message number. The nonce is the message number, as 8 big-endian
+// bytes (see SubkeyNonce), and must never repeat under one master key.
+//
+// Since no ACORN key protects more than one message, a cryptanalytic
+// result that needs many messages under one key does not apply, and a
+// master key can protect up to 2^64 messages. In exchange, each message
+// costs a key derivation: a single HKDF-Expand block, which is one
+// HMAC-SHA256 computation, or about four SHA-256 block compressions.
+//
+// The master key may be of any length, but should have at least 128 bits
+// of entropy. The instance always uses the Go implementation, even if an
+// Engine is registered, and does not implement Batch. It is safe for
+// concurrent use.
+func NewAEADSubkey(masterKey []byte) cipher.AEAD {
+	return &subkeyAEAD{prk: hkdf.Extract(masterKey, nil)}
+}
+
+// SubkeyNonce returns the nonce for message number n
+// for an AEAD returned by NewAEADSubkey.
+func SubkeyNonce(n uint64) []byte {
+	var nonce [SubkeyNonceSize]byte
+	binary.BigEndian.PutUint64(nonce[:], n)
+	return nonce[:]
+}
+
+func (a *subkeyAEAD) NonceSize() int {
+	return SubkeyNonceSize
+}
+
+func (a *subkeyAEAD) Overhead() int {
+	return TagSize
+}
+
+// subkey returns an aead with the key for the message numbered by nonce.
+func (a *subkeyAEAD) subkey(nonce []byte) aead {
+	if len(nonce) != SubkeyNonceSize {
+		panic("acorn: invalid nonce length")
+	}
+	info := make([]byte, 0, len(subkeyInfo)+SubkeyNonceSize)
+	info = append(info, subkeyInfo...)
+	info = append(info, nonce...)
+	key := hkdf.Expand(a.prk, info, KeySize)
+	k := aead{key: loadKey(key)}
+	for i := range key {
+		key[i] = 0
+	}
+	return k
+}
+
+// Each subkey encrypts one message, so the ACORN nonce can be fixed.
+var subkeyZeroNonce [NonceSize]byte
+
+func (a *subkeyAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	k := a.subkey(nonce)
+	defer func() { k = aead{} }()
+	return k.Seal(dst, subkeyZeroNonce[:], plaintext, additionalData)
+}
+
+func (a *subkeyAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	k := a.subkey(nonce)
+	defer func() { k = aead{} }()
+	return k.Open(dst, subkeyZeroNonce[:], ciphertext, additionalData)
+}
@@ -0,0 +1,41 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/magical/go-acorn/internal/hkdf"
+)
+
+func TestAEADSubkey(t *testing.T) {
+	master := []byte("a master key of any length")
+	a := NewAEADSubkey(master)
+	pt := []byte("plaintext")
+
+	// message 7 is ACORN under the HKDF output, with a zero nonce
+	subkey := hkdf.Key(master, nil, []byte("acorn-128 message subkey\x00\x00\x00\x00\x00\x00\x00\x07"), KeySize)
+	want := NewAEAD(subkey).Seal(nil, make([]byte, NonceSize), pt, nil)
+	got := a.Seal(nil, SubkeyNonce(7), pt, nil)
+	if !bytes.Equal(got, want) {
+		t.Errorf("Seal = %s, want %s", hex.EncodeToString(got), hex.EncodeToString(want))
+	}
+	if out, err := a.Open(nil, SubkeyNonce(7), got, nil); err != nil || !bytes.Equal(out, pt) {
+		t.Errorf("Open = %q, %v", out, err)
+	}
+	if _, err := a.Open(nil, SubkeyNonce(8), got, nil); err != ErrAuthentication {
+		t.Errorf("Open under the wrong message number returned %v, want ErrAuthentication", err)
+	}
+	if other := NewAEADSubkey([]byte("another master key")).Seal(nil, SubkeyNonce(7), pt, nil); bytes.Equal(other, got) {
+		t.Errorf("two master keys gave the same ciphertext")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Seal with a 16-byte nonce did not panic")
+		}
+	}()
+	a.Seal(nil, make([]byte, NonceSize), pt, nil)
+}
@@ -0,0 +1,143 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// A tamperCase is a sealed message changed in some way
+// that Open must reject.
+type tamperCase struct {
+	name         string
+	nonce, c, ad []byte
+}
+
+// tamperCases generates adversarial variants of the message
+// sealed with nonce, p, and ad.
+func tamperCases(a interface {
+	Seal(dst, nonce, plaintext, ad []byte) []byte
+}, r *rand.Rand, nonce, p, ad []byte) []tamperCase {
+	c := a.Seal(nil, nonce, p, ad)
+	clone := func(b []byte) []byte { return append([]byte(nil), b...) }
+	var cases []tamperCase
+	add := func(name string, nonce, c, ad []byte) {
+		cases = append(cases, tamperCase{name, nonce, c, ad})
+	}
+	flip := func(b []byte, bit int) []byte {
+		b = clone(b)
+		b[bit/8] ^= 1 << uint(bit%8)
+		return b
+	}
+
+	// every bit of the tag, and a sample of ciphertext bits
+	for bit := 0; bit < TagSize*8; bit++ {
+		add(fmt.Sprintf("tag bit %d", bit), nonce, flip(c, len(p)*8+bit), ad)
+	}
+	for i := 0; i < 16 && len(p) > 0; i++ {
+		bit := r.Intn(len(p) * 8)
+		add(fmt.Sprintf("ciphertext bit %d", bit), nonce, flip(c, bit), ad)
+	}
+	if len(p) > 0 {
+		add("first ciphertext bit", nonce, flip(c, 0), ad)
+		add("last ciphertext bit", nonce, flip(c, len(p)*8-1), ad)
+	}
+
+	// additional data changed, dropped, truncated, or extended
+	for i := 0; i < 8 && len(ad) > 0; i++ {
+		bit := r.Intn(len(ad) * 8)
+		add(fmt.Sprintf("ad bit %d", bit), nonce, c, flip(ad, bit))
+	}
+	if len(ad) > 0 {
+		add("ad dropped", nonce, c, nil)
+		add("ad truncated", nonce, c, ad[:len(ad)-1])
+	}
+	add("ad extended", nonce, c, append(clone(ad), 0))
+
+	// wrong nonce: one bit off, or another message's
+	for _, bit := range []int{0, 63, 64, 127} {
+		add(fmt.Sprintf("nonce bit %d", bit), flip(nonce, bit), c, ad)
+	}
+	other := make([]byte, NonceSize)
+	r.Read(other)
+	add("swapped nonce", other, c, ad)
+
+	// ciphertext and additional data swapped, when that is possible
+	if len(p) > 0 || len(ad) > 0 {
+		add("ciphertext and ad swapped", nonce, append(clone(ad), c[len(p):]...), p)
+	}
+
+	// truncated to every length, and extended
+	for n := 0; n < len(c); n++ {
+		add(fmt.Sprintf("truncated to %d bytes", n), nonce, c[:n], ad)
+	}
+	add("extended by a zero byte", nonce, append(clone(c), 0), ad)
+	add("extended by a copy of the tag", nonce, append(clone(c), c[len(p):]...), ad)
+	if len(p) > 0 {
+		add("tag moved forward", nonce, append(clone(c[:len(p)-1]), c[len(p)-1:]...)[1:], ad)
+	}
+	return cases
+}
+
+func TestTamper(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	key := make([]byte, KeySize)
+	r.Read(key)
+	for name, a := range contractAEADs(key) {
+		for _, size := range [][2]int{{0, 0}, {1, 0}, {0, 1}, {3, 5}, {16, 16}, {37, 0}, {100, 13}} {
+			nonce := make([]byte, NonceSize)
+			p := make([]byte, size[0])
+			ad := make([]byte, size[1])
+			r.Read(nonce)
+			r.Read(p)
+			r.Read(ad)
+			for _, tc := range tamperCases(a, r, nonce, p, ad) {
+				// dst is marked so that both a change to it and
+				// plaintext left in its spare capacity show up
+				n := len(tc.c)
+				dst := bytes.Repeat([]byte{0xAA}, 2+n)[:2]
+				out, err := a.Open(dst, tc.nonce, tc.c, tc.ad)
+				if err != ErrAuthentication {
+					t.Errorf("%s: len=%d adlen=%d, %s: Open returned %x, %v; want ErrAuthentication", name, len(p), len(ad), tc.name, out, err)
+					continue
+				}
+				if len(out) != 2 || &out[0] != &dst[0] || out[0] != 0xAA || out[1] != 0xAA {
+					t.Errorf("%s: len=%d adlen=%d, %s: Open returned dst %x, want it unchanged", name, len(p), len(ad), tc.name, out)
+				}
+				spare := dst[2:cap(dst)]
+				if len(p) > 1 && bytes.Contains(spare, p) {
+					t.Errorf("%s: len=%d adlen=%d, %s: plaintext left in dst", name, len(p), len(ad), tc.name)
+				}
+			}
+		}
+	}
+}
+
+func TestTamperBatch(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	key := make([]byte, KeySize)
+	r.Read(key)
+	a := NewAEAD(key).(Batch)
+	nonce := make([]byte, NonceSize)
+	p := make([]byte, 40)
+	ad := make([]byte, 7)
+	r.Read(nonce)
+	r.Read(p)
+	r.Read(ad)
+	cases := tamperCases(a, r, nonce, p, ad)
+	dst := make([][]byte, len(cases))
+	nonces := make([][]byte, len(cases))
+	cs := make([][]byte, len(cases))
+	ads := make([][]byte, len(cases))
+	for i, tc := range cases {
+		nonces[i], cs[i], ads[i] = tc.nonce, tc.c, tc.ad
+	}
+	for i, err := range a.OpenBatch(dst, nonces, cs, ads, false) {
+		if err != ErrAuthentication || len(dst[i]) != 0 {
+			t.Errorf("%s: OpenBatch returned %x, %v; want ErrAuthentication", cases[i].name, dst[i], err)
+		}
+	}
+}
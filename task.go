@@ -0,0 +1,209 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import "crypto/subtle"
+
+// A Task is a SealDetached or OpenDetached broken into steps, for
+// cooperative schedulers and interrupt-driven firmware that need to
+// bound how long a single call can take. Each call to Step does at most
+// a given amount of work and returns, leaving the rest for later calls.
+//
+// Work is counted in units of eight state updates, the cost of one byte
+// of additional data or text. Besides one unit per byte, initialization
+// costs 224 units, each of the two paddings 32, and finalization 96, so
+// that a message with n bytes of text and a bytes of additional data
+// takes n+a+384 units in all. Remaining reports how many are left.
+//
+// A Task holds the key and cipher state until it is done, when it wipes
+// them. Like a Fixed, it never allocates, so a Task can be declared as a
+// package variable and reused; it must be started by SealTask or OpenTask
+// before each use.
+type Task struct {
+	key      [4]uint32
+	s        state
+	nonce    []byte
+	ad       []byte
+	in, out  []byte
+	tag      []byte
+	expected [TagSize]byte
+	open     bool
+	phase    int
+	pos      int // units done in the current phase
+	err      error
+}
+
+// The phases of a Task, in order.
+const (
+	taskInit = iota
+	taskAD
+	taskPadAD
+	taskText
+	taskPadText
+	taskFinal
+	taskDone
+)
+
+// SealTask starts a SealDetached of plaintext into t, with the same
+// arguments and errors, which runs as t.Step is called. The caller must
+// not touch out or tag, nor change the other arguments, until t is done.
+func (f *Fixed) SealTask(t *Task, out, tag, nonce, plaintext, additionalData []byte) error {
+	if err := checkFixed(out, tag, nonce, len(plaintext)); err != nil {
+		return err
+	}
+	*t = Task{key: f.key, nonce: nonce, ad: additionalData,
+		in: plaintext, out: out[:len(plaintext)], tag: tag}
+	return nil
+}
+
+// OpenTask starts an OpenDetached of ciphertext into t, with the same
+// arguments and errors, which runs as t.Step is called. The caller must
+// not use out, nor change the other arguments, until t is done; Step
+// then returns ErrAuthentication if the ciphertext was not authentic.
+func (f *Fixed) OpenTask(t *Task, out, nonce, ciphertext, tag, additionalData []byte) error {
+	if err := checkFixed(out, tag, nonce, len(ciphertext)); err != nil {
+		return err
+	}
+	*t = Task{key: f.key, nonce: nonce, ad: additionalData,
+		in: ciphertext, out: out[:len(ciphertext)], tag: tag, open: true}
+	return nil
+}
+
+// Remaining returns the number of units of work left in t.
+func (t *Task) Remaining() int {
+	if t.phase == taskDone {
+		return 0
+	}
+	n := -t.pos
+	for p := t.phase; p < taskDone; p++ {
+		n += t.phaseLen(p)
+	}
+	return n
+}
+
+// Step does up to budget units of work on t, and reports whether t is
+// done. Once it is, Step returns the task's error, which is nil for a
+// seal; later calls do nothing and return the same result. A budget
+// of 4 or more lets Step work a word at a time, which is faster.
+func (t *Task) Step(budget int) (done bool, err error) {
+	for budget > 0 && t.phase < taskDone {
+		n := 1
+		if budget >= 4 && t.phaseLen(t.phase)-t.pos >= 4 {
+			n = 4
+		}
+		var m, ca, cb uint32
+		for j := n - 1; j >= 0; j-- {
+			mj, caj, cbj := t.unit(t.pos + j)
+			m, ca, cb = m<<8|mj, ca<<8|caj, cb<<8|cbj
+		}
+		var ks uint32
+		if n == 4 {
+			ks = t.s.update32(m, ca, cb)
+		} else {
+			ks = t.s.update8(m, ca, cb)
+		}
+		t.emit(n, m, ks)
+		t.pos += n
+		budget -= n
+		t.advance()
+	}
+	return t.phase == taskDone, t.err
+}
+
+// advance moves past finished phases, and finishes t after the last.
+func (t *Task) advance() {
+	for t.phase < taskDone && t.pos == t.phaseLen(t.phase) {
+		t.phase++
+		t.pos = 0
+		if t.phase == taskDone {
+			t.finish()
+		}
+	}
+}
+
+func (t *Task) phaseLen(p int) int {
+	switch p {
+	case taskInit:
+		return 1792 / 8
+	case taskAD:
+		return len(t.ad)
+	case taskPadAD, taskPadText:
+		return 256 / 8
+	case taskText:
+		return len(t.in)
+	case taskFinal:
+		return (640 + 128) / 8
+	}
+	return 0
+}
+
+// unit returns the message byte and control bytes for unit i
+// of the current phase.
+func (t *Task) unit(i int) (m, ca, cb uint32) {
+	switch t.phase {
+	case taskInit:
+		// key, nonce, then the key repeated, with a 1 bit after the nonce
+		if i >= 16 && i < 32 {
+			m = uint32(t.nonce[i-16])
+		} else {
+			m = t.key[i/4%4] >> (uint(i%4) * 8) & 0xFF
+		}
+		if i == 32 {
+			m ^= 0x01
+		}
+		return m, 0xFF, 0xFF
+	case taskAD:
+		return uint32(t.ad[i]), 0xFF, 0xFF
+	case taskPadAD, taskPadText:
+		if i == 0 {
+			m = 0x01
+		}
+		if i < 128/8 {
+			ca = 0xFF
+		}
+		if t.phase == taskPadAD {
+			cb = 0xFF
+		}
+		return m, ca, cb
+	case taskText:
+		if t.open {
+			cb = 0xFF
+		}
+		return uint32(t.in[i]), 0xFF, cb
+	}
+	return 0, 0xFF, 0xFF // taskFinal
+}
+
+// emit stores the n bytes of keystream ks made from message m.
+func (t *Task) emit(n int, m, ks uint32) {
+	switch t.phase {
+	case taskText:
+		x := m ^ ks
+		for j := 0; j < n; j++ {
+			t.out[t.pos+j] = uint8(x >> (uint(j) * 8))
+		}
+	case taskFinal:
+		for j := 0; j < n; j++ {
+			if i := t.pos + j - 640/8; i >= 0 {
+				t.expected[i] = uint8(ks >> (uint(j) * 8))
+			}
+		}
+	}
+}
+
+// finish checks or writes the tag and wipes t.
+func (t *Task) finish() {
+	if !t.open {
+		copy(t.tag, t.expected[:])
+	} else if subtle.ConstantTimeCompare(t.tag, t.expected[:]) == 0 {
+		for i := range t.out {
+			t.out[i] = 0
+		}
+		reportFailure(&t.key, len(t.in)+TagSize, len(t.ad))
+		t.err = ErrAuthentication
+	}
+	t.s.reset()
+	t.key = [4]uint32{}
+	t.expected = [TagSize]byte{}
+	t.nonce, t.ad, t.in, t.out, t.tag = nil, nil, nil, nil, nil
+}
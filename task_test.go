@@ -0,0 +1,102 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTask(t *testing.T) {
+	f, _ := NewFixed(countUp(KeySize))
+	nonce := countUp(NonceSize)
+	var scratch Scratch
+	for _, n := range []int{0, 1, 7, 64} {
+		msg, ad := countUp(n), countUp(n/2+1)
+		want := make([]byte, n)
+		wantTag := make([]byte, TagSize)
+		f.SealDetached(want, wantTag, nonce, msg, ad, &scratch)
+
+		for _, budget := range []int{1, 3, 4, 5, 1000} {
+			var task Task
+			out, tag := make([]byte, n), make([]byte, TagSize)
+			if err := f.SealTask(&task, out, tag, nonce, msg, ad); err != nil {
+				t.Fatal(err)
+			}
+			total := task.Remaining()
+			if total != n+len(ad)+384 {
+				t.Errorf("Remaining() = %d, want %d", total, n+len(ad)+384)
+			}
+			steps := 0
+			for {
+				before := task.Remaining()
+				done, err := task.Step(budget)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if used := before - task.Remaining(); used > budget || used <= 0 {
+					t.Fatalf("Step(%d) did %d units", budget, used)
+				}
+				steps++
+				if done {
+					break
+				}
+			}
+			if wantSteps := (total + budget - 1) / budget; budget < 4 && steps != wantSteps {
+				t.Errorf("len %d, budget %d: took %d steps, want %d", n, budget, steps, wantSteps)
+			}
+			if !bytes.Equal(out, want) || !bytes.Equal(tag, wantTag) {
+				t.Errorf("len %d, budget %d: sealed %x %x, want %x %x", n, budget, out, tag, want, wantTag)
+			}
+			if task.s != (state{}) || task.key != ([4]uint32{}) {
+				t.Errorf("task not wiped")
+			}
+
+			// open in place
+			if err := f.OpenTask(&task, out, nonce, out, tag, ad); err != nil {
+				t.Fatal(err)
+			}
+			for done := false; !done; {
+				done, _ = task.Step(budget)
+			}
+			if _, err := task.Step(budget); err != nil || !bytes.Equal(out, msg) {
+				t.Errorf("len %d, budget %d: opened %x, %v", n, budget, out, err)
+			}
+		}
+	}
+
+	msg := []byte("interrupted")
+	out, tag := make([]byte, len(msg)), make([]byte, TagSize)
+	f.SealDetached(out, tag, nonce, msg, nil, &scratch)
+	tag[3] ^= 1
+	var task Task
+	f.OpenTask(&task, out, nonce, out, tag, nil)
+	for done := false; !done; {
+		var err error
+		if done, err = task.Step(10); done && err != ErrAuthentication {
+			t.Errorf("Step with a bad tag returned %v", err)
+		}
+	}
+	if !bytes.Equal(out, make([]byte, len(out))) {
+		t.Errorf("output not zeroed after failure: %x", out)
+	}
+	if err := f.SealTask(&task, out[:1], tag, nonce, msg, nil); err == nil {
+		t.Errorf("SealTask accepted a short output buffer")
+	}
+}
+
+func TestTaskAllocs(t *testing.T) {
+	f, _ := NewFixed(countUp(KeySize))
+	nonce, msg := countUp(NonceSize), countUp(100)
+	out, tag := make([]byte, len(msg)), make([]byte, TagSize)
+	var task Task
+	n := testing.AllocsPerRun(10, func() {
+		f.SealTask(&task, out, tag, nonce, msg, nil)
+		for done := false; !done; {
+			done, _ = task.Step(16)
+		}
+	})
+	if n != 0 {
+		t.Errorf("allocated %v times per task, want 0", n)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+)
+
+// ErrFault is the panic value of a Seal wrapped by VerifyAfterSeal
+// whose output did not open to the plaintext.
+var ErrFault = errors.New("acorn: fault detected: sealed message does not open")
+
+type verifyAEAD struct {
+	cipher.AEAD
+}
+
+// VerifyAfterSeal returns an AEAD whose Seal opens each message it seals
+// with a before returning it, as a countermeasure against fault injection
+// and memory corruption. If the message does not open, or opens to
+// something other than the plaintext, Seal wipes its output and panics
+// with ErrFault, rather than return a ciphertext or tag computed from a
+// corrupted state, which may leak the key.
+//
+// This roughly doubles the cost of Seal. Open is unchanged, and the
+// returned AEAD does not implement Batch.
+func VerifyAfterSeal(a cipher.AEAD) cipher.AEAD {
+	return &verifyAEAD{a}
+}
+
+func (a *verifyAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	orig := plaintext
+	if len(plaintext) > 0 && cap(dst) > len(dst) && &dst[:len(dst)+1][len(dst)] == &plaintext[0] {
+		// sealing in place overwrites the plaintext
+		orig = append([]byte(nil), plaintext...)
+	}
+	ret := a.AEAD.Seal(dst, nonce, plaintext, additionalData)
+	out := ret[len(dst):]
+	check, err := a.AEAD.Open(nil, nonce, out, additionalData)
+	ok := err == nil && len(check) == len(orig) && subtle.ConstantTimeCompare(check, orig) == 1
+	for i := range check {
+		check[i] = 0
+	}
+	if !ok {
+		for i := range out {
+			out[i] = 0
+		}
+		panic(ErrFault)
+	}
+	return ret
+}
@@ -0,0 +1,56 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+package acorn
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"testing"
+)
+
+// faultyAEAD flips a bit of the ciphertext,
+// as a glitch during encryption might.
+type faultyAEAD struct {
+	cipher.AEAD
+}
+
+func (a faultyAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	ret := a.AEAD.Seal(dst, nonce, plaintext, additionalData)
+	ret[len(dst)] ^= 1
+	return ret
+}
+
+func TestVerifyAfterSeal(t *testing.T) {
+	key, nonce := countUp(KeySize), countUp(NonceSize)
+	plain := NewAEAD(key)
+	a := VerifyAfterSeal(plain)
+	pt := []byte("safety critical")
+
+	want := plain.Seal(nil, nonce, pt, []byte("ad"))
+	if got := a.Seal([]byte("x"), nonce, pt, []byte("ad")); !bytes.Equal(got, append([]byte("x"), want...)) {
+		t.Errorf("Seal = %x, want x%x", got, want)
+	}
+	// in place
+	buf := make([]byte, len(pt), len(pt)+TagSize)
+	copy(buf, pt)
+	if got := a.Seal(buf[:0], nonce, buf, []byte("ad")); !bytes.Equal(got, want) {
+		t.Errorf("Seal in place = %x, want %x", got, want)
+	}
+	if got, err := a.Open(nil, nonce, want, []byte("ad")); err != nil || !bytes.Equal(got, pt) {
+		t.Errorf("Open = %q, %v", got, err)
+	}
+
+	faulty := VerifyAfterSeal(faultyAEAD{plain})
+	dst := make([]byte, 0, 64)
+	func() {
+		defer func() {
+			if r := recover(); r != ErrFault {
+				t.Errorf("Seal with a fault panicked with %v, want ErrFault", r)
+			}
+		}()
+		faulty.Seal(dst, nonce, pt, []byte("ad"))
+	}()
+	if out := dst[:len(pt)+TagSize]; !bytes.Equal(out, make([]byte, len(out))) {
+		t.Errorf("the faulty output was not wiped: %x", out)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright © 2019 Andrew Ekstedt. See LICENSE for details.
+
+//go:build !acorn_small
+// +build !acorn_small
+
+package acorn
+
+func (s *state) update32(m, ca, cb uint32) uint32 {
+	// same as update8, but with 32-bit shifts and masks instead of 8 bits.
+	// this is about as far as you can go before the feedback starts to compound.
+
+	s244 := uint32(s.s230 >> 14)
+	s235 := uint32(s.s230 >> 5)
+	s196 := uint32(s.s193 >> 3)
+	s160 := uint32(s.s154 >> 6)
+	s111 := uint32(s.s107 >> 4)
+	s66 := uint32(s.s61 >> 5)
+	s23 := uint32(s.s0 >> 23)
+	s12 := uint32(s.s0 >> 12)
+	s0 := uint32(s.s0)
+
+	// feedback the 6 LFSRs
+
+	x289 := (s235 ^ uint32(s.s230))
+
+	s230 := (uint32(s.s230) ^ s196 ^ uint32(s.s193))
+	s193 := (uint32(s.s193) ^ s160 ^ uint32(s.s154))
+	s154 := (uint32(s.s154) ^ s111 ^ uint32(s.s107))
+	s107 := (uint32(s.s107) ^ s66 ^ uint32(s.s61))
+	s61 := (uint32(s.s61) ^ s23 ^ s0)
+
+	// calculate keystream and feedback bit
+
+	ks := (s12 ^ s154 ^ maj(s235, s61, s193) ^ ch(s230, s111, s66))
+	f := (s0 ^ ^s107 ^ maj(s244, s23, s160) ^ (ca & s196) ^ (cb & ks))
+
+	s293 := f ^ m
+
+	// update the state
+	s.s230 = s.s230>>32 ^ uint64(x289)<<(289-230-32) ^ uint64(s293)<<(293-230-32)
+	s.s193 = s.s193>>32 ^ uint64(s230)<<(230-193-32)
+	s.s154 = s.s154>>32 ^ uint64(s193)<<(193-154-32)
+	s.s107 = s.s107>>32 ^ uint64(s154)<<(154-107-32)
+	s.s61 = s.s61>>32 ^ uint64(s107)<<(107-61-32)
+	s.s0 = s.s0>>32 ^ uint64(s61)<<(61-32)
+
+	return ks
+}